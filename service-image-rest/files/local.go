@@ -4,6 +4,7 @@ import (
 	"io"
 	"os"
 	"path/filepath"
+	"sort"
 
 	"golang.org/x/xerrors"
 )
@@ -92,6 +93,54 @@ func (l *Local) Get(path string) (*os.File, error) {
 	return f, nil
 }
 
+// List returns the files in the directory at the given path ordered by name,
+// the list is empty when the directory does not exist
+func (l *Local) List(path string) ([]FileInfo, error) {
+	entries, err := os.ReadDir(l.fullPath(path))
+
+	if os.IsNotExist(err) {
+		return []FileInfo{}, nil
+	}
+
+	if err != nil {
+		return nil, xerrors.Errorf("Unable to read directory: %w", err)
+	}
+
+	fl := []FileInfo{}
+
+	for _, e := range entries {
+		if e.IsDir() {
+			continue
+		}
+
+		fi, err := e.Info()
+
+		if err != nil {
+			return nil, xerrors.Errorf("Unable to get file info: %w", err)
+		}
+
+		fl = append(fl, FileInfo{Name: fi.Name(), Size: fi.Size(), ModTime: fi.ModTime()})
+	}
+
+	sort.Slice(fl, func(i, j int) bool {
+		return fl[i].Name < fl[j].Name
+	})
+
+	return fl, nil
+}
+
+// Delete removes the file or the directory with its files at the given path,
+// removing a missing path is not an error
+func (l *Local) Delete(path string) error {
+	err := os.RemoveAll(l.fullPath(path))
+
+	if err != nil {
+		return xerrors.Errorf("Unable to delete path: %w", err)
+	}
+
+	return nil
+}
+
 // returns the absolute path
 func (l *Local) fullPath(path string) string {
 	return filepath.Join(l.basePath, path)
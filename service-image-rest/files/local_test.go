@@ -66,3 +66,48 @@ func TestGetsContentsAndWritesToWriter(t *testing.T) {
 	d, err := ioutil.ReadAll(r)
 	assert.Equal(t, fileContents, string(d))
 }
+
+func TestListsFilesOfDirectory(t *testing.T) {
+	l, _, cleanup := setupLocal(t)
+	defer cleanup()
+
+	for _, p := range []string{"/1/front.png", "/1/back.png", "/2/test.png"} {
+		err := l.Save(p, bytes.NewBuffer([]byte("Hello World")))
+		assert.NoError(t, err)
+	}
+
+	fl, err := l.List("/1")
+	assert.NoError(t, err)
+	assert.Len(t, fl, 2)
+	assert.Equal(t, "back.png", fl[0].Name)
+	assert.Equal(t, int64(11), fl[0].Size)
+	assert.Equal(t, "front.png", fl[1].Name)
+
+	// a missing directory has no files
+	fl, err = l.List("/3")
+	assert.NoError(t, err)
+	assert.Empty(t, fl)
+}
+
+func TestDeletesDirectory(t *testing.T) {
+	l, _, cleanup := setupLocal(t)
+	defer cleanup()
+
+	for _, p := range []string{"/1/front.png", "/1/back.png", "/2/test.png"} {
+		err := l.Save(p, bytes.NewBuffer([]byte("Hello World")))
+		assert.NoError(t, err)
+	}
+
+	assert.NoError(t, l.Delete("/1"))
+
+	fl, err := l.List("/1")
+	assert.NoError(t, err)
+	assert.Empty(t, fl)
+
+	fl, err = l.List("/2")
+	assert.NoError(t, err)
+	assert.Len(t, fl, 1)
+
+	// a missing directory is already deleted
+	assert.NoError(t, l.Delete("/3"))
+}
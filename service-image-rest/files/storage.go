@@ -1,7 +1,19 @@
 package files
 
-import "io"
+import (
+	"io"
+	"time"
+)
 
 type Storage interface {
 	Save(path string, file io.Reader) error
+	List(path string) ([]FileInfo, error)
+	Delete(path string) error
+}
+
+// FileInfo describes a stored file
+type FileInfo struct {
+	Name    string
+	Size    int64
+	ModTime time.Time
 }
@@ -1,10 +1,12 @@
 package handlers
 
 import (
+	"encoding/json"
 	"io"
 	"net/http"
 	"path/filepath"
 	"strconv"
+	"time"
 
 	"github.com/CharlesSchiavinato/go-microservices/service-image-rest/files"
 	"github.com/gorilla/mux"
@@ -35,6 +37,58 @@ func (f *Files) UploadREST(rw http.ResponseWriter, r *http.Request) {
 	f.saveFile(id, fn, rw, r.Body)
 }
 
+// Image is a file stored for a product
+type Image struct {
+	Filename   string    `json:"filename"`
+	Size       int64     `json:"size"`
+	ModifiedOn time.Time `json:"modified_on"`
+}
+
+// ListREST returns the images of the product with the id of the path ordered by filename
+func (f *Files) ListREST(rw http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+
+	f.log.Info("Handle GET list", "id", id)
+
+	fl, err := f.store.List(id)
+
+	if err != nil {
+		f.log.Error("Unable to list files", "error", err)
+		http.Error(rw, "Unable to list files", http.StatusInternalServerError)
+		return
+	}
+
+	il := make([]Image, 0, len(fl))
+	for _, fi := range fl {
+		il = append(il, Image{fi.Name, fi.Size, fi.ModTime.UTC()})
+	}
+
+	rw.Header().Set("Content-Type", "application/json")
+
+	err = json.NewEncoder(rw).Encode(il)
+
+	if err != nil {
+		f.log.Error("Unable to write list", "error", err)
+	}
+}
+
+// DeleteREST removes the images of the product with the id of the path
+func (f *Files) DeleteREST(rw http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+
+	f.log.Info("Handle DELETE", "id", id)
+
+	err := f.store.Delete(id)
+
+	if err != nil {
+		f.log.Error("Unable to delete files", "error", err)
+		http.Error(rw, "Unable to delete files", http.StatusInternalServerError)
+		return
+	}
+
+	rw.WriteHeader(http.StatusNoContent)
+}
+
 // UploadMultipar something
 func (f *Files) UploadMultipart(rw http.ResponseWriter, r *http.Request) {
 	err := r.ParseMultipartForm(128 * 1024)
@@ -54,14 +54,19 @@ func main() {
 	ph.HandleFunc("/images/{id:[0-9]+}/{filename:[a-zA-Z]+\\.[a-z]{3}}", fh.UploadREST)
 	ph.HandleFunc("/", fh.UploadMultipart)
 
-	// get files
-	gh := sm.Methods(http.MethodGet).Subrouter()
+	// get files, HEAD checks a file exists
+	gh := sm.Methods(http.MethodGet, http.MethodHead).Subrouter()
+	gh.HandleFunc("/images/{id:[0-9]+}", fh.ListREST)
 	gh.Handle(
 		"/images/{id:[0-9]+}/{filename:[a-zA-Z]+\\.[a-z]{3}}",
 		http.StripPrefix("/images/", http.FileServer(http.Dir(basePath))),
 	)
 	gh.Use(mw.GzipMiddleware)
 
+	// delete the files of a product
+	dh := sm.Methods(http.MethodDelete).Subrouter()
+	dh.HandleFunc("/images/{id:[0-9]+}", fh.DeleteREST)
+
 	// create a new server
 	s := http.Server{
 		Addr:         bindAddress,       // configure the bind address
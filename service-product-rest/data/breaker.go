@@ -0,0 +1,79 @@
+package data
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+var ErrCircuitOpen = fmt.Errorf("Circuit breaker is open")
+
+type breakerState int
+
+const (
+	breakerClosed breakerState = iota
+	breakerOpen
+	breakerHalfOpen
+)
+
+// CircuitBreaker stops calling a failing dependency after a number of
+// consecutive failures, a single trial call is allowed after the open timeout
+type CircuitBreaker struct {
+	mu          sync.Mutex
+	state       breakerState
+	failures    int
+	threshold   int
+	openTimeout time.Duration
+	openedAt    time.Time
+}
+
+// NewCircuitBreaker creates a breaker which opens after threshold consecutive
+// failures and stays open during openTimeout
+func NewCircuitBreaker(threshold int, openTimeout time.Duration) *CircuitBreaker {
+	return &CircuitBreaker{threshold: threshold, openTimeout: openTimeout}
+}
+
+// Allow returns ErrCircuitOpen when the call must not be done
+func (b *CircuitBreaker) Allow() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case breakerOpen:
+		if time.Since(b.openedAt) < b.openTimeout {
+			return ErrCircuitOpen
+		}
+
+		b.state = breakerHalfOpen
+
+		return nil
+	case breakerHalfOpen:
+		// the trial call is in progress
+		return ErrCircuitOpen
+	}
+
+	return nil
+}
+
+// Success records a successful call and closes the breaker
+func (b *CircuitBreaker) Success() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.state = breakerClosed
+	b.failures = 0
+}
+
+// Failure records a failed call, opening the breaker when the threshold
+// is reached or the trial call failed
+func (b *CircuitBreaker) Failure() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.failures++
+
+	if b.state == breakerHalfOpen || b.failures >= b.threshold {
+		b.state = breakerOpen
+		b.openedAt = time.Now()
+	}
+}
@@ -0,0 +1,286 @@
+package data
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/go-playground/validator/v10"
+)
+
+var ErrCategoryNotFound = fmt.Errorf("Category not found")
+var ErrParentCategoryNotFound = fmt.Errorf("Parent category not found")
+var ErrCategoryCycle = fmt.Errorf("Category can not be moved under itself or its subcategories")
+var ErrDuplicateCategory = fmt.Errorf("Category name is used by another category with the same parent")
+var ErrCategoryHasChildren = fmt.Errorf("Category has subcategories")
+var ErrCategoryInUse = fmt.Errorf("Category is used by products")
+
+// Category groups the products in a tree, a product belongs to a category
+// and to all the ancestors of that category
+// swagger:model
+type Category struct {
+	// the id of the category
+	//
+	// required: true
+	// min: 1
+	ID int `json:"id"`
+	// the name of the category, unique among the categories with the same parent
+	Name string `json:"name" validate:"required,min=2,max=50"`
+	// the id of the parent category, absent on the root categories
+	ParentID  int       `json:"parent_id,omitempty"`
+	CreatedOn time.Time `json:"-"`
+	UpdatedOn time.Time `json:"-"`
+}
+
+// CategoryNode is a category with its subcategories
+// swagger:model
+type CategoryNode struct {
+	Category
+	// the subcategories, ordered by id
+	Children []*CategoryNode `json:"children,omitempty"`
+}
+
+// A list of categories
+// swagger:response categoriesResponse
+type categoriesResponseWrapper struct {
+	// in: body
+	Body []Category
+}
+
+// A category
+// swagger:response categoryResponse
+type categoryResponseWrapper struct {
+	// in: body
+	Body Category
+}
+
+// The categories as a tree, from the root categories
+// swagger:response categoryTreeResponse
+type categoryTreeResponseWrapper struct {
+	// in: body
+	Body []CategoryNode
+}
+
+// swagger:parameters GetCategory UpdateCategory DeleteCategory
+type categoryIDParameterWrapper struct {
+	// The id of the category
+	// in: path
+	// required: true
+	ID int `json:"id"`
+}
+
+// swagger:parameters CreateCategory UpdateCategory
+type categoryParameterWrapper struct {
+	// in: body
+	// required: true
+	Body Category
+}
+
+// categoryList keeps the categories ordered by id, it is guarded by productLock
+// so the products can be checked against the categories atomically
+var categoryList = []*Category{}
+
+// categorySeq is the id of the last added category, the ids of the removed categories are not
+// reused since deleted products may still reference them. It is guarded by productLock
+var categorySeq int
+
+// Validate checks the fields of the category
+func (c *Category) Validate() error {
+	c.Name = strings.TrimSpace(c.Name)
+
+	validate := validator.New()
+
+	// report the fields by their json name
+	validate.RegisterTagNameFunc(func(f reflect.StructField) string {
+		return strings.SplitN(f.Tag.Get("json"), ",", 2)[0]
+	})
+
+	return validate.Struct(c)
+}
+
+// CategoryList returns the categories ordered by id
+func (p *ProductDB) CategoryList() []Category {
+	productLock.RLock()
+	defer productLock.RUnlock()
+
+	cl := make([]Category, 0, len(categoryList))
+	for _, c := range categoryList {
+		cl = append(cl, *c)
+	}
+
+	return cl
+}
+
+// CategoryTree returns the root categories with their subcategories
+func (p *ProductDB) CategoryTree() []*CategoryNode {
+	productLock.RLock()
+	defer productLock.RUnlock()
+
+	nodes := map[int]*CategoryNode{}
+	for _, c := range categoryList {
+		nodes[c.ID] = &CategoryNode{Category: *c}
+	}
+
+	// the list is ordered by id, so are the children
+	roots := []*CategoryNode{}
+	for _, c := range categoryList {
+		if c.ParentID == 0 {
+			roots = append(roots, nodes[c.ID])
+			continue
+		}
+
+		parent := nodes[c.ParentID]
+		parent.Children = append(parent.Children, nodes[c.ID])
+	}
+
+	return roots
+}
+
+// CategoryGet returns the category with the given id
+func (p *ProductDB) CategoryGet(id int) (*Category, error) {
+	productLock.RLock()
+	defer productLock.RUnlock()
+
+	i := categoryIndexByID(id)
+
+	if i < 0 {
+		return nil, ErrCategoryNotFound
+	}
+
+	c := *categoryList[i]
+
+	return &c, nil
+}
+
+// CategoryAdd adds a new category under the parent category, at the root when it has no parent
+func (p *ProductDB) CategoryAdd(c *Category) error {
+	productLock.Lock()
+	defer productLock.Unlock()
+
+	if err := checkCategoryParent(c); err != nil {
+		return err
+	}
+
+	categorySeq++
+	c.ID = categorySeq
+	c.CreatedOn = time.Now().UTC()
+	c.UpdatedOn = c.CreatedOn
+
+	categoryList = append(categoryList, c)
+
+	return nil
+}
+
+// CategoryUpdate renames the category with the given id or moves it under
+// another parent, a category can not be moved into its own subtree
+func (p *ProductDB) CategoryUpdate(c *Category) error {
+	productLock.Lock()
+	defer productLock.Unlock()
+
+	i := categoryIndexByID(c.ID)
+
+	if i < 0 {
+		return ErrCategoryNotFound
+	}
+
+	if c.ParentID != 0 && categorySubtree(c.ID)[c.ParentID] {
+		return ErrCategoryCycle
+	}
+
+	if err := checkCategoryParent(c); err != nil {
+		return err
+	}
+
+	c.CreatedOn = categoryList[i].CreatedOn
+	c.UpdatedOn = time.Now().UTC()
+	categoryList[i] = c
+
+	return nil
+}
+
+// CategoryDelete removes the category with the given id, the categories
+// with subcategories or used by products which are not deleted can not be removed
+func (p *ProductDB) CategoryDelete(id int) error {
+	productLock.Lock()
+	defer productLock.Unlock()
+
+	i := categoryIndexByID(id)
+
+	if i < 0 {
+		return ErrCategoryNotFound
+	}
+
+	for _, c := range categoryList {
+		if c.ParentID == id {
+			return ErrCategoryHasChildren
+		}
+	}
+
+	for _, pr := range productList {
+		if pr.CategoryID == id && !pr.IsDeleted() {
+			return ErrCategoryInUse
+		}
+	}
+
+	categoryList = append(categoryList[:i:i], categoryList[i+1:]...)
+
+	return nil
+}
+
+// checkCategoryParent checks the parent exists and no sibling has the same name,
+// it must be called holding productLock
+func checkCategoryParent(c *Category) error {
+	if c.ParentID != 0 && categoryIndexByID(c.ParentID) < 0 {
+		return ErrParentCategoryNotFound
+	}
+
+	for _, s := range categoryList {
+		if s.ID != c.ID && s.ParentID == c.ParentID && strings.EqualFold(s.Name, c.Name) {
+			return ErrDuplicateCategory
+		}
+	}
+
+	return nil
+}
+
+// checkProductCategory checks the category of the product exists,
+// it must be called holding productLock
+func checkProductCategory(pr *Product) error {
+	if pr.CategoryID != 0 && categoryIndexByID(pr.CategoryID) < 0 {
+		return ErrCategoryNotFound
+	}
+
+	return nil
+}
+
+// categorySubtree returns the ids of the category and all its subcategories,
+// it must be called holding productLock
+func categorySubtree(id int) map[int]bool {
+	ids := map[int]bool{id: true}
+
+	// the children have greater ids than their parents only until a category
+	// is moved, so the list is walked until no category is added
+	for added := true; added; {
+		added = false
+
+		for _, c := range categoryList {
+			if !ids[c.ID] && ids[c.ParentID] {
+				ids[c.ID] = true
+				added = true
+			}
+		}
+	}
+
+	return ids
+}
+
+func categoryIndexByID(id int) int {
+	for i, c := range categoryList {
+		if c.ID == id {
+			return i
+		}
+	}
+
+	return -1
+}
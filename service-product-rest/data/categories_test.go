@@ -0,0 +1,113 @@
+package data
+
+import (
+	"testing"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCategoryTreeAndRules(t *testing.T) {
+	pdb := NewProductDB(hclog.NewNullLogger(), nil, nil)
+
+	drinks := &Category{Name: "Drinks"}
+	assert.NoError(t, pdb.CategoryAdd(drinks))
+
+	coffee := &Category{Name: "Coffee", ParentID: drinks.ID}
+	assert.NoError(t, pdb.CategoryAdd(coffee))
+
+	iced := &Category{Name: "Iced", ParentID: coffee.ID}
+	assert.NoError(t, pdb.CategoryAdd(iced))
+
+	assert.Equal(t, ErrParentCategoryNotFound, pdb.CategoryAdd(&Category{Name: "Tea", ParentID: 1000}))
+	assert.Equal(t, ErrDuplicateCategory, pdb.CategoryAdd(&Category{Name: "coffee", ParentID: drinks.ID}))
+
+	// a category can not be moved under its subcategories
+	assert.Equal(t, ErrCategoryCycle, pdb.CategoryUpdate(&Category{ID: drinks.ID, Name: "Drinks", ParentID: iced.ID}))
+	assert.Equal(t, ErrCategoryCycle, pdb.CategoryUpdate(&Category{ID: coffee.ID, Name: "Coffee", ParentID: coffee.ID}))
+
+	var tree *CategoryNode
+	for _, n := range pdb.CategoryTree() {
+		if n.ID == drinks.ID {
+			tree = n
+		}
+	}
+
+	assert.NotNil(t, tree)
+	assert.Len(t, tree.Children, 1)
+	assert.Equal(t, "Iced", tree.Children[0].Children[0].Name)
+
+	pr := &Product{Name: "Frappe", Price: Money{Amount: 350, Currency: "EUR"}, SKU: "cat-fra-ppe", CategoryID: iced.ID}
+	assert.NoError(t, pdb.ProductAdd(pr, "test"))
+
+	assert.Equal(t, ErrCategoryNotFound, pdb.ProductAdd(&Product{Name: "Chai", Price: Money{Amount: 300, Currency: "EUR"}, SKU: "cat-cha-iii", CategoryID: 1000}, "test"))
+	assert.Equal(t, ErrCategoryHasChildren, pdb.CategoryDelete(coffee.ID))
+	assert.Equal(t, ErrCategoryInUse, pdb.CategoryDelete(iced.ID))
+
+	// the deleted products do not keep their category
+	assert.NoError(t, pdb.ProductDelete(pr.ID, 0, "test"))
+	assert.NoError(t, pdb.CategoryDelete(iced.ID))
+
+	pg, err := pdb.ProductRestore(pr.ID, "test")
+	assert.NoError(t, err)
+	assert.Equal(t, 0, pg.CategoryID)
+
+	assert.NoError(t, pdb.ProductDelete(pr.ID, 0, "test"))
+	assert.Equal(t, 1, pdb.ProductPurge(0))
+	assert.NoError(t, pdb.CategoryDelete(coffee.ID))
+	assert.NoError(t, pdb.CategoryDelete(drinks.ID))
+	assert.Equal(t, ErrCategoryNotFound, pdb.CategoryDelete(drinks.ID))
+}
+
+func TestProductListByCategoryAndTags(t *testing.T) {
+	pdb := NewProductDB(hclog.NewNullLogger(), nil, nil)
+
+	food := &Category{Name: "Food"}
+	assert.NoError(t, pdb.CategoryAdd(food))
+
+	cakes := &Category{Name: "Cakes", ParentID: food.ID}
+	assert.NoError(t, pdb.CategoryAdd(cakes))
+
+	products := []*Product{
+		{Name: "Croissant", Price: Money{Amount: 150, Currency: "EUR"}, SKU: "fac-cro-one", CategoryID: food.ID, Tags: []string{"Vegan ", "pastry"}},
+		{Name: "Cheesecake", Price: Money{Amount: 400, Currency: "EUR"}, SKU: "fac-che-one", CategoryID: cakes.ID, Tags: []string{"pastry"}},
+		{Name: "Brownie", Price: Money{Amount: 300, Currency: "EUR"}, SKU: "fac-bro-one", CategoryID: cakes.ID, Tags: []string{"vegan", "chocolate", "vegan"}},
+	}
+
+	for _, pr := range products {
+		pr.Normalize()
+		assert.NoError(t, pr.Validate())
+		assert.NoError(t, pdb.ProductAdd(pr, "test"))
+	}
+
+	assert.Equal(t, []string{"pastry", "vegan"}, products[0].Tags)
+
+	q := &ProductQuery{Category: food.ID, Tags: []string{"VEGAN"}}
+	assert.NoError(t, q.Validate())
+
+	pg, err := pdb.ProductListFacets("", q)
+
+	assert.NoError(t, err)
+	assert.Equal(t, 2, pg.Total)
+	assert.Equal(t, "Croissant", pg.Products[0].Name)
+	assert.Equal(t, "Brownie", pg.Products[1].Name)
+	assert.Equal(t, []CategoryFacet{
+		{ID: food.ID, Name: "Food", Count: 2},
+		{ID: cakes.ID, Name: "Cakes", ParentID: food.ID, Count: 1},
+	}, pg.Facets.Categories)
+	assert.Equal(t, []TagFacet{{Tag: "vegan", Count: 2}, {Tag: "chocolate", Count: 1}, {Tag: "pastry", Count: 1}}, pg.Facets.Tags)
+
+	_, total, err := pdb.ProductList("", &ProductQuery{Category: cakes.ID})
+
+	assert.NoError(t, err)
+	assert.Equal(t, 2, total)
+
+	_, _, err = pdb.ProductList("", &ProductQuery{Category: 1000})
+	assert.Equal(t, ErrCategoryNotFound, err)
+
+	for _, pr := range products {
+		assert.NoError(t, pdb.ProductDelete(pr.ID, 0, "test"))
+	}
+
+	pdb.ProductPurge(0)
+}
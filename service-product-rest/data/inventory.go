@@ -0,0 +1,280 @@
+package data
+
+import (
+	"fmt"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/go-playground/validator/v10"
+)
+
+var ErrInvalidWarehouse = fmt.Errorf("Warehouse must have 1 to 32 lower case letters, digits or dashes")
+var ErrInvalidStockAdjustment = fmt.Errorf("Stock adjustment must change the quantity")
+var ErrInsufficientStock = fmt.Errorf("Insufficient stock")
+
+// warehousePattern is the format of the warehouse codes
+var warehousePattern = regexp.MustCompile(`^[a-z0-9-]{1,32}$`)
+
+// StockLevel is the quantity of a product in a warehouse
+// swagger:model
+type StockLevel struct {
+	// the code of the warehouse
+	Warehouse string `json:"warehouse"`
+	// the quantity in the warehouse, including the reserved units
+	OnHand int `json:"on_hand"`
+	// the quantity held by pending reservations
+	Reserved int `json:"reserved"`
+	// the quantity which can be reserved
+	Available int       `json:"available"`
+	UpdatedOn time.Time `json:"updated_on"`
+}
+
+// Stock is the quantity of a product in all the warehouses
+// swagger:model
+type Stock struct {
+	// the id of the product
+	ProductID int `json:"product_id"`
+	// the quantity in all the warehouses, including the reserved units
+	OnHand int `json:"on_hand"`
+	// the quantity held by pending reservations
+	Reserved int `json:"reserved"`
+	// the quantity which can be reserved
+	Available int `json:"available"`
+	// the stock of each warehouse, ordered by warehouse
+	Warehouses []StockLevel `json:"warehouses"`
+}
+
+// StockCount sets the quantity of a product in a warehouse, after a stocktake
+// swagger:model
+type StockCount struct {
+	// the counted quantity, it can not be lower than the reserved quantity
+	OnHand int `json:"on_hand" validate:"gte=0"`
+}
+
+// StockAdjustment changes the quantity of a product in a warehouse, positive
+// for the received units and negative for the damaged or lost ones
+// swagger:model
+type StockAdjustment struct {
+	// the change of the quantity, it can not be zero
+	Delta int `json:"delta" validate:"required"`
+	// why the quantity changed, like "restock" or "damaged"
+	Reason string `json:"reason,omitempty" validate:"max=200"`
+}
+
+// The stock of a product
+// swagger:response stockResponse
+type stockResponseWrapper struct {
+	// in: body
+	Body Stock
+}
+
+// swagger:parameters GetStock CountStock AdjustStock
+type stockProductIDParameterWrapper struct {
+	// The id of the product
+	// in: path
+	// required: true
+	ID int `json:"id"`
+}
+
+// swagger:parameters CountStock AdjustStock
+type stockWarehouseParameterWrapper struct {
+	// The code of the warehouse
+	// in: path
+	// required: true
+	Warehouse string `json:"warehouse"`
+}
+
+// swagger:parameters CountStock
+type stockCountParameterWrapper struct {
+	// in: body
+	// required: true
+	Body StockCount
+}
+
+// swagger:parameters AdjustStock
+type stockAdjustmentParameterWrapper struct {
+	// in: body
+	// required: true
+	Body StockAdjustment
+}
+
+// stockLevels keeps the stock of the products by warehouse, it is guarded by
+// productLock so the reservations check and hold the stock atomically
+var stockLevels = map[int]map[string]*StockLevel{}
+
+// NormalizeWarehouse returns the warehouse code in lower case without spaces
+func NormalizeWarehouse(w string) string {
+	return strings.ToLower(strings.TrimSpace(w))
+}
+
+// ValidWarehouse returns true when the normalized warehouse code has a valid format
+func ValidWarehouse(w string) bool {
+	return warehousePattern.MatchString(w)
+}
+
+// Validate checks the counted quantity
+func (c *StockCount) Validate() error {
+	return newInventoryValidator().Struct(c)
+}
+
+// Validate checks the stock adjustment
+func (a *StockAdjustment) Validate() error {
+	a.Reason = strings.TrimSpace(a.Reason)
+
+	return newInventoryValidator().Struct(a)
+}
+
+// newInventoryValidator creates a validator reporting the fields by their json name
+func newInventoryValidator() *validator.Validate {
+	validate := validator.New()
+	validate.RegisterValidation("customWarehouse", validateWarehouse)
+
+	validate.RegisterTagNameFunc(func(f reflect.StructField) string {
+		return strings.SplitN(f.Tag.Get("json"), ",", 2)[0]
+	})
+
+	return validate
+}
+
+func validateWarehouse(fl validator.FieldLevel) bool {
+	w := fl.Field().String()
+
+	return w == "" || ValidWarehouse(w)
+}
+
+// StockGet returns the stock of the product in all the warehouses
+func (p *ProductDB) StockGet(productID int) (*Stock, error) {
+	productLock.RLock()
+	defer productLock.RUnlock()
+
+	if i := productIndexByID(productID); i < 0 || productList[i].IsDeleted() {
+		return nil, ErrProductNotFound
+	}
+
+	return productStock(productID), nil
+}
+
+// StockCount sets the quantity of the product in the warehouse, the reserved
+// units must still be in the warehouse
+func (p *ProductDB) StockCount(productID int, warehouse string, onHand int) (*Stock, error) {
+	productLock.Lock()
+	defer productLock.Unlock()
+
+	sl, err := stockLevel(productID, warehouse)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if onHand < sl.Reserved {
+		return nil, fmt.Errorf("%w: %d units of product %d are reserved in %s", ErrInsufficientStock, sl.Reserved, productID, sl.Warehouse)
+	}
+
+	sl.OnHand = onHand
+	sl.UpdatedOn = time.Now().UTC()
+	setStockLevel(productID, sl)
+
+	return productStock(productID), nil
+}
+
+// StockAdjust adds the delta to the quantity of the product in the warehouse,
+// the quantity can not go below the reserved units
+func (p *ProductDB) StockAdjust(productID int, warehouse string, delta int) (*Stock, error) {
+	if delta == 0 {
+		return nil, ErrInvalidStockAdjustment
+	}
+
+	productLock.Lock()
+	defer productLock.Unlock()
+
+	sl, err := stockLevel(productID, warehouse)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if sl.OnHand+delta < sl.Reserved {
+		return nil, fmt.Errorf("%w: %d units of product %d are available in %s", ErrInsufficientStock, sl.OnHand-sl.Reserved, productID, sl.Warehouse)
+	}
+
+	sl.OnHand += delta
+	sl.UpdatedOn = time.Now().UTC()
+	setStockLevel(productID, sl)
+
+	return productStock(productID), nil
+}
+
+// stockLevel returns the stock of an existing product in the warehouse, an empty level not
+// yet stored when the product was never stocked there. It must be called holding productLock
+func stockLevel(productID int, warehouse string) (*StockLevel, error) {
+	warehouse = NormalizeWarehouse(warehouse)
+
+	if !ValidWarehouse(warehouse) {
+		return nil, ErrInvalidWarehouse
+	}
+
+	if i := productIndexByID(productID); i < 0 || productList[i].IsDeleted() {
+		return nil, ErrProductNotFound
+	}
+
+	if sl, ok := stockLevels[productID][warehouse]; ok {
+		return sl, nil
+	}
+
+	return &StockLevel{Warehouse: warehouse}, nil
+}
+
+// setStockLevel stores the stock of the product in the warehouse, it must be called holding productLock
+func setStockLevel(productID int, sl *StockLevel) {
+	levels, ok := stockLevels[productID]
+
+	if !ok {
+		levels = map[string]*StockLevel{}
+		stockLevels[productID] = levels
+	}
+
+	levels[sl.Warehouse] = sl
+}
+
+// productStock returns the stock of the product with the totals of the
+// warehouses, it must be called holding productLock
+func productStock(productID int) *Stock {
+	s := &Stock{ProductID: productID, Warehouses: []StockLevel{}}
+
+	for _, sl := range stockLevels[productID] {
+		l := *sl
+		l.Available = l.OnHand - l.Reserved
+
+		s.OnHand += l.OnHand
+		s.Reserved += l.Reserved
+		s.Available += l.Available
+		s.Warehouses = append(s.Warehouses, l)
+	}
+
+	sort.Slice(s.Warehouses, func(i, j int) bool {
+		return s.Warehouses[i].Warehouse < s.Warehouses[j].Warehouse
+	})
+
+	return s
+}
+
+// availableWarehouses returns the warehouses of the product with available
+// units, ordered by warehouse. It must be called holding productLock
+func availableWarehouses(productID int) []*StockLevel {
+	wl := []*StockLevel{}
+
+	for _, sl := range stockLevels[productID] {
+		if sl.OnHand > sl.Reserved {
+			wl = append(wl, sl)
+		}
+	}
+
+	sort.Slice(wl, func(i, j int) bool {
+		return wl[i].Warehouse < wl[j].Warehouse
+	})
+
+	return wl
+}
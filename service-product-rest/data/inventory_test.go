@@ -0,0 +1,179 @@
+package data
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStockAdjustments(t *testing.T) {
+	pdb := NewProductDB(hclog.NewNullLogger(), nil, nil)
+
+	pr := &Product{Name: "Cortado", Price: Money{Amount: 300, Currency: "EUR"}, SKU: "inv-cor-tad"}
+	assert.NoError(t, pdb.ProductAdd(pr, "test"))
+
+	st, err := pdb.StockCount(pr.ID, " LIS-1 ", 10)
+	assert.NoError(t, err)
+	assert.Equal(t, 10, st.Available)
+
+	st, err = pdb.StockAdjust(pr.ID, "opo", 5)
+	assert.NoError(t, err)
+	assert.Equal(t, 15, st.OnHand)
+	assert.Equal(t, []string{"lis-1", "opo"}, []string{st.Warehouses[0].Warehouse, st.Warehouses[1].Warehouse})
+
+	_, err = pdb.StockAdjust(pr.ID, "opo", -6)
+	assert.True(t, errors.Is(err, ErrInsufficientStock))
+
+	_, err = pdb.StockAdjust(pr.ID, "porto centro", 1)
+	assert.Equal(t, ErrInvalidWarehouse, err)
+
+	_, err = pdb.StockAdjust(pr.ID, "opo", 0)
+	assert.Equal(t, ErrInvalidStockAdjustment, err)
+
+	// the failed adjustments do not create the warehouse
+	_, err = pdb.StockAdjust(pr.ID, "fao", -1)
+	assert.True(t, errors.Is(err, ErrInsufficientStock))
+
+	st, err = pdb.StockGet(pr.ID)
+	assert.NoError(t, err)
+	assert.Len(t, st.Warehouses, 2)
+
+	// the reserved units can not be counted or adjusted away
+	rv := &Reservation{Items: []ReservationItem{{ProductID: pr.ID, Warehouse: "opo", Quantity: 4}}}
+	assert.NoError(t, pdb.ReservationCreate(rv, time.Minute))
+
+	_, err = pdb.StockCount(pr.ID, "opo", 3)
+	assert.True(t, errors.Is(err, ErrInsufficientStock))
+
+	_, err = pdb.StockAdjust(pr.ID, "opo", -2)
+	assert.True(t, errors.Is(err, ErrInsufficientStock))
+
+	_, err = pdb.ReservationCancel(rv.ID)
+	assert.NoError(t, err)
+
+	// the stock of the purged products is removed
+	assert.NoError(t, pdb.ProductDelete(pr.ID, 0, "test"))
+
+	_, err = pdb.StockGet(pr.ID)
+	assert.Equal(t, ErrProductNotFound, err)
+
+	assert.Equal(t, 1, pdb.ProductPurge(0))
+	assert.NotContains(t, stockLevels, pr.ID)
+}
+
+func TestReservationLifecycle(t *testing.T) {
+	pdb := NewProductDB(hclog.NewNullLogger(), nil, nil)
+
+	pr := &Product{Name: "Ristretto", Price: Money{Amount: 200, Currency: "EUR"}, SKU: "inv-ris-tre"}
+	assert.NoError(t, pdb.ProductAdd(pr, "test"))
+
+	_, err := pdb.StockCount(pr.ID, "lis", 3)
+	assert.NoError(t, err)
+	_, err = pdb.StockCount(pr.ID, "opo", 4)
+	assert.NoError(t, err)
+
+	// the units are taken from several warehouses
+	rv := &Reservation{Items: []ReservationItem{{ProductID: pr.ID, Quantity: 5}}}
+	assert.NoError(t, rv.Validate())
+	assert.NoError(t, pdb.ReservationCreate(rv, time.Minute))
+	assert.Equal(t, ReservationPending, rv.Status)
+	assert.Equal(t, []Allocation{{"lis", 3}, {"opo", 2}}, rv.Items[0].Allocations)
+
+	// nothing is held when an item can not be reserved
+	other := &Reservation{Items: []ReservationItem{{ProductID: pr.ID, Quantity: 1}, {ProductID: pr.ID, Warehouse: "opo", Quantity: 2}}}
+	err = pdb.ReservationCreate(other, time.Minute)
+	assert.True(t, errors.Is(err, ErrInsufficientStock))
+
+	st, _ := pdb.StockGet(pr.ID)
+	assert.Equal(t, 2, st.Available)
+
+	err = pdb.ReservationCreate(&Reservation{Items: []ReservationItem{{ProductID: 1000, Quantity: 1}}}, time.Minute)
+	assert.True(t, errors.Is(err, ErrProductNotFound))
+
+	// the confirmed units leave the stock
+	cr, err := pdb.ReservationConfirm(rv.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, ReservationConfirmed, cr.Status)
+
+	cr, err = pdb.ReservationConfirm(rv.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, ReservationConfirmed, cr.Status)
+
+	_, err = pdb.ReservationCancel(rv.ID)
+	assert.True(t, errors.Is(err, ErrReservationNotPending))
+
+	st, _ = pdb.StockGet(pr.ID)
+	assert.Equal(t, 2, st.OnHand)
+	assert.Equal(t, 0, st.Reserved)
+
+	// the expired reservations release the stock
+	ex := &Reservation{Items: []ReservationItem{{ProductID: pr.ID, Quantity: 2}}}
+	assert.NoError(t, pdb.ReservationCreate(ex, time.Millisecond))
+
+	time.Sleep(5 * time.Millisecond)
+	assert.GreaterOrEqual(t, pdb.ReservationExpire(), 1)
+
+	er, err := pdb.ReservationGet(ex.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, ReservationExpired, er.Status)
+
+	_, err = pdb.ReservationConfirm(ex.ID)
+	assert.True(t, errors.Is(err, ErrReservationNotPending))
+
+	st, _ = pdb.StockGet(pr.ID)
+	assert.Equal(t, 2, st.Available)
+
+	assert.GreaterOrEqual(t, pdb.ReservationCleanup(0), 2)
+
+	_, err = pdb.ReservationGet(rv.ID)
+	assert.Equal(t, ErrReservationNotFound, err)
+
+	assert.NoError(t, pdb.ProductDelete(pr.ID, 0, "test"))
+	assert.Equal(t, 1, pdb.ProductPurge(0))
+}
+
+func TestReservationNeverOversells(t *testing.T) {
+	pdb := NewProductDB(hclog.NewNullLogger(), nil, nil)
+
+	pr := &Product{Name: "Lungo", Price: Money{Amount: 250, Currency: "EUR"}, SKU: "inv-lun-goo"}
+	assert.NoError(t, pdb.ProductAdd(pr, "test"))
+
+	_, err := pdb.StockCount(pr.ID, "lis", 10)
+	assert.NoError(t, err)
+	_, err = pdb.StockCount(pr.ID, "opo", 7)
+	assert.NoError(t, err)
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	reserved := 0
+
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			rv := &Reservation{Items: []ReservationItem{{ProductID: pr.ID, Quantity: 2}}}
+
+			if pdb.ReservationCreate(rv, time.Minute) == nil {
+				mu.Lock()
+				reserved += rv.Items[0].Quantity
+				mu.Unlock()
+			}
+		}()
+	}
+
+	wg.Wait()
+
+	st, _ := pdb.StockGet(pr.ID)
+	assert.Equal(t, 16, reserved)
+	assert.Equal(t, 16, st.Reserved)
+	assert.Equal(t, 1, st.Available)
+
+	assert.NoError(t, pdb.ProductDelete(pr.ID, 0, "test"))
+	assert.Equal(t, 1, pdb.ProductPurge(0))
+}
@@ -0,0 +1,262 @@
+package data
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+var ErrUnsupportedCurrency = fmt.Errorf("Unsupported currency")
+var ErrInvalidAmount = fmt.Errorf("Invalid amount")
+
+// currencyMinorUnits maps the currencies supported by the currency service
+// to the number of decimal digits of their minor unit
+var currencyMinorUnits = map[string]int{
+	"EUR": 2,
+	"USD": 2,
+	"JPY": 0,
+	"BRL": 2,
+}
+
+// MinorUnits returns the number of decimal digits of the currency minor unit
+func MinorUnits(currency string) (int, error) {
+	d, ok := currencyMinorUnits[currency]
+
+	if !ok {
+		return 0, ErrUnsupportedCurrency
+	}
+
+	return d, nil
+}
+
+// Money is an amount in the minor units of a currency, like cents for EUR.
+// It is serialized to JSON as {"amount": "2.45", "currency": "EUR"}
+// swagger:model
+type Money struct {
+	// the amount in the minor units of the currency
+	Amount int64 `json:"-"`
+	// the ISO 4217 code of the currency
+	Currency string `json:"currency"`
+}
+
+// NewMoney parses the decimal amount in the given currency,
+// the amount can not have more decimals than the currency minor unit
+func NewMoney(amount string, currency string) (Money, error) {
+	d, err := MinorUnits(currency)
+
+	if err != nil {
+		return Money{}, err
+	}
+
+	amount = strings.TrimSpace(amount)
+	neg := strings.HasPrefix(amount, "-")
+	amount = strings.TrimPrefix(amount, "-")
+
+	ip, fp, _ := strings.Cut(amount, ".")
+
+	if ip == "" || len(fp) > d || strings.ContainsAny(ip+fp, "+-") {
+		return Money{}, ErrInvalidAmount
+	}
+
+	fp += strings.Repeat("0", d-len(fp))
+
+	v, err := strconv.ParseInt(ip+fp, 10, 64)
+
+	if err != nil {
+		return Money{}, ErrInvalidAmount
+	}
+
+	if neg {
+		v = -v
+	}
+
+	return Money{Amount: v, Currency: currency}, nil
+}
+
+// String returns the decimal amount, like 2.45
+func (m Money) String() string {
+	d, err := MinorUnits(m.Currency)
+
+	if err != nil || d == 0 {
+		return strconv.FormatInt(m.Amount, 10)
+	}
+
+	a := m.Amount
+	sign := ""
+
+	if a < 0 {
+		sign = "-"
+		a = -a
+	}
+
+	s := fmt.Sprintf("%0*d", d+1, a)
+
+	return sign + s[:len(s)-d] + "." + s[len(s)-d:]
+}
+
+// Float64 returns the amount in major units, it must only be used to compare amounts
+func (m Money) Float64() float64 {
+	d, _ := MinorUnits(m.Currency)
+
+	return float64(m.Amount) / math.Pow10(d)
+}
+
+// Convert returns the amount in the destination currency using the exchange rate,
+// rounded half away from zero to the minor unit of the destination currency
+func (m Money) Convert(destination string, rate float64) (Money, error) {
+	from, err := MinorUnits(m.Currency)
+
+	if err != nil {
+		return Money{}, err
+	}
+
+	to, err := MinorUnits(destination)
+
+	if err != nil {
+		return Money{}, err
+	}
+
+	v := math.Round(float64(m.Amount) * rate * math.Pow10(to-from))
+
+	return Money{Amount: int64(v), Currency: destination}, nil
+}
+
+// MarshalJSON encodes the amount as a decimal string
+func (m Money) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		Amount   string `json:"amount"`
+		Currency string `json:"currency"`
+	}{m.String(), m.Currency})
+}
+
+// UnmarshalJSON decodes the amount from a decimal string or a number
+func (m *Money) UnmarshalJSON(b []byte) error {
+	mj := struct {
+		Amount   interface{} `json:"amount"`
+		Currency string      `json:"currency"`
+	}{}
+
+	d := json.NewDecoder(strings.NewReader(string(b)))
+	d.UseNumber()
+
+	err := d.Decode(&mj)
+
+	if err != nil {
+		return err
+	}
+
+	var amount string
+
+	switch a := mj.Amount.(type) {
+	case string:
+		amount = a
+	case json.Number:
+		amount = a.String()
+	case nil:
+		amount = "0"
+	default:
+		return ErrInvalidAmount
+	}
+
+	nm, err := NewMoney(amount, mj.Currency)
+
+	if err != nil {
+		return fmt.Errorf("Invalid price %q %q: %w", amount, mj.Currency, err)
+	}
+
+	*m = nm
+
+	return nil
+}
+
+// moneyMsgpack is the MessagePack representation of an amount, with the decimal amount like in JSON
+type moneyMsgpack struct {
+	Amount   interface{} `msgpack:"amount"`
+	Currency string      `msgpack:"currency"`
+}
+
+// EncodeMsgpack encodes the amount as a decimal string
+func (m Money) EncodeMsgpack(e *msgpack.Encoder) error {
+	return e.Encode(moneyMsgpack{m.String(), m.Currency})
+}
+
+// DecodeMsgpack decodes the amount from a decimal string or a number
+func (m *Money) DecodeMsgpack(d *msgpack.Decoder) error {
+	mm := moneyMsgpack{}
+
+	err := d.Decode(&mm)
+
+	if err != nil {
+		return err
+	}
+
+	var amount string
+
+	switch a := mm.Amount.(type) {
+	case string:
+		amount = a
+	case int8, int16, int32, int64, uint8, uint16, uint32, uint64:
+		amount = fmt.Sprint(a)
+	case float32:
+		amount = strconv.FormatFloat(float64(a), 'f', -1, 32)
+	case float64:
+		amount = strconv.FormatFloat(a, 'f', -1, 64)
+	case nil:
+		amount = "0"
+	default:
+		return ErrInvalidAmount
+	}
+
+	nm, err := NewMoney(amount, mm.Currency)
+
+	if err != nil {
+		return fmt.Errorf("Invalid price %q %q: %w", amount, mm.Currency, err)
+	}
+
+	*m = nm
+
+	return nil
+}
+
+// moneyXML is the XML representation of an amount, with the decimal amount like in JSON
+type moneyXML struct {
+	Amount   string `xml:"amount"`
+	Currency string `xml:"currency"`
+}
+
+// MarshalXML encodes the amount as a decimal string
+func (m Money) MarshalXML(e *xml.Encoder, start xml.StartElement) error {
+	return e.EncodeElement(moneyXML{m.String(), m.Currency}, start)
+}
+
+// UnmarshalXML decodes the amount from a decimal string
+func (m *Money) UnmarshalXML(d *xml.Decoder, start xml.StartElement) error {
+	mx := moneyXML{}
+
+	err := d.DecodeElement(&mx, &start)
+
+	if err != nil {
+		return err
+	}
+
+	amount := strings.TrimSpace(mx.Amount)
+
+	if amount == "" {
+		amount = "0"
+	}
+
+	nm, err := NewMoney(amount, strings.TrimSpace(mx.Currency))
+
+	if err != nil {
+		return fmt.Errorf("Invalid price %q %q: %w", amount, mx.Currency, err)
+	}
+
+	*m = nm
+
+	return nil
+}
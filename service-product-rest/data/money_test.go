@@ -0,0 +1,66 @@
+package data
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewMoneyParsesDecimalAmount(t *testing.T) {
+	m, err := NewMoney("2.4", "EUR")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(240), m.Amount)
+	assert.Equal(t, "2.40", m.String())
+
+	m, err = NewMoney("150", "JPY")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(150), m.Amount)
+	assert.Equal(t, "150", m.String())
+
+	_, err = NewMoney("1.999", "EUR")
+	assert.Equal(t, ErrInvalidAmount, err)
+
+	_, err = NewMoney("1.5", "JPY")
+	assert.Equal(t, ErrInvalidAmount, err)
+
+	_, err = NewMoney("1.50", "GBX")
+	assert.Equal(t, ErrUnsupportedCurrency, err)
+}
+
+func TestMoneyConvertRoundsToDestinationMinorUnit(t *testing.T) {
+	m := Money{Amount: 245, Currency: "EUR"}
+
+	c, err := m.Convert("BRL", 5.4321)
+	assert.NoError(t, err)
+	assert.Equal(t, Money{Amount: 1331, Currency: "BRL"}, c)
+
+	c, err = m.Convert("JPY", 140.5)
+	assert.NoError(t, err)
+	assert.Equal(t, Money{Amount: 344, Currency: "JPY"}, c)
+}
+
+func TestMoneyJSON(t *testing.T) {
+	b, err := json.Marshal(Money{Amount: 5, Currency: "USD"})
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"amount": "0.05", "currency": "USD"}`, string(b))
+
+	m := Money{}
+	assert.NoError(t, json.Unmarshal([]byte(`{"amount": 12.3, "currency": "BRL"}`), &m))
+	assert.Equal(t, Money{Amount: 1230, Currency: "BRL"}, m)
+
+	assert.Error(t, json.Unmarshal([]byte(`{"amount": "12.3"}`), &m))
+}
+
+func TestMoneyXML(t *testing.T) {
+	b, err := xml.Marshal(Money{Amount: 245, Currency: "EUR"})
+	assert.NoError(t, err)
+	assert.Equal(t, `<Money><amount>2.45</amount><currency>EUR</currency></Money>`, string(b))
+
+	m := Money{}
+	assert.NoError(t, xml.Unmarshal([]byte(`<price><amount> 1.5 </amount><currency>USD</currency></price>`), &m))
+	assert.Equal(t, Money{Amount: 150, Currency: "USD"}, m)
+
+	assert.Error(t, xml.Unmarshal([]byte(`<price><amount>1.234</amount><currency>EUR</currency></price>`), &m))
+}
@@ -0,0 +1,196 @@
+package data
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+var ErrOutboxEntryNotFound = fmt.Errorf("Outbox entry not found")
+
+// OutboxEntry is a product event waiting to be published. The entries are
+// written in the same critical section as the product change, so a change is
+// never stored without its event
+type OutboxEntry struct {
+	// Event is the product change, its ID is the sequence of the entry
+	// and it is kept on the republications so consumers can deduplicate
+	Event ProductEvent
+	// Attempts is the number of failed publications
+	Attempts int
+	// LastError is the reason of the last failed publication
+	LastError string
+	// RetryAt is the time before which the entry is not published again
+	RetryAt time.Time
+	// PublishedOn is set once the event is published
+	PublishedOn *time.Time
+	// DeadLetteredOn is set when the publication is given up after the last attempt
+	DeadLetteredOn *time.Time
+}
+
+// outbox keeps the entries in the order of the changes, it is guarded by productLock
+var outbox = []*OutboxEntry{}
+
+// outboxSeq is the sequence of the last outbox entry, it is guarded by productLock
+var outboxSeq uint64
+
+// outboxDelivered is the sequence of the last outbox entry delivered to the event
+// broker, it is guarded by productLock
+var outboxDelivered uint64
+
+// addOutboxEntry records the product change in the outbox, it must be called holding productLock
+func addOutboxEntry(t ProductEventType, pr *Product, revertedFrom int) {
+	np := *pr
+	outboxSeq++
+
+	outbox = append(outbox, &OutboxEntry{
+		Event: ProductEvent{
+			ID:           outboxSeq,
+			Type:         t,
+			ProductID:    pr.ID,
+			Version:      pr.Version,
+			Time:         pr.UpdatedOn,
+			RevertedFrom: revertedFrom,
+			Product:      &np,
+		},
+	})
+}
+
+// deliverOutbox sends the entries recorded since the last delivery to the event broker, the
+// consumers of the broker get the events of the outbox with their sequence as id. It must
+// be called holding productLock
+func deliverOutbox(b *ProductEventBroker) {
+	i := sort.Search(len(outbox), func(i int) bool { return outbox[i].Event.ID > outboxDelivered })
+
+	for _, e := range outbox[i:] {
+		if b != nil {
+			b.Publish(e.Event)
+		}
+
+		outboxDelivered = e.Event.ID
+	}
+}
+
+// OutboxPending returns up to limit entries due for publication in the order of the changes.
+// The entries of a product waiting for a retry hold back the next entries of the product, so
+// they do not fill the batch, and the dead-lettered entries are not published again
+func (p *ProductDB) OutboxPending(limit int) []OutboxEntry {
+	productLock.RLock()
+	defer productLock.RUnlock()
+
+	now := time.Now()
+	blocked := map[int]bool{}
+
+	el := []OutboxEntry{}
+	for _, e := range outbox {
+		if len(el) == limit {
+			break
+		}
+
+		if e.PublishedOn != nil || e.DeadLetteredOn != nil || blocked[e.Event.ProductID] {
+			continue
+		}
+
+		if now.Before(e.RetryAt) {
+			blocked[e.Event.ProductID] = true
+			continue
+		}
+
+		el = append(el, *e)
+	}
+
+	return el
+}
+
+// OutboxPublished marks the entry with the given sequence as published
+func (p *ProductDB) OutboxPublished(seq uint64) error {
+	productLock.Lock()
+	defer productLock.Unlock()
+
+	e := outboxEntry(seq)
+
+	if e == nil {
+		return ErrOutboxEntryNotFound
+	}
+
+	now := time.Now().UTC()
+	e.PublishedOn = &now
+
+	return nil
+}
+
+// OutboxFailed records a failed publication of the entry with the given sequence,
+// the entry is not published again before retryAt
+func (p *ProductDB) OutboxFailed(seq uint64, err error, retryAt time.Time) error {
+	productLock.Lock()
+	defer productLock.Unlock()
+
+	e := outboxEntry(seq)
+
+	if e == nil {
+		return ErrOutboxEntryNotFound
+	}
+
+	e.Attempts++
+	e.LastError = err.Error()
+	e.RetryAt = retryAt
+
+	return nil
+}
+
+// OutboxDeadLetter records the last failed publication of the entry with the given
+// sequence, the entry is not published again and the next entries of its product are
+func (p *ProductDB) OutboxDeadLetter(seq uint64, err error) error {
+	productLock.Lock()
+	defer productLock.Unlock()
+
+	e := outboxEntry(seq)
+
+	if e == nil {
+		return ErrOutboxEntryNotFound
+	}
+
+	now := time.Now().UTC()
+	e.Attempts++
+	e.LastError = err.Error()
+	e.DeadLetteredOn = &now
+
+	return nil
+}
+
+// OutboxCleanup removes the entries published or dead-lettered before the retention period
+// and returns the number of removed entries. The entries not delivered to the event broker
+// yet are kept
+func (p *ProductDB) OutboxCleanup(retention time.Duration) int {
+	productLock.Lock()
+	defer productLock.Unlock()
+
+	limit := time.Now().UTC().Add(-retention)
+
+	el := []*OutboxEntry{}
+	for _, e := range outbox {
+		done := e.PublishedOn
+		if done == nil {
+			done = e.DeadLetteredOn
+		}
+
+		if done == nil || !done.Before(limit) || e.Event.ID > outboxDelivered {
+			el = append(el, e)
+		}
+	}
+
+	removed := len(outbox) - len(el)
+	outbox = el
+
+	return removed
+}
+
+// outboxEntry returns the entry with the given sequence, it must be called holding productLock
+func outboxEntry(seq uint64) *OutboxEntry {
+	for _, e := range outbox {
+		if e.Event.ID == seq {
+			return e
+		}
+	}
+
+	return nil
+}
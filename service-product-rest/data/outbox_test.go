@@ -0,0 +1,98 @@
+package data
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/stretchr/testify/assert"
+)
+
+// pendingFor returns the pending outbox entries of the given product
+func pendingFor(pdb *ProductDB, id int) []OutboxEntry {
+	el := []OutboxEntry{}
+	for _, e := range pdb.OutboxPending(1000) {
+		if e.Event.ProductID == id {
+			el = append(el, e)
+		}
+	}
+
+	return el
+}
+
+func TestOutboxRecordsChanges(t *testing.T) {
+	pdb := NewProductDB(hclog.NewNullLogger(), nil, nil)
+
+	pr := &Product{Name: "Macchiato", Price: Money{Amount: 280, Currency: "EUR"}, SKU: "abc-abc-abc"}
+	pdb.ProductAdd(pr, "test")
+	assert.NoError(t, pdb.ProductUpdate(&Product{ID: pr.ID, Name: "Macchiato", Price: Money{Amount: 300, Currency: "EUR"}, SKU: "abc-abc-abc"}, 1, "test"))
+
+	el := pendingFor(pdb, pr.ID)
+
+	assert.Len(t, el, 2)
+	assert.Equal(t, ProductCreated, el[0].Event.Type)
+	assert.Equal(t, ProductUpdated, el[1].Event.Type)
+	assert.Equal(t, 2, el[1].Event.Version)
+	assert.Less(t, el[0].Event.ID, el[1].Event.ID)
+
+	retryAt := time.Now()
+	assert.NoError(t, pdb.OutboxFailed(el[0].Event.ID, fmt.Errorf("unavailable"), retryAt))
+	assert.NoError(t, pdb.OutboxPublished(el[1].Event.ID))
+
+	el = pendingFor(pdb, pr.ID)
+
+	assert.Len(t, el, 1)
+	assert.Equal(t, 1, el[0].Attempts)
+	assert.Equal(t, "unavailable", el[0].LastError)
+	assert.Equal(t, retryAt, el[0].RetryAt)
+
+	assert.NoError(t, pdb.OutboxPublished(el[0].Event.ID))
+	assert.Empty(t, pendingFor(pdb, pr.ID))
+
+	// remove the product from the data store shared with the other tests
+	assert.NoError(t, pdb.ProductDelete(pr.ID, 0, "test"))
+	pdb.ProductPurge(0)
+
+	assert.Equal(t, 0, pdb.OutboxCleanup(time.Hour))
+	assert.GreaterOrEqual(t, pdb.OutboxCleanup(0), 2)
+	assert.Equal(t, ErrOutboxEntryNotFound, pdb.OutboxPublished(el[0].Event.ID))
+}
+
+func TestOutboxPendingSkipsBlockedProducts(t *testing.T) {
+	pdb := NewProductDB(hclog.NewNullLogger(), nil, nil)
+
+	blocked := &Product{Name: "Ristretto", Price: Money{Amount: 220, Currency: "EUR"}, SKU: "pen-ris-one"}
+	other := &Product{Name: "Lungo", Price: Money{Amount: 210, Currency: "EUR"}, SKU: "pen-lun-one"}
+	pdb.ProductAdd(blocked, "test")
+	pdb.ProductAdd(other, "test")
+	assert.NoError(t, pdb.ProductDelete(blocked.ID, 0, "test"))
+
+	el := pendingFor(pdb, blocked.ID)
+	assert.Len(t, el, 2)
+
+	// the entries of the product wait for the retry of its first entry
+	assert.NoError(t, pdb.OutboxFailed(el[0].Event.ID, fmt.Errorf("unavailable"), time.Now().Add(time.Minute)))
+
+	assert.Empty(t, pendingFor(pdb, blocked.ID))
+	assert.Len(t, pendingFor(pdb, other.ID), 1)
+
+	// a dead-lettered entry does not hold back the next entries of the product
+	assert.NoError(t, pdb.OutboxDeadLetter(el[0].Event.ID, fmt.Errorf("rejected")))
+
+	pl := pendingFor(pdb, blocked.ID)
+	assert.Len(t, pl, 1)
+	assert.Equal(t, el[1].Event.ID, pl[0].Event.ID)
+
+	// the dead letters are removed after the retention period
+	assert.NoError(t, pdb.OutboxPublished(pl[0].Event.ID))
+	assert.NoError(t, pdb.ProductDelete(other.ID, 0, "test"))
+	pdb.ProductPurge(0)
+
+	for _, e := range pendingFor(pdb, other.ID) {
+		assert.NoError(t, pdb.OutboxPublished(e.Event.ID))
+	}
+
+	pdb.OutboxCleanup(0)
+	assert.Equal(t, ErrOutboxEntryNotFound, pdb.OutboxDeadLetter(el[0].Event.ID, fmt.Errorf("rejected")))
+}
@@ -0,0 +1,298 @@
+package data
+
+import (
+	"fmt"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/go-playground/validator/v10"
+)
+
+var ErrPriceNotFound = fmt.Errorf("Price not found")
+var ErrInvalidPriceList = fmt.Errorf("Price list must have 1 to 32 lower case letters, digits or dashes")
+var ErrInvalidPeriod = fmt.Errorf("The end of the period must be after its start")
+
+// DefaultPriceList is the price list of the products when none is requested, the other
+// price lists fall back to it for the products they have no price for
+const DefaultPriceList = "default"
+
+// priceListPattern is the format of the price list codes
+var priceListPattern = regexp.MustCompile(`^[a-z0-9-]{1,32}$`)
+
+// PriceEntry is the price of a product in a price list, like retail or wholesale.
+// A price with an effective period replaces the prices without one during the period,
+// so the price changes can be scheduled
+// swagger:model
+type PriceEntry struct {
+	// the id of the price
+	ID int `json:"id"`
+	// the id of the product
+	ProductID int `json:"product_id"`
+	// the code of the price list, the default price list when absent
+	PriceList string `json:"price_list" validate:"customPriceList"`
+	// the price of the product in the price list
+	Price Money `json:"price" validate:"customPrice"`
+	// the time the price takes effect, it is effective since ever when absent
+	EffectiveFrom *time.Time `json:"effective_from,omitempty"`
+	// the time the price stops being effective, it is effective for ever when absent
+	EffectiveTo *time.Time `json:"effective_to,omitempty"`
+	CreatedOn   time.Time  `json:"created_on"`
+}
+
+// ResolvedPrice tells where the price of a product comes from
+// swagger:model
+type ResolvedPrice struct {
+	// the price list of the price, the default price list when the requested one has no price for the product
+	PriceList string `json:"price_list" xml:"price_list"`
+	// the instant the price is effective
+	At time.Time `json:"at" xml:"at"`
+	// the price before the promotion
+	ListPrice Money `json:"list_price" xml:"list_price"`
+	// the id of the price of the price list, absent when it is the base price of the product
+	PriceID int `json:"price_id,omitempty" xml:"price_id,omitempty"`
+	// the id of the promotion applied to the list price
+	PromotionID int `json:"promotion_id,omitempty" xml:"promotion_id,omitempty"`
+}
+
+// The prices of a product, ordered by price list and start
+// swagger:response pricesResponse
+type pricesResponseWrapper struct {
+	// in: body
+	Body []PriceEntry
+}
+
+// A price of a product
+// swagger:response priceResponse
+type priceResponseWrapper struct {
+	// in: body
+	Body PriceEntry
+}
+
+// swagger:parameters GetProduct GetProductBySKU SearchProducts ExportProducts
+type productPriceSelectionParameterWrapper struct {
+	// The price list of the price, the default price list when absent
+	// in: query
+	PriceList string `json:"price_list"`
+	// The RFC 3339 instant of the price, the current time when absent
+	// in: query
+	At string `json:"at"`
+}
+
+// swagger:parameters ListPrices CreatePrice DeletePrice
+type priceProductIDParameterWrapper struct {
+	// The id of the product
+	// in: path
+	// required: true
+	ID int `json:"id"`
+}
+
+// swagger:parameters DeletePrice
+type priceIDParameterWrapper struct {
+	// The id of the price
+	// in: path
+	// required: true
+	PriceID int `json:"price"`
+}
+
+// swagger:parameters CreatePrice
+type priceParameterWrapper struct {
+	// in: body
+	// required: true
+	Body PriceEntry
+}
+
+// priceEntries keeps the prices by product, it is guarded by productLock
+var priceEntries = map[int][]*PriceEntry{}
+
+// priceSeq is the id of the last added price, it is guarded by productLock
+var priceSeq int
+
+// Validate checks the fields of the price
+func (e *PriceEntry) Validate() error {
+	e.PriceList = strings.ToLower(strings.TrimSpace(e.PriceList))
+
+	if e.PriceList == "" {
+		e.PriceList = DefaultPriceList
+	}
+
+	return newPricingValidator().Struct(e)
+}
+
+// newPricingValidator creates a validator of the prices and promotions reporting the fields by their json name
+func newPricingValidator() *validator.Validate {
+	validate := validator.New()
+	validate.RegisterValidation("customPrice", validatePrice)
+	validate.RegisterValidation("customPriceList", validatePriceList)
+	validate.RegisterCustomTypeFunc(priceValue, Money{})
+
+	validate.RegisterTagNameFunc(func(f reflect.StructField) string {
+		return strings.SplitN(f.Tag.Get("json"), ",", 2)[0]
+	})
+
+	return validate
+}
+
+func validatePriceList(fl validator.FieldLevel) bool {
+	return ValidPriceList(fl.Field().String())
+}
+
+// ValidPriceList returns true when the price list code has a valid format
+func ValidPriceList(code string) bool {
+	return priceListPattern.MatchString(code)
+}
+
+// PriceList returns the prices of the product ordered by price list and start
+func (p *ProductDB) PriceList(productID int) ([]PriceEntry, error) {
+	productLock.RLock()
+	defer productLock.RUnlock()
+
+	if i := productIndexByID(productID); i < 0 || productList[i].IsDeleted() {
+		return nil, ErrProductNotFound
+	}
+
+	el := []PriceEntry{}
+	for _, e := range priceEntries[productID] {
+		el = append(el, *e)
+	}
+
+	sort.SliceStable(el, func(i, j int) bool {
+		if el[i].PriceList != el[j].PriceList {
+			return el[i].PriceList < el[j].PriceList
+		}
+
+		return startsBefore(el[i].EffectiveFrom, el[j].EffectiveFrom)
+	})
+
+	return el, nil
+}
+
+// PriceAdd adds a price to the price list of the product
+func (p *ProductDB) PriceAdd(e *PriceEntry) error {
+	if e.EffectiveFrom != nil && e.EffectiveTo != nil && !e.EffectiveTo.After(*e.EffectiveFrom) {
+		return ErrInvalidPeriod
+	}
+
+	productLock.Lock()
+	defer productLock.Unlock()
+
+	if i := productIndexByID(e.ProductID); i < 0 || productList[i].IsDeleted() {
+		return ErrProductNotFound
+	}
+
+	priceSeq++
+	e.ID = priceSeq
+	e.CreatedOn = time.Now().UTC()
+
+	ne := *e
+	priceEntries[e.ProductID] = append(priceEntries[e.ProductID], &ne)
+
+	return nil
+}
+
+// PriceDelete removes the price of the product
+func (p *ProductDB) PriceDelete(productID, id int) error {
+	productLock.Lock()
+	defer productLock.Unlock()
+
+	if i := productIndexByID(productID); i < 0 || productList[i].IsDeleted() {
+		return ErrProductNotFound
+	}
+
+	el := priceEntries[productID]
+
+	for i, e := range el {
+		if e.ID == id {
+			priceEntries[productID] = append(el[:i], el[i+1:]...)
+			return nil
+		}
+	}
+
+	return ErrPriceNotFound
+}
+
+// ProductGetPriced returns the product with the given id with its effective price in the price
+// list at the instant, after the promotions, converted to the given currency. Deleted products
+// are only returned when includeDeleted is true
+func (p *ProductDB) ProductGetPriced(id int, currency string, includeDeleted bool, priceList string, at time.Time) (*Product, error) {
+	productLock.RLock()
+	i := productIndexByID(id)
+
+	if i < 0 || (productList[i].IsDeleted() && !includeDeleted) {
+		productLock.RUnlock()
+		return nil, ErrProductNotFound
+	}
+
+	np := *productList[i]
+	resolvePrice(&np, priceList, at)
+	productLock.RUnlock()
+
+	err := p.convertPrice(&np, currency, map[string]Rate{})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &np, nil
+}
+
+// resolvePrice replaces the price of the product with its effective price in the price list at
+// the instant: the price of the price list, else the price of the default price list, else the
+// base price of the product, with the best promotion applied. It must be called holding productLock
+func resolvePrice(pr *Product, priceList string, at time.Time) {
+	rp := &ResolvedPrice{PriceList: DefaultPriceList, At: at, ListPrice: pr.Price}
+
+	for _, l := range []string{priceList, DefaultPriceList} {
+		if e := effectivePrice(pr.ID, l, at); e != nil {
+			rp.PriceList = l
+			rp.PriceID = e.ID
+			rp.ListPrice = e.Price
+			break
+		}
+	}
+
+	pr.Price = rp.ListPrice
+
+	if pm, price, ok := bestPromotion(pr, priceList, at); ok {
+		rp.PromotionID = pm.ID
+		pr.Price = price
+	}
+
+	pr.Pricing = rp
+}
+
+// effectivePrice returns the price of the product in the price list at the instant, the price which
+// started the latest when several are effective. It must be called holding productLock
+func effectivePrice(productID int, priceList string, at time.Time) *PriceEntry {
+	var ep *PriceEntry
+
+	for _, e := range priceEntries[productID] {
+		if e.PriceList != priceList || !inPeriod(at, e.EffectiveFrom, e.EffectiveTo) {
+			continue
+		}
+
+		// the latest price wins between prices starting at the same time
+		if ep == nil || !startsBefore(e.EffectiveFrom, ep.EffectiveFrom) {
+			ep = e
+		}
+	}
+
+	return ep
+}
+
+// inPeriod returns true when the instant is in the period, a missing bound leaves the period open
+func inPeriod(at time.Time, from, to *time.Time) bool {
+	return (from == nil || !at.Before(*from)) && (to == nil || at.Before(*to))
+}
+
+// startsBefore returns true when the period starting at a starts strictly before
+// the one starting at b, a missing start is before any time
+func startsBefore(a, b *time.Time) bool {
+	if a == nil || b == nil {
+		return a == nil && b != nil
+	}
+
+	return a.Before(*b)
+}
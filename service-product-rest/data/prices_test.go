@@ -0,0 +1,98 @@
+package data
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPriceResolution(t *testing.T) {
+	pdb := NewProductDB(hclog.NewNullLogger(), nil, nil)
+
+	pr := &Product{Name: "Doppio", Price: Money{Amount: 300, Currency: "EUR"}, SKU: "pri-dop-pio"}
+	assert.NoError(t, pdb.ProductAdd(pr, "test"))
+
+	now := time.Now().UTC()
+	from, to := now.Add(24*time.Hour), now.Add(48*time.Hour)
+
+	price := func(list string, at time.Time) *Product {
+		pg, err := pdb.ProductGetPriced(pr.ID, "", false, list, at)
+		assert.NoError(t, err)
+
+		return pg
+	}
+
+	// without prices the base price is used
+	pg := price(DefaultPriceList, now)
+	assert.Equal(t, int64(300), pg.Price.Amount)
+	assert.Equal(t, 0, pg.Pricing.PriceID)
+
+	wholesale := &PriceEntry{ProductID: pr.ID, PriceList: " Wholesale ", Price: Money{Amount: 250, Currency: "EUR"}}
+	assert.NoError(t, wholesale.Validate())
+	assert.NoError(t, pdb.PriceAdd(wholesale))
+
+	scheduled := &PriceEntry{ProductID: pr.ID, Price: Money{Amount: 280, Currency: "EUR"}, EffectiveFrom: &from, EffectiveTo: &to}
+	assert.NoError(t, scheduled.Validate())
+	assert.NoError(t, pdb.PriceAdd(scheduled))
+
+	assert.Equal(t, ErrInvalidPeriod, pdb.PriceAdd(&PriceEntry{ProductID: pr.ID, PriceList: DefaultPriceList, Price: Money{Amount: 1, Currency: "EUR"}, EffectiveFrom: &to, EffectiveTo: &from}))
+	assert.Error(t, (&PriceEntry{PriceList: "retail list", Price: Money{Amount: 1, Currency: "EUR"}}).Validate())
+
+	pg = price("wholesale", now)
+	assert.Equal(t, int64(250), pg.Price.Amount)
+	assert.Equal(t, "wholesale", pg.Pricing.PriceList)
+
+	// the other price lists fall back to the default one, then to the base price
+	pg = price("retail", from.Add(time.Hour))
+	assert.Equal(t, int64(280), pg.Price.Amount)
+	assert.Equal(t, DefaultPriceList, pg.Pricing.PriceList)
+	assert.Equal(t, scheduled.ID, pg.Pricing.PriceID)
+
+	assert.Equal(t, int64(300), price("retail", to).Price.Amount)
+
+	// the best promotion running at the instant is applied to the list price
+	ten := &Promotion{Name: "Ten off", Type: PromotionPercentage, Percent: 10, StartsAt: now.Add(-time.Hour), ProductIDs: []int{pr.ID}}
+	assert.NoError(t, ten.Validate())
+	assert.NoError(t, pdb.PromotionAdd(ten))
+
+	fixed := &Promotion{Name: "Wholesale deal", Type: PromotionFixed, Amount: &Money{Amount: 50, Currency: "EUR"}, StartsAt: now.Add(-time.Hour), EndsAt: &from, PriceLists: []string{"wholesale"}}
+	assert.NoError(t, fixed.Validate())
+	assert.NoError(t, pdb.PromotionAdd(fixed))
+
+	yen := &Promotion{Name: "Yen deal", Type: PromotionFixed, Amount: &Money{Amount: 1000, Currency: "JPY"}, StartsAt: now.Add(-time.Hour)}
+	assert.NoError(t, pdb.PromotionAdd(yen))
+
+	pg = price(DefaultPriceList, now)
+	assert.Equal(t, int64(270), pg.Price.Amount)
+	assert.Equal(t, int64(300), pg.Pricing.ListPrice.Amount)
+	assert.Equal(t, ten.ID, pg.Pricing.PromotionID)
+
+	pg = price("wholesale", now)
+	assert.Equal(t, int64(200), pg.Price.Amount)
+	assert.Equal(t, fixed.ID, pg.Pricing.PromotionID)
+
+	pg = price("wholesale", from)
+	assert.Equal(t, int64(225), pg.Price.Amount)
+
+	assert.Equal(t, ErrInvalidDiscount, pdb.PromotionAdd(&Promotion{Name: "Broken", Type: PromotionFixed, Percent: 5, StartsAt: now}))
+	assert.True(t, errors.Is(pdb.PromotionAdd(&Promotion{Name: "Ghost", Type: PromotionPercentage, Percent: 5, StartsAt: now, ProductIDs: []int{1000}}), ErrProductNotFound))
+
+	for _, pm := range []*Promotion{ten, fixed, yen} {
+		assert.NoError(t, pdb.PromotionDelete(pm.ID))
+	}
+
+	assert.NoError(t, pdb.PriceDelete(pr.ID, wholesale.ID))
+	assert.Equal(t, ErrPriceNotFound, pdb.PriceDelete(pr.ID, wholesale.ID))
+
+	el, err := pdb.PriceList(pr.ID)
+	assert.NoError(t, err)
+	assert.Len(t, el, 1)
+
+	// the prices of the purged products are removed
+	assert.NoError(t, pdb.ProductDelete(pr.ID, 0, "test"))
+	assert.Equal(t, 1, pdb.ProductPurge(0))
+	assert.NotContains(t, priceEntries, pr.ID)
+}
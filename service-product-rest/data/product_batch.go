@@ -0,0 +1,229 @@
+package data
+
+import (
+	"fmt"
+)
+
+// MaxBatchOperations limits the number of operations of a batch
+const MaxBatchOperations = 1000
+
+// Operations of a batch
+const (
+	BatchCreate = "create"
+	BatchUpdate = "update"
+	BatchDelete = "delete"
+)
+
+var ErrInvalidBatchOperation = fmt.Errorf("Invalid operation, it must be create, update or delete")
+var ErrMissingBatchProduct = fmt.Errorf("The operation requires a product")
+var ErrBatchRolledBack = fmt.Errorf("The operation was rolled back because another operation failed")
+var ErrBatchNotExecuted = fmt.Errorf("The operation was not executed because another operation failed")
+
+// BatchOperation is a product change of a batch
+// swagger:model
+type BatchOperation struct {
+	// create, update or delete
+	//
+	// required: true
+	Op string `json:"op"`
+	// the id of the product to update or delete
+	ID int `json:"id,omitempty"`
+	// the expected version of the product to update or delete, it is not checked when absent
+	Version int `json:"version,omitempty"`
+	// the product to create or the new content of the product to update
+	Product *Product `json:"product,omitempty"`
+}
+
+// BatchRequest is a list of product changes executed in one request
+// swagger:model
+type BatchRequest struct {
+	// roll back all the operations when one of them fails
+	Atomic bool `json:"atomic"`
+	// the operations, executed in order
+	//
+	// required: true
+	Operations []BatchOperation `json:"operations"`
+}
+
+// BatchReport is the result of a batch
+// swagger:model
+type BatchReport struct {
+	// the batch was atomic
+	Atomic bool `json:"atomic"`
+	// the changes were kept, false when an atomic batch was rolled back
+	Committed bool `json:"committed"`
+	// the result of each operation
+	Results []BatchResult `json:"results"`
+}
+
+// BatchResult is the result of an operation of a batch
+// swagger:model
+type BatchResult struct {
+	// the position of the operation in the batch, starting at 0
+	Index int `json:"index"`
+	// the operation
+	Op string `json:"op"`
+	// the HTTP status the operation would have on its own endpoint
+	Status int `json:"status"`
+	// the id of the product
+	ID int `json:"id,omitempty"`
+	// the version of the product after the operation
+	Version int `json:"version,omitempty"`
+	// the reason of the failure
+	Error string `json:"error,omitempty"`
+	// the validation errors of the product
+	Errors []FieldError `json:"errors,omitempty"`
+
+	// Err is the error of the operation, nil when it succeeded
+	Err error `json:"-"`
+}
+
+// ProductBatch executes the operations in order. When atomic is true the batch
+// stops at the first failed operation and all the changes are rolled back,
+// otherwise every operation is executed on its own. It returns the result of
+// each operation and whether the changes were kept
+func (p *ProductDB) ProductBatch(ops []BatchOperation, atomic bool, actor string) ([]BatchResult, bool) {
+	productLock.Lock()
+	defer productLock.Unlock()
+
+	var snap *productSnapshot
+	if atomic {
+		snap = takeSnapshot()
+	}
+
+	results := make([]BatchResult, len(ops))
+	failed := false
+
+	for i, op := range ops {
+		results[i] = BatchResult{Index: i, Op: op.Op, ID: op.ID}
+
+		if atomic && failed {
+			results[i].Err = ErrBatchNotExecuted
+			continue
+		}
+
+		rv, err := executeBatchOperation(op, actor)
+
+		if err != nil {
+			results[i].Err = err
+			failed = true
+			continue
+		}
+
+		results[i].ID = rv.ProductID
+		results[i].Version = rv.Revision
+
+		if !atomic {
+			p.notify()
+		}
+	}
+
+	if atomic && failed {
+		snap.restore()
+
+		for i := range results {
+			if results[i].Err == nil {
+				results[i].Err = ErrBatchRolledBack
+				results[i].Version = 0
+			}
+		}
+
+		return results, false
+	}
+
+	// the events of an atomic batch are only sent once all the operations succeeded
+	if atomic {
+		p.notify()
+	}
+
+	return results, true
+}
+
+// executeBatchOperation validates and executes an operation, it must be called holding productLock
+func executeBatchOperation(op BatchOperation, actor string) (*Revision, error) {
+	switch op.Op {
+	case BatchCreate, BatchUpdate:
+		if op.Product == nil {
+			return nil, ErrMissingBatchProduct
+		}
+
+		pr := *op.Product
+		pr.Normalize()
+
+		if err := pr.Validate(); err != nil {
+			return nil, err
+		}
+
+		if op.Op == BatchCreate {
+			return addProduct(&pr, actor)
+		}
+
+		pr.ID = op.ID
+
+		return updateProduct(&pr, op.Version, actor)
+	case BatchDelete:
+		return deleteProduct(op.ID, op.Version, actor)
+	}
+
+	return nil, ErrInvalidBatchOperation
+}
+
+// productSnapshot is the state of the data store before a batch, used to roll it back
+type productSnapshot struct {
+	products  []Product
+	revisions map[int]int
+	outbox    int
+	outboxSeq uint64
+}
+
+// takeSnapshot copies the state of the data store, it must be called holding productLock
+func takeSnapshot() *productSnapshot {
+	s := &productSnapshot{
+		products:  make([]Product, len(productList)),
+		revisions: map[int]int{},
+		outbox:    len(outbox),
+		outboxSeq: outboxSeq,
+	}
+
+	for i, pr := range productList {
+		s.products[i] = *pr
+	}
+
+	for id, rl := range revisions {
+		s.revisions[id] = len(rl)
+	}
+
+	return s
+}
+
+// restore brings back the state of the data store and the search index, it must be called holding productLock
+func (s *productSnapshot) restore() {
+	productList = make([]*Product, len(s.products))
+
+	for i := range s.products {
+		np := s.products[i]
+		productList[i] = &np
+	}
+
+	for id, rl := range revisions {
+		n, ok := s.revisions[id]
+
+		if !ok {
+			delete(revisions, id)
+			productIndex.Remove(id)
+			continue
+		}
+
+		// the products changed by the batch are indexed again as they were
+		if len(rl) > n {
+			revisions[id] = rl[:n]
+
+			if i := productIndexByID(id); i >= 0 {
+				indexProduct(productList[i])
+			}
+		}
+	}
+
+	outbox = outbox[:s.outbox]
+	outboxSeq = s.outboxSeq
+}
@@ -0,0 +1,78 @@
+package data
+
+import (
+	"testing"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestProductBatchAtomicRollsBack(t *testing.T) {
+	eb := NewProductEventBroker(10)
+	pdb := NewProductDB(hclog.NewNullLogger(), nil, eb)
+
+	_, ch, cancel := eb.Subscribe(0)
+	defer cancel()
+
+	productLock.RLock()
+	products, outboxLen := len(productList), len(outbox)
+	productLock.RUnlock()
+
+	ops := []BatchOperation{
+		{Op: BatchCreate, Product: &Product{Name: "Lungo", Price: Money{Amount: 210, Currency: "EUR"}, SKU: "bat-lun-one"}},
+		{Op: BatchUpdate, ID: 1, Version: 1, Product: &Product{Name: "Latte", Price: Money{Amount: 250, Currency: "EUR"}, SKU: "cof-lat-std"}},
+		{Op: BatchDelete, ID: 1000},
+		{Op: BatchDelete, ID: 2},
+	}
+
+	results, committed := pdb.ProductBatch(ops, true, "sync")
+
+	assert.False(t, committed)
+	assert.Equal(t, ErrBatchRolledBack, results[0].Err)
+	assert.Equal(t, ErrBatchRolledBack, results[1].Err)
+	assert.Equal(t, ErrProductNotFound, results[2].Err)
+	assert.Equal(t, ErrBatchNotExecuted, results[3].Err)
+
+	productLock.RLock()
+	assert.Len(t, productList, products)
+	assert.Len(t, outbox, outboxLen)
+	productLock.RUnlock()
+
+	pg, err := pdb.ProductGetByID(1, "", false)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, pg.Version)
+
+	h, _ := pdb.ProductHistory(1)
+	assert.Len(t, h, 1)
+
+	// the events of the rolled back changes are not sent
+	assert.Len(t, ch, 0)
+}
+
+func TestProductBatchBestEffort(t *testing.T) {
+	pdb := NewProductDB(hclog.NewNullLogger(), nil, nil)
+
+	ops := []BatchOperation{
+		{Op: BatchCreate, Product: &Product{Name: "Lungo", Price: Money{Amount: 210, Currency: "EUR"}, SKU: "abc-abc-abc"}},
+		{Op: BatchCreate, Product: &Product{Name: "Lu", Price: Money{Amount: 210, Currency: "EUR"}, SKU: "abc-abc-abc"}},
+		{Op: BatchUpdate, ID: 2},
+		{Op: "replace"},
+	}
+
+	results, committed := pdb.ProductBatch(ops, false, "sync")
+
+	assert.True(t, committed)
+	assert.NoError(t, results[0].Err)
+	assert.Equal(t, 1, results[0].Version)
+	assert.NotNil(t, ValidationFieldErrors(results[1].Err))
+	assert.Equal(t, ErrMissingBatchProduct, results[2].Err)
+	assert.Equal(t, ErrInvalidBatchOperation, results[3].Err)
+
+	// the created product is kept and removed from the data store shared with the other tests
+	results, committed = pdb.ProductBatch([]BatchOperation{{Op: BatchDelete, ID: results[0].ID, Version: 1}}, true, "sync")
+
+	assert.True(t, committed)
+	assert.NoError(t, results[0].Err)
+	assert.Equal(t, 2, results[0].Version)
+	pdb.ProductPurge(0)
+}
@@ -0,0 +1,115 @@
+package data
+
+import (
+	"sync"
+	"time"
+)
+
+// ProductEventType is the kind of change of a product event
+type ProductEventType string
+
+const (
+	ProductCreated ProductEventType = "created"
+	ProductUpdated ProductEventType = "updated"
+	ProductDeleted ProductEventType = "deleted"
+)
+
+// subscriberBuffer is the number of events queued for a slow subscriber
+// before it is disconnected
+const subscriberBuffer = 64
+
+// ProductEvent describes a change of a product
+// swagger:model
+type ProductEvent struct {
+	// sequential id of the event
+	ID uint64 `json:"id"`
+	// kind of change: created, updated or deleted
+	Type ProductEventType `json:"type"`
+	// id of the changed product
+	ProductID int `json:"product_id"`
+	// version of the product after the change
+	Version int `json:"version"`
+	// time of the change
+	Time time.Time `json:"time"`
+	// the revision restored by the change, when it is a revert
+	RevertedFrom int `json:"reverted_from,omitempty"`
+	// the product after the change
+	Product *Product `json:"product"`
+}
+
+// ProductEventBroker delivers the product events to the subscribers and keeps
+// the latest events in a ring buffer, so subscribers can resume after a disconnection
+type ProductEventBroker struct {
+	mu          sync.Mutex
+	buffer      []ProductEvent
+	next        int
+	full        bool
+	subscribers map[chan ProductEvent]struct{}
+}
+
+// NewProductEventBroker creates a broker keeping the latest size events
+func NewProductEventBroker(size int) *ProductEventBroker {
+	return &ProductEventBroker{
+		buffer:      make([]ProductEvent, size),
+		subscribers: map[chan ProductEvent]struct{}{},
+	}
+}
+
+// Publish delivers the event to the subscribers, the events are published in the order
+// of their ids. The product of the event is shared with the subscribers and must not change
+func (b *ProductEventBroker) Publish(e ProductEvent) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.buffer[b.next] = e
+	b.next = (b.next + 1) % len(b.buffer)
+	b.full = b.full || b.next == 0
+
+	for ch := range b.subscribers {
+		select {
+		case ch <- e:
+		default:
+			// the subscriber is not keeping up, it can resume from its last event
+			delete(b.subscribers, ch)
+			close(ch)
+		}
+	}
+}
+
+// Subscribe returns the buffered events after lastID and a channel receiving the
+// new events. The channel is closed when the subscriber falls behind or cancel is called
+func (b *ProductEventBroker) Subscribe(lastID uint64) ([]ProductEvent, <-chan ProductEvent, func()) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	backlog := []ProductEvent{}
+	for _, e := range b.buffered() {
+		if e.ID > lastID {
+			backlog = append(backlog, e)
+		}
+	}
+
+	ch := make(chan ProductEvent, subscriberBuffer)
+	b.subscribers[ch] = struct{}{}
+
+	cancel := func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+
+		if _, ok := b.subscribers[ch]; ok {
+			delete(b.subscribers, ch)
+			close(ch)
+		}
+	}
+
+	return backlog, ch, cancel
+}
+
+// buffered returns the events of the ring buffer from the oldest to the newest
+func (b *ProductEventBroker) buffered() []ProductEvent {
+	if !b.full {
+		return b.buffer[:b.next]
+	}
+
+	return append(append([]ProductEvent{}, b.buffer[b.next:]...), b.buffer[:b.next]...)
+}
@@ -0,0 +1,91 @@
+package data
+
+import (
+	"testing"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestProductEventBrokerResume(t *testing.T) {
+	b := NewProductEventBroker(3)
+
+	for i := 1; i <= 5; i++ {
+		b.Publish(ProductEvent{ID: uint64(i), Type: ProductUpdated, ProductID: i, Version: i, Product: &Product{ID: i, Version: i}})
+	}
+
+	// the ring buffer only keeps the latest 3 events
+	backlog, _, cancel := b.Subscribe(0)
+	defer cancel()
+
+	assert.Len(t, backlog, 3)
+	assert.Equal(t, uint64(3), backlog[0].ID)
+	assert.Equal(t, uint64(5), backlog[2].ID)
+
+	backlog, _, cancel2 := b.Subscribe(4)
+	defer cancel2()
+
+	assert.Len(t, backlog, 1)
+	assert.Equal(t, 5, backlog[0].ProductID)
+}
+
+func TestProductEventBrokerSubscribe(t *testing.T) {
+	b := NewProductEventBroker(10)
+	_, ch, cancel := b.Subscribe(0)
+
+	b.Publish(ProductEvent{ID: 7, Type: ProductCreated, ProductID: 1, Version: 1, Product: &Product{ID: 1, Name: "Latte", Version: 1}})
+
+	e := <-ch
+	assert.Equal(t, ProductCreated, e.Type)
+	assert.Equal(t, uint64(7), e.ID)
+	assert.Equal(t, "Latte", e.Product.Name)
+
+	cancel()
+	_, ok := <-ch
+	assert.False(t, ok)
+
+	// cancelling twice is safe
+	cancel()
+}
+
+func TestProductEventBrokerSlowSubscriber(t *testing.T) {
+	b := NewProductEventBroker(10)
+	_, ch, cancel := b.Subscribe(0)
+	defer cancel()
+
+	for i := 0; i < subscriberBuffer+1; i++ {
+		b.Publish(ProductEvent{ID: uint64(i + 1), Type: ProductUpdated, ProductID: 1, Product: &Product{ID: 1}})
+	}
+
+	n := 0
+	for range ch {
+		n++
+	}
+
+	// the channel is closed once the subscriber falls behind
+	assert.Equal(t, subscriberBuffer, n)
+}
+
+func TestProductEventBrokerDeliversOutbox(t *testing.T) {
+	b := NewProductEventBroker(10)
+	pdb := NewProductDB(hclog.NewNullLogger(), nil, b)
+
+	_, ch, cancel := b.Subscribe(0)
+	defer cancel()
+
+	pr := &Product{Name: "Galao", Price: Money{Amount: 270, Currency: "EUR"}, SKU: "eve-gal-one"}
+	assert.NoError(t, pdb.ProductAdd(pr, "test"))
+
+	// the event is the outbox entry of the change, with its sequence as id
+	e := <-ch
+	el := pendingFor(pdb, pr.ID)
+
+	assert.Len(t, el, 1)
+	assert.Equal(t, el[0].Event.ID, e.ID)
+	assert.Equal(t, ProductCreated, e.Type)
+	assert.Equal(t, "Galao", e.Product.Name)
+
+	// remove the product from the data store shared with the other tests
+	assert.NoError(t, pdb.ProductDelete(pr.ID, 0, "test"))
+	pdb.ProductPurge(0)
+}
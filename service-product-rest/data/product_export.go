@@ -0,0 +1,75 @@
+package data
+
+import (
+	"encoding/csv"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Content types of the product import and export
+const (
+	CSVContentType    = "text/csv"
+	NDJSONContentType = "application/x-ndjson"
+)
+
+// csvColumns are the columns of the CSV exports, the imports ignore the id and version columns
+var csvColumns = []string{"id", "name", "description", "price", "currency", "sku", "category_id", "tags", "version"}
+
+// csvTagSeparator separates the tags in the tags column of the CSV
+const csvTagSeparator = "|"
+
+// ProductExport returns the products which are not deleted ordered by id, with their
+// effective prices in the price list at the instant converted to the given currency
+func (p *ProductDB) ProductExport(currency string, priceList string, at time.Time) (Products, error) {
+	productLock.RLock()
+
+	pl := Products{}
+	for _, pr := range productList {
+		if !pr.IsDeleted() {
+			np := *pr
+			resolvePrice(&np, priceList, at)
+			pl = append(pl, &np)
+		}
+	}
+
+	productLock.RUnlock()
+
+	rates := map[string]Rate{}
+
+	for _, np := range pl {
+		if err := p.convertPrice(np, currency, rates); err != nil {
+			return nil, err
+		}
+	}
+
+	q := &ProductQuery{Sort: "id"}
+	q.sort(pl)
+
+	return pl, nil
+}
+
+// WriteCSVHeader writes the header of a CSV export
+func WriteCSVHeader(w *csv.Writer) error {
+	return w.Write(csvColumns)
+}
+
+// WriteCSV writes the product as a row of a CSV export, the category is empty when the product has none
+func (p *Product) WriteCSV(w *csv.Writer) error {
+	category := ""
+	if p.CategoryID != 0 {
+		category = strconv.Itoa(p.CategoryID)
+	}
+
+	return w.Write([]string{
+		strconv.Itoa(p.ID),
+		p.Name,
+		p.Description,
+		p.Price.String(),
+		p.Price.Currency,
+		p.SKU,
+		category,
+		strings.Join(p.Tags, csvTagSeparator),
+		strconv.Itoa(p.Version),
+	})
+}
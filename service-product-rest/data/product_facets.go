@@ -0,0 +1,123 @@
+package data
+
+import (
+	"sort"
+)
+
+// CategoryFacet is the number of matching products in a category,
+// the products of the subcategories are counted in their ancestors too
+// swagger:model
+type CategoryFacet struct {
+	// the id of the category
+	ID int `json:"id" xml:"id"`
+	// the name of the category
+	Name string `json:"name" xml:"name"`
+	// the id of the parent category, absent on the root categories
+	ParentID int `json:"parent_id,omitempty" xml:"parent_id,omitempty"`
+	// the number of matching products
+	Count int `json:"count" xml:"count"`
+}
+
+// TagFacet is the number of matching products with a tag
+// swagger:model
+type TagFacet struct {
+	// the tag
+	Tag string `json:"tag" xml:"tag"`
+	// the number of matching products
+	Count int `json:"count" xml:"count"`
+}
+
+// ProductFacets are the counts of the matching products by category and tag,
+// ordered from the largest count
+// swagger:model
+type ProductFacets struct {
+	Categories []CategoryFacet `json:"categories" xml:"categories>category"`
+	Tags       []TagFacet      `json:"tags" xml:"tags>tag"`
+}
+
+// ProductPage is a page of products with the facets of all the matching products
+// swagger:model
+type ProductPage struct {
+	// the products of the page
+	Products Products `json:"products" xml:"products>product"`
+	// the number of matching products
+	Total int `json:"total" xml:"total"`
+	// the counts of the matching products by category and tag
+	Facets *ProductFacets `json:"facets" xml:"facets,omitempty"`
+}
+
+// A page of products with the facet counts, returned when the facets are requested
+// swagger:response productPageResponse
+type productPageResponseWrapper struct {
+	// in: body
+	Body ProductPage
+}
+
+// ProductListFacets returns the page of products matching the query like ProductList,
+// along with the facet counts of all the matching products
+func (p *ProductDB) ProductListFacets(currency string, q *ProductQuery) (*ProductPage, error) {
+	// the facets are counted with the categories read along with the products
+	categories := map[int]Category{}
+	pr, err := p.matchProducts(currency, q, categories)
+
+	if err != nil {
+		return nil, err
+	}
+
+	q.sort(pr)
+
+	return &ProductPage{Products: q.page(pr), Total: len(pr), Facets: productFacets(pr, categories)}, nil
+}
+
+// productFacets counts the products by category, including the ancestors, and by tag
+func productFacets(pl Products, categories map[int]Category) *ProductFacets {
+	cc := map[int]int{}
+	tc := map[string]int{}
+
+	for _, pr := range pl {
+		// the category of a deleted product may have been removed
+		for id := pr.CategoryID; id != 0; {
+			c, ok := categories[id]
+
+			if !ok {
+				break
+			}
+
+			cc[id]++
+			id = c.ParentID
+		}
+
+		for _, t := range pr.Tags {
+			tc[t]++
+		}
+	}
+
+	f := &ProductFacets{Categories: []CategoryFacet{}, Tags: []TagFacet{}}
+
+	for id, n := range cc {
+		c := categories[id]
+		f.Categories = append(f.Categories, CategoryFacet{ID: c.ID, Name: c.Name, ParentID: c.ParentID, Count: n})
+	}
+
+	for t, n := range tc {
+		f.Tags = append(f.Tags, TagFacet{Tag: t, Count: n})
+	}
+
+	sort.Slice(f.Categories, func(i, j int) bool {
+		if f.Categories[i].Count != f.Categories[j].Count {
+			return f.Categories[i].Count > f.Categories[j].Count
+		}
+
+		return f.Categories[i].ID < f.Categories[j].ID
+	})
+
+	sort.Slice(f.Tags, func(i, j int) bool {
+		if f.Tags[i].Count != f.Tags[j].Count {
+			return f.Tags[i].Count > f.Tags[j].Count
+		}
+
+		return f.Tags[i].Tag < f.Tags[j].Tag
+	})
+
+	return f
+}
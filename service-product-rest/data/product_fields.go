@@ -0,0 +1,130 @@
+package data
+
+import (
+	"encoding/xml"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Related resources embedded in the products on request
+const (
+	// ExpandImages completes the attached images with their size and upload time
+	ExpandImages = "images"
+	// ExpandRate embeds the exchange rate used to convert the price
+	ExpandRate = "rate"
+)
+
+// swagger:parameters ListProducts GetProduct
+type productViewParameterWrapper struct {
+	// Comma separated product fields returned, like id,name,price, the expanded resources are always returned
+	// in: query
+	Fields string `json:"fields"`
+	// Comma separated related resources embedded in the products: images, the attached images with their size and upload time,
+	// and rate, the exchange rate used to convert the price
+	// in: query
+	Expand string `json:"expand"`
+}
+
+// productFieldIndex maps the names of the product fields, their json name, to their
+// index in the Product struct. The fields not serialized are left out
+var productFieldIndex = func() map[string]int {
+	t := reflect.TypeOf(Product{})
+	fm := map[string]int{}
+
+	for i := 0; i < t.NumField(); i++ {
+		name := strings.SplitN(t.Field(i).Tag.Get("json"), ",", 2)[0]
+
+		if name != "-" && name != "" {
+			fm[name] = i
+		}
+	}
+
+	return fm
+}()
+
+// projectionTypes caches the types of the projections by their fields
+var projectionTypes sync.Map
+
+// ProductFieldNames returns the names of the product fields in alphabetical order
+func ProductFieldNames() []string {
+	names := make([]string, 0, len(productFieldIndex))
+	for n := range productFieldIndex {
+		names = append(names, n)
+	}
+
+	sort.Strings(names)
+
+	return names
+}
+
+// ParseProductFields returns the product fields of the comma separated list, without
+// the duplicates. It returns an error naming the first unknown field
+func ParseProductFields(list string) ([]string, error) {
+	fields := []string{}
+	seen := map[string]bool{}
+
+	for _, f := range strings.Split(list, ",") {
+		f = strings.TrimSpace(f)
+
+		if _, ok := productFieldIndex[f]; !ok {
+			return nil, fmt.Errorf("Invalid field %q, it must be one of %s", f, strings.Join(ProductFieldNames(), ", "))
+		}
+
+		if !seen[f] {
+			seen[f] = true
+			fields = append(fields, f)
+		}
+	}
+
+	return fields, nil
+}
+
+// Project returns a copy of the product with only the given fields, in the order of the
+// Product struct. The copy is serialized like the product to JSON and to XML
+func (p *Product) Project(fields []string) interface{} {
+	t := projectionType(fields)
+	v := reflect.New(t).Elem()
+	src := reflect.ValueOf(p).Elem()
+
+	// the first field is the XML name
+	for i := 1; i < t.NumField(); i++ {
+		v.Field(i).Set(src.FieldByName(t.Field(i).Name))
+	}
+
+	return v.Addr().Interface()
+}
+
+// projectionType returns the struct type with the product fields, they must be valid
+func projectionType(fields []string) reflect.Type {
+	idx := make([]int, 0, len(fields))
+	for _, f := range fields {
+		idx = append(idx, productFieldIndex[f])
+	}
+
+	sort.Ints(idx)
+
+	key := fmt.Sprint(idx)
+
+	if t, ok := projectionTypes.Load(key); ok {
+		return t.(reflect.Type)
+	}
+
+	pt := reflect.TypeOf(Product{})
+	sf := []reflect.StructField{{
+		Name: "XMLName",
+		Type: reflect.TypeOf(xml.Name{}),
+		Tag:  `json:"-" xml:"product"`,
+	}}
+
+	for _, i := range idx {
+		f := pt.Field(i)
+		sf = append(sf, reflect.StructField{Name: f.Name, Type: f.Type, Tag: f.Tag})
+	}
+
+	t, _ := projectionTypes.LoadOrStore(key, reflect.StructOf(sf))
+
+	return t.(reflect.Type)
+}
@@ -0,0 +1,36 @@
+package data
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseProductFields(t *testing.T) {
+	fields, err := ParseProductFields("name, id,name")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"name", "id"}, fields)
+
+	_, err = ParseProductFields("id,created_on")
+	assert.Error(t, err)
+
+	_, err = ParseProductFields("")
+	assert.Error(t, err)
+}
+
+func TestProductProject(t *testing.T) {
+	pr := &Product{ID: 7, Name: "Latte", Description: "Milky", Price: Money{Amount: 245, Currency: "EUR"}, Tags: []string{"milk"}}
+
+	b, err := json.Marshal(pr.Project([]string{"price", "id", "tags"}))
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"id": 7, "price": {"amount": "2.45", "currency": "EUR"}, "tags": ["milk"]}`, string(b))
+
+	b, err = xml.Marshal(pr.Project([]string{"name", "id"}))
+	assert.NoError(t, err)
+	assert.Equal(t, `<product><id>7</id><name>Latte</name></product>`, string(b))
+
+	// the projections with the same fields share their type
+	assert.IsType(t, pr.Project([]string{"id", "name"}), pr.Project([]string{"name", "id"}))
+}
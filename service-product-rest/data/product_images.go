@@ -0,0 +1,278 @@
+package data
+
+import (
+	"fmt"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/go-playground/validator/v10"
+)
+
+var ErrImageNotFound = fmt.Errorf("Image not found")
+var ErrInvalidImageFilename = fmt.Errorf("Filename must be letters with a 3 letters extension, like front.png")
+var ErrTooManyImages = fmt.Errorf("A product has at most %d images", maxProductImages)
+
+// imageFilenamePattern is the format of the filenames the image service stores
+var imageFilenamePattern = regexp.MustCompile(`^[a-zA-Z]+\.[a-z]{3}$`)
+
+// maxProductImages is the max number of images attached to a product
+const maxProductImages = 20
+
+// ProductImage is an image of a product stored by the image service
+// swagger:model
+type ProductImage struct {
+	// the name of the image file
+	Filename string `json:"filename" xml:"filename"`
+	// the URL of the image in the image service
+	URL string `json:"url" xml:"url"`
+	// the text describing the image
+	Alt string `json:"alt" xml:"alt" validate:"max=150"`
+	// the image shown first, a product with images has exactly one primary image
+	Primary bool `json:"primary" xml:"primary"`
+	// the position of the image in the images of the product starting at 1, when it
+	// is 0 the image is added at the end or keeps its position
+	Position int `json:"position" xml:"position" validate:"gte=0"`
+	// the size of the image in bytes, only returned when the images are expanded
+	Size int64 `json:"size,omitempty" xml:"size,omitempty"`
+	// the last time the image was uploaded, only returned when the images are expanded
+	ModifiedOn *time.Time `json:"modified_on,omitempty" xml:"modified_on,omitempty"`
+}
+
+// The images attached to a product, in their order
+// swagger:response productImagesResponse
+type productImagesResponseWrapper struct {
+	// in: body
+	Body []ProductImage
+}
+
+// An image attached to a product
+// swagger:response productImageResponse
+type productImageResponseWrapper struct {
+	// in: body
+	Body ProductImage
+}
+
+// swagger:parameters ListProductImages PutProductImage DeleteProductImage
+type productImageProductIDParameterWrapper struct {
+	// The id of the product
+	// in: path
+	// required: true
+	ID int `json:"id"`
+}
+
+// swagger:parameters PutProductImage DeleteProductImage
+type productImageFilenameParameterWrapper struct {
+	// The name of the image file in the image service, like front.png
+	// in: path
+	// required: true
+	Filename string `json:"filename"`
+}
+
+// swagger:parameters PutProductImage
+type productImageParameterWrapper struct {
+	// in: body
+	Body ProductImage
+}
+
+// imageCleanups keeps the ids of the purged products whose images must be removed
+// from the image service, it is guarded by productLock
+var imageCleanups = map[int]bool{}
+
+// ValidImageFilename returns true when the filename can be stored by the image service
+func ValidImageFilename(filename string) bool {
+	return imageFilenamePattern.MatchString(filename)
+}
+
+// Validate checks the fields of the image
+func (i *ProductImage) Validate() error {
+	i.Alt = strings.TrimSpace(i.Alt)
+
+	validate := validator.New()
+
+	// report the fields by their json name
+	validate.RegisterTagNameFunc(func(f reflect.StructField) string {
+		return strings.SplitN(f.Tag.Get("json"), ",", 2)[0]
+	})
+
+	return validate.Struct(i)
+}
+
+// ProductImageList returns the images attached to the product in their order
+func (p *ProductDB) ProductImageList(productID int) ([]ProductImage, error) {
+	productLock.RLock()
+	defer productLock.RUnlock()
+
+	i := productIndexByID(productID)
+
+	if i < 0 || productList[i].IsDeleted() {
+		return nil, ErrProductNotFound
+	}
+
+	il := make([]ProductImage, len(productList[i].Images))
+	copy(il, productList[i].Images)
+
+	return il, nil
+}
+
+// ProductImagePut attaches the image to the product or replaces its alt text, position and
+// primary flag when it is attached. The first image attached is the primary one, making an
+// image primary unsets the previous one. The image is updated with its stored values and
+// true is returned when it was attached. The change is recorded as a product update
+func (p *ProductDB) ProductImagePut(productID int, img *ProductImage, actor string) (bool, error) {
+	if !ValidImageFilename(img.Filename) {
+		return false, ErrInvalidImageFilename
+	}
+
+	productLock.Lock()
+	defer productLock.Unlock()
+
+	i := productIndexByID(productID)
+
+	if i < 0 || productList[i].IsDeleted() {
+		return false, ErrProductNotFound
+	}
+
+	il := []ProductImage{}
+	wasPrimary := false
+	at := -1
+
+	for j, pi := range productList[i].Images {
+		if pi.Filename == img.Filename {
+			wasPrimary = pi.Primary
+			at = j
+			continue
+		}
+
+		il = append(il, pi)
+	}
+
+	added := at < 0
+
+	if added && len(il) >= maxProductImages {
+		return false, ErrTooManyImages
+	}
+
+	ni := *img
+	ni.Size = 0
+	ni.ModifiedOn = nil
+
+	// the primary image stays primary unless another image is made primary
+	if ni.Primary || len(il) == 0 || wasPrimary {
+		for j := range il {
+			il[j].Primary = false
+		}
+
+		ni.Primary = true
+	}
+
+	// an attached image keeps its position when none is given
+	pos := ni.Position - 1
+	if pos < 0 && !added {
+		pos = at
+	}
+
+	if pos < 0 || pos > len(il) {
+		pos = len(il)
+	}
+
+	il = append(il, ProductImage{})
+	copy(il[pos+1:], il[pos:])
+	il[pos] = ni
+
+	updateImages(i, il, actor)
+	p.notify()
+
+	*img = il[pos]
+
+	return added, nil
+}
+
+// ProductImageDelete detaches the image from the product, the first of the remaining images
+// becomes the primary one when the primary image is detached. The change is recorded as a
+// product update, the image file is kept by the image service
+func (p *ProductDB) ProductImageDelete(productID int, filename string, actor string) error {
+	productLock.Lock()
+	defer productLock.Unlock()
+
+	i := productIndexByID(productID)
+
+	if i < 0 || productList[i].IsDeleted() {
+		return ErrProductNotFound
+	}
+
+	il := []ProductImage{}
+	found := false
+	primary := false
+
+	for _, pi := range productList[i].Images {
+		if pi.Filename == filename {
+			found = true
+			primary = pi.Primary
+			continue
+		}
+
+		il = append(il, pi)
+	}
+
+	if !found {
+		return ErrImageNotFound
+	}
+
+	if primary && len(il) > 0 {
+		il[0].Primary = true
+	}
+
+	updateImages(i, il, actor)
+	p.notify()
+
+	return nil
+}
+
+// updateImages replaces the images of the product at the index of productList, numbering
+// their positions. The product is copied so the stored revisions keep their images. It
+// must be called holding productLock and returns the recorded revision
+func updateImages(i int, il []ProductImage, actor string) *Revision {
+	for j := range il {
+		il[j].Position = j + 1
+	}
+
+	if len(il) == 0 {
+		il = nil
+	}
+
+	prev := productList[i]
+	pr := *prev
+	pr.Images = il
+	pr.Version++
+	pr.UpdatedOn = time.Now().UTC()
+	productList[i] = &pr
+
+	return record(ProductUpdated, prev, &pr, actor, 0)
+}
+
+// ImageCleanups returns the ids of the purged products whose images must be removed
+// from the image service, in ascending order
+func (p *ProductDB) ImageCleanups() []int {
+	productLock.RLock()
+	defer productLock.RUnlock()
+
+	ids := make([]int, 0, len(imageCleanups))
+	for id := range imageCleanups {
+		ids = append(ids, id)
+	}
+
+	sort.Ints(ids)
+
+	return ids
+}
+
+// ImageCleanupDone removes the purged product from the image cleanups once
+// its images were removed from the image service
+func (p *ProductDB) ImageCleanupDone(productID int) {
+	productLock.Lock()
+	delete(imageCleanups, productID)
+	productLock.Unlock()
+}
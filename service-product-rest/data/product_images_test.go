@@ -0,0 +1,96 @@
+package data
+
+import (
+	"testing"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestProductImagePut(t *testing.T) {
+	pdb := NewProductDB(hclog.NewNullLogger(), nil, nil)
+
+	pr := &Product{Name: "Flat white", Price: Money{Amount: 350, Currency: "EUR"}, SKU: "img-fla-whi"}
+	assert.NoError(t, pdb.ProductAdd(pr, "test"))
+
+	filenames := func() []string {
+		il, err := pdb.ProductImageList(pr.ID)
+		assert.NoError(t, err)
+
+		fl := []string{}
+		for _, img := range il {
+			if img.Primary {
+				fl = append(fl, "*"+img.Filename)
+				continue
+			}
+
+			fl = append(fl, img.Filename)
+		}
+
+		return fl
+	}
+
+	for _, fn := range []string{"front.png", "back.png", "side.png"} {
+		added, err := pdb.ProductImagePut(pr.ID, &ProductImage{Filename: fn}, "test")
+		assert.NoError(t, err)
+		assert.True(t, added)
+	}
+
+	assert.Equal(t, []string{"*front.png", "back.png", "side.png"}, filenames())
+
+	// the primary image stays primary when it moves
+	img := &ProductImage{Filename: "front.png", Alt: "Front", Position: 3}
+	added, err := pdb.ProductImagePut(pr.ID, img, "test")
+	assert.NoError(t, err)
+	assert.False(t, added)
+	assert.True(t, img.Primary)
+	assert.Equal(t, 3, img.Position)
+	assert.Equal(t, []string{"back.png", "side.png", "*front.png"}, filenames())
+
+	// an image keeps its position when none is given
+	_, err = pdb.ProductImagePut(pr.ID, &ProductImage{Filename: "side.png", Primary: true}, "test")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"back.png", "*side.png", "front.png"}, filenames())
+
+	assert.NoError(t, pdb.ProductImageDelete(pr.ID, "side.png", "test"))
+	assert.Equal(t, []string{"*back.png", "front.png"}, filenames())
+	assert.Equal(t, ErrImageNotFound, pdb.ProductImageDelete(pr.ID, "side.png", "test"))
+
+	_, err = pdb.ProductImagePut(pr.ID, &ProductImage{Filename: "../side.png"}, "test")
+	assert.Equal(t, ErrInvalidImageFilename, err)
+
+	_, err = pdb.ProductImagePut(0, &ProductImage{Filename: "side.png"}, "test")
+	assert.Equal(t, ErrProductNotFound, err)
+
+	// the revisions keep the images they were recorded with
+	cur, err := pdb.ProductGetByID(pr.ID, "", false)
+	assert.NoError(t, err)
+
+	rv, err := pdb.ProductRevision(pr.ID, cur.Version-1)
+	assert.NoError(t, err)
+	assert.Len(t, rv.Product.Images, 3)
+	assert.Len(t, cur.Images, 2)
+
+	assert.NoError(t, pdb.ProductDelete(pr.ID, 0, "test"))
+	assert.Equal(t, 1, pdb.ProductPurge(0))
+	pdb.ImageCleanupDone(pr.ID)
+}
+
+func TestProductPurgeQueuesImageCleanups(t *testing.T) {
+	pdb := NewProductDB(hclog.NewNullLogger(), nil, nil)
+
+	pr := &Product{Name: "Cortado", Price: Money{Amount: 250, Currency: "EUR"}, SKU: "img-cor-tad"}
+	assert.NoError(t, pdb.ProductAdd(pr, "test"))
+
+	_, err := pdb.ProductImagePut(pr.ID, &ProductImage{Filename: "front.png"}, "test")
+	assert.NoError(t, err)
+	assert.NotContains(t, pdb.ImageCleanups(), pr.ID)
+
+	assert.NoError(t, pdb.ProductDelete(pr.ID, 0, "test"))
+	assert.Equal(t, 1, pdb.ProductPurge(0))
+
+	assert.Contains(t, pdb.ImageCleanups(), pr.ID)
+
+	pdb.ImageCleanupDone(pr.ID)
+	assert.NotContains(t, pdb.ImageCleanups(), pr.ID)
+}
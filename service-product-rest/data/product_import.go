@@ -0,0 +1,309 @@
+package data
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+var ErrMissingCSVColumn = fmt.Errorf("CSV header must have the name, price, currency and sku columns")
+var ErrInvalidImportMode = fmt.Errorf("Invalid import mode, it must be create or upsert")
+
+// maxNDJSONLine limits the size of a product line in the NDJSON imports
+const maxNDJSONLine = 1024 * 1024
+
+// ImportMode defines how the imported rows are stored
+type ImportMode string
+
+const (
+	// ImportCreate creates a product for every row
+	ImportCreate ImportMode = "create"
+	// ImportUpsert updates the product with the SKU of the row, creating it when there is none
+	ImportUpsert ImportMode = "upsert"
+)
+
+// Status of an imported row
+const (
+	ImportRowCreated = "created"
+	ImportRowUpdated = "updated"
+	ImportRowInvalid = "invalid"
+	ImportRowFailed  = "failed"
+)
+
+// ImportRow is the result of the import of a row
+// swagger:model
+type ImportRow struct {
+	// the number of the row, starting at 1 after the CSV header
+	Row int `json:"row"`
+	// created, updated, invalid or failed
+	Status string `json:"status"`
+	// the id of the created or updated product, absent on a dry run creation
+	ID int `json:"id,omitempty"`
+	// the SKU of the row
+	SKU string `json:"sku,omitempty"`
+	// the validation errors of an invalid row
+	Errors []FieldError `json:"errors,omitempty"`
+	// the reason of an invalid or failed row
+	Error string `json:"error,omitempty"`
+}
+
+// ImportReport is the result of a product import
+// swagger:model
+type ImportReport struct {
+	// the import did not change the products
+	DryRun bool `json:"dry_run"`
+	// create or upsert
+	Mode ImportMode `json:"mode"`
+	// the number of created products
+	Created int `json:"created"`
+	// the number of updated products
+	Updated int `json:"updated"`
+	// the number of invalid or failed rows
+	Failed int `json:"failed"`
+	// the result of each row
+	Rows []ImportRow `json:"rows"`
+	// the reason the import stopped before the end of the body, the rows
+	// reported before it were imported
+	Error string `json:"error,omitempty"`
+}
+
+// ProductReader reads the products of an import one at a time, it returns
+// io.EOF after the last product. An error wrapping ErrInvalidRow only affects
+// the current row and the reading can continue
+type ProductReader interface {
+	Read() (*Product, error)
+}
+
+var ErrInvalidRow = fmt.Errorf("Invalid row")
+
+// CSVProductReader reads the products from CSV rows with a header
+type CSVProductReader struct {
+	r       *csv.Reader
+	columns map[string]int
+}
+
+// NewCSVProductReader reads the header of the CSV, which must have the
+// name, price, currency and sku columns, description, category_id and tags,
+// separated by |, are optional
+func NewCSVProductReader(r io.Reader) (*CSVProductReader, error) {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+	cr.TrimLeadingSpace = true
+
+	header, err := cr.Read()
+
+	if err != nil {
+		return nil, ErrMissingCSVColumn
+	}
+
+	columns := map[string]int{}
+	for i, c := range header {
+		columns[strings.ToLower(strings.TrimSpace(c))] = i
+	}
+
+	for _, c := range []string{"name", "price", "currency", "sku"} {
+		if _, ok := columns[c]; !ok {
+			return nil, ErrMissingCSVColumn
+		}
+	}
+
+	return &CSVProductReader{cr, columns}, nil
+}
+
+// Read returns the product of the next CSV row
+func (c *CSVProductReader) Read() (*Product, error) {
+	rec, err := c.r.Read()
+
+	if err == io.EOF {
+		return nil, err
+	}
+
+	var pe *csv.ParseError
+	if errors.As(err, &pe) {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidRow, pe.Err)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	field := func(name string) string {
+		i, ok := c.columns[name]
+
+		if !ok || i >= len(rec) {
+			return ""
+		}
+
+		return strings.TrimSpace(rec[i])
+	}
+
+	price, err := NewMoney(field("price"), field("currency"))
+
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidRow, err)
+	}
+
+	category := 0
+	if s := field("category_id"); s != "" {
+		category, err = strconv.Atoi(s)
+
+		if err != nil {
+			return nil, fmt.Errorf("%w: invalid category_id %q", ErrInvalidRow, s)
+		}
+	}
+
+	var tags []string
+	if s := field("tags"); s != "" {
+		tags = strings.Split(s, csvTagSeparator)
+	}
+
+	return &Product{
+		Name:        field("name"),
+		Description: field("description"),
+		Price:       price,
+		SKU:         field("sku"),
+		CategoryID:  category,
+		Tags:        tags,
+	}, nil
+}
+
+// NDJSONProductReader reads the products from newline delimited JSON, one product per line
+type NDJSONProductReader struct {
+	s *bufio.Scanner
+}
+
+// NewNDJSONProductReader creates a reader of newline delimited JSON products
+func NewNDJSONProductReader(r io.Reader) *NDJSONProductReader {
+	s := bufio.NewScanner(r)
+	s.Buffer(make([]byte, 64*1024), maxNDJSONLine)
+
+	return &NDJSONProductReader{s}
+}
+
+// Read returns the product of the next line, the blank lines are not rows
+func (n *NDJSONProductReader) Read() (*Product, error) {
+	for n.s.Scan() {
+		line := n.s.Bytes()
+
+		if len(strings.TrimSpace(string(line))) == 0 {
+			continue
+		}
+
+		pr := &Product{}
+
+		if err := json.Unmarshal(line, pr); err != nil {
+			return nil, fmt.Errorf("%w: %s", ErrInvalidRow, err)
+		}
+
+		return pr, nil
+	}
+
+	if err := n.s.Err(); err != nil {
+		return nil, err
+	}
+
+	return nil, io.EOF
+}
+
+// ProductImport validates and stores the products of the reader as they are read.
+// The rows are reported one by one, an invalid row does not stop the import.
+// On a dry run the rows are validated and reported without changing the products
+func (p *ProductDB) ProductImport(r ProductReader, mode ImportMode, dryRun bool, actor string) (*ImportReport, error) {
+	if mode != ImportCreate && mode != ImportUpsert {
+		return nil, ErrInvalidImportMode
+	}
+
+	rep := &ImportReport{DryRun: dryRun, Mode: mode, Rows: []ImportRow{}}
+
+	for n := 1; ; n++ {
+		pr, err := r.Read()
+
+		if err == io.EOF {
+			return rep, nil
+		}
+
+		if errors.Is(err, ErrInvalidRow) {
+			rep.add(ImportRow{Row: n, Status: ImportRowInvalid, Error: err.Error()})
+			continue
+		}
+
+		if err != nil {
+			rep.Error = err.Error()
+			return rep, err
+		}
+
+		rep.add(p.importProduct(n, pr, mode, dryRun, actor))
+	}
+}
+
+// importProduct validates and stores the product of a row
+func (p *ProductDB) importProduct(n int, pr *Product, mode ImportMode, dryRun bool, actor string) ImportRow {
+	row := ImportRow{Row: n, SKU: pr.SKU}
+
+	pr.Normalize()
+
+	if err := pr.Validate(); err != nil {
+		row.Status = ImportRowInvalid
+		row.Errors = ValidationFieldErrors(err)
+
+		if row.Errors == nil {
+			row.Error = err.Error()
+		}
+
+		return row
+	}
+
+	id := 0
+	if mode == ImportUpsert {
+		id = productIDBySKU(pr.SKU)
+	}
+
+	if id == 0 {
+		row.Status = ImportRowCreated
+
+		if !dryRun {
+			if err := p.ProductAdd(pr, actor); err != nil {
+				row.Status = ImportRowFailed
+				row.Error = err.Error()
+				return row
+			}
+
+			row.ID = pr.ID
+		}
+
+		return row
+	}
+
+	row.Status = ImportRowUpdated
+	row.ID = id
+
+	if !dryRun {
+		pr.ID = id
+
+		if err := p.ProductUpdate(pr, 0, actor); err != nil {
+			row.Status = ImportRowFailed
+			row.Error = err.Error()
+		}
+	}
+
+	return row
+}
+
+// add appends the row to the report and counts it
+func (rep *ImportReport) add(row ImportRow) {
+	switch row.Status {
+	case ImportRowCreated:
+		rep.Created++
+	case ImportRowUpdated:
+		rep.Updated++
+	default:
+		rep.Failed++
+	}
+
+	rep.Rows = append(rep.Rows, row)
+}
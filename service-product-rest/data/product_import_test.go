@@ -0,0 +1,116 @@
+package data
+
+import (
+	"bytes"
+	"encoding/csv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestProductImportCSV(t *testing.T) {
+	pdb := NewProductDB(hclog.NewNullLogger(), nil, nil)
+
+	body := `name,price,currency,sku,description,tags
+Affogato,3.50,EUR,imp-csv-one,with ice cream,Dessert|iced
+Af,3.50,EUR,imp-csv-two,,
+Irish,3.505,EUR,imp-csv-three,,
+"broken,1,EUR
+`
+
+	cr, err := NewCSVProductReader(strings.NewReader(body))
+	assert.NoError(t, err)
+
+	rep, err := pdb.ProductImport(cr, ImportCreate, false, "importer")
+
+	assert.NoError(t, err)
+	assert.Equal(t, 1, rep.Created)
+	assert.Equal(t, 3, rep.Failed)
+	assert.Len(t, rep.Rows, 4)
+
+	assert.Equal(t, ImportRowCreated, rep.Rows[0].Status)
+	assert.Equal(t, "name", rep.Rows[1].Errors[0].Field)
+	assert.Equal(t, ImportRowInvalid, rep.Rows[2].Status)
+	assert.Contains(t, rep.Rows[2].Error, ErrInvalidAmount.Error())
+	assert.Equal(t, ImportRowInvalid, rep.Rows[3].Status)
+
+	pg, err := pdb.ProductGetByID(rep.Rows[0].ID, "", false)
+	assert.NoError(t, err)
+	assert.Equal(t, "with ice cream", pg.Description)
+	assert.Equal(t, []string{"dessert", "iced"}, pg.Tags)
+
+	_, err = NewCSVProductReader(strings.NewReader("name,sku\n"))
+	assert.Equal(t, ErrMissingCSVColumn, err)
+
+	// remove the product from the data store shared with the other tests
+	assert.NoError(t, pdb.ProductDelete(pg.ID, 0, "test"))
+	pdb.ProductPurge(0)
+}
+
+func TestProductImportNDJSONUpsert(t *testing.T) {
+	pdb := NewProductDB(hclog.NewNullLogger(), nil, nil)
+
+	pr := &Product{Name: "Galao", Price: Money{Amount: 200, Currency: "EUR"}, SKU: "imp-json-one"}
+	pdb.ProductAdd(pr, "test")
+
+	body := `{"name": "Galao", "price": {"amount": "2.20", "currency": "EUR"}, "sku": "imp-json-one"}
+
+{"name": "Bica", "price": {"amount": "0.90", "currency": "EUR"}, "sku": "imp-json-two"}
+{"name": `
+
+	// a dry run reports the rows without changing the products
+	rep, err := pdb.ProductImport(NewNDJSONProductReader(strings.NewReader(body)), ImportUpsert, true, "importer")
+
+	assert.NoError(t, err)
+	assert.True(t, rep.DryRun)
+	assert.Equal(t, ImportRowUpdated, rep.Rows[0].Status)
+	assert.Equal(t, pr.ID, rep.Rows[0].ID)
+	assert.Equal(t, ImportRowCreated, rep.Rows[1].Status)
+	assert.Equal(t, 0, rep.Rows[1].ID)
+	assert.Equal(t, ImportRowInvalid, rep.Rows[2].Status)
+	assert.Equal(t, 3, rep.Rows[2].Row)
+	assert.Equal(t, 0, productIDBySKU("imp-json-two"))
+
+	rep, err = pdb.ProductImport(NewNDJSONProductReader(strings.NewReader(body)), ImportUpsert, false, "importer")
+
+	assert.NoError(t, err)
+	assert.Equal(t, 1, rep.Created)
+	assert.Equal(t, 1, rep.Updated)
+
+	pg, err := pdb.ProductGetByID(pr.ID, "", false)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(220), pg.Price.Amount)
+	assert.Equal(t, 2, pg.Version)
+
+	_, err = pdb.ProductImport(NewNDJSONProductReader(strings.NewReader(body)), "replace", false, "importer")
+	assert.Equal(t, ErrInvalidImportMode, err)
+
+	// remove the products from the data store shared with the other tests
+	assert.NoError(t, pdb.ProductDelete(pr.ID, 0, "test"))
+	assert.NoError(t, pdb.ProductDelete(rep.Rows[1].ID, 0, "test"))
+	pdb.ProductPurge(0)
+}
+
+func TestProductExportCSV(t *testing.T) {
+	pdb := NewProductDB(hclog.NewNullLogger(), nil, nil)
+
+	pl, err := pdb.ProductExport("", DefaultPriceList, time.Now().UTC())
+	assert.NoError(t, err)
+
+	b := &bytes.Buffer{}
+	w := csv.NewWriter(b)
+	assert.NoError(t, WriteCSVHeader(w))
+
+	for _, pr := range pl {
+		assert.NoError(t, pr.WriteCSV(w))
+	}
+
+	w.Flush()
+
+	lines := strings.Split(strings.TrimSpace(b.String()), "\n")
+	assert.Equal(t, "id,name,description,price,currency,sku,category_id,tags,version", lines[0])
+	assert.Equal(t, "1,Latte,Frothy milky coffee,2.45,EUR,cof-lat-std,,,1", lines[1])
+}
@@ -0,0 +1,57 @@
+package data
+
+import (
+	"encoding/json"
+	"fmt"
+
+	jsonpatch "github.com/evanphx/json-patch/v5"
+)
+
+// Content types accepted by the product patch
+const (
+	MergePatchContentType = "application/merge-patch+json"
+	JSONPatchContentType  = "application/json-patch+json"
+)
+
+var ErrUnsupportedPatch = fmt.Errorf("Unsupported patch content type")
+
+// Patch returns a copy of the product with the patch applied, contentType
+// selects between JSON Merge Patch (RFC 7396) and JSON Patch (RFC 6902).
+// The id of the product can not be changed by the patch and the result
+// must be validated before being saved
+func (p *Product) Patch(contentType string, patch []byte) (*Product, error) {
+	doc, err := json.Marshal(p)
+
+	if err != nil {
+		return nil, err
+	}
+
+	switch contentType {
+	case MergePatchContentType:
+		doc, err = jsonpatch.MergePatch(doc, patch)
+	case JSONPatchContentType:
+		var jp jsonpatch.Patch
+		jp, err = jsonpatch.DecodePatch(patch)
+
+		if err == nil {
+			doc, err = jp.Apply(doc)
+		}
+	default:
+		return nil, ErrUnsupportedPatch
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	np := &Product{}
+	err = json.Unmarshal(doc, np)
+
+	if err != nil {
+		return nil, err
+	}
+
+	np.ID = p.ID
+
+	return np, nil
+}
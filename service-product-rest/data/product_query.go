@@ -0,0 +1,236 @@
+package data
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// DefaultPageLimit is the page size used when the query does not define one
+const DefaultPageLimit = 20
+
+// MaxPageLimit is the largest page size a client can request
+const MaxPageLimit = 100
+
+var ErrInvalidSort = fmt.Errorf("Invalid sort field")
+var ErrInvalidLimit = fmt.Errorf("Invalid limit")
+var ErrInvalidPriceRange = fmt.Errorf("Invalid price range")
+var ErrInvalidCategory = fmt.Errorf("Invalid category")
+var ErrPriceCurrencyRequired = fmt.Errorf("The currency is required to filter or sort by price")
+
+// productSorters maps the fields accepted by the sort parameter to
+// the function comparing two products by that field
+var productSorters = map[string]func(a, b *Product) bool{
+	"id":      func(a, b *Product) bool { return a.ID < b.ID },
+	"name":    func(a, b *Product) bool { return strings.ToLower(a.Name) < strings.ToLower(b.Name) },
+	"price":   func(a, b *Product) bool { return a.Price.Float64() < b.Price.Float64() },
+	"created": func(a, b *Product) bool { return a.CreatedOn.Before(b.CreatedOn) },
+}
+
+// swagger:parameters ListProducts
+type productQueryParameterWrapper struct {
+	// Substring of the product name in the language of the response, case insensitive
+	// in: query
+	Name string `json:"name"`
+	// SKU of the product
+	// in: query
+	SKU string `json:"sku"`
+	// Minimum price, expressed in the requested currency
+	// in: query
+	MinPrice float64 `json:"min_price"`
+	// Maximum price, expressed in the requested currency
+	// in: query
+	MaxPrice float64 `json:"max_price"`
+	// Id of a category, the products of its subcategories are listed too
+	// in: query
+	Category int `json:"category"`
+	// Tags the products must all have, repeated or separated by commas
+	// in: query
+	Tags []string `json:"tag"`
+	// Return the page with the facet counts by category and tag of the matching products
+	// in: query
+	Facets bool `json:"facets"`
+	// Field used to sort the list (id, name, price or created), prefix with - for descending order.
+	// The names are sorted in the language of the response
+	// in: query
+	Sort string `json:"sort"`
+	// Max number of products in the page
+	// in: query
+	Limit int `json:"limit"`
+	// Cursor of the page returned in the Link header
+	// in: query
+	Cursor string `json:"cursor"`
+	// Currency code used to convert the prices, required to filter or sort by price
+	// in: query
+	Currency string `json:"currency"`
+	// The price list of the prices, the default price list when absent
+	// in: query
+	PriceList string `json:"price_list"`
+	// The RFC 3339 instant of the prices, the current time when absent
+	// in: query
+	At string `json:"at"`
+	// List the deleted products too, only for the administrators
+	// in: query
+	IncludeDeleted bool `json:"include_deleted"`
+}
+
+// ProductQuery defines the filters, sort order and page used to list products
+type ProductQuery struct {
+	// Name matches products containing the value in the name, case insensitive
+	Name string
+	// SKU matches products with exactly this SKU
+	SKU string
+	// MinPrice and MaxPrice bound the price, zero means no bound
+	MinPrice float64
+	MaxPrice float64
+	// Category matches products in the category or in its subcategories
+	Category int
+	// Tags matches products having all the tags
+	Tags []string
+	// Sort is the field used to order the list, prefixed with - for descending order
+	Sort string
+	// Offset is the number of matching products skipped before the page
+	Offset int
+	// Limit is the max number of products in the page
+	Limit int
+	// IncludeDeleted lists the soft deleted products too
+	IncludeDeleted bool
+	// PriceList and At select the effective prices the products are filtered, sorted and
+	// returned with, the prices of the default price list at the current time when unset
+	PriceList string
+	At        time.Time
+	// Locales is the chain the names and descriptions of the listed products are translated
+	// with before they are filtered and sorted, the default locale when empty
+	Locales []string
+
+	// categories is the subtree of Category, resolved when the products are read
+	categories map[int]bool
+}
+
+// Validate checks the query values
+func (q *ProductQuery) Validate() error {
+	if _, ok := productSorters[strings.TrimPrefix(q.Sort, "-")]; q.Sort != "" && !ok {
+		return ErrInvalidSort
+	}
+
+	if q.Limit < 0 || q.Limit > MaxPageLimit || q.Offset < 0 {
+		return ErrInvalidLimit
+	}
+
+	if q.MinPrice < 0 || q.MaxPrice < 0 || (q.MaxPrice > 0 && q.MinPrice > q.MaxPrice) {
+		return ErrInvalidPriceRange
+	}
+
+	if q.Category < 0 {
+		return ErrInvalidCategory
+	}
+
+	q.Tags = NormalizeTags(q.Tags)
+
+	return nil
+}
+
+// priceAt returns the instant of the effective prices, the current time when At is not set
+func (q *ProductQuery) priceAt() time.Time {
+	if q.At.IsZero() {
+		return time.Now().UTC()
+	}
+
+	return q.At
+}
+
+// PageLimit returns the page size, applying the default when none was requested
+func (q *ProductQuery) PageLimit() int {
+	if q.Limit == 0 {
+		return DefaultPageLimit
+	}
+
+	return q.Limit
+}
+
+// resolveCategories reads the subtree of the category filter, it must be called holding productLock
+func (q *ProductQuery) resolveCategories() error {
+	if q.Category == 0 {
+		return nil
+	}
+
+	if categoryIndexByID(q.Category) < 0 {
+		return ErrCategoryNotFound
+	}
+
+	q.categories = categorySubtree(q.Category)
+
+	return nil
+}
+
+// checkCurrency returns an error when the prices are compared without a currency, the
+// products may have different base currencies so their prices must be converted first
+func (q *ProductQuery) checkCurrency(currency string) error {
+	if currency != "" {
+		return nil
+	}
+
+	if q.MinPrice > 0 || q.MaxPrice > 0 || strings.TrimPrefix(q.Sort, "-") == "price" {
+		return ErrPriceCurrencyRequired
+	}
+
+	return nil
+}
+
+func (q *ProductQuery) match(p *Product) bool {
+	if q.Name != "" && !strings.Contains(strings.ToLower(p.Name), strings.ToLower(q.Name)) {
+		return false
+	}
+
+	if q.SKU != "" && p.SKU != NormalizeSKU(q.SKU) {
+		return false
+	}
+
+	if q.MinPrice > 0 && p.Price.Float64() < q.MinPrice {
+		return false
+	}
+
+	if q.MaxPrice > 0 && p.Price.Float64() > q.MaxPrice {
+		return false
+	}
+
+	if q.Category != 0 && !q.categories[p.CategoryID] {
+		return false
+	}
+
+	return p.hasTags(q.Tags)
+}
+
+func (q *ProductQuery) sort(pl Products) {
+	field := strings.TrimPrefix(q.Sort, "-")
+	desc := strings.HasPrefix(q.Sort, "-")
+
+	less, ok := productSorters[field]
+
+	if !ok {
+		less = productSorters["id"]
+	}
+
+	sort.SliceStable(pl, func(i, j int) bool {
+		if desc {
+			return less(pl[j], pl[i])
+		}
+
+		return less(pl[i], pl[j])
+	})
+}
+
+func (q *ProductQuery) page(pl Products) Products {
+	if q.Offset >= len(pl) {
+		return Products{}
+	}
+
+	end := q.Offset + q.PageLimit()
+
+	if end > len(pl) {
+		end = len(pl)
+	}
+
+	return pl[q.Offset:end]
+}
@@ -0,0 +1,194 @@
+package data
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/CharlesSchiavinato/go-microservices/service-product-rest/search"
+)
+
+var ErrEmptySearch = fmt.Errorf("Search must have at least a word")
+
+// Boosts of the indexed product fields, a match in the name weighs more than in the description
+const (
+	searchNameBoost        = 2
+	searchDescriptionBoost = 1
+)
+
+// searchSnippetWords is the max number of words of the description snippets
+const searchSnippetWords = 20
+
+// SearchResult is a product matching a search
+// swagger:model
+type SearchResult struct {
+	// the matching product
+	Product *Product `json:"product"`
+	// the relevance of the product, the higher the more relevant
+	Score float64 `json:"score"`
+	// the name and a snippet of the description with the matching words in <em> tags, HTML escaped
+	Highlights map[string]string `json:"highlights,omitempty"`
+}
+
+// The products matching a search, from the most relevant
+// swagger:response productSearchResponse
+type productSearchResponseWrapper struct {
+	// in: body
+	Body []SearchResult
+}
+
+// swagger:parameters SearchProducts
+type productSearchParameterWrapper struct {
+	// Words to search in the name and description of the products, the last
+	// word is matched as a prefix unless the text ends with a space
+	// in: query
+	// required: true
+	Q string `json:"q"`
+	// Id of a category, the products of its subcategories are searched too
+	// in: query
+	Category int `json:"category"`
+	// Tags the products must all have, repeated or separated by commas
+	// in: query
+	Tags []string `json:"tag"`
+	// Field used to sort the results (id, name, price or created) instead of the relevance
+	// in: query
+	Sort string `json:"sort"`
+	// Max number of products in the page
+	// in: query
+	Limit int `json:"limit"`
+	// Cursor of the page returned in the Link header
+	// in: query
+	Cursor string `json:"cursor"`
+	// Currency code used to convert the prices, required to filter or sort by price
+	// in: query
+	Currency string `json:"currency"`
+}
+
+// productIndex is the full-text index of the name and description of the
+// products which are not deleted, it is updated with productLock held
+var productIndex = newProductIndex()
+
+func newProductIndex() *search.Index {
+	ix := search.NewIndex(searchNameBoost, searchDescriptionBoost)
+
+	for _, pr := range productList {
+		ix.Add(pr.ID, pr.Name, pr.Description)
+	}
+
+	return ix
+}
+
+// indexProduct updates the product in the search index, the deleted
+// products are removed. It must be called holding productLock
+func indexProduct(pr *Product) {
+	if pr.IsDeleted() {
+		productIndex.Remove(pr.ID)
+		return
+	}
+
+	productIndex.Add(pr.ID, pr.Name, pr.Description)
+}
+
+// ProductSearch returns the page of products matching the search text and the filters
+// of the query, from the most relevant unless the query has a sort order, along with
+// the total number of matching products. Prices are converted to the given currency
+func (p *ProductDB) ProductSearch(text string, currency string, q *ProductQuery) ([]SearchResult, int, error) {
+	sq := search.ParseQuery(text)
+
+	if sq.Empty() {
+		return nil, 0, ErrEmptySearch
+	}
+
+	if err := q.checkCurrency(currency); err != nil {
+		return nil, 0, err
+	}
+
+	productLock.RLock()
+
+	if err := q.resolveCategories(); err != nil {
+		productLock.RUnlock()
+		return nil, 0, err
+	}
+
+	hits := productIndex.Search(sq)
+
+	byID := map[int]*Product{}
+	for _, pr := range productList {
+		byID[pr.ID] = pr
+	}
+
+	at := q.priceAt()
+
+	rl := []SearchResult{}
+	for _, h := range hits {
+		if pr, ok := byID[h.ID]; ok {
+			np := *pr
+			resolvePrice(&np, q.PriceList, at)
+			rl = append(rl, SearchResult{Product: &np, Score: h.Score})
+		}
+	}
+
+	productLock.RUnlock()
+
+	rates := map[string]Rate{}
+
+	matched := []SearchResult{}
+	for _, r := range rl {
+		if err := p.convertPrice(r.Product, currency, rates); err != nil {
+			return nil, 0, err
+		}
+
+		if q.match(r.Product) {
+			matched = append(matched, r)
+		}
+	}
+
+	if q.Sort != "" {
+		less := productSorters[strings.TrimPrefix(q.Sort, "-")]
+		desc := strings.HasPrefix(q.Sort, "-")
+
+		sort.SliceStable(matched, func(i, j int) bool {
+			if desc {
+				return less(matched[j].Product, matched[i].Product)
+			}
+
+			return less(matched[i].Product, matched[j].Product)
+		})
+	}
+
+	total := len(matched)
+
+	if q.Offset >= total {
+		return []SearchResult{}, total, nil
+	}
+
+	end := q.Offset + q.PageLimit()
+
+	if end > total {
+		end = total
+	}
+
+	page := matched[q.Offset:end]
+
+	// only the products of the page are highlighted
+	for i := range page {
+		page[i].Highlights = highlights(page[i].Product, sq)
+	}
+
+	return page, total, nil
+}
+
+// highlights returns the name and the description snippet of the product with the matching words
+func highlights(pr *Product, sq *search.Query) map[string]string {
+	hl := map[string]string{}
+
+	if h, ok := search.Highlight(pr.Name, sq, 0); ok {
+		hl["name"] = h
+	}
+
+	if h, ok := search.Highlight(pr.Description, sq, searchSnippetWords); ok {
+		hl["description"] = h
+	}
+
+	return hl
+}
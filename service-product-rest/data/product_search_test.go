@@ -0,0 +1,67 @@
+package data
+
+import (
+	"testing"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestProductSearchFollowsChanges(t *testing.T) {
+	pdb := NewProductDB(hclog.NewNullLogger(), nil, nil)
+
+	pr := &Product{Name: "Cortado", Description: "Expresso cut with warm milk", Price: Money{Amount: 220, Currency: "EUR"}, SKU: "sea-cor-one"}
+	assert.NoError(t, pdb.ProductAdd(pr, "test"))
+
+	rl, total, err := pdb.ProductSearch("warm milk", "", &ProductQuery{})
+
+	assert.NoError(t, err)
+	assert.Equal(t, 1, total)
+	assert.Equal(t, pr.ID, rl[0].Product.ID)
+	assert.Equal(t, "Expresso cut with <em>warm</em> <em>milk</em>", rl[0].Highlights["description"])
+
+	// the name weighs more than the description
+	rl, _, err = pdb.ProductSearch("expres", "", &ProductQuery{})
+
+	assert.NoError(t, err)
+	assert.Equal(t, 2, rl[0].Product.ID)
+	assert.Equal(t, pr.ID, rl[1].Product.ID)
+	assert.Equal(t, "<em>Expresso</em>", rl[0].Highlights["name"])
+
+	up := &Product{ID: pr.ID, Name: "Galão", Description: "Café com muito leite", Price: Money{Amount: 220, Currency: "EUR"}}
+	assert.NoError(t, pdb.ProductUpdate(up, 0, "test"))
+
+	_, total, _ = pdb.ProductSearch("warm ", "", &ProductQuery{})
+	assert.Equal(t, 0, total)
+
+	rl, total, _ = pdb.ProductSearch("galao leites ", "", &ProductQuery{})
+	assert.Equal(t, 1, total)
+	assert.Equal(t, "<em>Galão</em>", rl[0].Highlights["name"])
+
+	assert.NoError(t, pdb.ProductDelete(pr.ID, 0, "test"))
+
+	_, total, _ = pdb.ProductSearch("galao", "", &ProductQuery{})
+	assert.Equal(t, 0, total)
+
+	_, _, err = pdb.ProductSearch(" the ", "", &ProductQuery{})
+	assert.Equal(t, ErrEmptySearch, err)
+
+	pdb.ProductPurge(0)
+}
+
+func TestProductSearchBatchRollback(t *testing.T) {
+	pdb := NewProductDB(hclog.NewNullLogger(), nil, nil)
+
+	ops := []BatchOperation{
+		{Op: BatchCreate, Product: &Product{Name: "Bombon", Price: Money{Amount: 210, Currency: "EUR"}, SKU: "sea-bom-one"}},
+		{Op: BatchDelete, ID: 1000},
+	}
+
+	_, committed := pdb.ProductBatch(ops, true, "test")
+	assert.False(t, committed)
+
+	_, total, err := pdb.ProductSearch("bombon", "", &ProductQuery{})
+
+	assert.NoError(t, err)
+	assert.Equal(t, 0, total)
+}
@@ -1,19 +1,20 @@
 package data
 
 import (
-	"context"
 	"encoding/json"
 	"fmt"
 	"io"
-	"regexp"
+	"reflect"
+	"strings"
+	"sync"
 	"time"
 
-	protos "github.com/CharlesSchiavinato/go-microservices/service-currency-grpc/protos/currency"
 	"github.com/go-playground/validator/v10"
 	"github.com/hashicorp/go-hclog"
 )
 
 var ErrProductNotFound = fmt.Errorf("Product not found")
+var ErrVersionMismatch = fmt.Errorf("Product version mismatch")
 
 // A list of products returns in the response
 // swagger:response productsResponse
@@ -31,10 +32,16 @@ type productResponseWrapper struct {
 	Body Product
 }
 
-// swagger:response noContent
+// No content is returned by this API endpoint
+// swagger:response noContentResponse
 type productNoContentWrapper struct {
 }
 
+// The product was not modified since the version in the If-None-Match header
+// swagger:response notModifiedResponse
+type productNotModifiedWrapper struct {
+}
+
 // swagger:parameters id
 type productIDParameterWrapper struct {
 	// The id of the product
@@ -43,6 +50,31 @@ type productIDParameterWrapper struct {
 	ID int `json:"id"`
 }
 
+// swagger:parameters GetProductBySKU
+type productSKUParameterWrapper struct {
+	// The SKU of the product
+	// in: path
+	// required: true
+	SKU string `json:"sku"`
+	// Currency code used to convert the price of the product
+	// in: query
+	Currency string `json:"currency"`
+}
+
+// swagger:parameters GetProduct
+type productIncludeDeletedParameterWrapper struct {
+	// Return the product even when it was deleted, only for the administrators
+	// in: query
+	IncludeDeleted bool `json:"include_deleted"`
+}
+
+// swagger:parameters ListProducts GetProduct
+type productAdminKeyParameterWrapper struct {
+	// Key of the administrators, required to include the deleted products
+	// in: header
+	AdminKey string `json:"X-Admin-Key"`
+}
+
 // product defines the structure for an API product
 // swagger:model
 type Product struct {
@@ -50,42 +82,92 @@ type Product struct {
 	//
 	// required: true
 	// min: 1
-	ID          int     `json:"id"`
-	Name        string  `json:"name" validate:"required,min=3,max=50"`
-	Description string  `json:"description"`
-	Price       float64 `json:"price" validate:"gt=0"`
-	SKU         string  `json:"sku" validate:"required,customSKU"`
-	CreatedOn   string  `json:"-"`
-	UpdatedOn   string  `json:"-"`
-	DeletedOn   string  `json:"-"`
+	ID          int            `json:"id" xml:"id"`
+	Name        string         `json:"name" xml:"name" validate:"required,min=3,max=50"`
+	Description string         `json:"description" xml:"description"`
+	Price       Money          `json:"price" xml:"price" validate:"customPrice"`
+	SKU         string         `json:"sku" xml:"sku" validate:"customSKU"`
+	CategoryID  int            `json:"category_id,omitempty" xml:"category_id,omitempty"`
+	Tags        []string       `json:"tags,omitempty" xml:"tags>tag,omitempty" validate:"max=20,dive,max=30"`
+	Version     int            `json:"version" xml:"version"`
+	CreatedOn   time.Time      `json:"-" xml:"-"`
+	UpdatedOn   time.Time      `json:"-" xml:"-"`
+	DeletedOn   *time.Time     `json:"deleted_on,omitempty" xml:"deleted_on,omitempty"`
+	Pricing     *ResolvedPrice `json:"pricing,omitempty" xml:"pricing,omitempty"`
+	Images      []ProductImage `json:"images,omitempty" xml:"images>image,omitempty"`
+	Rate        *Rate          `json:"rate,omitempty" xml:"rate,omitempty"`
 }
 
 type ProductDB struct {
-	log      hclog.Logger
-	currency protos.CurrencyClient
+	log    hclog.Logger
+	rates  *RateCache
+	events *ProductEventBroker
 }
 
-func NewProductDB(l hclog.Logger, c protos.CurrencyClient) *ProductDB {
-	return &ProductDB{l, c}
+// NewProductDB creates the product data store, prices are converted with the rates
+// of the cache and the changes are published to the event broker
+func NewProductDB(l hclog.Logger, r *RateCache, e *ProductEventBroker) *ProductDB {
+	return &ProductDB{l, r, e}
 }
 
+// IsDeleted returns true when the product was soft deleted
+func (p *Product) IsDeleted() bool {
+	return p.DeletedOn != nil
+}
+
+// Normalize normalizes the SKU and the tags of a product sent by a client and clears the
+// fields owned by the server
+func (p *Product) Normalize() {
+	p.SKU = NormalizeSKU(p.SKU)
+	p.Tags = NormalizeTags(p.Tags)
+	// the price and the rate are resolved on each read, they are never stored, and
+	// the images are attached through their own requests
+	p.Pricing = nil
+	p.Images = nil
+	p.Rate = nil
+}
+
+// Validate checks the fields of the product, it must be normalized
 func (p *Product) Validate() error {
 	validate := validator.New()
 	validate.RegisterValidation("customSKU", validateSKU)
+	validate.RegisterValidation("customPrice", validatePrice)
+	validate.RegisterCustomTypeFunc(priceValue, Money{})
+
+	// report the fields by their json name
+	validate.RegisterTagNameFunc(func(f reflect.StructField) string {
+		return strings.SplitN(f.Tag.Get("json"), ",", 2)[0]
+	})
+
 	return validate.Struct(p)
 }
 
-func validateSKU(fl validator.FieldLevel) bool {
-	// sku is of format abc-abc-abc
-	re := regexp.MustCompile(`[a-z]+-[a-z]+-[a-z]`)
-	matches := re.FindAllString(fl.Field().String(), -1)
+// priceValue exposes the amount of a price to the validator,
+// zero when the currency is not supported
+func priceValue(v reflect.Value) interface{} {
+	m, ok := v.Interface().(Money)
+
+	if !ok {
+		return int64(0)
+	}
+
+	if _, err := MinorUnits(m.Currency); err != nil {
+		return int64(0)
+	}
+
+	return m.Amount
+}
 
-	return len(matches) == 1
+func validatePrice(fl validator.FieldLevel) bool {
+	return fl.Field().Int() > 0
 }
 
 // products is a collection of product
 type Products []*Product
 
+// productLock guards the state of the data store, each guarded variable names it
+var productLock sync.RWMutex
+
 // ToJSON serializes the contents of the collection to JSON
 // NewEncoder provides better performance than json.Unmarshal as it does not
 // have to buffer the output into an in memory slice of bytes
@@ -104,83 +186,385 @@ func FromJSON(i interface{}, r io.Reader) error {
 	return d.Decode(i)
 }
 
-func (p *ProductDB) ProductList(currency string) (Products, error) {
-	if currency == "" {
-		return productList, nil
+// ProductList returns the page of products matching the query along with the
+// total number of matching products. The effective prices of the price list of the
+// query are converted to the given currency before the price filters are applied,
+// so they are expressed in that currency, and the products are translated with the
+// locales of the query before the name is filtered and sorted
+func (p *ProductDB) ProductList(currency string, q *ProductQuery) (Products, int, error) {
+	pr, err := p.matchProducts(currency, q, nil)
+
+	if err != nil {
+		return nil, 0, err
 	}
 
-	rate, err := p.getRate(currency)
+	q.sort(pr)
 
-	if err != nil {
+	return q.page(pr), len(pr), nil
+}
+
+// matchProducts returns the products matching the query, translated with its locales and with their
+// effective prices converted to the given currency. When categories is not nil it is filled with the categories read along with the products
+func (p *ProductDB) matchProducts(currency string, q *ProductQuery, categories map[int]Category) (Products, error) {
+	if err := q.checkCurrency(currency); err != nil {
 		return nil, err
 	}
 
-	pr := Products{}
+	productLock.RLock()
+
+	if err := q.resolveCategories(); err != nil {
+		productLock.RUnlock()
+		return nil, err
+	}
+
+	at := q.priceAt()
+
+	pl := Products{}
 	for _, p := range productList {
+		if p.IsDeleted() && !q.IncludeDeleted {
+			continue
+		}
+
 		np := *p
-		np.Price = np.Price * rate
-		pr = append(pr, &np)
+		resolvePrice(&np, q.PriceList, at)
+		localize(&np, q.Locales)
+		pl = append(pl, &np)
+	}
+
+	if categories != nil {
+		for _, c := range categoryList {
+			categories[c.ID] = *c
+		}
+	}
+
+	productLock.RUnlock()
+
+	// the products may have different base currencies, each rate is fetched once
+	rates := map[string]Rate{}
+
+	pr := Products{}
+	for _, np := range pl {
+		err := p.convertPrice(np, currency, rates)
+
+		if err != nil {
+			return nil, err
+		}
+
+		if q.match(np) {
+			pr = append(pr, np)
+		}
 	}
 
 	return pr, nil
 }
 
-func ProductAdd(p *Product) {
-	p.ID = NextID()
-	p.CreatedOn = time.Now().UTC().String()
-	p.UpdatedOn = time.Now().UTC().String()
+// ProductAdd adds a new product to the data store, actor is recorded in the product history.
+// The SKU is generated when it is empty and the SKU policy allows it. The product is
+// completed with its id and version, the data store keeps a copy of it
+func (p *ProductDB) ProductAdd(pr *Product, actor string) error {
+	productLock.Lock()
+	defer productLock.Unlock()
+
+	_, err := addProduct(pr, actor)
+
+	if err != nil {
+		return err
+	}
+
+	p.notify()
 
-	productList = append(productList, p)
+	return nil
 }
 
-func ProductUpdate(p *Product) error {
-	i := productIndexByID(p.ID)
+// ProductUpdate replaces the product with the given id, deleted products can
+// not be updated. When version is greater than zero it must match the stored
+// version of the product. The product is completed with its new version, the
+// data store keeps a copy of it
+func (p *ProductDB) ProductUpdate(pr *Product, version int, actor string) error {
+	productLock.Lock()
+	defer productLock.Unlock()
 
-	if i < 0 {
-		return ErrProductNotFound
+	_, err := updateProduct(pr, version, actor)
+
+	if err != nil {
+		return err
 	}
 
-	productList[i] = p
+	p.notify()
 
 	return nil
 }
 
-func ProductDelete(id int) error {
-	i := productIndexByID(id)
+// ProductDelete marks the product with the given id as deleted, the product
+// stays in the data store until it is restored or purged. When version is
+// greater than zero it must match the stored version of the product
+func (p *ProductDB) ProductDelete(id int, version int, actor string) error {
+	productLock.Lock()
+	defer productLock.Unlock()
 
-	if i < 0 {
-		return ErrProductNotFound
+	_, err := deleteProduct(id, version, actor)
+
+	if err != nil {
+		return err
 	}
 
-	productList = append(productList[:i], productList[i+1:]...)
+	p.notify()
 
 	return nil
 }
 
-func (p *ProductDB) ProductGetByID(id int, currency string) (*Product, error) {
+// addProduct stores a copy of the new product, so the caller can read the product once
+// productLock is released. It must be called holding productLock
+func addProduct(pr *Product, actor string) (*Revision, error) {
+	if err := checkProductCategory(pr); err != nil {
+		return nil, err
+	}
+
+	pr.ID = nextID()
+
+	if err := assignSKU(pr); err != nil {
+		return nil, err
+	}
+
+	pr.Version = 1
+	pr.CreatedOn = time.Now().UTC()
+	pr.UpdatedOn = time.Now().UTC()
+	pr.DeletedOn = nil
+
+	np := copyProduct(pr)
+	productList = append(productList, np)
+
+	return record(ProductCreated, nil, np, actor, 0), nil
+}
+
+// updateProduct replaces the stored product with a copy of the product, so the caller can
+// read the product once productLock is released. It must be called holding productLock
+func updateProduct(pr *Product, version int, actor string) (*Revision, error) {
+	i := productIndexByID(pr.ID)
+
+	if i < 0 || productList[i].IsDeleted() {
+		return nil, ErrProductNotFound
+	}
+
+	if version > 0 && productList[i].Version != version {
+		return nil, ErrVersionMismatch
+	}
+
+	if err := checkProductCategory(pr); err != nil {
+		return nil, err
+	}
+
+	// the product keeps its SKU when the update does not have one
+	if NormalizeSKU(pr.SKU) == "" {
+		pr.SKU = productList[i].SKU
+	}
+
+	if err := assignSKU(pr); err != nil {
+		return nil, err
+	}
+
+	pr.Version = productList[i].Version + 1
+	pr.CreatedOn = productList[i].CreatedOn
+	pr.UpdatedOn = time.Now().UTC()
+	pr.DeletedOn = nil
+	pr.Images = productList[i].Images
+	prev := productList[i]
+	np := copyProduct(pr)
+	productList[i] = np
+
+	return record(ProductUpdated, prev, np, actor, 0), nil
+}
+
+// deleteProduct marks the stored product as deleted, the product is copied so the products
+// already read are not changed. It must be called holding productLock
+func deleteProduct(id int, version int, actor string) (*Revision, error) {
+	i := productIndexByID(id)
+
+	if i < 0 || productList[i].IsDeleted() {
+		return nil, ErrProductNotFound
+	}
+
+	if version > 0 && productList[i].Version != version {
+		return nil, ErrVersionMismatch
+	}
+
+	prev := productList[i]
+	pr := *prev
+	now := time.Now().UTC()
+	pr.DeletedOn = &now
+	pr.UpdatedOn = now
+	pr.Version++
+	productList[i] = &pr
+
+	return record(ProductDeleted, prev, &pr, actor, 0), nil
+}
+
+// ProductRestore clears the deletion mark of the product with the given id,
+// it fails when another product uses its SKU since it was deleted. The product
+// loses its category when the category was removed since it was deleted
+func (p *ProductDB) ProductRestore(id int, actor string) (*Product, error) {
+	productLock.Lock()
+	defer productLock.Unlock()
+
 	i := productIndexByID(id)
 
 	if i < 0 {
 		return nil, ErrProductNotFound
 	}
 
-	if currency == "" {
-		return productList[i], nil
+	if productList[i].IsDeleted() {
+		if productIDBySKULocked(productList[i].SKU) != 0 {
+			return nil, ErrDuplicateSKU
+		}
+
+		// the product is copied so the products already read are not changed
+		prev := productList[i]
+		pr := *prev
+
+		if checkProductCategory(&pr) != nil {
+			pr.CategoryID = 0
+		}
+
+		pr.DeletedOn = nil
+		pr.UpdatedOn = time.Now().UTC()
+		pr.Version++
+		productList[i] = &pr
+		record(ProductUpdated, prev, &pr, actor, 0)
+		p.notify()
+	}
+
+	np := *productList[i]
+
+	return &np, nil
+}
+
+// ProductPurge removes from the data store the products deleted before
+// the retention period and returns the number of removed products
+func (p *ProductDB) ProductPurge(retention time.Duration) int {
+	productLock.Lock()
+	defer productLock.Unlock()
+
+	limit := time.Now().UTC().Add(-retention)
+
+	pl := []*Product{}
+	for _, pr := range productList {
+		if pr.IsDeleted() && pr.DeletedOn.Before(limit) {
+			p.log.Info("Purging product", "id", pr.ID, "deleted_on", pr.DeletedOn)
+			delete(stockLevels, pr.ID)
+			delete(priceEntries, pr.ID)
+			delete(translations, pr.ID)
+			imageCleanups[pr.ID] = true
+			continue
+		}
+
+		pl = append(pl, pr)
 	}
 
-	rate, err := p.getRate(currency)
+	purged := len(productList) - len(pl)
+	productList = pl
+
+	return purged
+}
+
+// ProductGetByID returns the product with the given id, deleted products
+// are only returned when includeDeleted is true
+func (p *ProductDB) ProductGetByID(id int, currency string, includeDeleted bool) (*Product, error) {
+	productLock.RLock()
+	i := productIndexByID(id)
+
+	if i < 0 || (productList[i].IsDeleted() && !includeDeleted) {
+		productLock.RUnlock()
+		return nil, ErrProductNotFound
+	}
+
+	np := *productList[i]
+	productLock.RUnlock()
+
+	err := p.convertPrice(&np, currency, map[string]Rate{})
 
 	if err != nil {
-		p.log.Error("Unable to get rate", "currency", currency, "error", err)
 		return nil, err
 	}
 
-	np := *productList[i]
-	np.Price = np.Price * rate
+	return &np, nil
+}
+
+// ConvertPrice returns a copy of the product with the price converted to the given currency
+func (p *ProductDB) ConvertPrice(pr *Product, currency string) (*Product, error) {
+	np := *pr
+
+	err := p.convertPrice(&np, currency, map[string]Rate{})
+
+	if err != nil {
+		return nil, err
+	}
 
 	return &np, nil
 }
 
+// record writes the product change in the history, the outbox and the search index, prev is the
+// product before the change, nil when it is created, and revertedFrom the revision restored by
+// a revert, zero for the other changes. It must be called holding productLock, so the change,
+// its revision and its outbox entry are written atomically. It returns the recorded revision
+func record(t ProductEventType, prev, pr *Product, actor string, revertedFrom int) *Revision {
+	rv := addRevision(t, prev, pr, actor, revertedFrom)
+	addOutboxEntry(t, pr, revertedFrom)
+	indexProduct(pr)
+
+	return rv
+}
+
+// notify sends the recorded changes from the outbox to the event broker, it is called
+// holding productLock so the events follow the order of the changes
+func (p *ProductDB) notify() {
+	deliverOutbox(p.events)
+}
+
+// convertPrice converts the product price from its base currency to the given
+// currency, rates keeps the exchange rates by base currency between calls
+func (p *ProductDB) convertPrice(pr *Product, currency string, rates map[string]Rate) error {
+	if currency == "" || currency == pr.Price.Currency {
+		return nil
+	}
+
+	rate, ok := rates[pr.Price.Currency]
+
+	if !ok {
+		var err error
+		rate, err = p.rates.GetRate(pr.Price.Currency, currency)
+
+		if err != nil {
+			return err
+		}
+
+		rates[pr.Price.Currency] = rate
+	}
+
+	m, err := pr.Price.Convert(currency, rate.Rate)
+
+	if err != nil {
+		return err
+	}
+
+	pr.Price = m
+	pr.Rate = &rate
+
+	// the list price has the currency of the price
+	if pr.Pricing != nil {
+		lp, err := pr.Pricing.ListPrice.Convert(currency, rate.Rate)
+
+		if err != nil {
+			return err
+		}
+
+		rp := *pr.Pricing
+		rp.ListPrice = lp
+		pr.Pricing = &rp
+	}
+
+	return nil
+}
+
 func productIndexByID(id int) int {
 	for i, p := range productList {
 		if p.ID == id {
@@ -191,42 +575,47 @@ func productIndexByID(id int) int {
 	return -1
 }
 
-func NextID() int {
-	return len(productList) + 1
-}
+// nextID returns the id after the highest one in the data store,
+// purged products may leave gaps so the list length can not be used.
+// The ids in the history are not reused, they keep the revisions of the purged products
+func nextID() int {
+	id := 0
 
-func (p *ProductDB) getRate(destination string) (float64, error) {
-	rr := &protos.RateRequest{
-		Base:        protos.Currencies_EUR,
-		Destination: protos.Currencies(protos.Currencies_value[destination]),
+	for _, p := range productList {
+		if p.ID > id {
+			id = p.ID
+		}
 	}
 
-	resp, err := p.currency.GetRate(context.Background(), rr)
-
-	if err != nil {
-		p.log.Error("Unable to get rate", "currency", destination, "error", err)
+	for pid := range revisions {
+		if pid > id {
+			id = pid
+		}
 	}
 
-	return float64(resp.Rate), err
+	return id + 1
 }
 
+// productList keeps the products ordered by id, it is guarded by productLock
 var productList = []*Product{
 	&Product{
 		ID:          1,
 		Name:        "Latte",
 		Description: "Frothy milky coffee",
-		Price:       2.45,
-		SKU:         "abc323",
-		CreatedOn:   time.Now().UTC().String(),
-		UpdatedOn:   time.Now().UTC().String(),
+		Price:       Money{Amount: 245, Currency: "EUR"},
+		SKU:         "cof-lat-std",
+		Version:     1,
+		CreatedOn:   time.Now().UTC(),
+		UpdatedOn:   time.Now().UTC(),
 	},
 	&Product{
 		ID:          2,
 		Name:        "Expresso",
 		Description: "Short and strong coffee without milk",
-		Price:       1.99,
-		SKU:         "fjd34",
-		CreatedOn:   time.Now().UTC().String(),
-		UpdatedOn:   time.Now().UTC().String(),
+		Price:       Money{Amount: 199, Currency: "EUR"},
+		SKU:         "cof-exp-std",
+		Version:     1,
+		CreatedOn:   time.Now().UTC(),
+		UpdatedOn:   time.Now().UTC(),
 	},
 }
@@ -2,14 +2,16 @@ package data
 
 import (
 	"testing"
+	"time"
 
+	"github.com/hashicorp/go-hclog"
 	"github.com/stretchr/testify/assert"
 )
 
 func TestProductMissingNameReturnsErr(t *testing.T) {
 	p := Product{
 		Name:  "",
-		Price: 1.22,
+		Price: Money{Amount: 122, Currency: "EUR"},
 		SKU:   "aaa-aaa-aaa",
 	}
 
@@ -18,10 +20,33 @@ func TestProductMissingNameReturnsErr(t *testing.T) {
 	assert.Len(t, err, 1)
 }
 
+func TestProductValidateKeepsTheProduct(t *testing.T) {
+	p := &Product{
+		Name:   "Latte",
+		Price:  Money{Amount: 245, Currency: "EUR"},
+		SKU:    " ABC-def-GHI ",
+		Images: []ProductImage{{Filename: "front.png"}},
+		Rate:   &Rate{Base: "EUR", Rate: 2},
+	}
+
+	p.Validate()
+
+	assert.Equal(t, " ABC-def-GHI ", p.SKU)
+	assert.Len(t, p.Images, 1)
+	assert.NotNil(t, p.Rate)
+
+	p.Normalize()
+
+	assert.NoError(t, p.Validate())
+	assert.Equal(t, "abc-def-ghi", p.SKU)
+	assert.Nil(t, p.Images)
+	assert.Nil(t, p.Rate)
+}
+
 func TestProductMinNameReturnsErr(t *testing.T) {
 	p := Product{
 		Name:  "aa",
-		Price: 1.22,
+		Price: Money{Amount: 122, Currency: "EUR"},
 		SKU:   "aaa-aaa-aaa",
 	}
 
@@ -29,3 +54,155 @@ func TestProductMinNameReturnsErr(t *testing.T) {
 
 	assert.Len(t, err, 1)
 }
+
+func TestProductListFiltersSortsAndPages(t *testing.T) {
+	pdb := NewProductDB(hclog.NewNullLogger(), nil, nil)
+
+	q := &ProductQuery{Sort: "-price", Limit: 1}
+	assert.NoError(t, q.Validate())
+
+	pl, total, err := pdb.ProductList("EUR", q)
+
+	assert.NoError(t, err)
+	assert.Equal(t, 2, total)
+	assert.Len(t, pl, 1)
+	assert.Equal(t, "Latte", pl[0].Name)
+
+	q = &ProductQuery{Name: "PRESS", MaxPrice: 2}
+	pl, total, err = pdb.ProductList("EUR", q)
+
+	assert.NoError(t, err)
+	assert.Equal(t, 1, total)
+	assert.Equal(t, "Expresso", pl[0].Name)
+}
+
+func TestProductListPricesRequireCurrency(t *testing.T) {
+	pdb := NewProductDB(hclog.NewNullLogger(), nil, nil)
+
+	for _, q := range []*ProductQuery{{Sort: "-price"}, {MinPrice: 1}, {MaxPrice: 2}} {
+		_, _, err := pdb.ProductList("", q)
+
+		assert.Equal(t, ErrPriceCurrencyRequired, err)
+	}
+
+	_, _, err := pdb.ProductList("", &ProductQuery{Sort: "name"})
+
+	assert.NoError(t, err)
+}
+
+func TestProductQueryInvalidSortReturnsErr(t *testing.T) {
+	q := &ProductQuery{Sort: "description"}
+
+	assert.Equal(t, ErrInvalidSort, q.Validate())
+}
+
+func TestProductDeleteRestoreAndPurge(t *testing.T) {
+	pdb := NewProductDB(hclog.NewNullLogger(), nil, nil)
+
+	pr := &Product{Name: "Mocha", Price: Money{Amount: 299, Currency: "EUR"}, SKU: "abc-abc-abc"}
+	pdb.ProductAdd(pr, "test")
+
+	assert.NoError(t, pdb.ProductDelete(pr.ID, 0, "test"))
+	assert.Equal(t, ErrProductNotFound, pdb.ProductDelete(pr.ID, 0, "test"))
+
+	// the delete stores a copy, the product stored before is not changed
+	assert.False(t, pr.IsDeleted())
+	assert.Equal(t, 1, pr.Version)
+
+	_, err := pdb.ProductGetByID(pr.ID, "", false)
+	assert.Equal(t, ErrProductNotFound, err)
+
+	pg, err := pdb.ProductGetByID(pr.ID, "", true)
+	assert.NoError(t, err)
+	assert.True(t, pg.IsDeleted())
+
+	pg, err = pdb.ProductRestore(pr.ID, "test")
+	assert.NoError(t, err)
+	assert.False(t, pg.IsDeleted())
+
+	assert.NoError(t, pdb.ProductDelete(pr.ID, 0, "test"))
+	assert.Equal(t, 0, pdb.ProductPurge(time.Hour))
+	assert.Equal(t, 1, pdb.ProductPurge(0))
+
+	_, err = pdb.ProductGetByID(pr.ID, "", true)
+	assert.Equal(t, ErrProductNotFound, err)
+}
+
+func TestProductUpdateChecksVersion(t *testing.T) {
+	pdb := NewProductDB(hclog.NewNullLogger(), nil, nil)
+
+	pr := &Product{Name: "Cappuccino", Price: Money{Amount: 310, Currency: "EUR"}, SKU: "abc-abc-abc"}
+	pdb.ProductAdd(pr, "test")
+	created := pr.CreatedOn
+
+	pu := &Product{ID: pr.ID, Name: "Cappuccino", Price: Money{Amount: 350, Currency: "EUR"}, SKU: "abc-abc-abc"}
+	assert.NoError(t, pdb.ProductUpdate(pu, 1, "test"))
+	assert.Equal(t, 2, pu.Version)
+	assert.Equal(t, created, pu.CreatedOn)
+
+	pu = &Product{ID: pr.ID, Name: "Cappuccino", Price: Money{Amount: 390, Currency: "EUR"}, SKU: "abc-abc-abc"}
+	assert.Equal(t, ErrVersionMismatch, pdb.ProductUpdate(pu, 1, "test"))
+	assert.Equal(t, ErrVersionMismatch, pdb.ProductDelete(pr.ID, 1, "test"))
+	assert.NoError(t, pdb.ProductDelete(pr.ID, 2, "test"))
+	pdb.ProductPurge(0)
+}
+
+func TestProductAddAndUpdateStoreACopy(t *testing.T) {
+	pdb := NewProductDB(hclog.NewNullLogger(), nil, nil)
+
+	pr := &Product{Name: "Macchiato", Price: Money{Amount: 270, Currency: "EUR"}, SKU: "abc-abc-abc", Tags: []string{"milk"}}
+	assert.NoError(t, pdb.ProductAdd(pr, "test"))
+
+	// the caller owns the product it added, changing it does not change the stored product
+	pr.Name = "Changed"
+	pr.Tags[0] = "changed"
+
+	pg, err := pdb.ProductGetByID(pr.ID, "", false)
+	assert.NoError(t, err)
+	assert.Equal(t, "Macchiato", pg.Name)
+	assert.Equal(t, []string{"milk"}, pg.Tags)
+
+	pu := &Product{ID: pr.ID, Name: "Macchiato", Price: Money{Amount: 280, Currency: "EUR"}, SKU: "abc-abc-abc"}
+	assert.NoError(t, pdb.ProductUpdate(pu, 1, "test"))
+	assert.NoError(t, pdb.ProductDelete(pr.ID, 0, "test"))
+
+	assert.False(t, pu.IsDeleted())
+	assert.Equal(t, 2, pu.Version)
+
+	pdb.ProductPurge(0)
+}
+
+func TestProductPatch(t *testing.T) {
+	p := &Product{ID: 1, Name: "Latte", Price: Money{Amount: 245, Currency: "EUR"}, SKU: "abc-abc-abc"}
+
+	np, err := p.Patch(MergePatchContentType, []byte(`{"price": {"amount": "2.99"}, "id": 5}`))
+	assert.NoError(t, err)
+	assert.Equal(t, 1, np.ID)
+	assert.Equal(t, Money{Amount: 299, Currency: "EUR"}, np.Price)
+	assert.Equal(t, "Latte", np.Name)
+
+	np, err = p.Patch(JSONPatchContentType, []byte(`[{"op": "replace", "path": "/name", "value": "Mocha"}]`))
+	assert.NoError(t, err)
+	assert.Equal(t, "Mocha", np.Name)
+	assert.Equal(t, "Latte", p.Name)
+
+	_, err = p.Patch("application/json", []byte(`{}`))
+	assert.Equal(t, ErrUnsupportedPatch, err)
+}
+
+func TestValidationFieldErrorsUsesJSONNames(t *testing.T) {
+	p := Product{
+		Name:  "aa",
+		Price: Money{Amount: 0, Currency: "EUR"},
+		SKU:   "aaa-aaa-aaa",
+	}
+
+	fe := ValidationFieldErrors(p.Validate())
+
+	assert.Len(t, fe, 2)
+	assert.Equal(t, "name", fe[0].Field)
+	assert.Equal(t, "min", fe[0].Rule)
+	assert.Equal(t, "3", fe[0].Param)
+	assert.Equal(t, "price", fe[1].Field)
+	assert.Equal(t, "customPrice", fe[1].Rule)
+}
@@ -0,0 +1,258 @@
+package data
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"time"
+)
+
+var ErrPromotionNotFound = fmt.Errorf("Promotion not found")
+var ErrInvalidDiscount = fmt.Errorf("A percentage promotion needs a percent and a fixed promotion needs an amount")
+
+// PromotionType is the kind of discount of a promotion
+type PromotionType string
+
+const (
+	// PromotionPercentage takes a percent of the price off
+	PromotionPercentage PromotionType = "percentage"
+	// PromotionFixed takes an amount off the prices in the same currency
+	PromotionFixed PromotionType = "fixed"
+)
+
+// Promotion is a discount on the prices during a period. When several promotions
+// apply to a product, the one giving the lowest price is applied
+// swagger:model
+type Promotion struct {
+	// the id of the promotion
+	ID int `json:"id"`
+	// the name of the promotion
+	Name string `json:"name" validate:"required,min=3,max=50"`
+	// the kind of discount: percentage or fixed
+	Type PromotionType `json:"type" validate:"oneof=percentage fixed"`
+	// the percent taken off the price by the percentage promotions
+	Percent float64 `json:"percent,omitempty" validate:"gte=0,lte=100"`
+	// the amount taken off the price by the fixed promotions, only
+	// the prices in the currency of the amount are discounted
+	Amount *Money `json:"amount,omitempty"`
+	// the products on promotion, with the products of the category
+	ProductIDs []int `json:"product_ids,omitempty" validate:"max=1000"`
+	// the category on promotion, including its subcategories
+	CategoryID int `json:"category_id,omitempty"`
+	// the price lists on promotion, all of them when empty
+	PriceLists []string `json:"price_lists,omitempty" validate:"max=20,dive,customPriceList"`
+	// the start of the promotion
+	StartsAt time.Time `json:"starts_at" validate:"required"`
+	// the end of the promotion, it does not end when absent
+	EndsAt    *time.Time `json:"ends_at,omitempty"`
+	CreatedOn time.Time  `json:"created_on"`
+}
+
+// A list of promotions
+// swagger:response promotionsResponse
+type promotionsResponseWrapper struct {
+	// in: body
+	Body []Promotion
+}
+
+// A promotion
+// swagger:response promotionResponse
+type promotionResponseWrapper struct {
+	// in: body
+	Body Promotion
+}
+
+// swagger:parameters GetPromotion DeletePromotion
+type promotionIDParameterWrapper struct {
+	// The id of the promotion
+	// in: path
+	// required: true
+	ID int `json:"id"`
+}
+
+// swagger:parameters CreatePromotion
+type promotionParameterWrapper struct {
+	// in: body
+	// required: true
+	Body Promotion
+}
+
+// promotionList keeps the promotions ordered by id, it is guarded by productLock
+var promotionList = []*Promotion{}
+
+// promotionSeq is the id of the last added promotion, it is guarded by productLock
+var promotionSeq int
+
+// Validate checks the fields of the promotion
+func (pm *Promotion) Validate() error {
+	pm.Name = strings.TrimSpace(pm.Name)
+
+	for i, l := range pm.PriceLists {
+		pm.PriceLists[i] = strings.ToLower(strings.TrimSpace(l))
+	}
+
+	return newPricingValidator().Struct(pm)
+}
+
+// PromotionList returns the promotions ordered by id
+func (p *ProductDB) PromotionList() []Promotion {
+	productLock.RLock()
+	defer productLock.RUnlock()
+
+	pl := make([]Promotion, 0, len(promotionList))
+	for _, pm := range promotionList {
+		pl = append(pl, *pm)
+	}
+
+	return pl
+}
+
+// PromotionGet returns the promotion with the given id
+func (p *ProductDB) PromotionGet(id int) (*Promotion, error) {
+	productLock.RLock()
+	defer productLock.RUnlock()
+
+	i := promotionIndexByID(id)
+
+	if i < 0 {
+		return nil, ErrPromotionNotFound
+	}
+
+	pm := *promotionList[i]
+
+	return &pm, nil
+}
+
+// PromotionAdd adds a promotion, its products and category must exist
+func (p *ProductDB) PromotionAdd(pm *Promotion) error {
+	switch {
+	case pm.Type == PromotionPercentage && (pm.Percent <= 0 || pm.Amount != nil):
+		return ErrInvalidDiscount
+	case pm.Type == PromotionFixed && (pm.Percent != 0 || pm.Amount == nil || pm.Amount.Amount <= 0):
+		return ErrInvalidDiscount
+	case pm.EndsAt != nil && !pm.EndsAt.After(pm.StartsAt):
+		return ErrInvalidPeriod
+	}
+
+	productLock.Lock()
+	defer productLock.Unlock()
+
+	for _, id := range pm.ProductIDs {
+		if i := productIndexByID(id); i < 0 || productList[i].IsDeleted() {
+			return fmt.Errorf("%w: product %d", ErrProductNotFound, id)
+		}
+	}
+
+	if pm.CategoryID != 0 && categoryIndexByID(pm.CategoryID) < 0 {
+		return ErrCategoryNotFound
+	}
+
+	promotionSeq++
+	pm.ID = promotionSeq
+	pm.CreatedOn = time.Now().UTC()
+
+	np := *pm
+	promotionList = append(promotionList, &np)
+
+	return nil
+}
+
+// PromotionDelete removes the promotion with the given id
+func (p *ProductDB) PromotionDelete(id int) error {
+	productLock.Lock()
+	defer productLock.Unlock()
+
+	i := promotionIndexByID(id)
+
+	if i < 0 {
+		return ErrPromotionNotFound
+	}
+
+	promotionList = append(promotionList[:i], promotionList[i+1:]...)
+
+	return nil
+}
+
+// bestPromotion returns the promotion giving the lowest price to the product in the price list at
+// the instant, with the discounted price. It returns false when no promotion lowers the price.
+// It must be called holding productLock
+func bestPromotion(pr *Product, priceList string, at time.Time) (*Promotion, Money, bool) {
+	var best *Promotion
+	price := pr.Price
+
+	for _, pm := range promotionList {
+		if !pm.appliesTo(pr, priceList, at) {
+			continue
+		}
+
+		if d := pm.discount(pr.Price); d.Amount < price.Amount {
+			best, price = pm, d
+		}
+	}
+
+	return best, price, best != nil
+}
+
+// appliesTo returns true when the promotion is running at the instant for the product in the price list
+func (pm *Promotion) appliesTo(pr *Product, priceList string, at time.Time) bool {
+	if !inPeriod(at, &pm.StartsAt, pm.EndsAt) {
+		return false
+	}
+
+	if len(pm.PriceLists) > 0 && !containsString(pm.PriceLists, priceList) {
+		return false
+	}
+
+	if len(pm.ProductIDs) == 0 && pm.CategoryID == 0 {
+		return true
+	}
+
+	for _, id := range pm.ProductIDs {
+		if id == pr.ID {
+			return true
+		}
+	}
+
+	return pm.CategoryID != 0 && pr.CategoryID != 0 && categorySubtree(pm.CategoryID)[pr.CategoryID]
+}
+
+// discount returns the price with the discount of the promotion, rounded half away
+// from zero to the minor unit. The price does not go below zero
+func (pm *Promotion) discount(price Money) Money {
+	off := int64(0)
+
+	switch pm.Type {
+	case PromotionPercentage:
+		off = int64(math.Round(float64(price.Amount) * pm.Percent / 100))
+	case PromotionFixed:
+		if pm.Amount.Currency == price.Currency {
+			off = pm.Amount.Amount
+		}
+	}
+
+	if off > price.Amount {
+		off = price.Amount
+	}
+
+	return Money{Amount: price.Amount - off, Currency: price.Currency}
+}
+
+func promotionIndexByID(id int) int {
+	for i, pm := range promotionList {
+		if pm.ID == id {
+			return i
+		}
+	}
+
+	return -1
+}
+
+func containsString(sl []string, s string) bool {
+	for _, v := range sl {
+		if v == s {
+			return true
+		}
+	}
+
+	return false
+}
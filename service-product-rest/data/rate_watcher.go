@@ -0,0 +1,118 @@
+package data
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/go-hclog"
+)
+
+// RateWatcher keeps the rates of the cache up to date by polling the currency
+// service, so the prices are converted without calling the service per request.
+// The currency service does not provide a rate subscription, when one is
+// available it can replace the polling
+type RateWatcher struct {
+	log        hclog.Logger
+	rates      *RateCache
+	interval   time.Duration
+	minBackoff time.Duration
+	maxBackoff time.Duration
+}
+
+// NewRateWatcher creates a watcher refreshing the rates every interval, after a
+// failure the refresh is retried with an exponential backoff up to maxBackoff
+func NewRateWatcher(l hclog.Logger, rc *RateCache, interval, minBackoff, maxBackoff time.Duration) *RateWatcher {
+	return &RateWatcher{l, rc, interval, minBackoff, maxBackoff}
+}
+
+// Run refreshes the rates until the context is cancelled
+func (w *RateWatcher) Run(ctx context.Context) {
+	backoff := w.minBackoff
+
+	for {
+		wait := w.interval
+		err := w.refresh()
+
+		if err != nil {
+			w.log.Error("Unable to refresh rates, retrying", "backoff", backoff, "error", err)
+			wait = backoff
+			backoff = backoff * 2
+
+			if backoff > w.maxBackoff {
+				backoff = w.maxBackoff
+			}
+		} else {
+			backoff = w.minBackoff
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(wait):
+		}
+	}
+}
+
+// refresh fetches the rates between every pair of supported currencies, a failing
+// pair does not stop the refresh of the others and all the failures are returned
+func (w *RateWatcher) refresh() error {
+	var errs refreshErrors
+
+	for _, base := range supportedCurrencies() {
+		for _, dest := range supportedCurrencies() {
+			if base == dest {
+				continue
+			}
+
+			changed, err := w.rates.Refresh(base, dest)
+
+			if err != nil {
+				w.log.Error("Unable to refresh rate", "base", base, "currency", dest, "error", err)
+				errs = append(errs, fmt.Errorf("%s to %s: %w", base, dest, err))
+				continue
+			}
+
+			if changed {
+				w.log.Debug("Rate changed", "base", base, "currency", dest)
+			}
+		}
+	}
+
+	if len(errs) > 0 {
+		return errs
+	}
+
+	return nil
+}
+
+// refreshErrors are the failures of the pairs of currencies of a refresh
+type refreshErrors []error
+
+func (re refreshErrors) Error() string {
+	sl := make([]string, 0, len(re))
+	for _, err := range re {
+		sl = append(sl, err.Error())
+	}
+
+	return fmt.Sprintf("Unable to refresh %d rates: %s", len(re), strings.Join(sl, "; "))
+}
+
+// Unwrap returns the failures so errors.Is and errors.As match any of them
+func (re refreshErrors) Unwrap() []error {
+	return re
+}
+
+// supportedCurrencies returns the sorted codes of the supported currencies
+func supportedCurrencies() []string {
+	cl := []string{}
+	for c := range currencyMinorUnits {
+		cl = append(cl, c)
+	}
+
+	sort.Strings(cl)
+
+	return cl
+}
@@ -0,0 +1,176 @@
+package data
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	protos "github.com/CharlesSchiavinato/go-microservices/service-currency-grpc/protos/currency"
+	"github.com/hashicorp/go-hclog"
+	"golang.org/x/sync/singleflight"
+)
+
+var ErrRateUnavailable = fmt.Errorf("Currency rate unavailable")
+
+// RateFallback defines what is done when the currency service can not provide a rate
+type RateFallback string
+
+const (
+	// RateFallbackStale serves the last known rate, flagged as stale
+	RateFallbackStale RateFallback = "stale"
+	// RateFallbackUnavailable fails the request with ErrRateUnavailable
+	RateFallbackUnavailable RateFallback = "unavailable"
+)
+
+// rateRequestTimeout is the max time waiting for the currency service
+const rateRequestTimeout = 2 * time.Second
+
+// Rate is the exchange rate used to convert a price
+// swagger:model
+type Rate struct {
+	Base        string    `json:"base" xml:"base"`
+	Destination string    `json:"destination" xml:"destination"`
+	Rate        float64   `json:"rate" xml:"rate"`
+	FetchedAt   time.Time `json:"fetched_at" xml:"fetched_at"`
+	// Stale is true when the rate is older than the cache TTL
+	// because the currency service is unavailable
+	Stale bool `json:"stale,omitempty" xml:"stale,omitempty"`
+}
+
+// RateCache caches the exchange rates returned by the currency service. Concurrent
+// lookups of the same rate share a single call and a circuit breaker stops the calls
+// while the service is failing
+type RateCache struct {
+	log      hclog.Logger
+	currency protos.CurrencyClient
+	ttl      time.Duration
+	fallback RateFallback
+	breaker  *CircuitBreaker
+	group    singleflight.Group
+
+	mu    sync.RWMutex
+	rates map[string]Rate
+}
+
+// NewRateCache creates a cache keeping the rates during ttl, fallback defines
+// the behaviour when a rate is expired and the currency service is failing
+func NewRateCache(l hclog.Logger, c protos.CurrencyClient, ttl time.Duration, fallback RateFallback, b *CircuitBreaker) *RateCache {
+	return &RateCache{
+		log:      l,
+		currency: c,
+		ttl:      ttl,
+		fallback: fallback,
+		breaker:  b,
+		rates:    map[string]Rate{},
+	}
+}
+
+// GetRate returns the rate to convert from the base to the destination currency
+func (rc *RateCache) GetRate(base, destination string) (Rate, error) {
+	bc, ok := protos.Currencies_value[base]
+
+	if !ok {
+		return Rate{}, ErrUnsupportedCurrency
+	}
+
+	dc, ok := protos.Currencies_value[destination]
+
+	if !ok {
+		return Rate{}, ErrUnsupportedCurrency
+	}
+
+	key := base + ":" + destination
+
+	rc.mu.RLock()
+	cached, found := rc.rates[key]
+	rc.mu.RUnlock()
+
+	if found && time.Since(cached.FetchedAt) < rc.ttl {
+		return cached, nil
+	}
+
+	v, err, _ := rc.group.Do(key, func() (interface{}, error) {
+		return rc.fetch(base, destination, protos.Currencies(bc), protos.Currencies(dc))
+	})
+
+	if err == nil {
+		return v.(Rate), nil
+	}
+
+	rc.log.Error("Unable to get rate", "base", base, "currency", destination, "error", err)
+
+	if found && rc.fallback == RateFallbackStale {
+		rc.log.Warn("Using stale rate", "base", base, "currency", destination, "fetched_at", cached.FetchedAt)
+		cached.Stale = true
+		return cached, nil
+	}
+
+	return Rate{}, fmt.Errorf("%w: %s", ErrRateUnavailable, err)
+}
+
+// Refresh fetches the rate from the currency service, ignoring the cached value,
+// and returns true when the rate changed
+func (rc *RateCache) Refresh(base, destination string) (bool, error) {
+	bc, ok := protos.Currencies_value[base]
+
+	if !ok {
+		return false, ErrUnsupportedCurrency
+	}
+
+	dc, ok := protos.Currencies_value[destination]
+
+	if !ok {
+		return false, ErrUnsupportedCurrency
+	}
+
+	key := base + ":" + destination
+
+	rc.mu.RLock()
+	old, found := rc.rates[key]
+	rc.mu.RUnlock()
+
+	v, err, _ := rc.group.Do(key, func() (interface{}, error) {
+		return rc.fetch(base, destination, protos.Currencies(bc), protos.Currencies(dc))
+	})
+
+	if err != nil {
+		return false, err
+	}
+
+	return !found || old.Rate != v.(Rate).Rate, nil
+}
+
+// fetch calls the currency service through the circuit breaker and caches the rate
+func (rc *RateCache) fetch(base, destination string, bc, dc protos.Currencies) (Rate, error) {
+	err := rc.breaker.Allow()
+
+	if err != nil {
+		return Rate{}, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), rateRequestTimeout)
+	defer cancel()
+
+	resp, err := rc.currency.GetRate(ctx, &protos.RateRequest{Base: bc, Destination: dc})
+
+	if err != nil {
+		rc.breaker.Failure()
+		return Rate{}, err
+	}
+
+	rc.breaker.Success()
+
+	r := Rate{
+		Base:        base,
+		Destination: destination,
+		Rate:        resp.GetRate(),
+		FetchedAt:   time.Now().UTC(),
+	}
+
+	rc.mu.Lock()
+	rc.rates[base+":"+destination] = r
+	rc.mu.Unlock()
+
+	return r, nil
+}
@@ -0,0 +1,229 @@
+package data
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	protos "github.com/CharlesSchiavinato/go-microservices/service-currency-grpc/protos/currency"
+	"github.com/hashicorp/go-hclog"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+// fakeCurrencyServer is an in process CurrencyServer returning a fixed rate
+type fakeCurrencyServer struct {
+	mu    sync.Mutex
+	rate  float64
+	calls int32
+	fail  atomic.Value
+	delay time.Duration
+	// failBase fails the rates from this currency only
+	failBase string
+}
+
+func (f *fakeCurrencyServer) GetRate(ctx context.Context, rr *protos.RateRequest) (*protos.RateResponse, error) {
+	atomic.AddInt32(&f.calls, 1)
+	time.Sleep(f.delay)
+
+	if fail, _ := f.fail.Load().(bool); fail || rr.GetBase().String() == f.failBase {
+		return nil, fmt.Errorf("currency service failure")
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return &protos.RateResponse{Rate: f.rate}, nil
+}
+
+func (f *fakeCurrencyServer) setRate(r float64) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.rate = r
+}
+
+// setupCurrencyClient serves the fake server over an in memory connection
+func setupCurrencyClient(t *testing.T, fs *fakeCurrencyServer) protos.CurrencyClient {
+	lis := bufconn.Listen(1024 * 1024)
+
+	gs := grpc.NewServer()
+	protos.RegisterCurrencyServer(gs, fs)
+
+	go gs.Serve(lis)
+
+	conn, err := grpc.Dial(
+		"bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, s string) (net.Conn, error) {
+			return lis.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() {
+		conn.Close()
+		gs.Stop()
+	})
+
+	return protos.NewCurrencyClient(conn)
+}
+
+func TestRateCacheCachesRates(t *testing.T) {
+	fs := &fakeCurrencyServer{rate: 5.5}
+	rc := NewRateCache(hclog.NewNullLogger(), setupCurrencyClient(t, fs), time.Minute, RateFallbackUnavailable, NewCircuitBreaker(3, time.Minute))
+
+	for i := 0; i < 3; i++ {
+		r, err := rc.GetRate("EUR", "BRL")
+		assert.NoError(t, err)
+		assert.Equal(t, 5.5, r.Rate)
+		assert.False(t, r.Stale)
+	}
+
+	assert.Equal(t, int32(1), atomic.LoadInt32(&fs.calls))
+
+	_, err := rc.GetRate("EUR", "GBX")
+	assert.Equal(t, ErrUnsupportedCurrency, err)
+}
+
+func TestRateCacheDeduplicatesConcurrentLookups(t *testing.T) {
+	fs := &fakeCurrencyServer{rate: 1.1, delay: 50 * time.Millisecond}
+	rc := NewRateCache(hclog.NewNullLogger(), setupCurrencyClient(t, fs), time.Minute, RateFallbackUnavailable, NewCircuitBreaker(3, time.Minute))
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			_, err := rc.GetRate("EUR", "USD")
+			assert.NoError(t, err)
+		}()
+	}
+
+	wg.Wait()
+
+	assert.Equal(t, int32(1), atomic.LoadInt32(&fs.calls))
+}
+
+func TestRateCacheServesStaleRateWhenServiceFails(t *testing.T) {
+	fs := &fakeCurrencyServer{rate: 2}
+	rc := NewRateCache(hclog.NewNullLogger(), setupCurrencyClient(t, fs), 0, RateFallbackStale, NewCircuitBreaker(3, time.Minute))
+
+	_, err := rc.GetRate("EUR", "USD")
+	assert.NoError(t, err)
+
+	fs.fail.Store(true)
+
+	r, err := rc.GetRate("EUR", "USD")
+	assert.NoError(t, err)
+	assert.True(t, r.Stale)
+	assert.Equal(t, 2.0, r.Rate)
+
+	_, err = rc.GetRate("EUR", "JPY")
+	assert.ErrorIs(t, err, ErrRateUnavailable)
+}
+
+func TestRateCacheUnavailableFallback(t *testing.T) {
+	fs := &fakeCurrencyServer{rate: 2}
+	rc := NewRateCache(hclog.NewNullLogger(), setupCurrencyClient(t, fs), 0, RateFallbackUnavailable, NewCircuitBreaker(3, time.Minute))
+
+	_, err := rc.GetRate("EUR", "USD")
+	assert.NoError(t, err)
+
+	fs.fail.Store(true)
+
+	_, err = rc.GetRate("EUR", "USD")
+	assert.ErrorIs(t, err, ErrRateUnavailable)
+}
+
+func TestRateCacheBreakerStopsCallsToFailingService(t *testing.T) {
+	fs := &fakeCurrencyServer{rate: 2}
+	fs.fail.Store(true)
+	rc := NewRateCache(hclog.NewNullLogger(), setupCurrencyClient(t, fs), 0, RateFallbackUnavailable, NewCircuitBreaker(2, 50*time.Millisecond))
+
+	for i := 0; i < 5; i++ {
+		_, err := rc.GetRate("EUR", "USD")
+		assert.ErrorIs(t, err, ErrRateUnavailable)
+	}
+
+	assert.Equal(t, int32(2), atomic.LoadInt32(&fs.calls))
+
+	// after the open timeout a trial call closes the breaker
+	fs.fail.Store(false)
+	time.Sleep(60 * time.Millisecond)
+
+	_, err := rc.GetRate("EUR", "USD")
+	assert.NoError(t, err)
+	assert.Equal(t, int32(3), atomic.LoadInt32(&fs.calls))
+}
+
+func TestRateWatcherUpdatesChangedRates(t *testing.T) {
+	fs := &fakeCurrencyServer{rate: 2}
+	rc := NewRateCache(hclog.NewNullLogger(), setupCurrencyClient(t, fs), time.Hour, RateFallbackStale, NewCircuitBreaker(3, time.Minute))
+
+	r, err := rc.GetRate("EUR", "USD")
+	assert.NoError(t, err)
+	assert.Equal(t, 2.0, r.Rate)
+
+	fs.setRate(2.5)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	go NewRateWatcher(hclog.NewNullLogger(), rc, 10*time.Millisecond, time.Millisecond, 10*time.Millisecond).Run(ctx)
+
+	assert.Eventually(t, func() bool {
+		r, err := rc.GetRate("EUR", "USD")
+		return err == nil && r.Rate == 2.5
+	}, time.Second, 5*time.Millisecond)
+}
+
+func TestRateWatcherRetriesAfterFailure(t *testing.T) {
+	fs := &fakeCurrencyServer{rate: 3}
+	fs.fail.Store(true)
+	rc := NewRateCache(hclog.NewNullLogger(), setupCurrencyClient(t, fs), time.Hour, RateFallbackUnavailable, NewCircuitBreaker(100, time.Minute))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	go NewRateWatcher(hclog.NewNullLogger(), rc, time.Hour, time.Millisecond, 5*time.Millisecond).Run(ctx)
+
+	// the service recovers while the watcher is backing off
+	time.Sleep(20 * time.Millisecond)
+	fs.fail.Store(false)
+
+	assert.Eventually(t, func() bool {
+		calls := atomic.LoadInt32(&fs.calls)
+		r, err := rc.GetRate("BRL", "JPY")
+		return err == nil && r.Rate == 3 && atomic.LoadInt32(&fs.calls) == calls
+	}, time.Second, 5*time.Millisecond)
+}
+
+func TestRateWatcherRefreshesPairsAfterFailure(t *testing.T) {
+	fs := &fakeCurrencyServer{rate: 4, failBase: "EUR"}
+	rc := NewRateCache(hclog.NewNullLogger(), setupCurrencyClient(t, fs), time.Hour, RateFallbackUnavailable, NewCircuitBreaker(100, time.Minute))
+
+	err := NewRateWatcher(hclog.NewNullLogger(), rc, time.Hour, time.Millisecond, time.Millisecond).refresh()
+
+	n := len(supportedCurrencies())
+	assert.Error(t, err)
+	assert.Len(t, err.(refreshErrors), n-1)
+	assert.Equal(t, int32(n*(n-1)), atomic.LoadInt32(&fs.calls))
+
+	// the pairs after the failing ones were refreshed
+	r, err := rc.GetRate("USD", "JPY")
+	assert.NoError(t, err)
+	assert.Equal(t, 4.0, r.Rate)
+	assert.Equal(t, int32(n*(n-1)), atomic.LoadInt32(&fs.calls))
+}
@@ -0,0 +1,307 @@
+package data
+
+import (
+	"fmt"
+	"time"
+)
+
+var ErrReservationNotFound = fmt.Errorf("Reservation not found")
+var ErrReservationNotPending = fmt.Errorf("Reservation is no longer pending")
+
+// ReservationStatus is the state of a reservation
+type ReservationStatus string
+
+const (
+	// ReservationPending holds the stock until the reservation is confirmed, cancelled or expires
+	ReservationPending ReservationStatus = "pending"
+	// ReservationConfirmed removed the reserved units from the stock
+	ReservationConfirmed ReservationStatus = "confirmed"
+	// ReservationCancelled released the stock
+	ReservationCancelled ReservationStatus = "cancelled"
+	// ReservationExpired released the stock once its time to live was over
+	ReservationExpired ReservationStatus = "expired"
+)
+
+// Reservation holds units of products for a while, like during a checkout.
+// The held units can not be reserved again until the reservation is cancelled
+// or expires, they leave the stock when the reservation is confirmed
+// swagger:model
+type Reservation struct {
+	// the id of the reservation
+	ID int `json:"id"`
+	// the state of the reservation: pending, confirmed, cancelled or expired
+	Status ReservationStatus `json:"status"`
+	// the reserved products, all of them are reserved or none is
+	Items []ReservationItem `json:"items" validate:"required,min=1,max=100,dive"`
+	// the seconds the stock is held, the service default when absent
+	TTL int `json:"ttl,omitempty" validate:"gte=0"`
+	// the time the stock is released when the reservation is still pending
+	ExpiresAt time.Time `json:"expires_at"`
+	CreatedOn time.Time `json:"created_on"`
+	UpdatedOn time.Time `json:"updated_on"`
+}
+
+// ReservationItem is a quantity of a product to reserve
+// swagger:model
+type ReservationItem struct {
+	// the id of the product
+	ProductID int `json:"product_id" validate:"gt=0"`
+	// the warehouse to reserve from, the units are taken from the
+	// warehouses with available units when absent
+	Warehouse string `json:"warehouse,omitempty" validate:"customWarehouse"`
+	// the number of units
+	Quantity int `json:"quantity" validate:"gt=0"`
+	// the units held in each warehouse
+	Allocations []Allocation `json:"allocations,omitempty"`
+}
+
+// Allocation is the number of units of a reservation item held in a warehouse
+// swagger:model
+type Allocation struct {
+	// the code of the warehouse
+	Warehouse string `json:"warehouse"`
+	// the number of units
+	Quantity int `json:"quantity"`
+}
+
+// A reservation
+// swagger:response reservationResponse
+type reservationResponseWrapper struct {
+	// in: body
+	Body Reservation
+}
+
+// swagger:parameters GetReservation ConfirmReservation CancelReservation
+type reservationIDParameterWrapper struct {
+	// The id of the reservation
+	// in: path
+	// required: true
+	ID int `json:"id"`
+}
+
+// swagger:parameters CreateReservation
+type reservationParameterWrapper struct {
+	// in: body
+	// required: true
+	Body Reservation
+}
+
+// reservations keeps the reservations by id, it is guarded by productLock
+var reservations = map[int]*Reservation{}
+
+// reservationSeq is the id of the last reservation, it is guarded by productLock
+var reservationSeq int
+
+// Validate checks the items of the reservation
+func (rv *Reservation) Validate() error {
+	for i := range rv.Items {
+		rv.Items[i].Warehouse = NormalizeWarehouse(rv.Items[i].Warehouse)
+	}
+
+	return newInventoryValidator().Struct(rv)
+}
+
+// ReservationGet returns the reservation with the given id
+func (p *ProductDB) ReservationGet(id int) (*Reservation, error) {
+	productLock.RLock()
+	defer productLock.RUnlock()
+
+	rv, ok := reservations[id]
+
+	if !ok {
+		return nil, ErrReservationNotFound
+	}
+
+	nr := *rv
+
+	return &nr, nil
+}
+
+// ReservationCreate holds the units of all the items for the ttl, nothing is held when
+// an item can not be reserved. The availability is checked and the units are held in the
+// same critical section, so concurrent reservations never hold more than the stock
+func (p *ProductDB) ReservationCreate(rv *Reservation, ttl time.Duration) error {
+	productLock.Lock()
+	defer productLock.Unlock()
+
+	// the units are counted per stock level first, an item may take
+	// the units left in a warehouse by a previous item
+	held := map[*StockLevel]int{}
+
+	for i := range rv.Items {
+		it := &rv.Items[i]
+		it.Allocations = nil
+
+		if j := productIndexByID(it.ProductID); j < 0 || productList[j].IsDeleted() {
+			return fmt.Errorf("%w: product %d", ErrProductNotFound, it.ProductID)
+		}
+
+		levels := availableWarehouses(it.ProductID)
+
+		if it.Warehouse != "" {
+			levels = []*StockLevel{}
+
+			if sl, ok := stockLevels[it.ProductID][it.Warehouse]; ok {
+				levels = append(levels, sl)
+			}
+		}
+
+		need := it.Quantity
+
+		for _, sl := range levels {
+			free := sl.OnHand - sl.Reserved - held[sl]
+
+			if free <= 0 {
+				continue
+			}
+
+			if free > need {
+				free = need
+			}
+
+			held[sl] += free
+			it.Allocations = append(it.Allocations, Allocation{Warehouse: sl.Warehouse, Quantity: free})
+			need -= free
+
+			if need == 0 {
+				break
+			}
+		}
+
+		if need > 0 {
+			where := ""
+			if it.Warehouse != "" {
+				where = " in " + it.Warehouse
+			}
+
+			return fmt.Errorf("%w: %d of %d units of product %d are available%s", ErrInsufficientStock, it.Quantity-need, it.Quantity, it.ProductID, where)
+		}
+	}
+
+	now := time.Now().UTC()
+
+	for sl, q := range held {
+		sl.Reserved += q
+		sl.UpdatedOn = now
+	}
+
+	reservationSeq++
+	rv.ID = reservationSeq
+	rv.Status = ReservationPending
+	rv.TTL = int(ttl / time.Second)
+	rv.ExpiresAt = now.Add(ttl)
+	rv.CreatedOn = now
+	rv.UpdatedOn = now
+
+	// the stored reservation changes status, the caller keeps its own copy
+	nr := *rv
+	reservations[nr.ID] = &nr
+
+	return nil
+}
+
+// ReservationConfirm removes the reserved units from the stock, confirming a
+// confirmed reservation has no effect. An expired reservation can not be confirmed
+func (p *ProductDB) ReservationConfirm(id int) (*Reservation, error) {
+	return closeReservation(id, ReservationConfirmed)
+}
+
+// ReservationCancel releases the reserved units, cancelling a cancelled reservation has no effect
+func (p *ProductDB) ReservationCancel(id int) (*Reservation, error) {
+	return closeReservation(id, ReservationCancelled)
+}
+
+// closeReservation moves the pending reservation to the final status
+func closeReservation(id int, status ReservationStatus) (*Reservation, error) {
+	productLock.Lock()
+	defer productLock.Unlock()
+
+	rv, ok := reservations[id]
+
+	if !ok {
+		return nil, ErrReservationNotFound
+	}
+
+	now := time.Now().UTC()
+
+	// the expiry job may not have run yet
+	if rv.Status == ReservationPending && !now.Before(rv.ExpiresAt) {
+		releaseReservation(rv, ReservationExpired, now)
+	}
+
+	if rv.Status != status {
+		if rv.Status != ReservationPending {
+			return nil, fmt.Errorf("%w: it is %s", ErrReservationNotPending, rv.Status)
+		}
+
+		releaseReservation(rv, status, now)
+	}
+
+	nr := *rv
+
+	return &nr, nil
+}
+
+// ReservationExpire releases the stock of the pending reservations past their
+// expiry time, it returns the number of expired reservations
+func (p *ProductDB) ReservationExpire() int {
+	productLock.Lock()
+	defer productLock.Unlock()
+
+	now := time.Now().UTC()
+	expired := 0
+
+	for _, rv := range reservations {
+		if rv.Status == ReservationPending && !now.Before(rv.ExpiresAt) {
+			releaseReservation(rv, ReservationExpired, now)
+			expired++
+		}
+	}
+
+	return expired
+}
+
+// ReservationCleanup removes the reservations which are no longer pending
+// for longer than the retention, it returns the number of removed reservations
+func (p *ProductDB) ReservationCleanup(retention time.Duration) int {
+	productLock.Lock()
+	defer productLock.Unlock()
+
+	limit := time.Now().UTC().Add(-retention)
+	removed := 0
+
+	for id, rv := range reservations {
+		if rv.Status != ReservationPending && rv.UpdatedOn.Before(limit) {
+			delete(reservations, id)
+			removed++
+		}
+	}
+
+	return removed
+}
+
+// releaseReservation gives the reserved units back to the stock, the units leave
+// the stock when the reservation is confirmed. It must be called holding productLock
+func releaseReservation(rv *Reservation, status ReservationStatus, now time.Time) {
+	for _, it := range rv.Items {
+		for _, a := range it.Allocations {
+			// the stock of the purged products is gone
+			sl, ok := stockLevels[it.ProductID][a.Warehouse]
+
+			if !ok {
+				continue
+			}
+
+			sl.Reserved -= a.Quantity
+
+			if status == ReservationConfirmed {
+				sl.OnHand -= a.Quantity
+			}
+
+			sl.UpdatedOn = now
+		}
+	}
+
+	rv.Status = status
+	rv.UpdatedOn = now
+}
@@ -0,0 +1,258 @@
+package data
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+)
+
+var ErrRevisionNotFound = fmt.Errorf("Revision not found")
+
+// FieldChange is the change of a product field in a revision
+// swagger:model
+type FieldChange struct {
+	// the json name of the field
+	Field string `json:"field"`
+	// the value before the change, absent when the field was not set
+	From json.RawMessage `json:"from,omitempty"`
+	// the value after the change, absent when the field was cleared
+	To json.RawMessage `json:"to,omitempty"`
+}
+
+// Revision is an immutable record of a product change
+// swagger:model
+type Revision struct {
+	// the id of the product
+	ProductID int `json:"product_id"`
+	// the revision number, it is the version of the product after the change
+	Revision int `json:"revision"`
+	// kind of change: created, updated or deleted
+	Type ProductEventType `json:"type"`
+	// who made the change
+	Actor string `json:"actor"`
+	// time of the change
+	Time time.Time `json:"time"`
+	// the fields changed, all the fields on the creation
+	Changes []FieldChange `json:"changes"`
+	// the revision restored by this change, when it is a revert
+	RevertedFrom int `json:"reverted_from,omitempty"`
+	// the product after the change, only returned with a single revision
+	Product *Product `json:"product,omitempty"`
+}
+
+// revisions keeps the history of the products by product id, it is guarded by productLock
+var revisions = initialRevisions()
+
+// revisionFields are the fields compared between the revisions, the others
+// change on every revision or are not part of the product content
+var revisionFields = map[string]bool{
+	"name": true, "description": true, "price": true, "sku": true,
+	"category_id": true, "tags": true, "deleted_on": true, "images": true,
+}
+
+// addRevision records the product change in the history, prev is nil when the
+// product is created. It must be called holding productLock
+func addRevision(t ProductEventType, prev, pr *Product, actor string, revertedFrom int) *Revision {
+	rv := &Revision{
+		ProductID:    pr.ID,
+		Revision:     pr.Version,
+		Type:         t,
+		Actor:        actor,
+		Time:         pr.UpdatedOn,
+		Changes:      diffProducts(prev, pr),
+		RevertedFrom: revertedFrom,
+		Product:      copyProduct(pr),
+	}
+
+	revisions[pr.ID] = append(revisions[pr.ID], rv)
+
+	return rv
+}
+
+// initialRevisions records the creation of the initial products
+func initialRevisions() map[int][]*Revision {
+	rm := map[int][]*Revision{}
+
+	for _, pr := range productList {
+		rm[pr.ID] = []*Revision{{
+			ProductID: pr.ID,
+			Revision:  pr.Version,
+			Type:      ProductCreated,
+			Actor:     "system",
+			Time:      pr.CreatedOn,
+			Changes:   diffProducts(nil, pr),
+			Product:   copyProduct(pr),
+		}}
+	}
+
+	return rm
+}
+
+// copyProduct returns a copy of the product which shares none of its slices and
+// pointers, so the snapshots of the revisions are not changed with the product
+func copyProduct(pr *Product) *Product {
+	np := *pr
+
+	if pr.Tags != nil {
+		np.Tags = append([]string{}, pr.Tags...)
+	}
+
+	if pr.Images != nil {
+		np.Images = append([]ProductImage{}, pr.Images...)
+	}
+
+	if pr.DeletedOn != nil {
+		d := *pr.DeletedOn
+		np.DeletedOn = &d
+	}
+
+	return &np
+}
+
+// diffProducts returns the changes of the fields between the products, comparing
+// their json representation so the changes are reported as the API returns them
+func diffProducts(prev, pr *Product) []FieldChange {
+	from := productFields(prev)
+	to := productFields(pr)
+
+	names := []string{}
+	for f := range revisionFields {
+		names = append(names, f)
+	}
+
+	sort.Strings(names)
+
+	fc := []FieldChange{}
+	for _, f := range names {
+		if !bytes.Equal(from[f], to[f]) {
+			fc = append(fc, FieldChange{Field: f, From: from[f], To: to[f]})
+		}
+	}
+
+	return fc
+}
+
+// productFields returns the json value of each field of the product
+func productFields(pr *Product) map[string]json.RawMessage {
+	fm := map[string]json.RawMessage{}
+
+	if pr == nil {
+		return fm
+	}
+
+	b, err := json.Marshal(pr)
+
+	if err == nil {
+		json.Unmarshal(b, &fm)
+	}
+
+	return fm
+}
+
+// ProductHistory returns the revisions of the product with the given id from
+// the oldest to the newest, without the product snapshots
+func (p *ProductDB) ProductHistory(id int) ([]Revision, error) {
+	productLock.RLock()
+	defer productLock.RUnlock()
+
+	rl, ok := revisions[id]
+
+	if !ok {
+		return nil, ErrProductNotFound
+	}
+
+	h := make([]Revision, 0, len(rl))
+	for _, rv := range rl {
+		r := *rv
+		r.Product = nil
+		h = append(h, r)
+	}
+
+	return h, nil
+}
+
+// ProductRevision returns the revision of the product with the product as it was after the change
+func (p *ProductDB) ProductRevision(id, rev int) (*Revision, error) {
+	productLock.RLock()
+	defer productLock.RUnlock()
+
+	rl, ok := revisions[id]
+
+	if !ok {
+		return nil, ErrProductNotFound
+	}
+
+	for _, rv := range rl {
+		if rv.Revision == rev {
+			r := *rv
+			r.Product = copyProduct(rv.Product)
+
+			return &r, nil
+		}
+	}
+
+	return nil, ErrRevisionNotFound
+}
+
+// ProductRevert updates the product with the content it had in the given revision, its
+// attached images included, the revert is recorded as a new revision. Deleted products can not be reverted,
+// nor be reverted to a SKU another product uses now or to a removed category,
+// when version is greater than zero it must match the stored version of the product
+func (p *ProductDB) ProductRevert(id, rev, version int, actor string) (*Product, error) {
+	productLock.Lock()
+	defer productLock.Unlock()
+
+	i := productIndexByID(id)
+
+	if i < 0 || productList[i].IsDeleted() {
+		return nil, ErrProductNotFound
+	}
+
+	if version > 0 && productList[i].Version != version {
+		return nil, ErrVersionMismatch
+	}
+
+	var target *Product
+	for _, rv := range revisions[id] {
+		if rv.Revision == rev {
+			target = rv.Product
+		}
+	}
+
+	if target == nil {
+		return nil, ErrRevisionNotFound
+	}
+
+	prev := productList[i]
+	pr := *prev
+	pr.Name = target.Name
+	pr.Description = target.Description
+	pr.Price = target.Price
+	pr.SKU = target.SKU
+	pr.CategoryID = target.CategoryID
+	// the image files are kept by the image service when they are detached
+	tc := copyProduct(target)
+	pr.Tags = tc.Tags
+	pr.Images = tc.Images
+
+	if err := checkProductCategory(&pr); err != nil {
+		return nil, err
+	}
+
+	if err := assignSKU(&pr); err != nil {
+		return nil, err
+	}
+
+	pr.Version++
+	pr.UpdatedOn = time.Now().UTC()
+	productList[i] = &pr
+
+	record(ProductUpdated, prev, &pr, actor, rev)
+	p.notify()
+
+	np := pr
+
+	return &np, nil
+}
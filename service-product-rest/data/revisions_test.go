@@ -0,0 +1,113 @@
+package data
+
+import (
+	"testing"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestProductHistoryAndRevert(t *testing.T) {
+	pdb := NewProductDB(hclog.NewNullLogger(), nil, nil)
+
+	h, err := pdb.ProductHistory(1)
+	assert.NoError(t, err)
+	assert.Equal(t, "system", h[0].Actor)
+
+	pr := &Product{Name: "Cortado", Price: Money{Amount: 260, Currency: "EUR"}, SKU: "abc-abc-abc"}
+	pdb.ProductAdd(pr, "alice")
+
+	pu := &Product{ID: pr.ID, Name: "Cortado", Price: Money{Amount: 290, Currency: "EUR"}, SKU: "abc-abc-abc"}
+	assert.NoError(t, pdb.ProductUpdate(pu, 1, "bob"))
+
+	h, err = pdb.ProductHistory(pr.ID)
+	assert.NoError(t, err)
+	assert.Len(t, h, 2)
+	assert.Equal(t, "alice", h[0].Actor)
+	assert.Len(t, h[0].Changes, 4)
+	assert.Nil(t, h[0].Product)
+
+	assert.Equal(t, "bob", h[1].Actor)
+	assert.Equal(t, 2, h[1].Revision)
+	assert.Equal(t, []FieldChange{{
+		Field: "price",
+		From:  []byte(`{"amount":"2.60","currency":"EUR"}`),
+		To:    []byte(`{"amount":"2.90","currency":"EUR"}`),
+	}}, h[1].Changes)
+
+	rv, err := pdb.ProductRevision(pr.ID, 1)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(260), rv.Product.Price.Amount)
+
+	_, err = pdb.ProductRevision(pr.ID, 9)
+	assert.Equal(t, ErrRevisionNotFound, err)
+
+	_, err = pdb.ProductRevert(pr.ID, 1, 1, "carol")
+	assert.Equal(t, ErrVersionMismatch, err)
+
+	pg, err := pdb.ProductRevert(pr.ID, 1, 2, "carol")
+	assert.NoError(t, err)
+	assert.Equal(t, 3, pg.Version)
+	assert.Equal(t, int64(260), pg.Price.Amount)
+
+	rv, err = pdb.ProductRevision(pr.ID, 3)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, rv.RevertedFrom)
+	assert.Equal(t, "carol", rv.Actor)
+
+	// the history of a purged product is kept and its id is not reused
+	assert.NoError(t, pdb.ProductDelete(pr.ID, 0, "dave"))
+	pdb.ProductPurge(0)
+
+	h, err = pdb.ProductHistory(pr.ID)
+	assert.NoError(t, err)
+	assert.Len(t, h, 4)
+	assert.Equal(t, ProductDeleted, h[3].Type)
+
+	productLock.Lock()
+	assert.Greater(t, nextID(), pr.ID)
+	productLock.Unlock()
+
+	_, err = pdb.ProductRevert(pr.ID, 1, 0, "erin")
+	assert.Equal(t, ErrProductNotFound, err)
+}
+
+func TestProductRevertRestoresImages(t *testing.T) {
+	pdb := NewProductDB(hclog.NewNullLogger(), nil, nil)
+
+	pr := &Product{Name: "Ristretto", Price: Money{Amount: 180, Currency: "EUR"}, SKU: "rev-ris-tto", Tags: []string{"strong"}}
+	assert.NoError(t, pdb.ProductAdd(pr, "alice"))
+
+	defer func() {
+		pdb.ProductDelete(pr.ID, 0, "test")
+		pdb.ProductPurge(0)
+	}()
+
+	// the snapshots of the revisions do not share the tags with the product
+	pr.Tags[0] = "changed"
+
+	rv, err := pdb.ProductRevision(pr.ID, 1)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"strong"}, rv.Product.Tags)
+
+	_, err = pdb.ProductImagePut(pr.ID, &ProductImage{Filename: "front.png"}, "bob")
+	assert.NoError(t, err)
+	assert.NoError(t, pdb.ProductImageDelete(pr.ID, "front.png", "bob"))
+
+	pg, err := pdb.ProductRevert(pr.ID, 2, 3, "carol")
+	assert.NoError(t, err)
+	assert.Len(t, pg.Images, 1)
+	assert.Equal(t, "front.png", pg.Images[0].Filename)
+
+	// the event of the revert names the restored revision
+	var revert *ProductEvent
+	for _, e := range pdb.OutboxPending(1000) {
+		if e.Event.ProductID == pr.ID && e.Event.Version == 4 {
+			ev := e.Event
+			revert = &ev
+		}
+	}
+
+	assert.NotNil(t, revert)
+	assert.Equal(t, 2, revert.RevertedFrom)
+}
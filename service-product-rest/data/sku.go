@@ -0,0 +1,154 @@
+package data
+
+import (
+	"crypto/rand"
+	"fmt"
+	"math/big"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/go-playground/validator/v10"
+)
+
+// DefaultSKUPattern is the format of the SKUs, like abc-abc-abc
+const DefaultSKUPattern = `^[a-z]+-[a-z]+-[a-z]+$`
+
+var ErrDuplicateSKU = fmt.Errorf("SKU is used by another product")
+var ErrInvalidSKUPattern = fmt.Errorf("Generated SKUs do not match the SKU pattern")
+
+// skuLetters are the letters of the generated SKUs
+const skuLetters = "abcdefghijklmnopqrstuvwxyz"
+
+// skuPolicy defines the valid SKUs, it is set before the service starts
+var skuPolicy = struct {
+	pattern  *regexp.Regexp
+	generate bool
+}{regexp.MustCompile(DefaultSKUPattern), false}
+
+// SetSKUPolicy sets the pattern the SKUs must match, it is anchored to the whole
+// SKU and applies to the normalized SKUs, which are lower case. When generate is
+// true the SKU is optional and the products created without one get a generated
+// SKU, like lat-qhwzm-rcvpe, which must match the pattern.
+// It must be called before the products are validated or stored
+func SetSKUPolicy(pattern string, generate bool) error {
+	// the anchors apply to all the alternatives, ^a|b$ matches only a or b
+	re, err := regexp.Compile(`^(?:` + pattern + `)$`)
+
+	if err != nil {
+		return err
+	}
+
+	if generate && !re.MatchString(newSKU("sample")) {
+		return ErrInvalidSKUPattern
+	}
+
+	skuPolicy.pattern = re
+	skuPolicy.generate = generate
+
+	return nil
+}
+
+// NormalizeSKU removes the surrounding spaces and lowers the case of the SKU
+func NormalizeSKU(sku string) string {
+	return strings.ToLower(strings.TrimSpace(sku))
+}
+
+func validateSKU(fl validator.FieldLevel) bool {
+	sku := fl.Field().String()
+
+	if sku == "" {
+		return skuPolicy.generate
+	}
+
+	return skuPolicy.pattern.MatchString(sku)
+}
+
+// newSKU generates a SKU from the first letters of the product name followed by random letters
+func newSKU(name string) string {
+	prefix := ""
+	for _, c := range strings.ToLower(name) {
+		if len(prefix) == 3 {
+			break
+		}
+
+		if c >= 'a' && c <= 'z' {
+			prefix += string(c)
+		}
+	}
+
+	prefix += strings.Repeat("x", 3-len(prefix))
+
+	return prefix + "-" + randomLetters(5) + "-" + randomLetters(5)
+}
+
+func randomLetters(n int) string {
+	b := make([]byte, n)
+
+	for i := range b {
+		v, err := rand.Int(rand.Reader, big.NewInt(int64(len(skuLetters))))
+
+		if err != nil {
+			panic(err)
+		}
+
+		b[i] = skuLetters[v.Int64()]
+	}
+
+	return string(b)
+}
+
+// assignSKU normalizes the SKU of the product, generating it when it is empty and
+// the policy allows it, and checks no other product uses it. It must be called holding productLock
+func assignSKU(pr *Product) error {
+	pr.SKU = NormalizeSKU(pr.SKU)
+
+	if pr.SKU == "" && skuPolicy.generate {
+		for pr.SKU == "" || productIDBySKULocked(pr.SKU) != 0 {
+			pr.SKU = newSKU(pr.Name)
+		}
+
+		return nil
+	}
+
+	if id := productIDBySKULocked(pr.SKU); pr.SKU != "" && id != 0 && id != pr.ID {
+		return ErrDuplicateSKU
+	}
+
+	return nil
+}
+
+// productIDBySKU returns the id of the product which is not deleted with the given SKU, 0 when there is none
+func productIDBySKU(sku string) int {
+	productLock.RLock()
+	defer productLock.RUnlock()
+
+	return productIDBySKULocked(sku)
+}
+
+// productIDBySKULocked is productIDBySKU for the callers holding productLock
+func productIDBySKULocked(sku string) int {
+	sku = NormalizeSKU(sku)
+
+	for _, pr := range productList {
+		if !pr.IsDeleted() && pr.SKU == sku {
+			return pr.ID
+		}
+	}
+
+	return 0
+}
+
+// ProductGetBySKU returns the product which is not deleted with the given SKU, priced like
+// ProductGetPriced. The SKU is normalized before the lookup
+func (p *ProductDB) ProductGetBySKU(sku string, currency string, priceList string, at time.Time) (*Product, error) {
+	productLock.RLock()
+	id := productIDBySKULocked(sku)
+	productLock.RUnlock()
+
+	if id == 0 {
+		return nil, ErrProductNotFound
+	}
+
+	return p.ProductGetPriced(id, currency, false, priceList, at)
+}
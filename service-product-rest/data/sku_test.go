@@ -0,0 +1,50 @@
+package data
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestProductSKUValidation(t *testing.T) {
+	defer SetSKUPolicy(DefaultSKUPattern, false)
+
+	p := &Product{Name: "Latte", Price: Money{Amount: 245, Currency: "EUR"}, SKU: " ABC-def-GHI "}
+
+	p.Normalize()
+	assert.NoError(t, p.Validate())
+	assert.Equal(t, "abc-def-ghi", p.SKU)
+
+	// the pattern is anchored
+	p.SKU = "abc-def-ghi123"
+	assert.Error(t, p.Validate())
+
+	p.SKU = ""
+	assert.Error(t, p.Validate())
+
+	assert.NoError(t, SetSKUPolicy(DefaultSKUPattern, true))
+	assert.NoError(t, p.Validate())
+
+	assert.NoError(t, SetSKUPolicy(`[a-z]{3}[0-9]{3}`, false))
+	p.SKU = "abc123"
+	assert.NoError(t, p.Validate())
+	p.SKU = "xabc123"
+	assert.Error(t, p.Validate())
+
+	// each alternative is anchored
+	assert.NoError(t, SetSKUPolicy(`^[a-z]{3}|[0-9]{3}$`, false))
+	p.SKU = "abc"
+	assert.NoError(t, p.Validate())
+	p.SKU = "abc123"
+	assert.Error(t, p.Validate())
+	p.SKU = "x123"
+	assert.Error(t, p.Validate())
+
+	assert.Equal(t, ErrInvalidSKUPattern, SetSKUPolicy(`[a-z]{3}[0-9]{3}`, true))
+	assert.Error(t, SetSKUPolicy(`[a-z`, false))
+}
+
+func TestNewSKU(t *testing.T) {
+	assert.Regexp(t, `^lat-[a-z]{5}-[a-z]{5}$`, newSKU("Latte"))
+	assert.Regexp(t, `^gxx-[a-z]{5}-[a-z]{5}$`, newSKU("7 G"))
+}
@@ -0,0 +1,48 @@
+package data
+
+import (
+	"sort"
+	"strings"
+)
+
+// NormalizeTags returns the tags in lower case without the surrounding spaces,
+// sorted and without duplicates, nil when there are no tags
+func NormalizeTags(tags []string) []string {
+	seen := map[string]bool{}
+
+	var nt []string
+	for _, t := range tags {
+		t = strings.ToLower(strings.TrimSpace(t))
+
+		if t == "" || seen[t] {
+			continue
+		}
+
+		seen[t] = true
+		nt = append(nt, t)
+	}
+
+	sort.Strings(nt)
+
+	return nt
+}
+
+// hasTags returns true when the product has all the tags, which must be normalized
+func (p *Product) hasTags(tags []string) bool {
+	for _, t := range tags {
+		found := false
+
+		for _, pt := range p.Tags {
+			if pt == t {
+				found = true
+				break
+			}
+		}
+
+		if !found {
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,336 @@
+package data
+
+import (
+	"fmt"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/go-playground/validator/v10"
+)
+
+var ErrTranslationNotFound = fmt.Errorf("Translation not found")
+var ErrInvalidLocale = fmt.Errorf("Locale must be a language tag like pt or pt-BR")
+var ErrDefaultLocale = fmt.Errorf("The text in the default locale is the name and description of the product")
+
+// localePattern is the format of the normalized locales, a language with an optional script and region
+var localePattern = regexp.MustCompile(`^[a-z]{2,3}(-[A-Z][a-z]{3})?(-([A-Z]{2}|[0-9]{3}))?$`)
+
+// defaultLocale is the locale of the name and description of the products
+var defaultLocale = "en"
+
+// Translation is the name and description of a product in a locale
+// swagger:model
+type Translation struct {
+	// the language tag of the translation, like pt-BR
+	Locale string `json:"locale"`
+	// the translated name
+	Name string `json:"name" validate:"required,min=3,max=50"`
+	// the translated description, the description of the next locale of the fallback chain when empty
+	Description string    `json:"description,omitempty"`
+	UpdatedOn   time.Time `json:"updated_on"`
+}
+
+// The translations of a product, ordered by locale
+// swagger:response translationsResponse
+type translationsResponseWrapper struct {
+	// in: body
+	Body []Translation
+}
+
+// A translation of a product
+// swagger:response translationResponse
+type translationResponseWrapper struct {
+	// in: body
+	Body Translation
+}
+
+// swagger:parameters ListTranslations GetTranslation PutTranslation DeleteTranslation
+type translationProductIDParameterWrapper struct {
+	// The id of the product
+	// in: path
+	// required: true
+	ID int `json:"id"`
+}
+
+// swagger:parameters GetTranslation PutTranslation DeleteTranslation
+type translationLocaleParameterWrapper struct {
+	// The language tag of the translation, like pt-BR
+	// in: path
+	// required: true
+	Locale string `json:"locale"`
+}
+
+// swagger:parameters PutTranslation
+type translationParameterWrapper struct {
+	// in: body
+	// required: true
+	Body Translation
+}
+
+// translations keeps the translations by product and locale, it is guarded by productLock
+var translations = map[int]map[string]*Translation{}
+
+// SetDefaultLocale sets the locale of the name and description of the products
+func SetDefaultLocale(locale string) error {
+	l, ok := NormalizeLocale(locale)
+
+	if !ok {
+		return ErrInvalidLocale
+	}
+
+	productLock.Lock()
+	defaultLocale = l
+	productLock.Unlock()
+
+	return nil
+}
+
+// NormalizeLocale returns the language tag with the language in lower case and the region in upper
+// case, like pt-BR for pt_br. It returns false when the tag is not a language with an optional region
+func NormalizeLocale(tag string) (string, bool) {
+	parts := strings.Split(strings.ReplaceAll(strings.TrimSpace(tag), "_", "-"), "-")
+
+	for i, p := range parts {
+		switch {
+		case i == 0:
+			parts[i] = strings.ToLower(p)
+		case len(p) == 4:
+			parts[i] = strings.ToUpper(p[:1]) + strings.ToLower(p[1:])
+		default:
+			parts[i] = strings.ToUpper(p)
+		}
+	}
+
+	l := strings.Join(parts, "-")
+
+	return l, localePattern.MatchString(l)
+}
+
+// LocaleChain returns the locales to look the texts up for the preferred language tags, each
+// tag followed by its shorter tags and then the default locale, like pt-BR, pt, en. The
+// invalid tags are skipped
+func LocaleChain(preferred []string) []string {
+	productLock.RLock()
+	def := defaultLocale
+	productLock.RUnlock()
+
+	chain := []string{}
+	seen := map[string]bool{}
+
+	add := func(l string) {
+		if !seen[l] {
+			seen[l] = true
+			chain = append(chain, l)
+		}
+	}
+
+	for _, tag := range preferred {
+		l, ok := NormalizeLocale(tag)
+
+		if !ok {
+			continue
+		}
+
+		for {
+			add(l)
+
+			i := strings.LastIndex(l, "-")
+
+			if i < 0 {
+				break
+			}
+
+			l = l[:i]
+		}
+	}
+
+	add(def)
+
+	return chain
+}
+
+// Validate checks the fields of the translation
+func (t *Translation) Validate() error {
+	t.Name = strings.TrimSpace(t.Name)
+	t.Description = strings.TrimSpace(t.Description)
+
+	validate := validator.New()
+
+	// report the fields by their json name
+	validate.RegisterTagNameFunc(func(f reflect.StructField) string {
+		return strings.SplitN(f.Tag.Get("json"), ",", 2)[0]
+	})
+
+	return validate.Struct(t)
+}
+
+// TranslationList returns the translations of the product ordered by locale
+func (p *ProductDB) TranslationList(productID int) ([]Translation, error) {
+	productLock.RLock()
+	defer productLock.RUnlock()
+
+	if i := productIndexByID(productID); i < 0 || productList[i].IsDeleted() {
+		return nil, ErrProductNotFound
+	}
+
+	tl := []Translation{}
+	for _, t := range translations[productID] {
+		tl = append(tl, *t)
+	}
+
+	sort.Slice(tl, func(i, j int) bool {
+		return tl[i].Locale < tl[j].Locale
+	})
+
+	return tl, nil
+}
+
+// TranslationGet returns the translation of the product in the locale
+func (p *ProductDB) TranslationGet(productID int, locale string) (*Translation, error) {
+	l, ok := NormalizeLocale(locale)
+
+	if !ok {
+		return nil, ErrInvalidLocale
+	}
+
+	productLock.RLock()
+	defer productLock.RUnlock()
+
+	if i := productIndexByID(productID); i < 0 || productList[i].IsDeleted() {
+		return nil, ErrProductNotFound
+	}
+
+	t, ok := translations[productID][l]
+
+	if !ok {
+		return nil, ErrTranslationNotFound
+	}
+
+	nt := *t
+
+	return &nt, nil
+}
+
+// TranslationPut adds or replaces the translation of the product in the locale of
+// the translation, it returns true when the translation was added
+func (p *ProductDB) TranslationPut(productID int, t *Translation) (bool, error) {
+	l, ok := NormalizeLocale(t.Locale)
+
+	if !ok {
+		return false, ErrInvalidLocale
+	}
+
+	productLock.Lock()
+	defer productLock.Unlock()
+
+	if l == defaultLocale {
+		return false, ErrDefaultLocale
+	}
+
+	if i := productIndexByID(productID); i < 0 || productList[i].IsDeleted() {
+		return false, ErrProductNotFound
+	}
+
+	tm, ok := translations[productID]
+
+	if !ok {
+		tm = map[string]*Translation{}
+		translations[productID] = tm
+	}
+
+	_, exists := tm[l]
+
+	t.Locale = l
+	t.UpdatedOn = time.Now().UTC()
+
+	nt := *t
+	tm[l] = &nt
+
+	return !exists, nil
+}
+
+// TranslationDelete removes the translation of the product in the locale
+func (p *ProductDB) TranslationDelete(productID int, locale string) error {
+	l, ok := NormalizeLocale(locale)
+
+	if !ok {
+		return ErrInvalidLocale
+	}
+
+	productLock.Lock()
+	defer productLock.Unlock()
+
+	if i := productIndexByID(productID); i < 0 || productList[i].IsDeleted() {
+		return ErrProductNotFound
+	}
+
+	if _, ok := translations[productID][l]; !ok {
+		return ErrTranslationNotFound
+	}
+
+	delete(translations[productID], l)
+
+	return nil
+}
+
+// Localize replaces the name and description of the products with their translation in the
+// first locale of the chain having one. It returns the locales of the names, in the order
+// they were first used, for the Content-Language header
+func (p *ProductDB) Localize(pl []*Product, chain []string) []string {
+	productLock.RLock()
+	defer productLock.RUnlock()
+
+	used := []string{}
+	seen := map[string]bool{}
+
+	for _, pr := range pl {
+		l := localize(pr, chain)
+
+		if !seen[l] {
+			seen[l] = true
+			used = append(used, l)
+		}
+	}
+
+	return used
+}
+
+// localize translates the product with the chain, the default locale ends the lookup since the
+// product is written in it. It returns the locale of the name and must be called holding productLock
+func localize(pr *Product, chain []string) string {
+	tm := translations[pr.ID]
+	locale := defaultLocale
+	described := false
+
+	for _, l := range chain {
+		if l == defaultLocale {
+			break
+		}
+
+		t, ok := tm[l]
+
+		if !ok {
+			continue
+		}
+
+		if locale == defaultLocale {
+			pr.Name = t.Name
+			locale = l
+		}
+
+		// the description falls back along the chain on its own
+		if t.Description != "" && !described {
+			pr.Description = t.Description
+			described = true
+		}
+
+		if described {
+			break
+		}
+	}
+
+	return locale
+}
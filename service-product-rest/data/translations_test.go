@@ -0,0 +1,90 @@
+package data
+
+import (
+	"testing"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNormalizeLocale(t *testing.T) {
+	for tag, want := range map[string]string{
+		"pt":         "pt",
+		"PT_br":      "pt-BR",
+		" es-419 ":   "es-419",
+		"zh-hant-tw": "zh-Hant-TW",
+	} {
+		l, ok := NormalizeLocale(tag)
+		assert.True(t, ok, tag)
+		assert.Equal(t, want, l)
+	}
+
+	for _, tag := range []string{"", "*", "portuguese", "pt-BRA", "p1"} {
+		_, ok := NormalizeLocale(tag)
+		assert.False(t, ok, tag)
+	}
+}
+
+func TestLocaleChain(t *testing.T) {
+	assert.Equal(t, []string{"pt-BR", "pt", "es", "en"}, LocaleChain([]string{"pt-br", "pt", "es", "bogus!"}))
+	assert.Equal(t, []string{"en-GB", "en"}, LocaleChain([]string{"en-GB", "pt"})[:2])
+	assert.Equal(t, []string{"en"}, LocaleChain(nil))
+}
+
+func TestLocalize(t *testing.T) {
+	pdb := NewProductDB(hclog.NewNullLogger(), nil, nil)
+
+	pr := &Product{Name: "Iced latte", Description: "Milk and espresso over ice", Price: Money{Amount: 400, Currency: "EUR"}, SKU: "loc-ice-lat"}
+	assert.NoError(t, pdb.ProductAdd(pr, "test"))
+
+	added, err := pdb.TranslationPut(pr.ID, &Translation{Locale: "pt", Name: "Café gelado", Description: "Leite e espresso com gelo"})
+	assert.NoError(t, err)
+	assert.True(t, added)
+
+	// the description of pt-BR falls back to the pt one
+	_, err = pdb.TranslationPut(pr.ID, &Translation{Locale: "pt-br", Name: "Café com leite gelado"})
+	assert.NoError(t, err)
+
+	added, err = pdb.TranslationPut(pr.ID, &Translation{Locale: "pt-BR", Name: "Latte gelado"})
+	assert.NoError(t, err)
+	assert.False(t, added)
+
+	_, err = pdb.TranslationPut(pr.ID, &Translation{Locale: "en", Name: "Iced coffee"})
+	assert.Equal(t, ErrDefaultLocale, err)
+
+	_, err = pdb.TranslationPut(pr.ID, &Translation{Locale: "pt-", Name: "Latte"})
+	assert.Equal(t, ErrInvalidLocale, err)
+
+	localized := func(tags ...string) (*Product, []string) {
+		pg, err := pdb.ProductGetByID(pr.ID, "", false)
+		assert.NoError(t, err)
+
+		return pg, pdb.Localize([]*Product{pg}, LocaleChain(tags))
+	}
+
+	pg, locales := localized("pt-BR")
+	assert.Equal(t, "Latte gelado", pg.Name)
+	assert.Equal(t, "Leite e espresso com gelo", pg.Description)
+	assert.Equal(t, []string{"pt-BR"}, locales)
+
+	// the default locale is preferred to the later translations
+	pg, locales = localized("fr", "en", "pt")
+	assert.Equal(t, "Iced latte", pg.Name)
+	assert.Equal(t, []string{"en"}, locales)
+
+	tl, err := pdb.TranslationList(pr.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, "pt", tl[0].Locale)
+	assert.Equal(t, "pt-BR", tl[1].Locale)
+
+	assert.NoError(t, pdb.TranslationDelete(pr.ID, "pt-BR"))
+	assert.Equal(t, ErrTranslationNotFound, pdb.TranslationDelete(pr.ID, "pt-BR"))
+
+	pg, locales = localized("pt-BR")
+	assert.Equal(t, "Café gelado", pg.Name)
+	assert.Equal(t, []string{"pt"}, locales)
+
+	assert.NoError(t, pdb.ProductDelete(pr.ID, 0, "test"))
+	assert.Equal(t, 1, pdb.ProductPurge(0))
+	assert.NotContains(t, translations, pr.ID)
+}
@@ -0,0 +1,86 @@
+package data
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+
+	"github.com/go-playground/validator/v10"
+)
+
+// FieldError describes the validation failure of a single product field
+// swagger:model
+type FieldError struct {
+	// the json name of the field
+	Field string `json:"field"`
+	// the validation rule which failed
+	Rule string `json:"rule"`
+	// the parameter of the rule, like the min length
+	Param string `json:"param,omitempty"`
+	// human readable description of the failure
+	Message string `json:"message"`
+}
+
+// ValidationFieldErrors converts the error returned by Validate into a list
+// of field errors, it returns nil when err is not a validation error
+func ValidationFieldErrors(err error) []FieldError {
+	var ve validator.ValidationErrors
+
+	if !errors.As(err, &ve) {
+		return nil
+	}
+
+	fe := []FieldError{}
+	for _, e := range ve {
+		fe = append(fe, FieldError{
+			Field:   e.Field(),
+			Rule:    e.Tag(),
+			Param:   e.Param(),
+			Message: fieldErrorMessage(e),
+		})
+	}
+
+	return fe
+}
+
+func fieldErrorMessage(e validator.FieldError) string {
+	switch e.Tag() {
+	case "required":
+		return "is required"
+	case "min":
+		return fmt.Sprintf("must have at least %s %s", e.Param(), lengthUnit(e))
+	case "max":
+		return fmt.Sprintf("must have at most %s %s", e.Param(), lengthUnit(e))
+	case "gt":
+		return fmt.Sprintf("must be greater than %s", e.Param())
+	case "gte":
+		return fmt.Sprintf("must be at least %s", e.Param())
+	case "lte":
+		return fmt.Sprintf("must be at most %s", e.Param())
+	case "url":
+		return "must be an absolute URL"
+	case "startswith":
+		return fmt.Sprintf("must start with %s", e.Param())
+	case "oneof":
+		return fmt.Sprintf("must be one of: %s", e.Param())
+	case "customPrice":
+		return "must be a positive amount in a supported currency"
+	case "customSKU":
+		return fmt.Sprintf("must match the pattern %s", skuPolicy.pattern)
+	case "customPriceList":
+		return fmt.Sprintf("must match the pattern %s", priceListPattern)
+	case "customWarehouse":
+		return fmt.Sprintf("must match the pattern %s", warehousePattern)
+	}
+
+	return fmt.Sprintf("failed on the %s rule", e.Tag())
+}
+
+// lengthUnit returns what the length rules count on the field, the items of a list or the characters of a text
+func lengthUnit(e validator.FieldError) string {
+	if e.Kind() == reflect.Slice {
+		return "items"
+	}
+
+	return "characters"
+}
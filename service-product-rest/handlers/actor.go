@@ -0,0 +1,36 @@
+package handlers
+
+import (
+	"crypto/subtle"
+	"net/http"
+)
+
+// ActorHeader is the header identifying who makes the request, it is recorded in the product history
+const ActorHeader = "X-Actor"
+
+// AdminKeyHeader is the header carrying the key of the administrators
+const AdminKeyHeader = "X-Admin-Key"
+
+// anonymousActor is recorded when the request does not identify the actor
+const anonymousActor = "anonymous"
+
+// actor returns who makes the request, from the X-Actor header or else the X-Client-ID header
+func actor(r *http.Request) string {
+	if a := r.Header.Get(ActorHeader); a != "" && len(a) <= maxRequestIDLength {
+		return a
+	}
+
+	if c := r.Header.Get(ClientIDHeader); c != "" && len(c) <= maxRequestIDLength {
+		return c
+	}
+
+	return anonymousActor
+}
+
+// isAdmin returns true when the request carries the administrator key, nobody
+// is an administrator when the key is empty
+func isAdmin(r *http.Request, key string) bool {
+	k := r.Header.Get(AdminKeyHeader)
+
+	return key != "" && subtle.ConstantTimeCompare([]byte(k), []byte(key)) == 1
+}
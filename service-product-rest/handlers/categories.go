@@ -0,0 +1,253 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/CharlesSchiavinato/go-microservices/service-product-rest/data"
+	"github.com/gorilla/mux"
+	"github.com/hashicorp/go-hclog"
+)
+
+// Categories is a http.Handler managing the product categories
+type Categories struct {
+	l         hclog.Logger
+	productDB *data.ProductDB
+}
+
+// NewCategories creates the categories handler with the given data store
+func NewCategories(l hclog.Logger, pdb *data.ProductDB) *Categories {
+	return &Categories{l, pdb}
+}
+
+// swagger:route GET /categories categories ListCategories
+// Returns the categories ordered by id
+//
+// responses:
+//	200: categoriesResponse
+
+// CategoryList returns the categories
+func (c *Categories) CategoryList(rw http.ResponseWriter, r *http.Request) {
+	c.l.Debug("Handle CategoryList")
+
+	rw.Header().Add("Content-Type", "application/json")
+
+	err := data.ToJSON(c.productDB.CategoryList(), rw)
+
+	if err != nil {
+		c.l.Error("Handle CategoryList - Internal error", "error", err)
+		writeProblem(rw, r, http.StatusInternalServerError, "Unable to serialize the response")
+	}
+}
+
+// swagger:route GET /categories/tree categories GetCategoryTree
+// Returns the root categories with their subcategories
+//
+// responses:
+//	200: categoryTreeResponse
+
+// CategoryTree returns the categories as a tree
+func (c *Categories) CategoryTree(rw http.ResponseWriter, r *http.Request) {
+	c.l.Debug("Handle CategoryTree")
+
+	rw.Header().Add("Content-Type", "application/json")
+
+	err := data.ToJSON(c.productDB.CategoryTree(), rw)
+
+	if err != nil {
+		c.l.Error("Handle CategoryTree - Internal error", "error", err)
+		writeProblem(rw, r, http.StatusInternalServerError, "Unable to serialize the response")
+	}
+}
+
+// swagger:route GET /categories/{id} categories GetCategory
+// Returns a category
+//
+// responses:
+//	200: categoryResponse
+//	404: errorResponse
+
+// CategoryGet returns the category with the id of the path
+func (c *Categories) CategoryGet(rw http.ResponseWriter, r *http.Request) {
+	id, _ := strconv.Atoi(mux.Vars(r)["id"])
+
+	c.l.Debug("Handle CategoryGet", "id", id)
+
+	cg, err := c.productDB.CategoryGet(id)
+
+	if err == data.ErrCategoryNotFound {
+		writeProblem(rw, r, http.StatusNotFound, err.Error())
+		return
+	}
+
+	rw.Header().Add("Content-Type", "application/json")
+
+	err = data.ToJSON(cg, rw)
+
+	if err != nil {
+		c.l.Error("Handle CategoryGet - Internal error", "error", err)
+		writeProblem(rw, r, http.StatusInternalServerError, "Unable to serialize the response")
+	}
+}
+
+// swagger:route POST /categories categories CreateCategory
+// Creates a category, under the parent category when parent_id is set
+//
+// responses:
+//	201: categoryResponse
+//	400: errorResponse
+//	409: errorResponse
+//	422: errorValidation
+
+// CategoryCreate adds a category
+func (c *Categories) CategoryCreate(rw http.ResponseWriter, r *http.Request) {
+	c.l.Debug("Handle CategoryCreate")
+
+	cb, ok := c.readCategory(rw, r)
+
+	if !ok {
+		return
+	}
+
+	err := c.productDB.CategoryAdd(cb)
+
+	if !c.writeCategoryError(rw, r, "CategoryCreate", err) {
+		return
+	}
+
+	rw.Header().Set("Content-Type", "application/json")
+	rw.Header().Set("Location", fmt.Sprintf("/categories/%d", cb.ID))
+	rw.WriteHeader(http.StatusCreated)
+
+	err = data.ToJSON(cb, rw)
+
+	if err != nil {
+		c.l.Error("Handle CategoryCreate - Unable to serializing category", "error", err)
+	}
+}
+
+// swagger:route PUT /categories/{id} categories UpdateCategory
+// Renames a category or moves it under another parent, a category
+// can not be moved under itself or its subcategories
+//
+// responses:
+//	200: categoryResponse
+//	400: errorResponse
+//	404: errorResponse
+//	409: errorResponse
+//	422: errorValidation
+
+// CategoryUpdate replaces the category with the id of the path
+func (c *Categories) CategoryUpdate(rw http.ResponseWriter, r *http.Request) {
+	id, _ := strconv.Atoi(mux.Vars(r)["id"])
+
+	c.l.Debug("Handle CategoryUpdate", "id", id)
+
+	cb, ok := c.readCategory(rw, r)
+
+	if !ok {
+		return
+	}
+
+	cb.ID = id
+
+	err := c.productDB.CategoryUpdate(cb)
+
+	if err == data.ErrCategoryNotFound {
+		writeProblem(rw, r, http.StatusNotFound, err.Error())
+		return
+	}
+
+	if !c.writeCategoryError(rw, r, "CategoryUpdate", err) {
+		return
+	}
+
+	rw.Header().Set("Content-Type", "application/json")
+
+	err = data.ToJSON(cb, rw)
+
+	if err != nil {
+		c.l.Error("Handle CategoryUpdate - Unable to serializing category", "error", err)
+	}
+}
+
+// swagger:route DELETE /categories/{id} categories DeleteCategory
+// Removes a category, the categories with subcategories or used by products can not be removed
+//
+// responses:
+//	204: noContentResponse
+//	404: errorResponse
+//	409: errorResponse
+
+// CategoryDelete removes the category with the id of the path
+func (c *Categories) CategoryDelete(rw http.ResponseWriter, r *http.Request) {
+	id, _ := strconv.Atoi(mux.Vars(r)["id"])
+
+	c.l.Debug("Handle CategoryDelete", "id", id)
+
+	err := c.productDB.CategoryDelete(id)
+
+	if err == data.ErrCategoryNotFound {
+		writeProblem(rw, r, http.StatusNotFound, err.Error())
+		return
+	}
+
+	if err == data.ErrCategoryHasChildren || err == data.ErrCategoryInUse {
+		c.l.Error("Handle CategoryDelete - Category in use", "id", id, "error", err)
+		writeProblem(rw, r, http.StatusConflict, err.Error())
+		return
+	}
+
+	if err != nil {
+		c.l.Error("Handle CategoryDelete - Internal error", "id", id, "error", err)
+		writeProblem(rw, r, http.StatusInternalServerError, "Internal error")
+		return
+	}
+
+	rw.WriteHeader(http.StatusNoContent)
+}
+
+// readCategory decodes and validates the category of the request body,
+// it writes the error response and returns false when the category is invalid
+func (c *Categories) readCategory(rw http.ResponseWriter, r *http.Request) (*data.Category, bool) {
+	cb := &data.Category{}
+
+	err := data.FromJSON(cb, r.Body)
+
+	if err != nil {
+		c.l.Error("Handle Category - Deserializing category", "error", err)
+		writeProblem(rw, r, http.StatusBadRequest, fmt.Sprintf("Error reading category: %s", err))
+		return nil, false
+	}
+
+	err = cb.Validate()
+
+	if err != nil {
+		c.l.Error("Handle Category - Validating category", "error", err)
+		writeFieldsProblem(rw, r, "The category has invalid fields", err)
+		return nil, false
+	}
+
+	return cb, true
+}
+
+// writeCategoryError writes the error response of a category change,
+// it returns true when there was no error
+func (c *Categories) writeCategoryError(rw http.ResponseWriter, r *http.Request, handler string, err error) bool {
+	switch err {
+	case nil:
+		return true
+	case data.ErrParentCategoryNotFound, data.ErrCategoryCycle:
+		c.l.Error("Handle "+handler+" - Invalid parent", "error", err)
+		writeProblem(rw, r, http.StatusUnprocessableEntity, err.Error())
+	case data.ErrDuplicateCategory:
+		c.l.Error("Handle "+handler+" - Duplicate name", "error", err)
+		writeProblem(rw, r, http.StatusConflict, err.Error())
+	default:
+		c.l.Error("Handle "+handler+" - Internal error", "error", err)
+		writeProblem(rw, r, http.StatusInternalServerError, "Internal error")
+	}
+
+	return false
+}
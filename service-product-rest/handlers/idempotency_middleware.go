@@ -0,0 +1,200 @@
+package handlers
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/CharlesSchiavinato/go-microservices/service-product-rest/idempotency"
+	"github.com/hashicorp/go-hclog"
+)
+
+// IdempotencyKeyHeader is the header with the key identifying the retries of a request
+const IdempotencyKeyHeader = "Idempotency-Key"
+
+// ClientIDHeader identifies the client owning the idempotency keys,
+// the remote address is used when it is missing
+const ClientIDHeader = "X-Client-ID"
+
+// maxIdempotencyKeyLength limits the size of the keys accepted from the clients
+const maxIdempotencyKeyLength = 255
+
+// maxIdempotentBodySize is the max number of bytes read from an idempotent request
+const maxIdempotentBodySize = 1 << 20
+
+// swagger:parameters createProduct
+type idempotencyKeyParameterWrapper struct {
+	// Key identifying the retries of the request, the first response is replayed to the retries
+	// in: header
+	IdempotencyKey string `json:"Idempotency-Key"`
+}
+
+// Idempotency replays the stored response when a request is retried with the same Idempotency-Key
+type Idempotency struct {
+	l     hclog.Logger
+	store idempotency.Store
+	ttl   time.Duration
+}
+
+// NewIdempotency creates the idempotency handler, the responses are kept in store during ttl
+func NewIdempotency(l hclog.Logger, s idempotency.Store, ttl time.Duration) *Idempotency {
+	return &Idempotency{l, s, ttl}
+}
+
+// IdempotencyMiddleware stores the first response of the requests with the Idempotency-Key
+// header and replays it on the retries. A retry with a different body is rejected
+func (i *Idempotency) IdempotencyMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		key := r.Header.Get(IdempotencyKeyHeader)
+
+		if key == "" {
+			next.ServeHTTP(rw, r)
+			return
+		}
+
+		if len(key) > maxIdempotencyKeyLength {
+			writeProblem(rw, r, http.StatusBadRequest, "Invalid Idempotency-Key header")
+			return
+		}
+
+		body, err := io.ReadAll(http.MaxBytesReader(rw, r.Body, maxIdempotentBodySize))
+
+		var mbe *http.MaxBytesError
+		if errors.As(err, &mbe) {
+			i.l.Error("Handle IdempotencyMiddleware - Body too large", "limit", mbe.Limit)
+			writeProblem(rw, r, http.StatusRequestEntityTooLarge, fmt.Sprintf("The request body must be at most %d bytes", mbe.Limit))
+			return
+		}
+
+		if err != nil {
+			i.l.Error("Handle IdempotencyMiddleware - Reading body", "error", err)
+			writeProblem(rw, r, http.StatusBadRequest, "Error reading request")
+			return
+		}
+
+		r.Body = io.NopCloser(bytes.NewReader(body))
+
+		sk := clientID(r) + ":" + key
+		fp := fingerprint(r, body)
+
+		rec, ok, err := i.store.Begin(sk, fp, i.ttl)
+
+		if err != nil {
+			i.l.Error("Handle IdempotencyMiddleware - Reserving key", "error", err)
+			writeProblem(rw, r, http.StatusInternalServerError, "Internal error")
+			return
+		}
+
+		if !ok {
+			i.replay(rw, r, rec, fp)
+			return
+		}
+
+		// a panicking handler releases the key so the retries are not rejected until it expires
+		defer func() {
+			if v := recover(); v != nil {
+				if err := i.store.Release(sk); err != nil {
+					i.l.Error("Handle IdempotencyMiddleware - Releasing key", "error", err)
+				}
+
+				panic(v)
+			}
+		}()
+
+		rr := &recordingResponseWriter{rw: rw, status: http.StatusOK}
+		next.ServeHTTP(rr, r)
+
+		// server errors are not stored so the client can retry the request
+		if rr.status >= http.StatusInternalServerError {
+			err = i.store.Release(sk)
+		} else {
+			err = i.store.Complete(sk, &idempotency.Response{
+				Status: rr.status,
+				Header: rw.Header().Clone(),
+				Body:   rr.body.Bytes(),
+			})
+		}
+
+		if err != nil {
+			i.l.Error("Handle IdempotencyMiddleware - Storing response", "error", err)
+		}
+	})
+}
+
+// replay writes the response stored for a retried request
+func (i *Idempotency) replay(rw http.ResponseWriter, r *http.Request, rec *idempotency.Record, fp string) {
+	if rec.Fingerprint != fp {
+		writeProblem(rw, r, http.StatusUnprocessableEntity, "Idempotency-Key was already used with a different request")
+		return
+	}
+
+	if rec.Response == nil {
+		writeProblem(rw, r, http.StatusConflict, "A request with the same Idempotency-Key is being processed")
+		return
+	}
+
+	i.l.Debug("Handle IdempotencyMiddleware - Replaying response", "status", rec.Response.Status)
+
+	for k, v := range rec.Response.Header {
+		// keep the id of the current request
+		if k != RequestIDHeader {
+			rw.Header()[k] = v
+		}
+	}
+
+	rw.Header().Set("Idempotent-Replayed", "true")
+	rw.WriteHeader(rec.Response.Status)
+	rw.Write(rec.Response.Body)
+}
+
+// clientID returns the identity of the client sending the request
+func clientID(r *http.Request) string {
+	if id := r.Header.Get(ClientIDHeader); id != "" {
+		return id
+	}
+
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+
+	if err != nil {
+		return r.RemoteAddr
+	}
+
+	return host
+}
+
+// fingerprint identifies the method, path and body of the request
+func fingerprint(r *http.Request, body []byte) string {
+	h := sha256.New()
+	h.Write([]byte(r.Method + " " + r.URL.RequestURI() + "\n"))
+	h.Write(body)
+
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// recordingResponseWriter writes the response and keeps a copy of the status and body
+type recordingResponseWriter struct {
+	rw     http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (rr *recordingResponseWriter) Header() http.Header {
+	return rr.rw.Header()
+}
+
+func (rr *recordingResponseWriter) Write(p []byte) (int, error) {
+	rr.body.Write(p)
+
+	return rr.rw.Write(p)
+}
+
+func (rr *recordingResponseWriter) WriteHeader(statusCode int) {
+	rr.status = statusCode
+	rr.rw.WriteHeader(statusCode)
+}
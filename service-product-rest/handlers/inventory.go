@@ -0,0 +1,333 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/CharlesSchiavinato/go-microservices/service-product-rest/data"
+	"github.com/gorilla/mux"
+	"github.com/hashicorp/go-hclog"
+)
+
+// Inventory is a http.Handler managing the stock of the products and the reservations
+type Inventory struct {
+	l         hclog.Logger
+	productDB *data.ProductDB
+	// defaultTTL is the time the stock is held by the reservations without ttl
+	defaultTTL time.Duration
+	// maxTTL is the longest time a reservation can hold the stock
+	maxTTL time.Duration
+}
+
+// NewInventory creates the inventory handler with the given data store and reservation times
+func NewInventory(l hclog.Logger, pdb *data.ProductDB, defaultTTL, maxTTL time.Duration) *Inventory {
+	return &Inventory{l, pdb, defaultTTL, maxTTL}
+}
+
+// swagger:route GET /products/{id}/stock inventory GetStock
+// Returns the stock of a product in each warehouse
+//
+// responses:
+//	200: stockResponse
+//	404: errorResponse
+
+// StockGet returns the stock of the product with the id of the path
+func (i *Inventory) StockGet(rw http.ResponseWriter, r *http.Request) {
+	id, _ := strconv.Atoi(mux.Vars(r)["id"])
+
+	i.l.Debug("Handle StockGet", "id", id)
+
+	st, err := i.productDB.StockGet(id)
+
+	if err == data.ErrProductNotFound {
+		writeProblem(rw, r, http.StatusNotFound, err.Error())
+		return
+	}
+
+	i.writeStock(rw, r, "StockGet", st)
+}
+
+// swagger:route PUT /products/{id}/stock/{warehouse} inventory CountStock
+// Sets the quantity of a product in a warehouse after a stocktake,
+// the quantity can not be lower than the reserved units
+//
+// responses:
+//	200: stockResponse
+//	400: errorResponse
+//	404: errorResponse
+//	409: errorResponse
+//	422: errorValidation
+
+// StockCount sets the quantity of the product in the warehouse of the path
+func (i *Inventory) StockCount(rw http.ResponseWriter, r *http.Request) {
+	id, _ := strconv.Atoi(mux.Vars(r)["id"])
+	warehouse := mux.Vars(r)["warehouse"]
+
+	i.l.Debug("Handle StockCount", "id", id, "warehouse", warehouse)
+
+	sc := &data.StockCount{}
+
+	if !i.readBody(rw, r, "stock count", sc, sc.Validate) {
+		return
+	}
+
+	st, err := i.productDB.StockCount(id, warehouse, sc.OnHand)
+
+	if !i.writeStockError(rw, r, "StockCount", err) {
+		return
+	}
+
+	i.writeStock(rw, r, "StockCount", st)
+}
+
+// swagger:route POST /products/{id}/stock/{warehouse}/adjustments inventory AdjustStock
+// Adds units of a product to a warehouse, or removes them with a negative delta,
+// the quantity can not go below the reserved units
+//
+// responses:
+//	200: stockResponse
+//	400: errorResponse
+//	404: errorResponse
+//	409: errorResponse
+//	422: errorValidation
+
+// StockAdjust changes the quantity of the product in the warehouse of the path
+func (i *Inventory) StockAdjust(rw http.ResponseWriter, r *http.Request) {
+	id, _ := strconv.Atoi(mux.Vars(r)["id"])
+	warehouse := mux.Vars(r)["warehouse"]
+
+	i.l.Debug("Handle StockAdjust", "id", id, "warehouse", warehouse)
+
+	sa := &data.StockAdjustment{}
+
+	if !i.readBody(rw, r, "stock adjustment", sa, sa.Validate) {
+		return
+	}
+
+	st, err := i.productDB.StockAdjust(id, warehouse, sa.Delta)
+
+	if !i.writeStockError(rw, r, "StockAdjust", err) {
+		return
+	}
+
+	i.l.Info("Adjusted stock", "id", id, "warehouse", data.NormalizeWarehouse(warehouse), "delta", sa.Delta, "reason", sa.Reason, "actor", actor(r))
+
+	i.writeStock(rw, r, "StockAdjust", st)
+}
+
+// swagger:route POST /reservations inventory CreateReservation
+// Holds units of products until the reservation is confirmed, cancelled or
+// expires. All the items are reserved or none is
+//
+// responses:
+//	201: reservationResponse
+//	400: errorResponse
+//	409: errorResponse
+//	422: errorValidation
+
+// ReservationCreate reserves the items of the request body
+func (i *Inventory) ReservationCreate(rw http.ResponseWriter, r *http.Request) {
+	i.l.Debug("Handle ReservationCreate")
+
+	rv := &data.Reservation{}
+
+	if !i.readBody(rw, r, "reservation", rv, rv.Validate) {
+		return
+	}
+
+	ttl := i.defaultTTL
+
+	if rv.TTL > 0 {
+		ttl = time.Duration(rv.TTL) * time.Second
+	}
+
+	if ttl > i.maxTTL {
+		writeProblem(rw, r, http.StatusUnprocessableEntity, fmt.Sprintf("The ttl can not be longer than %d seconds", int(i.maxTTL/time.Second)))
+		return
+	}
+
+	err := i.productDB.ReservationCreate(rv, ttl)
+
+	if errors.Is(err, data.ErrProductNotFound) {
+		i.l.Error("Handle ReservationCreate - Unknown product", "error", err)
+		writeProblem(rw, r, http.StatusUnprocessableEntity, err.Error())
+		return
+	}
+
+	if errors.Is(err, data.ErrInsufficientStock) {
+		i.l.Error("Handle ReservationCreate - Insufficient stock", "error", err)
+		writeProblem(rw, r, http.StatusConflict, err.Error())
+		return
+	}
+
+	if err != nil {
+		i.l.Error("Handle ReservationCreate - Internal error", "error", err)
+		writeProblem(rw, r, http.StatusInternalServerError, "Internal error")
+		return
+	}
+
+	rw.Header().Set("Content-Type", "application/json")
+	rw.Header().Set("Location", fmt.Sprintf("/reservations/%d", rv.ID))
+	rw.WriteHeader(http.StatusCreated)
+
+	err = data.ToJSON(rv, rw)
+
+	if err != nil {
+		i.l.Error("Handle ReservationCreate - Unable to serializing reservation", "error", err)
+	}
+}
+
+// swagger:route GET /reservations/{id} inventory GetReservation
+// Returns a reservation
+//
+// responses:
+//	200: reservationResponse
+//	404: errorResponse
+
+// ReservationGet returns the reservation with the id of the path
+func (i *Inventory) ReservationGet(rw http.ResponseWriter, r *http.Request) {
+	id, _ := strconv.Atoi(mux.Vars(r)["id"])
+
+	i.l.Debug("Handle ReservationGet", "id", id)
+
+	rv, err := i.productDB.ReservationGet(id)
+
+	if err == data.ErrReservationNotFound {
+		writeProblem(rw, r, http.StatusNotFound, err.Error())
+		return
+	}
+
+	i.writeReservation(rw, r, "ReservationGet", rv)
+}
+
+// swagger:route POST /reservations/{id}/confirm inventory ConfirmReservation
+// Confirms a pending reservation, the reserved units leave the stock
+//
+// responses:
+//	200: reservationResponse
+//	404: errorResponse
+//	409: errorResponse
+
+// ReservationConfirm confirms the reservation with the id of the path
+func (i *Inventory) ReservationConfirm(rw http.ResponseWriter, r *http.Request) {
+	id, _ := strconv.Atoi(mux.Vars(r)["id"])
+
+	i.l.Debug("Handle ReservationConfirm", "id", id)
+
+	rv, err := i.productDB.ReservationConfirm(id)
+
+	if !i.writeReservationError(rw, r, "ReservationConfirm", err) {
+		return
+	}
+
+	i.writeReservation(rw, r, "ReservationConfirm", rv)
+}
+
+// swagger:route POST /reservations/{id}/cancel inventory CancelReservation
+// Cancels a pending reservation, the reserved units can be reserved again
+//
+// responses:
+//	200: reservationResponse
+//	404: errorResponse
+//	409: errorResponse
+
+// ReservationCancel cancels the reservation with the id of the path
+func (i *Inventory) ReservationCancel(rw http.ResponseWriter, r *http.Request) {
+	id, _ := strconv.Atoi(mux.Vars(r)["id"])
+
+	i.l.Debug("Handle ReservationCancel", "id", id)
+
+	rv, err := i.productDB.ReservationCancel(id)
+
+	if !i.writeReservationError(rw, r, "ReservationCancel", err) {
+		return
+	}
+
+	i.writeReservation(rw, r, "ReservationCancel", rv)
+}
+
+// readBody decodes and validates the request body, it writes the
+// error response and returns false when the body is invalid
+func (i *Inventory) readBody(rw http.ResponseWriter, r *http.Request, name string, v interface{}, validate func() error) bool {
+	err := data.FromJSON(v, r.Body)
+
+	if err != nil {
+		i.l.Error("Handle Inventory - Deserializing "+name, "error", err)
+		writeProblem(rw, r, http.StatusBadRequest, fmt.Sprintf("Error reading %s: %s", name, err))
+		return false
+	}
+
+	err = validate()
+
+	if err != nil {
+		i.l.Error("Handle Inventory - Validating "+name, "error", err)
+		writeFieldsProblem(rw, r, fmt.Sprintf("The %s has invalid fields", name), err)
+		return false
+	}
+
+	return true
+}
+
+// writeStockError writes the error response of a stock change, it returns true when there was no error
+func (i *Inventory) writeStockError(rw http.ResponseWriter, r *http.Request, handler string, err error) bool {
+	switch {
+	case err == nil:
+		return true
+	case err == data.ErrProductNotFound:
+		writeProblem(rw, r, http.StatusNotFound, err.Error())
+	case err == data.ErrInvalidWarehouse:
+		i.l.Error("Handle "+handler+" - Invalid warehouse", "error", err)
+		writeProblem(rw, r, http.StatusBadRequest, err.Error())
+	case errors.Is(err, data.ErrInsufficientStock):
+		i.l.Error("Handle "+handler+" - Reserved units", "error", err)
+		writeProblem(rw, r, http.StatusConflict, err.Error())
+	default:
+		i.l.Error("Handle "+handler+" - Internal error", "error", err)
+		writeProblem(rw, r, http.StatusInternalServerError, "Internal error")
+	}
+
+	return false
+}
+
+// writeReservationError writes the error response of a reservation change, it returns true when there was no error
+func (i *Inventory) writeReservationError(rw http.ResponseWriter, r *http.Request, handler string, err error) bool {
+	switch {
+	case err == nil:
+		return true
+	case err == data.ErrReservationNotFound:
+		writeProblem(rw, r, http.StatusNotFound, err.Error())
+	case errors.Is(err, data.ErrReservationNotPending):
+		i.l.Error("Handle "+handler+" - Reservation closed", "error", err)
+		writeProblem(rw, r, http.StatusConflict, err.Error())
+	default:
+		i.l.Error("Handle "+handler+" - Internal error", "error", err)
+		writeProblem(rw, r, http.StatusInternalServerError, "Internal error")
+	}
+
+	return false
+}
+
+func (i *Inventory) writeStock(rw http.ResponseWriter, r *http.Request, handler string, st *data.Stock) {
+	rw.Header().Set("Content-Type", "application/json")
+
+	err := data.ToJSON(st, rw)
+
+	if err != nil {
+		i.l.Error("Handle "+handler+" - Internal error", "error", err)
+		writeProblem(rw, r, http.StatusInternalServerError, "Unable to serialize the response")
+	}
+}
+
+func (i *Inventory) writeReservation(rw http.ResponseWriter, r *http.Request, handler string, rv *data.Reservation) {
+	rw.Header().Set("Content-Type", "application/json")
+
+	err := data.ToJSON(rv, rw)
+
+	if err != nil {
+		i.l.Error("Handle "+handler+" - Internal error", "error", err)
+		writeProblem(rw, r, http.StatusInternalServerError, "Unable to serialize the response")
+	}
+}
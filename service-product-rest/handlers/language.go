@@ -0,0 +1,70 @@
+package handlers
+
+import (
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/CharlesSchiavinato/go-microservices/service-product-rest/data"
+)
+
+// acceptedLanguages returns the language tags of the Accept-Language header from the most
+// preferred, without the wildcard and the tags refused with q=0. The tags with an invalid
+// weight are skipped
+func acceptedLanguages(r *http.Request) []string {
+	type weighted struct {
+		tag string
+		q   float64
+	}
+
+	wl := []weighted{}
+
+	for _, h := range r.Header.Values("Accept-Language") {
+		for _, part := range strings.Split(h, ",") {
+			tag, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+			tag = strings.TrimSpace(tag)
+			q := 1.0
+
+			if params = strings.TrimSpace(params); strings.HasPrefix(params, "q=") {
+				v, err := strconv.ParseFloat(strings.TrimPrefix(params, "q="), 64)
+
+				if err != nil || v < 0 || v > 1 {
+					continue
+				}
+
+				q = v
+			}
+
+			if tag == "" || tag == "*" || q == 0 {
+				continue
+			}
+
+			wl = append(wl, weighted{tag, q})
+		}
+	}
+
+	// the tags with the same weight keep the order of the header
+	sort.SliceStable(wl, func(i, j int) bool {
+		return wl[i].q > wl[j].q
+	})
+
+	tags := make([]string, 0, len(wl))
+	for _, w := range wl {
+		tags = append(tags, w.tag)
+	}
+
+	return tags
+}
+
+// localize translates the products to the languages of the Accept-Language header and
+// sets the Content-Language header to the locales of the returned texts
+func (p *Products) localize(rw http.ResponseWriter, r *http.Request, pl ...*data.Product) {
+	rw.Header().Add("Vary", "Accept-Language")
+
+	locales := p.productDB.Localize(pl, data.LocaleChain(acceptedLanguages(r)))
+
+	if len(locales) > 0 {
+		rw.Header().Set("Content-Language", strings.Join(locales, ", "))
+	}
+}
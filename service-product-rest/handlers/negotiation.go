@@ -0,0 +1,292 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/CharlesSchiavinato/go-microservices/service-product-rest/data"
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+// Media types of the product representations
+const (
+	JSONContentType    = "application/json"
+	XMLContentType     = "application/xml"
+	MsgpackContentType = "application/msgpack"
+)
+
+// productTypes are the media types of a product in the order of preference of the service,
+// listTypes adds CSV which only represents the lists of products
+var (
+	productTypes = []string{JSONContentType, XMLContentType, MsgpackContentType}
+	listTypes    = []string{JSONContentType, XMLContentType, data.CSVContentType, MsgpackContentType}
+)
+
+// mediaTypeAliases maps the other names of the supported media types to the name they are served as
+var mediaTypeAliases = map[string]string{
+	"text/xml":              XMLContentType,
+	"application/x-msgpack": MsgpackContentType,
+}
+
+// maxBodySize is the max number of bytes read from a product request body
+const maxBodySize = 1 << 20
+
+var errUnsupportedMediaType = fmt.Errorf("Content-Type must be %s, %s or %s", JSONContentType, XMLContentType, MsgpackContentType)
+
+// negotiate returns the media type of the response for the Accept header of the request, it
+// writes the 406 response and returns false when none of the offered media types is accepted
+func (p *Products) negotiate(rw http.ResponseWriter, r *http.Request, handler string, offers []string) (string, bool) {
+	rw.Header().Add("Vary", "Accept")
+
+	mt, ok := preferredMediaType(r, offers)
+
+	if !ok {
+		p.l.Error("Handle "+handler+" - Not acceptable", "accept", r.Header.Get("Accept"))
+		writeProblem(rw, r, http.StatusNotAcceptable, fmt.Sprintf("Accept must allow one of %s", strings.Join(offers, ", ")))
+		return "", false
+	}
+
+	return mt, true
+}
+
+// preferredMediaType returns the offered media type the Accept header prefers: the ranges are
+// tried from the highest weight and, with the same weight, from the most specific, and the first
+// offer of a range wins. The offers refused with q=0 are skipped. The first offer is returned when
+// the header is absent or has no valid range
+func preferredMediaType(r *http.Request, offers []string) (string, bool) {
+	type weighted struct {
+		mediaRange  string
+		q           float64
+		specificity int
+	}
+
+	wl := []weighted{}
+	refused := map[string]bool{}
+	valid := false
+
+	for _, h := range r.Header.Values("Accept") {
+		for _, part := range strings.Split(h, ",") {
+			mr, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+			mr = strings.ToLower(strings.TrimSpace(mr))
+			q := 1.0
+
+			if t, s, ok := strings.Cut(mr, "/"); !ok || t == "" || s == "" || (t == "*" && s != "*") {
+				continue
+			}
+
+			if alias, ok := mediaTypeAliases[mr]; ok {
+				mr = alias
+			}
+
+			for _, param := range strings.Split(params, ";") {
+				if param = strings.TrimSpace(param); strings.HasPrefix(param, "q=") {
+					q, _ = strconv.ParseFloat(strings.TrimPrefix(param, "q="), 64)
+				}
+			}
+
+			if q < 0 || q > 1 {
+				continue
+			}
+
+			valid = true
+
+			if q == 0 {
+				refused[mr] = true
+				continue
+			}
+
+			specificity := 2
+			switch {
+			case mr == "*/*":
+				specificity = 0
+			case strings.HasSuffix(mr, "/*"):
+				specificity = 1
+			}
+
+			wl = append(wl, weighted{mr, q, specificity})
+		}
+	}
+
+	if !valid {
+		return offers[0], true
+	}
+
+	sort.SliceStable(wl, func(i, j int) bool {
+		if wl[i].q != wl[j].q {
+			return wl[i].q > wl[j].q
+		}
+
+		return wl[i].specificity > wl[j].specificity
+	})
+
+	for _, w := range wl {
+		for _, o := range offers {
+			if !refused[o] && matchesMediaRange(w.mediaRange, o) {
+				return o, true
+			}
+		}
+	}
+
+	return "", false
+}
+
+// matchesMediaRange returns true when the media type is in the range, like application/* or */*
+func matchesMediaRange(mediaRange, mediaType string) bool {
+	if mediaRange == "*/*" || mediaRange == mediaType {
+		return true
+	}
+
+	return strings.HasSuffix(mediaRange, "/*") && strings.HasPrefix(mediaType, strings.TrimSuffix(mediaRange, "*"))
+}
+
+// writeRepresentation writes the status and the value in the media type. The value is encoded
+// before the status is written, so an encoding error can still be reported
+func writeRepresentation(rw http.ResponseWriter, status int, mediaType string, v interface{}) error {
+	b, err := encodeRepresentation(mediaType, v)
+
+	if err != nil {
+		return err
+	}
+
+	rw.Header().Set("Content-Type", mediaType)
+	rw.WriteHeader(status)
+
+	_, err = rw.Write(b)
+
+	return err
+}
+
+// encodeRepresentation encodes the value in the media type. In XML the lists of products are
+// the product elements of a products element, in CSV they have the columns of the export
+func encodeRepresentation(mediaType string, v interface{}) ([]byte, error) {
+	buf := &bytes.Buffer{}
+
+	switch mediaType {
+	case JSONContentType:
+		if err := data.ToJSON(v, buf); err != nil {
+			return nil, err
+		}
+	case XMLContentType:
+		buf.WriteString(xml.Header)
+
+		if err := encodeXML(buf, v); err != nil {
+			return nil, err
+		}
+
+		buf.WriteString("\n")
+	case MsgpackContentType:
+		if err := NewMsgpackEncoder(buf).Encode(v); err != nil {
+			return nil, err
+		}
+	case data.CSVContentType:
+		pl, ok := v.(data.Products)
+
+		if !ok {
+			return nil, fmt.Errorf("Unable to write %T to CSV", v)
+		}
+
+		w := csv.NewWriter(buf)
+
+		if err := data.WriteCSVHeader(w); err != nil {
+			return nil, err
+		}
+
+		for _, pr := range pl {
+			if err := pr.WriteCSV(w); err != nil {
+				return nil, err
+			}
+		}
+
+		w.Flush()
+
+		if err := w.Error(); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("Unsupported media type %s", mediaType)
+	}
+
+	return buf.Bytes(), nil
+}
+
+// encodeXML encodes the products, the lists of products and the pages of products to XML,
+// the other values name their root element
+func encodeXML(w io.Writer, v interface{}) error {
+	e := xml.NewEncoder(w)
+
+	switch v := v.(type) {
+	case *data.Product:
+		return e.EncodeElement(v, xml.StartElement{Name: xml.Name{Local: "product"}})
+	case data.Products:
+		return e.EncodeElement(struct {
+			Products data.Products `xml:"product"`
+		}{v}, xml.StartElement{Name: xml.Name{Local: "products"}})
+	case *data.ProductPage:
+		return e.EncodeElement(v, xml.StartElement{Name: xml.Name{Local: "page"}})
+	case []interface{}:
+		// the projections of the products name their element
+		return e.EncodeElement(struct {
+			Products []interface{} `xml:"product"`
+		}{v}, xml.StartElement{Name: xml.Name{Local: "products"}})
+	}
+
+	return e.Encode(v)
+}
+
+// NewMsgpackEncoder returns a MessagePack encoder naming the fields like the JSON representation,
+// with the integers in their smallest format and the map keys sorted
+func NewMsgpackEncoder(w io.Writer) *msgpack.Encoder {
+	enc := msgpack.NewEncoder(w)
+	enc.SetCustomStructTag("json")
+	enc.UseCompactInts(true)
+	enc.SetSortMapKeys(true)
+
+	return enc
+}
+
+// NewMsgpackDecoder returns a MessagePack decoder naming the fields like the JSON representation
+func NewMsgpackDecoder(r io.Reader) *msgpack.Decoder {
+	dec := msgpack.NewDecoder(r)
+	dec.SetCustomStructTag("json")
+
+	return dec
+}
+
+// decodeRepresentation decodes the request body by its Content-Type, the body is JSON when the
+// header is absent. It returns errUnsupportedMediaType for the other media types
+func decodeRepresentation(r *http.Request, v interface{}) error {
+	mt := JSONContentType
+
+	if ct := r.Header.Get("Content-Type"); ct != "" {
+		var err error
+
+		mt, _, err = mime.ParseMediaType(ct)
+
+		if err != nil {
+			return errUnsupportedMediaType
+		}
+	}
+
+	if alias, ok := mediaTypeAliases[mt]; ok {
+		mt = alias
+	}
+
+	switch mt {
+	case JSONContentType:
+		return data.FromJSON(v, r.Body)
+	case XMLContentType:
+		return xml.NewDecoder(r.Body).Decode(v)
+	case MsgpackContentType:
+		return NewMsgpackDecoder(r.Body).Decode(v)
+	}
+
+	return errUnsupportedMediaType
+}
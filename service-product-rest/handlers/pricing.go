@@ -0,0 +1,268 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/CharlesSchiavinato/go-microservices/service-product-rest/data"
+	"github.com/gorilla/mux"
+	"github.com/hashicorp/go-hclog"
+)
+
+// Pricing is a http.Handler managing the prices of the price lists and the promotions
+type Pricing struct {
+	l         hclog.Logger
+	productDB *data.ProductDB
+}
+
+// NewPricing creates the pricing handler with the given data store
+func NewPricing(l hclog.Logger, pdb *data.ProductDB) *Pricing {
+	return &Pricing{l, pdb}
+}
+
+// swagger:route GET /products/{id}/prices pricing ListPrices
+// Returns the prices of a product in the price lists, ordered by price list and start
+//
+// responses:
+//	200: pricesResponse
+//	404: errorResponse
+
+// PriceList returns the prices of the product with the id of the path
+func (p *Pricing) PriceList(rw http.ResponseWriter, r *http.Request) {
+	id, _ := strconv.Atoi(mux.Vars(r)["id"])
+
+	p.l.Debug("Handle PriceList", "id", id)
+
+	el, err := p.productDB.PriceList(id)
+
+	if err == data.ErrProductNotFound {
+		writeProblem(rw, r, http.StatusNotFound, err.Error())
+		return
+	}
+
+	p.writeJSON(rw, r, "PriceList", el)
+}
+
+// swagger:route POST /products/{id}/prices pricing CreatePrice
+// Adds a price of a product to a price list, with an effective period to schedule a price change
+//
+// responses:
+//	201: priceResponse
+//	400: errorResponse
+//	404: errorResponse
+//	422: errorValidation
+
+// PriceCreate adds the price of the request body to the product with the id of the path
+func (p *Pricing) PriceCreate(rw http.ResponseWriter, r *http.Request) {
+	id, _ := strconv.Atoi(mux.Vars(r)["id"])
+
+	p.l.Debug("Handle PriceCreate", "id", id)
+
+	e := &data.PriceEntry{}
+
+	if !p.readBody(rw, r, "price", e, e.Validate) {
+		return
+	}
+
+	e.ProductID = id
+
+	err := p.productDB.PriceAdd(e)
+
+	if err == data.ErrProductNotFound {
+		writeProblem(rw, r, http.StatusNotFound, err.Error())
+		return
+	}
+
+	if err == data.ErrInvalidPeriod {
+		p.l.Error("Handle PriceCreate - Invalid period", "id", id, "error", err)
+		writeProblem(rw, r, http.StatusUnprocessableEntity, err.Error())
+		return
+	}
+
+	if err != nil {
+		p.l.Error("Handle PriceCreate - Internal error", "id", id, "error", err)
+		writeProblem(rw, r, http.StatusInternalServerError, "Internal error")
+		return
+	}
+
+	rw.Header().Set("Location", fmt.Sprintf("/products/%d/prices/%d", id, e.ID))
+	p.writeCreated(rw, "PriceCreate", e)
+}
+
+// swagger:route DELETE /products/{id}/prices/{price} pricing DeletePrice
+// Removes a price of a product
+//
+// responses:
+//	204: noContentResponse
+//	404: errorResponse
+
+// PriceDelete removes the price with the id of the path
+func (p *Pricing) PriceDelete(rw http.ResponseWriter, r *http.Request) {
+	id, _ := strconv.Atoi(mux.Vars(r)["id"])
+	price, _ := strconv.Atoi(mux.Vars(r)["price"])
+
+	p.l.Debug("Handle PriceDelete", "id", id, "price", price)
+
+	err := p.productDB.PriceDelete(id, price)
+
+	if err == data.ErrProductNotFound || err == data.ErrPriceNotFound {
+		writeProblem(rw, r, http.StatusNotFound, err.Error())
+		return
+	}
+
+	if err != nil {
+		p.l.Error("Handle PriceDelete - Internal error", "id", id, "error", err)
+		writeProblem(rw, r, http.StatusInternalServerError, "Internal error")
+		return
+	}
+
+	rw.WriteHeader(http.StatusNoContent)
+}
+
+// swagger:route GET /promotions pricing ListPromotions
+// Returns the promotions ordered by id
+//
+// responses:
+//	200: promotionsResponse
+
+// PromotionList returns the promotions
+func (p *Pricing) PromotionList(rw http.ResponseWriter, r *http.Request) {
+	p.l.Debug("Handle PromotionList")
+
+	p.writeJSON(rw, r, "PromotionList", p.productDB.PromotionList())
+}
+
+// swagger:route GET /promotions/{id} pricing GetPromotion
+// Returns a promotion
+//
+// responses:
+//	200: promotionResponse
+//	404: errorResponse
+
+// PromotionGet returns the promotion with the id of the path
+func (p *Pricing) PromotionGet(rw http.ResponseWriter, r *http.Request) {
+	id, _ := strconv.Atoi(mux.Vars(r)["id"])
+
+	p.l.Debug("Handle PromotionGet", "id", id)
+
+	pm, err := p.productDB.PromotionGet(id)
+
+	if err == data.ErrPromotionNotFound {
+		writeProblem(rw, r, http.StatusNotFound, err.Error())
+		return
+	}
+
+	p.writeJSON(rw, r, "PromotionGet", pm)
+}
+
+// swagger:route POST /promotions pricing CreatePromotion
+// Creates a percentage or fixed discount on the products, the products of a category
+// or all the products, during a period. The best promotion of a product is applied
+//
+// responses:
+//	201: promotionResponse
+//	400: errorResponse
+//	422: errorValidation
+
+// PromotionCreate adds the promotion of the request body
+func (p *Pricing) PromotionCreate(rw http.ResponseWriter, r *http.Request) {
+	p.l.Debug("Handle PromotionCreate")
+
+	pm := &data.Promotion{}
+
+	if !p.readBody(rw, r, "promotion", pm, pm.Validate) {
+		return
+	}
+
+	err := p.productDB.PromotionAdd(pm)
+
+	if err == data.ErrInvalidDiscount || err == data.ErrInvalidPeriod || err == data.ErrCategoryNotFound || errors.Is(err, data.ErrProductNotFound) {
+		p.l.Error("Handle PromotionCreate - Invalid promotion", "error", err)
+		writeProblem(rw, r, http.StatusUnprocessableEntity, err.Error())
+		return
+	}
+
+	if err != nil {
+		p.l.Error("Handle PromotionCreate - Internal error", "error", err)
+		writeProblem(rw, r, http.StatusInternalServerError, "Internal error")
+		return
+	}
+
+	rw.Header().Set("Location", fmt.Sprintf("/promotions/%d", pm.ID))
+	p.writeCreated(rw, "PromotionCreate", pm)
+}
+
+// swagger:route DELETE /promotions/{id} pricing DeletePromotion
+// Removes a promotion
+//
+// responses:
+//	204: noContentResponse
+//	404: errorResponse
+
+// PromotionDelete removes the promotion with the id of the path
+func (p *Pricing) PromotionDelete(rw http.ResponseWriter, r *http.Request) {
+	id, _ := strconv.Atoi(mux.Vars(r)["id"])
+
+	p.l.Debug("Handle PromotionDelete", "id", id)
+
+	err := p.productDB.PromotionDelete(id)
+
+	if err == data.ErrPromotionNotFound {
+		writeProblem(rw, r, http.StatusNotFound, err.Error())
+		return
+	}
+
+	if err != nil {
+		p.l.Error("Handle PromotionDelete - Internal error", "id", id, "error", err)
+		writeProblem(rw, r, http.StatusInternalServerError, "Internal error")
+		return
+	}
+
+	rw.WriteHeader(http.StatusNoContent)
+}
+
+// readBody decodes and validates the request body, it writes the
+// error response and returns false when the body is invalid
+func (p *Pricing) readBody(rw http.ResponseWriter, r *http.Request, name string, v interface{}, validate func() error) bool {
+	err := data.FromJSON(v, r.Body)
+
+	if err != nil {
+		p.l.Error("Handle Pricing - Deserializing "+name, "error", err)
+		writeProblem(rw, r, http.StatusBadRequest, fmt.Sprintf("Error reading %s: %s", name, err))
+		return false
+	}
+
+	err = validate()
+
+	if err != nil {
+		p.l.Error("Handle Pricing - Validating "+name, "error", err)
+		writeFieldsProblem(rw, r, fmt.Sprintf("The %s has invalid fields", name), err)
+		return false
+	}
+
+	return true
+}
+
+func (p *Pricing) writeJSON(rw http.ResponseWriter, r *http.Request, handler string, v interface{}) {
+	rw.Header().Set("Content-Type", "application/json")
+
+	err := data.ToJSON(v, rw)
+
+	if err != nil {
+		p.l.Error("Handle "+handler+" - Internal error", "error", err)
+		writeProblem(rw, r, http.StatusInternalServerError, "Unable to serialize the response")
+	}
+}
+
+func (p *Pricing) writeCreated(rw http.ResponseWriter, handler string, v interface{}) {
+	rw.Header().Set("Content-Type", "application/json")
+	rw.WriteHeader(http.StatusCreated)
+
+	err := data.ToJSON(v, rw)
+
+	if err != nil {
+		p.l.Error("Handle "+handler+" - Unable to serializing response", "error", err)
+	}
+}
@@ -0,0 +1,96 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/CharlesSchiavinato/go-microservices/service-product-rest/data"
+)
+
+// ProblemContentType is the media type of the error responses (RFC 7807)
+const ProblemContentType = "application/problem+json"
+
+// Problem types returned in the type member of the error responses,
+// about:blank means the problem has no semantics beyond the HTTP status
+const (
+	problemTypeBlank      = "about:blank"
+	problemTypeValidation = "/problems/validation-error"
+)
+
+// Problem is an error response as defined by RFC 7807
+// swagger:model
+type Problem struct {
+	// URI reference identifying the problem type
+	Type string `json:"type"`
+	// short summary of the problem type
+	Title string `json:"title"`
+	// HTTP status code of the response
+	Status int `json:"status"`
+	// explanation specific to this occurrence of the problem
+	Detail string `json:"detail,omitempty"`
+	// path of the request which caused the problem
+	Instance string `json:"instance,omitempty"`
+	// id of the request, also returned in the X-Request-ID header
+	RequestID string `json:"request_id,omitempty"`
+	// validation failures for each invalid field
+	Errors []data.FieldError `json:"errors,omitempty"`
+}
+
+// Generic error returned by the API
+// swagger:response errorResponse
+type errorResponseWrapper struct {
+	// in: body
+	Body Problem
+}
+
+// Validation errors of each invalid field
+// swagger:response errorValidation
+type errorValidationWrapper struct {
+	// in: body
+	Body Problem
+}
+
+// newProblem creates the problem for the given status and request
+func newProblem(r *http.Request, status int, detail string) *Problem {
+	return &Problem{
+		Type:      problemTypeBlank,
+		Title:     http.StatusText(status),
+		Status:    status,
+		Detail:    detail,
+		Instance:  r.URL.Path,
+		RequestID: RequestID(r),
+	}
+}
+
+// writeProblem writes an error response with the given status and detail
+func writeProblem(rw http.ResponseWriter, r *http.Request, status int, detail string) {
+	sendProblem(rw, newProblem(r, status, detail))
+}
+
+// writeValidationProblem writes the error response for a product which
+// failed the validation, listing the invalid fields
+func writeValidationProblem(rw http.ResponseWriter, r *http.Request, err error) {
+	writeFieldsProblem(rw, r, "The product has invalid fields", err)
+}
+
+// writeFieldsProblem writes the validation error response with the given detail
+func writeFieldsProblem(rw http.ResponseWriter, r *http.Request, detail string, err error) {
+	pb := newProblem(r, http.StatusUnprocessableEntity, detail)
+	pb.Type = problemTypeValidation
+	pb.Title = "Validation failed"
+	pb.Errors = data.ValidationFieldErrors(err)
+
+	if pb.Errors == nil {
+		pb.Detail = err.Error()
+	}
+
+	sendProblem(rw, pb)
+}
+
+func sendProblem(rw http.ResponseWriter, pb *Problem) {
+	rw.Header().Set("Content-Type", ProblemContentType)
+	rw.Header().Set("X-Content-Type-Options", "nosniff")
+	rw.WriteHeader(pb.Status)
+
+	json.NewEncoder(rw).Encode(pb)
+}
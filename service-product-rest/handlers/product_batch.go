@@ -0,0 +1,110 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/CharlesSchiavinato/go-microservices/service-product-rest/data"
+)
+
+// swagger:parameters BatchProducts
+type productBatchParamsWrapper struct {
+	// Operations to execute
+	// in: body
+	// required: true
+	Body data.BatchRequest
+}
+
+// The result of each operation of a batch
+// swagger:response productBatchResponse
+type productBatchResponseWrapper struct {
+	// in: body
+	Body data.BatchReport
+}
+
+// swagger:route POST /products:batch products BatchProducts
+// Creates, updates and deletes products in one request. An atomic batch stops at the
+// first failed operation and rolls back the others, a best-effort batch executes
+// every operation on its own. Each result has the status the operation would
+// have on its own endpoint, 424 for the operations rolled back or not executed
+//
+// responses:
+// 	200: productBatchResponse
+//  400: errorResponse
+//  422: productBatchResponse
+
+// ProductBatch executes the operations of the request body
+func (p *Products) ProductBatch(rw http.ResponseWriter, r *http.Request) {
+	p.l.Debug("Handle ProductBatch")
+
+	br := &data.BatchRequest{}
+
+	err := data.FromJSON(br, r.Body)
+
+	if err != nil {
+		p.l.Error("Handle ProductBatch - Deserializing batch", "error", err)
+		writeProblem(rw, r, http.StatusBadRequest, fmt.Sprintf("Error reading batch: %s", err))
+		return
+	}
+
+	if len(br.Operations) == 0 || len(br.Operations) > data.MaxBatchOperations {
+		writeProblem(rw, r, http.StatusBadRequest, fmt.Sprintf("A batch must have from 1 to %d operations", data.MaxBatchOperations))
+		return
+	}
+
+	results, committed := p.productDB.ProductBatch(br.Operations, br.Atomic, actor(r))
+
+	for i := range results {
+		batchResultStatus(&results[i])
+	}
+
+	rw.Header().Set("Content-Type", "application/json")
+
+	if !committed {
+		rw.WriteHeader(http.StatusUnprocessableEntity)
+	}
+
+	err = data.ToJSON(&data.BatchReport{Atomic: br.Atomic, Committed: committed, Results: results}, rw)
+
+	if err != nil {
+		p.l.Error("Handle ProductBatch - Unable to serialize the report", "error", err)
+	}
+}
+
+// batchResultStatus sets the status and the error of the result from the error of the operation
+func batchResultStatus(res *data.BatchResult) {
+	err := res.Err
+
+	switch {
+	case err == nil && res.Op == data.BatchCreate:
+		res.Status = http.StatusCreated
+		return
+	case err == nil && res.Op == data.BatchDelete:
+		res.Status = http.StatusNoContent
+		return
+	case err == nil:
+		res.Status = http.StatusOK
+		return
+	case err == data.ErrProductNotFound:
+		res.Status = http.StatusNotFound
+	case err == data.ErrVersionMismatch:
+		res.Status = http.StatusPreconditionFailed
+	case err == data.ErrDuplicateSKU:
+		res.Status = http.StatusConflict
+	case err == data.ErrCategoryNotFound:
+		res.Status = http.StatusUnprocessableEntity
+	case err == data.ErrBatchRolledBack || err == data.ErrBatchNotExecuted:
+		res.Status = http.StatusFailedDependency
+	case err == data.ErrInvalidBatchOperation || err == data.ErrMissingBatchProduct:
+		res.Status = http.StatusBadRequest
+	default:
+		res.Errors = data.ValidationFieldErrors(err)
+		res.Status = http.StatusUnprocessableEntity
+
+		if res.Errors == nil {
+			res.Status = http.StatusInternalServerError
+		}
+	}
+
+	res.Error = err.Error()
+}
@@ -0,0 +1,110 @@
+package handlers
+
+import (
+	"fmt"
+	"hash/fnv"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/CharlesSchiavinato/go-microservices/service-product-rest/data"
+)
+
+var ErrInvalidIfMatch = fmt.Errorf("Invalid If-Match header")
+var ErrIfMatchRequired = fmt.Errorf("If-Match header is required")
+
+// writtenRepresentation returns the product written by the request as ProductGet returns it
+// with the default price list, localized for the request, and sets its entity tag in the
+// ETag header, so the tag of a write matches the tag of the next read. The written product
+// is returned without an ETag header when it can not be read back
+func (p *Products) writtenRepresentation(rw http.ResponseWriter, r *http.Request, pr *data.Product) *data.Product {
+	pg, err := p.productDB.ProductGetPriced(pr.ID, "", false, data.DefaultPriceList, time.Now().UTC())
+
+	if err != nil {
+		p.l.Error("Handle ProductWrite - Unable to read back the product", "id", pr.ID, "error", err)
+		return pr
+	}
+
+	p.localize(rw, r, pg)
+	rw.Header().Set("ETag", representationETag(rw, pg))
+
+	return pg
+}
+
+// representationETag returns the entity tag of the product read by the request, after it was
+// localized and priced. The translations, the price lists and the promotions do not change the
+// version of the product, so the version is followed by a hash of the locale, the translated
+// texts and the effective price with its source
+func representationETag(rw http.ResponseWriter, pr *data.Product) string {
+	h := fnv.New32a()
+	fmt.Fprintf(h, "%s\x00%s\x00%s\x00%s %s", rw.Header().Get("Content-Language"), pr.Name, pr.Description, pr.Price, pr.Price.Currency)
+
+	// the instant of the pricing is the time of the request, the price it selects is hashed
+	if rp := pr.Pricing; rp != nil {
+		fmt.Fprintf(h, "\x00%s %d %d %s %s", rp.PriceList, rp.PriceID, rp.PromotionID, rp.ListPrice, rp.ListPrice.Currency)
+	}
+
+	return fmt.Sprintf(`"%d-%08x"`, pr.Version, h.Sum32())
+}
+
+// ifMatchVersion returns the product version required by the If-Match header,
+// zero means any version is accepted. When the header is missing and
+// requireIfMatch is enabled ErrIfMatchRequired is returned. The comparison is
+// weak, only the version the tag starts with is compared, so the tags read in
+// any locale or price list match the product they were read from
+func (p *Products) ifMatchVersion(r *http.Request) (int, error) {
+	h := strings.TrimSpace(r.Header.Get("If-Match"))
+
+	if h == "" {
+		if p.requireIfMatch {
+			return 0, ErrIfMatchRequired
+		}
+
+		return 0, nil
+	}
+
+	if h == "*" {
+		return 0, nil
+	}
+
+	// weak tags can not be used with If-Match, the tags of the representations
+	// returned by the reads start with the version
+	tag, _, _ := strings.Cut(strings.Trim(h, `"`), "-")
+	v, err := strconv.Atoi(tag)
+
+	if err != nil || !strings.HasPrefix(h, `"`) || v < 1 {
+		return 0, ErrInvalidIfMatch
+	}
+
+	return v, nil
+}
+
+// ifNoneMatch returns true when the If-None-Match header of the request matches the entity tag
+func ifNoneMatch(r *http.Request, etag string) bool {
+	h := r.Header.Get("If-None-Match")
+
+	if h == "" {
+		return false
+	}
+
+	for _, t := range strings.Split(h, ",") {
+		t = strings.TrimPrefix(strings.TrimSpace(t), "W/")
+
+		if t == "*" || t == etag {
+			return true
+		}
+	}
+
+	return false
+}
+
+// writeIfMatchError writes the response for the errors returned by ifMatchVersion
+func writeIfMatchError(rw http.ResponseWriter, r *http.Request, err error) {
+	if err == ErrIfMatchRequired {
+		writeProblem(rw, r, http.StatusPreconditionRequired, err.Error())
+		return
+	}
+
+	writeProblem(rw, r, http.StatusBadRequest, err.Error())
+}
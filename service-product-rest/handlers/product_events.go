@@ -0,0 +1,197 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/CharlesSchiavinato/go-microservices/service-product-rest/data"
+	"github.com/hashicorp/go-hclog"
+)
+
+// ProductEvents streams the product changes as Server-Sent Events
+type ProductEvents struct {
+	l         hclog.Logger
+	productDB *data.ProductDB
+	events    *data.ProductEventBroker
+	heartbeat time.Duration
+}
+
+// connKey is the context key of the connection serving a request
+type connKey struct{}
+
+// ConnContext keeps the connection in the context of its requests, it is the ConnContext
+// of the http.Server so the event stream can outlive the WriteTimeout of the server
+func ConnContext(ctx context.Context, c net.Conn) context.Context {
+	return context.WithValue(ctx, connKey{}, c)
+}
+
+// NewProductEvents creates the product events handler, a comment is sent
+// every heartbeat to keep idle connections open
+func NewProductEvents(l hclog.Logger, pdb *data.ProductDB, eb *data.ProductEventBroker, heartbeat time.Duration) *ProductEvents {
+	return &ProductEvents{l, pdb, eb, heartbeat}
+}
+
+// swagger:parameters StreamProductEvents
+type productEventsParameterWrapper struct {
+	// Only stream the events of this product
+	// in: query
+	ProductID int `json:"product_id"`
+	// Currency code used to convert the prices of the products
+	// in: query
+	Currency string `json:"currency"`
+	// Id of the last event received, the stream resumes after it
+	// in: header
+	LastEventID string `json:"Last-Event-ID"`
+}
+
+// swagger:route GET /products/events products StreamProductEvents
+// Streams the created, updated and deleted product events as Server-Sent Events (text/event-stream).
+// Clients resume the stream after a disconnection with the Last-Event-ID header
+//
+// responses:
+//	200: productEventsResponse
+//	400: errorResponse
+
+// ProductEventStream writes the product events to the client until it disconnects
+func (pe *ProductEvents) ProductEventStream(rw http.ResponseWriter, r *http.Request) {
+	pe.l.Debug("Handle ProductEventStream")
+
+	fl, ok := rw.(http.Flusher)
+
+	if !ok {
+		writeProblem(rw, r, http.StatusInternalServerError, "Streaming is not supported")
+		return
+	}
+
+	q := r.URL.Query()
+	cur := q.Get("currency")
+
+	if cur != "" {
+		if _, err := data.MinorUnits(cur); err != nil {
+			writeProblem(rw, r, http.StatusBadRequest, err.Error())
+			return
+		}
+	}
+
+	productID := 0
+
+	if s := q.Get("product_id"); s != "" {
+		var err error
+		productID, err = strconv.Atoi(s)
+
+		if err != nil {
+			writeProblem(rw, r, http.StatusBadRequest, "Invalid product_id")
+			return
+		}
+	}
+
+	var lastID uint64
+
+	if s := r.Header.Get("Last-Event-ID"); s != "" {
+		var err error
+		lastID, err = strconv.ParseUint(s, 10, 64)
+
+		if err != nil {
+			writeProblem(rw, r, http.StatusBadRequest, "Invalid Last-Event-ID header")
+			return
+		}
+	}
+
+	// the stream is open until the client disconnects, the write timeout of the server would close it
+	if c, ok := r.Context().Value(connKey{}).(net.Conn); ok {
+		if err := c.SetWriteDeadline(time.Time{}); err != nil {
+			pe.l.Error("Handle ProductEventStream - Clearing write deadline", "error", err)
+			writeProblem(rw, r, http.StatusInternalServerError, "Streaming is not supported")
+			return
+		}
+	}
+
+	backlog, ch, cancel := pe.events.Subscribe(lastID)
+	defer cancel()
+
+	rw.Header().Set("Content-Type", "text/event-stream")
+	rw.Header().Set("Cache-Control", "no-cache")
+	rw.Header().Set("Connection", "keep-alive")
+	rw.WriteHeader(http.StatusOK)
+	fl.Flush()
+
+	send := func(e data.ProductEvent) error {
+		if productID > 0 && e.ProductID != productID {
+			return nil
+		}
+
+		err := pe.writeEvent(rw, e, cur)
+
+		if err == nil {
+			fl.Flush()
+		}
+
+		return err
+	}
+
+	for _, e := range backlog {
+		if err := send(e); err != nil {
+			pe.l.Error("Handle ProductEventStream - Writing event", "error", err)
+			return
+		}
+	}
+
+	hb := time.NewTicker(pe.heartbeat)
+	defer hb.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-hb.C:
+			fmt.Fprint(rw, ": heartbeat\n\n")
+			fl.Flush()
+		case e, ok := <-ch:
+			if !ok {
+				// the client fell behind, it reconnects and resumes with Last-Event-ID
+				return
+			}
+
+			if err := send(e); err != nil {
+				pe.l.Error("Handle ProductEventStream - Writing event", "error", err)
+				return
+			}
+		}
+	}
+}
+
+// writeEvent writes the event in the Server-Sent Events format,
+// converting the product price when a currency is given
+func (pe *ProductEvents) writeEvent(rw http.ResponseWriter, e data.ProductEvent, currency string) error {
+	if currency != "" {
+		pr, err := pe.productDB.ConvertPrice(e.Product, currency)
+
+		if err != nil {
+			return err
+		}
+
+		e.Product = pr
+	}
+
+	b, err := json.Marshal(e)
+
+	if err != nil {
+		return err
+	}
+
+	_, err = fmt.Fprintf(rw, "id: %d\nevent: %s\ndata: %s\n\n", e.ID, e.Type, b)
+
+	return err
+}
+
+// Stream of product events in the text/event-stream format
+// swagger:response productEventsResponse
+type productEventsResponseWrapper struct {
+	// in: body
+	Body data.ProductEvent
+}
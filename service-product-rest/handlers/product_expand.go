@@ -0,0 +1,73 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/CharlesSchiavinato/go-microservices/service-product-rest/data"
+)
+
+// expand embeds the images expanded by the view in the products. The attached images are
+// completed with their size and upload time fetched from the image service in parallel, the
+// products whose images could not be fetched keep their images as attached and are named
+// in a Warning header
+func (p *Products) expand(rw http.ResponseWriter, r *http.Request, pv *productView, pl ...*data.Product) {
+	if !pv.images {
+		return
+	}
+
+	ids := []int{}
+	for _, pr := range pl {
+		if len(pr.Images) > 0 {
+			ids = append(ids, pr.ID)
+		}
+	}
+
+	if len(ids) == 0 {
+		return
+	}
+
+	images, errs := p.images.ListAll(r.Context(), ids)
+
+	failed := []int{}
+
+	for _, pr := range pl {
+		if err, ok := errs[pr.ID]; ok {
+			p.l.Error("Handle ExpandImages - Unable to fetch images", "id", pr.ID, "error", err)
+			failed = append(failed, pr.ID)
+			continue
+		}
+
+		files := map[string]data.ProductImage{}
+		for _, f := range images[pr.ID] {
+			files[f.Filename] = f
+		}
+
+		// the images are shared with the stored product, they are completed on a copy
+		il := make([]data.ProductImage, len(pr.Images))
+		copy(il, pr.Images)
+
+		for i := range il {
+			if f, ok := files[il[i].Filename]; ok {
+				il[i].Size = f.Size
+				il[i].ModifiedOn = f.ModifiedOn
+			}
+		}
+
+		pr.Images = il
+	}
+
+	if len(failed) > 0 {
+		sort.Ints(failed)
+
+		sl := make([]string, 0, len(failed))
+		for _, id := range failed {
+			sl = append(sl, strconv.Itoa(id))
+		}
+
+		rw.Header().Add("Warning", fmt.Sprintf(`199 - "Unable to expand the images of the products %s"`, strings.Join(sl, ", ")))
+	}
+}
@@ -0,0 +1,175 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/CharlesSchiavinato/go-microservices/service-product-rest/data"
+	"github.com/gorilla/mux"
+)
+
+// The revisions of a product from the oldest to the newest
+// swagger:response productHistoryResponse
+type productHistoryResponseWrapper struct {
+	// in: body
+	Body []data.Revision
+}
+
+// A revision of a product with the product as it was after the change
+// swagger:response productRevisionResponse
+type productRevisionResponseWrapper struct {
+	// in: body
+	Body data.Revision
+}
+
+// swagger:parameters GetProductHistory GetProductRevision RevertProduct
+type productHistoryIDParameterWrapper struct {
+	// The id of the product
+	// in: path
+	// required: true
+	ID int `json:"id"`
+}
+
+// swagger:parameters GetProductRevision RevertProduct
+type productRevisionParameterWrapper struct {
+	// The revision number, the version of the product after the change
+	// in: path
+	// required: true
+	Rev int `json:"rev"`
+}
+
+// swagger:route GET /products/{id}/history products GetProductHistory
+// Returns the revisions of a product with who made each change, when, and the changed fields
+//
+// responses:
+// 	200: productHistoryResponse
+//  404: errorResponse
+
+// ProductHistory returns the revisions of a product
+func (p *Products) ProductHistory(rw http.ResponseWriter, r *http.Request) {
+	id, _ := strconv.Atoi(mux.Vars(r)["id"])
+
+	p.l.Debug("Handle ProductHistory", "id", id)
+
+	rw.Header().Add("Content-Type", "application/json")
+
+	h, err := p.productDB.ProductHistory(id)
+
+	if err == data.ErrProductNotFound {
+		p.l.Error("Handle ProductHistory - Product not found", "id", id, "error", err)
+		writeProblem(rw, r, http.StatusNotFound, "Product not found")
+		return
+	}
+
+	err = data.ToJSON(h, rw)
+
+	if err != nil {
+		p.l.Error("Handle ProductHistory - Internal error", "error", err)
+		writeProblem(rw, r, http.StatusInternalServerError, "Unable to serialize the response")
+		return
+	}
+}
+
+// swagger:route GET /products/{id}/revisions/{rev} products GetProductRevision
+// Returns a revision of a product with the product as it was after the change
+//
+// responses:
+// 	200: productRevisionResponse
+//  404: errorResponse
+
+// ProductRevision returns a revision of a product
+func (p *Products) ProductRevision(rw http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id, _ := strconv.Atoi(vars["id"])
+	rev, _ := strconv.Atoi(vars["rev"])
+
+	p.l.Debug("Handle ProductRevision", "id", id, "rev", rev)
+
+	rw.Header().Add("Content-Type", "application/json")
+
+	rv, err := p.productDB.ProductRevision(id, rev)
+
+	if err == data.ErrProductNotFound || err == data.ErrRevisionNotFound {
+		p.l.Error("Handle ProductRevision - Revision not found", "id", id, "rev", rev, "error", err)
+		writeProblem(rw, r, http.StatusNotFound, err.Error())
+		return
+	}
+
+	err = data.ToJSON(rv, rw)
+
+	if err != nil {
+		p.l.Error("Handle ProductRevision - Internal error", "error", err)
+		writeProblem(rw, r, http.StatusInternalServerError, "Unable to serialize the response")
+		return
+	}
+}
+
+// swagger:route POST /products/{id}/revert/{rev} products RevertProduct
+// Restores the name, description, price, SKU, category and tags a product had in a revision,
+// the revert is recorded as a new revision
+//
+// responses:
+// 	200: productResponse
+//  404: errorResponse
+//  409: errorResponse
+//  412: errorResponse
+//  428: errorResponse
+
+// ProductRevert updates a product with the content of one of its revisions
+func (p *Products) ProductRevert(rw http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id, _ := strconv.Atoi(vars["id"])
+	rev, _ := strconv.Atoi(vars["rev"])
+
+	p.l.Debug("Handle ProductRevert", "id", id, "rev", rev)
+
+	rw.Header().Add("Content-Type", "application/json")
+
+	version, err := p.ifMatchVersion(r)
+
+	if err != nil {
+		p.l.Error("Handle ProductRevert - Invalid precondition", "id", id, "error", err)
+		writeIfMatchError(rw, r, err)
+		return
+	}
+
+	pr, err := p.productDB.ProductRevert(id, rev, version, actor(r))
+
+	if err == data.ErrProductNotFound {
+		p.l.Error("Handle ProductRevert - Product not found", "id", id, "error", err)
+		writeProblem(rw, r, http.StatusNotFound, "Product not found")
+		return
+	}
+
+	if err == data.ErrRevisionNotFound {
+		p.l.Error("Handle ProductRevert - Revision not found", "id", id, "rev", rev, "error", err)
+		writeProblem(rw, r, http.StatusNotFound, err.Error())
+		return
+	}
+
+	if err == data.ErrVersionMismatch {
+		p.l.Error("Handle ProductRevert - Version mismatch", "id", id, "error", err)
+		writeProblem(rw, r, http.StatusPreconditionFailed, "Product was modified")
+		return
+	}
+
+	if err == data.ErrDuplicateSKU || err == data.ErrCategoryNotFound {
+		p.l.Error("Handle ProductRevert - Conflict", "id", id, "rev", rev, "error", err)
+		writeProblem(rw, r, http.StatusConflict, err.Error())
+		return
+	}
+
+	if err != nil {
+		p.l.Error("Handle ProductRevert - Internal error", "id", id, "error", err)
+		writeProblem(rw, r, http.StatusInternalServerError, "Internal error")
+		return
+	}
+
+	err = data.ToJSON(p.writtenRepresentation(rw, r, pr), rw)
+
+	if err != nil {
+		p.l.Error("Handle ProductRevert - Internal error", "error", err)
+		writeProblem(rw, r, http.StatusInternalServerError, "Unable to serialize the response")
+		return
+	}
+}
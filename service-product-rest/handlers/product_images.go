@@ -0,0 +1,189 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+
+	"github.com/CharlesSchiavinato/go-microservices/service-product-rest/data"
+	"github.com/CharlesSchiavinato/go-microservices/service-product-rest/images"
+	"github.com/gorilla/mux"
+	"github.com/hashicorp/go-hclog"
+)
+
+// ProductImages is a http.Handler attaching the images stored by the image service to the products
+type ProductImages struct {
+	l         hclog.Logger
+	productDB *data.ProductDB
+	images    *images.Client
+}
+
+// NewProductImages creates the product images handler, the images are checked with the client of the image service
+func NewProductImages(l hclog.Logger, pdb *data.ProductDB, ic *images.Client) *ProductImages {
+	return &ProductImages{l, pdb, ic}
+}
+
+// swagger:route GET /products/{id}/images images ListProductImages
+// Returns the images attached to a product, in their order
+//
+// responses:
+//	200: productImagesResponse
+//	404: errorResponse
+
+// ImageList returns the images of the product with the id of the path
+func (pi *ProductImages) ImageList(rw http.ResponseWriter, r *http.Request) {
+	id, _ := strconv.Atoi(mux.Vars(r)["id"])
+
+	pi.l.Debug("Handle ImageList", "id", id)
+
+	il, err := pi.productDB.ProductImageList(id)
+
+	if !pi.writeImageError(rw, r, "ImageList", err) {
+		return
+	}
+
+	rw.Header().Set("Content-Type", "application/json")
+
+	err = data.ToJSON(il, rw)
+
+	if err != nil {
+		pi.l.Error("Handle ImageList - Internal error", "error", err)
+		writeProblem(rw, r, http.StatusInternalServerError, "Unable to serialize the response")
+	}
+}
+
+// swagger:route PUT /products/{id}/images/{filename} images PutProductImage
+// Attaches an image stored by the image service to a product, or replaces the
+// alt text, the position and the primary flag of an attached image
+//
+// responses:
+//	200: productImageResponse
+//	201: productImageResponse
+//	400: errorResponse
+//	404: errorResponse
+//	422: errorValidation
+//	503: errorResponse
+
+// ImagePut attaches the image of the path to the product with the alt text, the position
+// and the primary flag of the request body, the body is optional. The image must be
+// stored by the image service
+func (pi *ProductImages) ImagePut(rw http.ResponseWriter, r *http.Request) {
+	id, _ := strconv.Atoi(mux.Vars(r)["id"])
+	filename := mux.Vars(r)["filename"]
+
+	pi.l.Debug("Handle ImagePut", "id", id, "filename", filename)
+
+	if !data.ValidImageFilename(filename) {
+		pi.writeImageError(rw, r, "ImagePut", data.ErrInvalidImageFilename)
+		return
+	}
+
+	img := &data.ProductImage{}
+
+	err := data.FromJSON(img, r.Body)
+
+	if err != nil && !errors.Is(err, io.EOF) {
+		pi.l.Error("Handle ImagePut - Deserializing image", "error", err)
+		writeProblem(rw, r, http.StatusBadRequest, fmt.Sprintf("Error reading image: %s", err))
+		return
+	}
+
+	err = img.Validate()
+
+	if err != nil {
+		pi.l.Error("Handle ImagePut - Validating image", "error", err)
+		writeFieldsProblem(rw, r, "The image has invalid fields", err)
+		return
+	}
+
+	// the product is looked up first so a missing product is not reported as a missing image
+	_, err = pi.productDB.ProductImageList(id)
+
+	if !pi.writeImageError(rw, r, "ImagePut", err) {
+		return
+	}
+
+	ok, err := pi.images.Exists(r.Context(), id, filename)
+
+	if err != nil {
+		pi.l.Error("Handle ImagePut - Unable to find the image", "id", id, "filename", filename, "error", err)
+		writeProblem(rw, r, http.StatusServiceUnavailable, "Unable to reach the image service")
+		return
+	}
+
+	if !ok {
+		pi.l.Error("Handle ImagePut - Image not stored", "id", id, "filename", filename)
+		writeProblem(rw, r, http.StatusUnprocessableEntity, fmt.Sprintf("The image service does not store the image %s of the product", filename))
+		return
+	}
+
+	img.Filename = filename
+	img.URL = pi.images.URL(id, filename)
+
+	added, err := pi.productDB.ProductImagePut(id, img, actor(r))
+
+	if !pi.writeImageError(rw, r, "ImagePut", err) {
+		return
+	}
+
+	status := http.StatusOK
+
+	if added {
+		status = http.StatusCreated
+	}
+
+	rw.Header().Set("Content-Type", "application/json")
+	rw.WriteHeader(status)
+
+	err = data.ToJSON(img, rw)
+
+	if err != nil {
+		pi.l.Error("Handle ImagePut - Unable to serialize image", "error", err)
+	}
+}
+
+// swagger:route DELETE /products/{id}/images/{filename} images DeleteProductImage
+// Detaches an image from a product, the image service keeps the image file
+//
+// responses:
+//	204: noContentResponse
+//	404: errorResponse
+
+// ImageDelete detaches the image of the path from the product
+func (pi *ProductImages) ImageDelete(rw http.ResponseWriter, r *http.Request) {
+	id, _ := strconv.Atoi(mux.Vars(r)["id"])
+	filename := mux.Vars(r)["filename"]
+
+	pi.l.Debug("Handle ImageDelete", "id", id, "filename", filename)
+
+	err := pi.productDB.ProductImageDelete(id, filename, actor(r))
+
+	if !pi.writeImageError(rw, r, "ImageDelete", err) {
+		return
+	}
+
+	rw.WriteHeader(http.StatusNoContent)
+}
+
+// writeImageError writes the error response of a product image request, it returns true when there was no error
+func (pi *ProductImages) writeImageError(rw http.ResponseWriter, r *http.Request, handler string, err error) bool {
+	switch err {
+	case nil:
+		return true
+	case data.ErrProductNotFound, data.ErrImageNotFound:
+		writeProblem(rw, r, http.StatusNotFound, err.Error())
+	case data.ErrInvalidImageFilename:
+		pi.l.Error("Handle "+handler+" - Invalid filename", "error", err)
+		writeProblem(rw, r, http.StatusBadRequest, err.Error())
+	case data.ErrTooManyImages:
+		pi.l.Error("Handle "+handler+" - Too many images", "error", err)
+		writeProblem(rw, r, http.StatusUnprocessableEntity, err.Error())
+	default:
+		pi.l.Error("Handle "+handler+" - Internal error", "error", err)
+		writeProblem(rw, r, http.StatusInternalServerError, "Internal error")
+	}
+
+	return false
+}
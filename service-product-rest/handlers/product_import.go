@@ -0,0 +1,271 @@
+package handlers
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/CharlesSchiavinato/go-microservices/service-product-rest/data"
+)
+
+// maxImportSize limits the size of the import bodies
+const maxImportSize = 32 * 1024 * 1024
+
+// flushRows is the number of exported rows written between the flushes of the response
+const flushRows = 100
+
+// swagger:parameters ImportProducts
+type productImportParameterWrapper struct {
+	// Products as CSV (text/csv) with the name, description, price, currency and sku
+	// columns, or as newline delimited JSON (application/x-ndjson)
+	// in: body
+	// required: true
+	Body string
+	// Validate and report the rows without changing the products
+	// in: query
+	DryRun bool `json:"dry_run"`
+	// create adds a product for every row, upsert updates the product with the SKU of the row
+	// in: query
+	// enum: create,upsert
+	// default: create
+	Mode string `json:"mode"`
+}
+
+// swagger:parameters ExportProducts
+type productExportParameterWrapper struct {
+	// Format of the export, csv or ndjson, the Accept header is used when it is absent
+	// in: query
+	// enum: csv,ndjson
+	Format string `json:"format"`
+	// Currency code used to convert the prices of the products
+	// in: query
+	Currency string `json:"currency"`
+}
+
+// The result of each row of a product import
+// swagger:response productImportResponse
+type productImportResponseWrapper struct {
+	// in: body
+	Body data.ImportReport
+}
+
+// The products which are not deleted, as CSV or newline delimited JSON
+// swagger:response productExportResponse
+type productExportResponseWrapper struct {
+	// in: body
+	Body []data.Product
+}
+
+// swagger:route POST /products:import products ImportProducts
+// Imports the products of a CSV or newline delimited JSON body, the rows are
+// validated and stored as they are read and the result of each row is reported
+//
+// consumes:
+//   - text/csv
+//   - application/x-ndjson
+//
+// responses:
+// 	200: productImportResponse
+//  400: errorResponse
+//  415: errorResponse
+
+// ProductImport imports the products of the request body
+func (p *Products) ProductImport(rw http.ResponseWriter, r *http.Request) {
+	p.l.Debug("Handle ProductImport")
+
+	q := r.URL.Query()
+	mode := data.ImportMode(q.Get("mode"))
+
+	if mode == "" {
+		mode = data.ImportCreate
+	}
+
+	dryRun := false
+
+	if s := q.Get("dry_run"); s != "" {
+		var err error
+		dryRun, err = strconv.ParseBool(s)
+
+		if err != nil {
+			writeProblem(rw, r, http.StatusBadRequest, "Invalid dry_run, it must be true or false")
+			return
+		}
+	}
+
+	body := http.MaxBytesReader(rw, r.Body, maxImportSize)
+
+	var pr data.ProductReader
+	ct, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+
+	switch ct {
+	case data.CSVContentType:
+		cr, err := data.NewCSVProductReader(body)
+
+		if err != nil {
+			p.l.Error("Handle ProductImport - Reading CSV header", "error", err)
+			writeProblem(rw, r, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		pr = cr
+	case data.NDJSONContentType, "application/ndjson":
+		pr = data.NewNDJSONProductReader(body)
+	default:
+		writeProblem(rw, r, http.StatusUnsupportedMediaType, fmt.Sprintf("Content-Type must be %s or %s", data.CSVContentType, data.NDJSONContentType))
+		return
+	}
+
+	rep, err := p.productDB.ProductImport(pr, mode, dryRun, actor(r))
+
+	if err == data.ErrInvalidImportMode {
+		writeProblem(rw, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	rw.Header().Set("Content-Type", "application/json")
+
+	if err != nil {
+		// the body could not be read to the end, the report tells which rows were imported
+		p.l.Error("Handle ProductImport - Reading body", "error", err)
+		rw.WriteHeader(http.StatusBadRequest)
+	}
+
+	err = data.ToJSON(rep, rw)
+
+	if err != nil {
+		p.l.Error("Handle ProductImport - Unable to serialize the report", "error", err)
+	}
+}
+
+// swagger:route GET /products:export products ExportProducts
+// Exports the products which are not deleted as CSV or newline delimited JSON, with their
+// effective price in the price list at the instant, after the promotions
+//
+// produces:
+//   - text/csv
+//   - application/x-ndjson
+//
+// responses:
+// 	200: productExportResponse
+//  400: errorResponse
+//  503: errorResponse
+
+// ProductExport streams the products in the requested format
+func (p *Products) ProductExport(rw http.ResponseWriter, r *http.Request) {
+	p.l.Debug("Handle ProductExport")
+
+	cur := r.URL.Query().Get("currency")
+	format := r.URL.Query().Get("format")
+
+	if format == "" && strings.Contains(r.Header.Get("Accept"), data.CSVContentType) {
+		format = "csv"
+	}
+
+	if format == "" {
+		format = "ndjson"
+	}
+
+	if format != "csv" && format != "ndjson" {
+		writeProblem(rw, r, http.StatusBadRequest, "Invalid format, it must be csv or ndjson")
+		return
+	}
+
+	list, at, err := priceSelection(r)
+
+	if err != nil {
+		p.l.Error("Handle ProductExport - Invalid price selection", "error", err)
+		writeProblem(rw, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	pl, err := p.productDB.ProductExport(cur, list, at)
+
+	if err == data.ErrUnsupportedCurrency {
+		p.l.Error("Handle ProductExport - Unsupported currency", "currency", cur, "error", err)
+		writeProblem(rw, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if errors.Is(err, data.ErrRateUnavailable) {
+		p.l.Error("Handle ProductExport - Currency rate unavailable", "currency", cur, "error", err)
+		writeProblem(rw, r, http.StatusServiceUnavailable, "Unable to get currency rate")
+		return
+	}
+
+	if err != nil {
+		p.l.Error("Handle ProductExport - Internal error", "error", err)
+		writeProblem(rw, r, http.StatusInternalServerError, "Internal error")
+		return
+	}
+
+	staleRateWarning(rw, pl...)
+
+	if format == "csv" {
+		err = p.exportCSV(rw, pl)
+	} else {
+		err = p.exportNDJSON(rw, pl)
+	}
+
+	if err != nil {
+		p.l.Error("Handle ProductExport - Writing the export", "error", err)
+	}
+}
+
+// exportCSV writes the products as CSV, flushing the response every flushRows rows
+func (p *Products) exportCSV(rw http.ResponseWriter, pl data.Products) error {
+	rw.Header().Set("Content-Type", data.CSVContentType)
+	rw.Header().Set("Content-Disposition", `attachment; filename="products.csv"`)
+
+	w := csv.NewWriter(rw)
+
+	if err := data.WriteCSVHeader(w); err != nil {
+		return err
+	}
+
+	for i, pr := range pl {
+		if err := pr.WriteCSV(w); err != nil {
+			return err
+		}
+
+		if (i+1)%flushRows == 0 {
+			w.Flush()
+			flush(rw)
+		}
+	}
+
+	w.Flush()
+
+	return w.Error()
+}
+
+// exportNDJSON writes the products as newline delimited JSON, flushing the response every flushRows rows
+func (p *Products) exportNDJSON(rw http.ResponseWriter, pl data.Products) error {
+	rw.Header().Set("Content-Type", data.NDJSONContentType)
+	rw.Header().Set("Content-Disposition", `attachment; filename="products.ndjson"`)
+
+	e := json.NewEncoder(rw)
+
+	for i, pr := range pl {
+		if err := e.Encode(withoutRate(pr)); err != nil {
+			return err
+		}
+
+		if (i+1)%flushRows == 0 {
+			flush(rw)
+		}
+	}
+
+	return nil
+}
+
+// flush sends the buffered response to the client when the writer supports it
+func flush(rw http.ResponseWriter) {
+	if f, ok := rw.(http.Flusher); ok {
+		f.Flush()
+	}
+}
@@ -2,34 +2,49 @@ package handlers
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"net/http"
 
 	"github.com/CharlesSchiavinato/go-microservices/service-product-rest/data"
 )
 
+// ProductMiddlewareValidation decodes the product of the request body by its Content-Type,
+// JSON, XML or MessagePack, validates it and adds it to the context
 func (p Products) ProductMiddlewareValidation(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
 		prb := &data.Product{}
 
-		err := data.FromJSON(prb, r.Body)
+		// the body is decoded by its Content-Type, up to maxBodySize bytes
+		r.Body = http.MaxBytesReader(rw, r.Body, maxBodySize)
+		err := decodeRepresentation(r, prb)
+
+		var mbe *http.MaxBytesError
+		if errors.As(err, &mbe) {
+			p.l.Error("Handle ProductMiddleware - Body too large", "limit", mbe.Limit)
+			writeProblem(rw, r, http.StatusRequestEntityTooLarge, fmt.Sprintf("The request body must be at most %d bytes", mbe.Limit))
+			return
+		}
+
+		if err == errUnsupportedMediaType {
+			p.l.Error("Handle ProductMiddleware - Unsupported content type", "content_type", r.Header.Get("Content-Type"))
+			writeProblem(rw, r, http.StatusUnsupportedMediaType, err.Error())
+			return
+		}
 
 		if err != nil {
 			p.l.Error("Handle ProductMiddleware - Deserializing product", "error", err)
-			http.Error(rw, "Error reading product", http.StatusBadRequest)
+			writeProblem(rw, r, http.StatusBadRequest, fmt.Sprintf("Error reading product: %s", err))
 			return
 		}
 
-		// validate de product
+		// validate de product, without the fields owned by the server
+		prb.Normalize()
 		err = prb.Validate()
 
 		if err != nil {
 			p.l.Error("Handle ProductMiddleware - Validating product", "error", err)
-			http.Error(
-				rw,
-				fmt.Sprintf("Error validating product: %s", err),
-				http.StatusBadRequest,
-			)
+			writeValidationProblem(rw, r, err)
 			return
 		}
 
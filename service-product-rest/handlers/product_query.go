@@ -0,0 +1,342 @@
+package handlers
+
+import (
+	"encoding/base64"
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/CharlesSchiavinato/go-microservices/service-product-rest/data"
+)
+
+var ErrInvalidCursor = fmt.Errorf("Invalid cursor")
+var ErrInvalidIncludeDeleted = fmt.Errorf("Invalid include_deleted")
+var ErrInvalidFacets = fmt.Errorf("Invalid facets")
+var ErrInvalidAt = fmt.Errorf("Invalid at, it must be a RFC 3339 time")
+var ErrInvalidExpand = fmt.Errorf("Invalid expand, it must be a list of %s and %s", data.ExpandImages, data.ExpandRate)
+
+// parseProductQuery reads the filter, sort and pagination parameters of the request
+func parseProductQuery(r *http.Request) (*data.ProductQuery, error) {
+	v := r.URL.Query()
+
+	q := &data.ProductQuery{
+		Name: v.Get("name"),
+		SKU:  v.Get("sku"),
+		Sort: v.Get("sort"),
+	}
+
+	var err error
+
+	if s := v.Get("limit"); s != "" {
+		q.Limit, err = strconv.Atoi(s)
+
+		if err != nil {
+			return nil, data.ErrInvalidLimit
+		}
+	}
+
+	if s := v.Get("min_price"); s != "" {
+		q.MinPrice, err = strconv.ParseFloat(s, 64)
+
+		if err != nil {
+			return nil, data.ErrInvalidPriceRange
+		}
+	}
+
+	if s := v.Get("max_price"); s != "" {
+		q.MaxPrice, err = strconv.ParseFloat(s, 64)
+
+		if err != nil {
+			return nil, data.ErrInvalidPriceRange
+		}
+	}
+
+	if s := v.Get("category"); s != "" {
+		q.Category, err = strconv.Atoi(s)
+
+		if err != nil {
+			return nil, data.ErrInvalidCategory
+		}
+	}
+
+	for _, s := range v["tag"] {
+		q.Tags = append(q.Tags, strings.Split(s, ",")...)
+	}
+
+	q.IncludeDeleted, err = includeDeleted(r)
+
+	if err != nil {
+		return nil, err
+	}
+
+	q.PriceList, q.At, err = priceSelection(r)
+
+	if err != nil {
+		return nil, err
+	}
+
+	// the listed names are filtered and sorted in the language they are returned in
+	q.Locales = data.LocaleChain(acceptedLanguages(r))
+
+	if s := v.Get("cursor"); s != "" {
+		q.Offset, err = decodeCursor(s)
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return q, q.Validate()
+}
+
+// withFacets reads the facets parameter of the request
+func withFacets(r *http.Request) (bool, error) {
+	s := r.URL.Query().Get("facets")
+
+	if s == "" {
+		return false, nil
+	}
+
+	b, err := strconv.ParseBool(s)
+
+	if err != nil {
+		return false, ErrInvalidFacets
+	}
+
+	return b, nil
+}
+
+// includeDeleted reads the include_deleted parameter of the request
+func includeDeleted(r *http.Request) (bool, error) {
+	s := r.URL.Query().Get("include_deleted")
+
+	if s == "" {
+		return false, nil
+	}
+
+	b, err := strconv.ParseBool(s)
+
+	if err != nil {
+		return false, ErrInvalidIncludeDeleted
+	}
+
+	return b, nil
+}
+
+// priceSelection returns the price list and the instant of the price of the product,
+// the default price list and the current time when they are not in the query
+func priceSelection(r *http.Request) (string, time.Time, error) {
+	v := r.URL.Query()
+
+	pl := strings.ToLower(strings.TrimSpace(v.Get("price_list")))
+
+	if pl == "" {
+		pl = data.DefaultPriceList
+	}
+
+	if !data.ValidPriceList(pl) {
+		return "", time.Time{}, data.ErrInvalidPriceList
+	}
+
+	at := time.Now().UTC()
+
+	if s := v.Get("at"); s != "" {
+		t, err := time.Parse(time.RFC3339, s)
+
+		if err != nil {
+			return "", time.Time{}, ErrInvalidAt
+		}
+
+		at = t.UTC()
+	}
+
+	return pl, at, nil
+}
+
+// encodeCursor returns the opaque cursor pointing to the given offset
+func encodeCursor(offset int) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(strconv.Itoa(offset)))
+}
+
+// decodeCursor returns the offset referenced by a cursor built by encodeCursor
+func decodeCursor(cursor string) (int, error) {
+	b, err := base64.RawURLEncoding.DecodeString(cursor)
+
+	if err != nil {
+		return 0, ErrInvalidCursor
+	}
+
+	offset, err := strconv.Atoi(string(b))
+
+	if err != nil || offset < 0 {
+		return 0, ErrInvalidCursor
+	}
+
+	return offset, nil
+}
+
+// pageLinks builds the Link header value with the first, prev and next pages
+// of the listing, keeping the other parameters of the request
+func pageLinks(u *url.URL, q *data.ProductQuery, total int) string {
+	link := func(offset int, rel string) string {
+		v := u.Query()
+		v.Del("cursor")
+
+		if offset > 0 {
+			v.Set("cursor", encodeCursor(offset))
+		}
+
+		lu := url.URL{Path: u.Path, RawQuery: v.Encode()}
+
+		return fmt.Sprintf("<%s>; rel=\"%s\"", lu.String(), rel)
+	}
+
+	limit := q.PageLimit()
+	links := []string{link(0, "first")}
+
+	if q.Offset > 0 {
+		prev := q.Offset - limit
+
+		if prev < 0 {
+			prev = 0
+		}
+
+		links = append(links, link(prev, "prev"))
+	}
+
+	if q.Offset+limit < total {
+		links = append(links, link(q.Offset+limit, "next"))
+	}
+
+	return strings.Join(links, ", ")
+}
+
+// productView is the representation of the products requested by the fields and expand parameters
+type productView struct {
+	// fields are the product fields returned, all of them when nil
+	fields []string
+	images bool
+	rate   bool
+}
+
+// parseProductView reads the fields and expand parameters of the request, the expanded
+// resources are returned even when they are not in the fields
+func parseProductView(r *http.Request) (*productView, error) {
+	v := r.URL.Query()
+	pv := &productView{}
+
+	if s := v.Get("expand"); s != "" {
+		for _, e := range strings.Split(s, ",") {
+			switch strings.TrimSpace(e) {
+			case data.ExpandImages:
+				pv.images = true
+			case data.ExpandRate:
+				pv.rate = true
+			default:
+				return nil, ErrInvalidExpand
+			}
+		}
+	}
+
+	// an empty fields parameter is invalid, it selects no field
+	if _, ok := v["fields"]; ok {
+		s := v.Get("fields")
+
+		if pv.images {
+			s += "," + data.ExpandImages
+		}
+
+		if pv.rate {
+			s += "," + data.ExpandRate
+		}
+
+		fields, err := data.ParseProductFields(s)
+
+		if err != nil {
+			return nil, err
+		}
+
+		pv.fields = fields
+	}
+
+	return pv, nil
+}
+
+// full returns true when the products are returned with all their fields and without expansion
+func (pv *productView) full() bool {
+	return pv.fields == nil && !pv.images && !pv.rate
+}
+
+// project returns the product with the fields of the view, the rate is only
+// returned when it is expanded
+func (pv *productView) project(pr *data.Product) interface{} {
+	if pv.fields == nil {
+		if pv.rate {
+			return pr
+		}
+
+		return withoutRate(pr)
+	}
+
+	return pr.Project(pv.fields)
+}
+
+// projectPage returns the page with the products with the fields of the view
+func (pv *productView) projectPage(pg *data.ProductPage) interface{} {
+	if pv.fields == nil {
+		np := *pg
+		np.Products = pv.projectList(pg.Products).(data.Products)
+
+		return &np
+	}
+
+	return &projectedPage{Products: pv.projectList(pg.Products).([]interface{}), Total: pg.Total, Facets: pg.Facets}
+}
+
+// projectedPage is a page of products with the fields of a view
+type projectedPage struct {
+	XMLName  xml.Name            `json:"-" xml:"page"`
+	Products []interface{}       `json:"products" xml:"products>product"`
+	Total    int                 `json:"total" xml:"total"`
+	Facets   *data.ProductFacets `json:"facets" xml:"facets,omitempty"`
+}
+
+// projectList returns the products with the fields of the view
+func (pv *productView) projectList(pl data.Products) interface{} {
+	if pv.fields == nil {
+		if pv.rate {
+			return pl
+		}
+
+		vl := make(data.Products, 0, len(pl))
+		for _, pr := range pl {
+			vl = append(vl, withoutRate(pr))
+		}
+
+		return vl
+	}
+
+	vl := make([]interface{}, 0, len(pl))
+	for _, pr := range pl {
+		vl = append(vl, pr.Project(pv.fields))
+	}
+
+	return vl
+}
+
+// withoutRate returns the product without the rate used to convert its price, the
+// rate is embedded in the product responses only when it is expanded
+func withoutRate(pr *data.Product) *data.Product {
+	if pr.Rate == nil {
+		return pr
+	}
+
+	np := *pr
+	np.Rate = nil
+
+	return &np
+}
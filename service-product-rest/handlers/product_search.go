@@ -0,0 +1,77 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/CharlesSchiavinato/go-microservices/service-product-rest/data"
+)
+
+// swagger:route GET /products/search products SearchProducts
+// Returns the products with the words of q in their name or description, from the most relevant.
+// The words are matched by their English and Portuguese stems and the last word as a prefix,
+// so the search can run while it is typed. The effective prices, filters, sort and pages are those of the listing
+//
+// responses:
+//	200: productSearchResponse
+//	400: errorResponse
+//	503: errorResponse
+
+// ProductSearch returns a page of the products matching a full-text search
+func (p *Products) ProductSearch(rw http.ResponseWriter, r *http.Request) {
+	text := r.URL.Query().Get("q")
+	cur := r.URL.Query().Get("currency")
+
+	p.l.Debug("Handle ProductSearch", "q", text)
+
+	rw.Header().Add("Content-Type", "application/json")
+
+	q, err := parseProductQuery(r)
+
+	if err != nil {
+		p.l.Error("Handle ProductSearch - Invalid query", "error", err)
+		writeProblem(rw, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if !p.allowDeleted(rw, r, "ProductSearch", q.IncludeDeleted) {
+		return
+	}
+
+	rl, total, err := p.productDB.ProductSearch(text, cur, q)
+
+	if err == data.ErrEmptySearch || err == data.ErrUnsupportedCurrency || err == data.ErrCategoryNotFound || err == data.ErrPriceCurrencyRequired {
+		p.l.Error("Handle ProductSearch - Invalid query", "q", text, "currency", cur, "error", err)
+		writeProblem(rw, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if errors.Is(err, data.ErrRateUnavailable) {
+		p.l.Error("Handle ProductSearch - Currency rate unavailable", "currency", cur, "error", err)
+		writeProblem(rw, r, http.StatusServiceUnavailable, "Unable to get currency rate")
+		return
+	}
+
+	if err != nil {
+		p.l.Error("Handle ProductSearch - Internal error", "error", err)
+		writeProblem(rw, r, http.StatusInternalServerError, "Internal error")
+		return
+	}
+
+	for i := range rl {
+		staleRateWarning(rw, rl[i].Product)
+		rl[i].Product = withoutRate(rl[i].Product)
+	}
+
+	rw.Header().Set("X-Total-Count", strconv.Itoa(total))
+	rw.Header().Set("Link", pageLinks(r.URL, q, total))
+
+	err = data.ToJSON(rl, rw)
+
+	if err != nil {
+		p.l.Error("Handle ProductSearch - Unable to serialize the results", "error", err)
+		writeProblem(rw, r, http.StatusInternalServerError, "Unable to serialize the response")
+		return
+	}
+}
@@ -8,75 +8,211 @@
 //
 //	Consumes:
 //	- application/json
+//	- application/xml
+//	- application/msgpack
 //
 //	Produces:
 //	- application/json
+//	- application/xml
+//	- application/msgpack
+//	- text/csv
+//	- application/problem+json
 //
 // swagger:meta
 package handlers
 
 import (
-	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
 	"net/http"
 	"strconv"
 
 	protos "github.com/CharlesSchiavinato/go-microservices/service-currency-grpc/protos/currency"
 	"github.com/CharlesSchiavinato/go-microservices/service-product-rest/data"
+	"github.com/CharlesSchiavinato/go-microservices/service-product-rest/images"
 	"github.com/gorilla/mux"
 	"github.com/hashicorp/go-hclog"
 )
 
 // Products is a http.Handler
 type Products struct {
-	l         hclog.Logger
-	cc        protos.CurrencyClient
-	productDB *data.ProductDB
+	l              hclog.Logger
+	cc             protos.CurrencyClient
+	productDB      *data.ProductDB
+	requireIfMatch bool
+	adminKey       string
+	images         *images.Client
 }
 
 type KeyProduct struct{}
 
-// NewProducts creates a products handler with the given logger
-func NewProducts(l hclog.Logger, cc protos.CurrencyClient, pdb *data.ProductDB) *Products {
-	return &Products{l, cc, pdb}
+// maxPatchSize is the max number of bytes read from a patch request
+const maxPatchSize = 1 << 20
+
+// NewProducts creates a products handler with the given logger,
+// requireIfMatch rejects updates and deletes without the If-Match header, only the
+// requests with adminKey see the deleted products and the images are expanded with
+// the client of the image service
+func NewProducts(l hclog.Logger, cc protos.CurrencyClient, pdb *data.ProductDB, requireIfMatch bool, adminKey string, ic *images.Client) *Products {
+	return &Products{l, cc, pdb, requireIfMatch, adminKey, ic}
 }
 
 // swagger:route GET /products products ListProducts
-// Returns a list of products from the data store
+// Returns a page of products from the data store, filtered and sorted by the query parameters.
+// The products have their effective price in the price list at the instant, after the promotions,
+// the price filters and the sort by price use it.
+// The total number of matching products is returned in the X-Total-Count header
+// and the links to the other pages in the Link header. With facets=true the page is
+// returned with the counts of the matching products by category and tag. The names and
+// descriptions are translated to the Accept-Language header, their locales are returned
+// in the Content-Language header. The list is returned in JSON, XML, CSV or MessagePack
+// by the Accept header, the page with the facets has no CSV representation.
+// The fields parameter selects the returned fields and expand embeds the related resources,
+// the products whose images could not be fetched are named in a Warning header.
+// Only the administrators can include the deleted products
 // responses:
 // 	200: productsResponse
+//  400: errorResponse
+//  403: errorResponse
+//  406: errorResponse
+//  503: errorResponse
 
-// ProductList returns all products from the data store
+// ProductList returns a page of products from the data store
 func (p *Products) ProductList(rw http.ResponseWriter, r *http.Request) {
 	p.l.Debug("Handle ProductList")
 
-	rw.Header().Add("Content-Type", "application/json")
-
 	cur := r.URL.Query().Get("currency")
 
+	q, err := parseProductQuery(r)
+
+	if err != nil {
+		p.l.Error("Handle ProductList - Invalid query", "error", err)
+		writeProblem(rw, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if !p.allowDeleted(rw, r, "ProductList", q.IncludeDeleted) {
+		return
+	}
+
+	facets, err := withFacets(r)
+
+	if err != nil {
+		p.l.Error("Handle ProductList - Invalid facets", "error", err)
+		writeProblem(rw, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	pv, err := parseProductView(r)
+
+	if err != nil {
+		p.l.Error("Handle ProductList - Invalid view", "error", err)
+		writeProblem(rw, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	// the page with the facets and the projected or expanded products have no CSV representation
+	offers := listTypes
+	if facets || !pv.full() {
+		offers = productTypes
+	}
+
+	mt, ok := p.negotiate(rw, r, "ProductList", offers)
+
+	if !ok {
+		return
+	}
+
 	// fetch the products from the datastore
-	pl, err := p.productDB.ProductList(cur)
+	pg := &data.ProductPage{}
+
+	if facets {
+		pg, err = p.productDB.ProductListFacets(cur, q)
+	} else {
+		pg.Products, pg.Total, err = p.productDB.ProductList(cur, q)
+	}
+
+	if err == data.ErrUnsupportedCurrency || err == data.ErrCategoryNotFound || err == data.ErrPriceCurrencyRequired {
+		p.l.Error("Handle ProductList - Invalid query", "currency", cur, "category", q.Category, "error", err)
+		writeProblem(rw, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if errors.Is(err, data.ErrRateUnavailable) {
+		p.l.Error("Handle ProductList - Currency rate unavailable", "currency", cur, "error", err)
+		writeProblem(rw, r, http.StatusServiceUnavailable, "Unable to get currency rate")
+		return
+	}
 
 	if err != nil {
 		p.l.Error("Handle ProductList - Unable to get currency rate", "error", err)
-		http.Error(rw, "Unable to get currency rate", http.StatusInternalServerError)
+		writeProblem(rw, r, http.StatusInternalServerError, "Unable to get currency rate")
 		return
 	}
 
-	// serialize the list to JSON
-	err = data.ToJSON(pl, rw)
+	staleRateWarning(rw, pg.Products...)
+	p.localize(rw, r, pg.Products...)
+	p.expand(rw, r, pv, pg.Products...)
+
+	rw.Header().Set("X-Total-Count", strconv.Itoa(pg.Total))
+	rw.Header().Set("Link", pageLinks(r.URL, q, pg.Total))
+
+	// serialize the list, in the page with the facets when they were requested
+	if facets {
+		err = writeRepresentation(rw, http.StatusOK, mt, pv.projectPage(pg))
+	} else {
+		err = writeRepresentation(rw, http.StatusOK, mt, pv.projectList(pg.Products))
+	}
 
 	if err != nil {
 		p.l.Error("Handle ProductList - Unable to serializing product", "error", err)
-		http.Error(rw, "Unable to serializing product", http.StatusInternalServerError)
+		writeProblem(rw, r, http.StatusInternalServerError, "Unable to serialize the response")
 		return
 	}
 }
 
+// allowDeleted writes the 403 response when the request includes the deleted products
+// without being made by an administrator, it returns true when the request is allowed
+func (p *Products) allowDeleted(rw http.ResponseWriter, r *http.Request, handler string, inc bool) bool {
+	if !inc || isAdmin(r, p.adminKey) {
+		return true
+	}
+
+	p.l.Error("Handle "+handler+" - Deleted products requested by a non administrator", "actor", actor(r))
+	writeProblem(rw, r, http.StatusForbidden, "Only administrators can include the deleted products")
+
+	return false
+}
+
+// staleRateWarning adds the Warning header when a price was converted with a stale rate
+func staleRateWarning(rw http.ResponseWriter, pl ...*data.Product) {
+	for _, pr := range pl {
+		if pr.Rate != nil && pr.Rate.Stale {
+			rw.Header().Set("Warning", `110 - "Exchange rate is stale"`)
+			return
+		}
+	}
+}
+
 // swagger:route GET /products/{id} products GetProduct
-// Returns the product from the data store
+// Returns the product from the data store with its effective price in the price list at the
+// instant, after the promotions, and its texts translated to the Accept-Language header.
+// The ETag header starts with the product version and the locale is returned in the Content-Language header.
+// The writes return the ETag of the product read without parameters, their If-Match header is compared
+// with the product version only, a weak comparison matching the tags read in any locale or price list.
+// The fields parameter selects the returned fields and expand embeds the related resources,
+// the products whose images could not be fetched are named in a Warning header.
+// Only the administrators can get the deleted products
 // responses:
 // 	200: productResponse
+// 	304: notModifiedResponse
+//  400: errorResponse
+//  403: errorResponse
 //  404: errorResponse
+//  406: errorResponse
+//  503: errorResponse
 
 // ProductGet returns the product from the data store
 func (p *Products) ProductGet(rw http.ResponseWriter, r *http.Request) {
@@ -86,57 +222,181 @@ func (p *Products) ProductGet(rw http.ResponseWriter, r *http.Request) {
 
 	p.l.Debug("Handle ProductGet", "id", id)
 
-	rw.Header().Add("Content-Type", "application/json")
-
 	if err != nil {
 		p.l.Error("Handle ProductGet - Invalid id", "id", id, "error", err)
-		http.Error(rw, "Invalid id", http.StatusBadRequest)
+		writeProblem(rw, r, http.StatusBadRequest, "Invalid id")
+		return
+	}
+
+	mt, ok := p.negotiate(rw, r, "ProductGet", productTypes)
+
+	if !ok {
+		return
+	}
+
+	pv, err := parseProductView(r)
+
+	if err != nil {
+		p.l.Error("Handle ProductGet - Invalid view", "id", id, "error", err)
+		writeProblem(rw, r, http.StatusBadRequest, err.Error())
 		return
 	}
 
-	pg, err := p.productDB.ProductGetByID(id, cur)
+	inc, err := includeDeleted(r)
+
+	if err != nil {
+		p.l.Error("Handle ProductGet - Invalid include_deleted", "id", id, "error", err)
+		writeProblem(rw, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if !p.allowDeleted(rw, r, "ProductGet", inc) {
+		return
+	}
+
+	pl, at, err := priceSelection(r)
+
+	if err != nil {
+		p.l.Error("Handle ProductGet - Invalid price selection", "id", id, "error", err)
+		writeProblem(rw, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	pg, err := p.productDB.ProductGetPriced(id, cur, inc, pl, at)
+
+	if err == data.ErrUnsupportedCurrency {
+		p.l.Error("Handle ProductGet - Unsupported currency", "currency", cur, "error", err)
+		writeProblem(rw, r, http.StatusBadRequest, err.Error())
+		return
+	}
 
 	if err == data.ErrProductNotFound {
 		p.l.Error("Handle ProductGet - Product not found", "id", id, "error", err)
-		http.Error(rw, "Product not found", http.StatusNotFound)
+		writeProblem(rw, r, http.StatusNotFound, "Product not found")
+		return
+	}
+
+	if errors.Is(err, data.ErrRateUnavailable) {
+		p.l.Error("Handle ProductGet - Currency rate unavailable", "currency", cur, "error", err)
+		writeProblem(rw, r, http.StatusServiceUnavailable, "Unable to get currency rate")
 		return
 	}
 
 	if err != nil {
 		p.l.Error("Handle ProductGet - Internal error", "error", err)
-		http.Error(rw, "Product not found", http.StatusInternalServerError)
+		writeProblem(rw, r, http.StatusInternalServerError, "Internal error")
+		return
+	}
+
+	staleRateWarning(rw, pg)
+	p.localize(rw, r, pg)
+
+	tag := representationETag(rw, pg)
+	rw.Header().Set("ETag", tag)
+
+	if ifNoneMatch(r, tag) {
+		rw.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	p.expand(rw, r, pv, pg)
+
+	err = writeRepresentation(rw, http.StatusOK, mt, pv.project(pg))
+
+	if err != nil {
+		p.l.Error("Handle ProductGet - Internal error", "error", err)
+		writeProblem(rw, r, http.StatusInternalServerError, "Unable to serialize the response")
+		return
+	}
+}
+
+// swagger:route GET /products/by-sku/{sku} products GetProductBySKU
+// Return the product with a SKU, the SKU is normalized before the lookup. The price is
+// resolved and the texts are translated to the Accept-Language header like on GetProduct
+//
+// responses:
+//	200: productResponse
+//	304: notModifiedResponse
+//	400: errorResponse
+//	404: errorResponse
+//	406: errorResponse
+//	503: errorResponse
+
+// ProductGetBySKU handles GET requests of a product by its SKU
+func (p *Products) ProductGetBySKU(rw http.ResponseWriter, r *http.Request) {
+	sku := mux.Vars(r)["sku"]
+	cur := r.URL.Query().Get("currency")
+
+	p.l.Debug("Handle ProductGetBySKU", "sku", sku)
+
+	mt, ok := p.negotiate(rw, r, "ProductGetBySKU", productTypes)
+
+	if !ok {
+		return
+	}
+
+	pl, at, err := priceSelection(r)
+
+	if err != nil {
+		p.l.Error("Handle ProductGetBySKU - Invalid price selection", "sku", sku, "error", err)
+		writeProblem(rw, r, http.StatusBadRequest, err.Error())
 		return
 	}
 
-	// get exchange rate
-	rr := &protos.RateRequest{
-		Base:        protos.Currencies_EUR,
-		Destination: protos.Currencies_BRL,
+	pg, err := p.productDB.ProductGetBySKU(sku, cur, pl, at)
+
+	if err == data.ErrUnsupportedCurrency {
+		p.l.Error("Handle ProductGetBySKU - Unsupported currency", "currency", cur, "error", err)
+		writeProblem(rw, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if err == data.ErrProductNotFound {
+		p.l.Error("Handle ProductGetBySKU - Product not found", "sku", sku, "error", err)
+		writeProblem(rw, r, http.StatusNotFound, "Product not found")
+		return
+	}
+
+	if errors.Is(err, data.ErrRateUnavailable) {
+		p.l.Error("Handle ProductGetBySKU - Currency rate unavailable", "currency", cur, "error", err)
+		writeProblem(rw, r, http.StatusServiceUnavailable, "Unable to get currency rate")
+		return
 	}
-	resp, err := p.cc.GetRate(context.Background(), rr)
 
 	if err != nil {
-		p.l.Error("Handle ProductGet - Error getting new rate", "error", err)
-		http.Error(rw, "Error getting new rate", http.StatusInternalServerError)
+		p.l.Error("Handle ProductGetBySKU - Internal error", "error", err)
+		writeProblem(rw, r, http.StatusInternalServerError, "Internal error")
 		return
 	}
 
-	pg.Price = pg.Price * float64(resp.Rate)
+	staleRateWarning(rw, pg)
+	p.localize(rw, r, pg)
+
+	tag := representationETag(rw, pg)
+	rw.Header().Set("ETag", tag)
+
+	if ifNoneMatch(r, tag) {
+		rw.WriteHeader(http.StatusNotModified)
+		return
+	}
 
-	err = data.ToJSON(pg, rw)
+	err = writeRepresentation(rw, http.StatusOK, mt, withoutRate(pg))
 
 	if err != nil {
-		p.l.Error("Handle ProductList - Internal error", "error", err)
-		http.Error(rw, "Unable to serializing json", http.StatusInternalServerError)
+		p.l.Error("Handle ProductGetBySKU - Internal error", "error", err)
+		writeProblem(rw, r, http.StatusInternalServerError, "Unable to serialize the response")
 		return
 	}
 }
 
 // swagger:route POST /products products createProduct
-// Create a new product
+// Create a new product, the URL of the product is returned in the Location header
 //
 // responses:
-//	200: productResponse
+//	201: productResponse
+//  406: errorResponse
+//  409: errorResponse
+//  415: errorResponse
 //  422: errorValidation
 //  501: errorResponse
 
@@ -146,18 +406,55 @@ func (p *Products) ProductCreate(rw http.ResponseWriter, r *http.Request) {
 
 	prb := r.Context().Value(KeyProduct{}).(*data.Product)
 
+	// the response type is negotiated before the product is added
+	mt, ok := p.negotiate(rw, r, "ProductCreate", productTypes)
+
+	if !ok {
+		return
+	}
+
 	// p.l.Printf("Product: %#v\n", pa)
-	data.ProductAdd(prb)
+	err := p.productDB.ProductAdd(prb, actor(r))
+
+	if err == data.ErrDuplicateSKU {
+		p.l.Error("Handle ProductCreate - Duplicate SKU", "sku", prb.SKU, "error", err)
+		writeProblem(rw, r, http.StatusConflict, err.Error())
+		return
+	}
+
+	if err == data.ErrCategoryNotFound {
+		p.l.Error("Handle ProductCreate - Category not found", "category_id", prb.CategoryID, "error", err)
+		writeProblem(rw, r, http.StatusUnprocessableEntity, err.Error())
+		return
+	}
+
+	if err != nil {
+		p.l.Error("Handle ProductCreate - Internal error", "error", err)
+		writeProblem(rw, r, http.StatusInternalServerError, "Internal error")
+		return
+	}
+
+	rw.Header().Set("Location", fmt.Sprintf("/products/%d", prb.ID))
+
+	err = writeRepresentation(rw, http.StatusCreated, mt, p.writtenRepresentation(rw, r, prb))
+
+	if err != nil {
+		p.l.Error("Handle ProductCreate - Unable to serializing product", "error", err)
+	}
 }
 
-// swagger:route PUT /products products updateProduct
-// Update a products details
+// swagger:route PUT /products/{id} products updateProduct
+// Update a products details, the If-Match header must contain the ETag of the product
 //
 // responses:
 //
-//	201: noContentResponse
+//	204: noContentResponse
 //	404: errorResponse
+//	409: errorResponse
+//	412: errorResponse
+//	415: errorResponse
 //	422: errorValidation
+//	428: errorResponse
 func (p *Products) ProductUpdate(rw http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	id, err := strconv.Atoi(vars["id"])
@@ -165,41 +462,209 @@ func (p *Products) ProductUpdate(rw http.ResponseWriter, r *http.Request) {
 	p.l.Debug("Handle PUT products", "id", id)
 
 	if err != nil {
-		http.Error(rw, "Invalid id", http.StatusBadRequest)
+		writeProblem(rw, r, http.StatusBadRequest, "Invalid id")
 		return
 	}
 
-	rw.Header().Add("Content-Type", "application/json")
+	version, err := p.ifMatchVersion(r)
+
+	if err != nil {
+		p.l.Error("Handle PUT - Invalid precondition", "id", id, "error", err)
+		writeIfMatchError(rw, r, err)
+		return
+	}
 
 	prb := r.Context().Value(KeyProduct{}).(*data.Product)
 
 	prb.ID = id
 
 	// p.l.Printf("Product: %#v\n", pa)
-	err = data.ProductUpdate(prb)
+	err = p.productDB.ProductUpdate(prb, version, actor(r))
 
 	if err == data.ErrProductNotFound {
 		p.l.Error("Handle PUT - Product not found", "id", id, "error", err)
-		http.Error(rw, "Product not found", http.StatusNotFound)
+		writeProblem(rw, r, http.StatusNotFound, "Product not found")
+		return
+	}
+
+	if err == data.ErrVersionMismatch {
+		p.l.Error("Handle PUT - Version mismatch", "id", id, "error", err)
+		writeProblem(rw, r, http.StatusPreconditionFailed, "Product was modified")
+		return
+	}
+
+	if err == data.ErrDuplicateSKU {
+		p.l.Error("Handle PUT - Duplicate SKU", "id", id, "sku", prb.SKU, "error", err)
+		writeProblem(rw, r, http.StatusConflict, err.Error())
+		return
+	}
+
+	if err == data.ErrCategoryNotFound {
+		p.l.Error("Handle PUT - Category not found", "category_id", prb.CategoryID, "error", err)
+		writeProblem(rw, r, http.StatusUnprocessableEntity, err.Error())
 		return
 	}
 
 	if err != nil {
 		p.l.Error("Handle PUT - Internal error", "id", id, "error", err)
-		http.Error(rw, "Product not found", http.StatusInternalServerError)
+		writeProblem(rw, r, http.StatusInternalServerError, "Internal error")
+		return
+	}
+
+	p.writtenRepresentation(rw, r, prb)
+	rw.WriteHeader(http.StatusNoContent)
+}
+
+// swagger:route PATCH /products/{id} products patchProduct
+// Update some product details with a JSON Merge Patch (application/merge-patch+json)
+// or a JSON Patch (application/json-patch+json), the If-Match header must contain the ETag of the product
+//
+// responses:
+//
+//	200: productResponse
+//	404: errorResponse
+//	406: errorResponse
+//	409: errorResponse
+//	412: errorResponse
+//	415: errorResponse
+//	422: errorValidation
+//	428: errorResponse
+
+// ProductPatch applies a patch to the stored product and saves the result
+func (p *Products) ProductPatch(rw http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id, err := strconv.Atoi(vars["id"])
+
+	p.l.Debug("Handle ProductPatch", "id", id)
+
+	if err != nil {
+		p.l.Error("Handle ProductPatch - Invalid id", "id", id, "error", err)
+		writeProblem(rw, r, http.StatusBadRequest, "Invalid id")
+		return
+	}
+
+	mt, ok := p.negotiate(rw, r, "ProductPatch", productTypes)
+
+	if !ok {
+		return
+	}
+
+	ct, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+
+	if err != nil || (ct != data.MergePatchContentType && ct != data.JSONPatchContentType) {
+		p.l.Error("Handle ProductPatch - Unsupported content type", "id", id, "content_type", ct)
+		writeProblem(rw, r, http.StatusUnsupportedMediaType, data.ErrUnsupportedPatch.Error())
+		return
+	}
+
+	version, err := p.ifMatchVersion(r)
+
+	if err != nil {
+		p.l.Error("Handle ProductPatch - Invalid precondition", "id", id, "error", err)
+		writeIfMatchError(rw, r, err)
+		return
+	}
+
+	patch, err := io.ReadAll(io.LimitReader(r.Body, maxPatchSize))
+
+	if err != nil {
+		p.l.Error("Handle ProductPatch - Reading patch", "id", id, "error", err)
+		writeProblem(rw, r, http.StatusBadRequest, "Error reading patch")
+		return
+	}
+
+	pg, err := p.productDB.ProductGetByID(id, "", false)
+
+	if err == data.ErrProductNotFound {
+		p.l.Error("Handle ProductPatch - Product not found", "id", id, "error", err)
+		writeProblem(rw, r, http.StatusNotFound, "Product not found")
+		return
+	}
+
+	if err != nil {
+		p.l.Error("Handle ProductPatch - Internal error", "id", id, "error", err)
+		writeProblem(rw, r, http.StatusInternalServerError, "Internal error")
+		return
+	}
+
+	if version > 0 && version != pg.Version {
+		p.l.Error("Handle ProductPatch - Version mismatch", "id", id, "version", version)
+		writeProblem(rw, r, http.StatusPreconditionFailed, "Product was modified")
+		return
+	}
+
+	prb, err := pg.Patch(ct, patch)
+
+	if err != nil {
+		p.l.Error("Handle ProductPatch - Applying patch", "id", id, "error", err)
+		writeProblem(rw, r, http.StatusBadRequest, fmt.Sprintf("Error applying patch: %s", err))
+		return
+	}
+
+	prb.Normalize()
+	err = prb.Validate()
+
+	if err != nil {
+		p.l.Error("Handle ProductPatch - Validating product", "id", id, "error", err)
+		writeValidationProblem(rw, r, err)
+		return
+	}
+
+	// the patch was applied to the version read above, a concurrent
+	// change between the read and the update is reported as a conflict
+	err = p.productDB.ProductUpdate(prb, pg.Version, actor(r))
+
+	if err == data.ErrProductNotFound {
+		p.l.Error("Handle ProductPatch - Product not found", "id", id, "error", err)
+		writeProblem(rw, r, http.StatusNotFound, "Product not found")
+		return
+	}
+
+	if err == data.ErrVersionMismatch {
+		p.l.Error("Handle ProductPatch - Concurrent update", "id", id, "error", err)
+		writeProblem(rw, r, http.StatusConflict, "Product was modified")
+		return
+	}
+
+	if err == data.ErrDuplicateSKU {
+		p.l.Error("Handle ProductPatch - Duplicate SKU", "id", id, "sku", prb.SKU, "error", err)
+		writeProblem(rw, r, http.StatusConflict, err.Error())
+		return
+	}
+
+	if err == data.ErrCategoryNotFound {
+		p.l.Error("Handle ProductPatch - Category not found", "category_id", prb.CategoryID, "error", err)
+		writeProblem(rw, r, http.StatusUnprocessableEntity, err.Error())
+		return
+	}
+
+	if err != nil {
+		p.l.Error("Handle ProductPatch - Internal error", "id", id, "error", err)
+		writeProblem(rw, r, http.StatusInternalServerError, "Internal error")
+		return
+	}
+
+	err = writeRepresentation(rw, http.StatusOK, mt, p.writtenRepresentation(rw, r, prb))
+
+	if err != nil {
+		p.l.Error("Handle ProductPatch - Internal error", "error", err)
+		writeProblem(rw, r, http.StatusInternalServerError, "Unable to serialize the response")
 		return
 	}
 }
 
 // swagger:route DELETE /products/{id} products DeleteProduct
-// Delete product
+// Delete product, the product can be restored until it is purged.
+// The If-Match header must contain the ETag of the product
 //
 // responses:
-// 	201: noContentResponse
+// 	204: noContentResponse
 //  404: errorResponse
+// 	412: errorResponse
+// 	428: errorResponse
 // 	501: errorResponse
 
-// Handle ProductDelete delete a product from the data store
+// Handle ProductDelete marks a product as deleted in the data store
 func (p *Products) ProductDelete(rw http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	id, err := strconv.Atoi(vars["id"])
@@ -208,23 +673,94 @@ func (p *Products) ProductDelete(rw http.ResponseWriter, r *http.Request) {
 
 	if err != nil {
 		p.l.Error("Handle ProductDelete - Invalid id", "id", id, "error", err)
-		http.Error(rw, "Invalid id", http.StatusBadRequest)
+		writeProblem(rw, r, http.StatusBadRequest, "Invalid id")
 		return
 	}
 
-	err = data.ProductDelete(id)
+	version, err := p.ifMatchVersion(r)
+
+	if err != nil {
+		p.l.Error("Handle ProductDelete - Invalid precondition", "id", id, "error", err)
+		writeIfMatchError(rw, r, err)
+		return
+	}
+
+	err = p.productDB.ProductDelete(id, version, actor(r))
 
 	if err == data.ErrProductNotFound {
 		p.l.Error("Handle ProductDelete - Product not found", "id", id, "error", err)
-		http.Error(rw, "Product not found", http.StatusNotFound)
+		writeProblem(rw, r, http.StatusNotFound, "Product not found")
+		return
+	}
+
+	if err == data.ErrVersionMismatch {
+		p.l.Error("Handle ProductDelete - Version mismatch", "id", id, "error", err)
+		writeProblem(rw, r, http.StatusPreconditionFailed, "Product was modified")
 		return
 	}
 
 	if err != nil {
 		p.l.Error("Handle ProductDelete - Internal error", "id", id, "error", err)
-		http.Error(rw, "Product not found", http.StatusInternalServerError)
+		writeProblem(rw, r, http.StatusInternalServerError, "Internal error")
 		return
 	}
 
 	rw.WriteHeader(http.StatusNoContent)
 }
+
+// swagger:route POST /products/{id}/restore products RestoreProduct
+// Restore a deleted product
+//
+// responses:
+// 	200: productResponse
+//  404: errorResponse
+//  406: errorResponse
+//  409: errorResponse
+
+// ProductRestore clears the deletion mark of a product
+func (p *Products) ProductRestore(rw http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id, err := strconv.Atoi(vars["id"])
+
+	p.l.Debug("Handle ProductRestore", "id", id)
+
+	if err != nil {
+		p.l.Error("Handle ProductRestore - Invalid id", "id", id, "error", err)
+		writeProblem(rw, r, http.StatusBadRequest, "Invalid id")
+		return
+	}
+
+	mt, ok := p.negotiate(rw, r, "ProductRestore", productTypes)
+
+	if !ok {
+		return
+	}
+
+	pr, err := p.productDB.ProductRestore(id, actor(r))
+
+	if err == data.ErrProductNotFound {
+		p.l.Error("Handle ProductRestore - Product not found", "id", id, "error", err)
+		writeProblem(rw, r, http.StatusNotFound, "Product not found")
+		return
+	}
+
+	if err == data.ErrDuplicateSKU {
+		p.l.Error("Handle ProductRestore - Duplicate SKU", "id", id, "error", err)
+		writeProblem(rw, r, http.StatusConflict, err.Error())
+		return
+	}
+
+	if err != nil {
+		p.l.Error("Handle ProductRestore - Internal error", "id", id, "error", err)
+		writeProblem(rw, r, http.StatusInternalServerError, "Internal error")
+		return
+	}
+
+	err = writeRepresentation(rw, http.StatusOK, mt, pr)
+
+	if err != nil {
+		p.l.Error("Handle ProductRestore - Internal error", "error", err)
+		writeProblem(rw, r, http.StatusInternalServerError, "Unable to serialize the response")
+		return
+	}
+}
@@ -0,0 +1,48 @@
+package handlers
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+)
+
+// RequestIDHeader is the header carrying the id of the request
+const RequestIDHeader = "X-Request-ID"
+
+// maxRequestIDLength limits the size of the ids accepted from the clients
+const maxRequestIDLength = 128
+
+type KeyRequestID struct{}
+
+// RequestIDMiddleware assigns an id to every request, reusing the one sent
+// by the client in the X-Request-ID header, and returns it in the response
+func RequestIDMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(RequestIDHeader)
+
+		if id == "" || len(id) > maxRequestIDLength {
+			id = newRequestID()
+		}
+
+		rw.Header().Set(RequestIDHeader, id)
+
+		ctx := context.WithValue(r.Context(), KeyRequestID{}, id)
+
+		next.ServeHTTP(rw, r.WithContext(ctx))
+	})
+}
+
+// RequestID returns the id assigned to the request by RequestIDMiddleware
+func RequestID(r *http.Request) string {
+	id, _ := r.Context().Value(KeyRequestID{}).(string)
+
+	return id
+}
+
+func newRequestID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+
+	return hex.EncodeToString(b)
+}
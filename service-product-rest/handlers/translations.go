@@ -0,0 +1,191 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/CharlesSchiavinato/go-microservices/service-product-rest/data"
+	"github.com/gorilla/mux"
+	"github.com/hashicorp/go-hclog"
+)
+
+// Translations is a http.Handler managing the translations of the product texts
+type Translations struct {
+	l         hclog.Logger
+	productDB *data.ProductDB
+}
+
+// NewTranslations creates the translations handler with the given data store
+func NewTranslations(l hclog.Logger, pdb *data.ProductDB) *Translations {
+	return &Translations{l, pdb}
+}
+
+// swagger:route GET /products/{id}/translations translations ListTranslations
+// Returns the translations of a product, ordered by locale
+//
+// responses:
+//	200: translationsResponse
+//	404: errorResponse
+
+// TranslationList returns the translations of the product with the id of the path
+func (t *Translations) TranslationList(rw http.ResponseWriter, r *http.Request) {
+	id, _ := strconv.Atoi(mux.Vars(r)["id"])
+
+	t.l.Debug("Handle TranslationList", "id", id)
+
+	tl, err := t.productDB.TranslationList(id)
+
+	if err == data.ErrProductNotFound {
+		writeProblem(rw, r, http.StatusNotFound, err.Error())
+		return
+	}
+
+	rw.Header().Set("Content-Type", "application/json")
+
+	err = data.ToJSON(tl, rw)
+
+	if err != nil {
+		t.l.Error("Handle TranslationList - Internal error", "error", err)
+		writeProblem(rw, r, http.StatusInternalServerError, "Unable to serialize the response")
+	}
+}
+
+// swagger:route GET /products/{id}/translations/{locale} translations GetTranslation
+// Returns the translation of a product in a locale
+//
+// responses:
+//	200: translationResponse
+//	400: errorResponse
+//	404: errorResponse
+
+// TranslationGet returns the translation of the product in the locale of the path
+func (t *Translations) TranslationGet(rw http.ResponseWriter, r *http.Request) {
+	id, _ := strconv.Atoi(mux.Vars(r)["id"])
+	locale := mux.Vars(r)["locale"]
+
+	t.l.Debug("Handle TranslationGet", "id", id, "locale", locale)
+
+	tr, err := t.productDB.TranslationGet(id, locale)
+
+	if !t.writeTranslationError(rw, r, "TranslationGet", err) {
+		return
+	}
+
+	t.writeTranslation(rw, r, "TranslationGet", http.StatusOK, tr)
+}
+
+// swagger:route PUT /products/{id}/translations/{locale} translations PutTranslation
+// Adds or replaces the name and description of a product in a locale, the
+// texts in the default locale are the name and description of the product
+//
+// responses:
+//	200: translationResponse
+//	201: translationResponse
+//	400: errorResponse
+//	404: errorResponse
+//	409: errorResponse
+//	422: errorValidation
+
+// TranslationPut stores the translation of the request body in the locale of the path
+func (t *Translations) TranslationPut(rw http.ResponseWriter, r *http.Request) {
+	id, _ := strconv.Atoi(mux.Vars(r)["id"])
+	locale := mux.Vars(r)["locale"]
+
+	t.l.Debug("Handle TranslationPut", "id", id, "locale", locale)
+
+	tr := &data.Translation{}
+
+	err := data.FromJSON(tr, r.Body)
+
+	if err != nil {
+		t.l.Error("Handle TranslationPut - Deserializing translation", "error", err)
+		writeProblem(rw, r, http.StatusBadRequest, fmt.Sprintf("Error reading translation: %s", err))
+		return
+	}
+
+	err = tr.Validate()
+
+	if err != nil {
+		t.l.Error("Handle TranslationPut - Validating translation", "error", err)
+		writeFieldsProblem(rw, r, "The translation has invalid fields", err)
+		return
+	}
+
+	tr.Locale = locale
+
+	added, err := t.productDB.TranslationPut(id, tr)
+
+	if err == data.ErrDefaultLocale {
+		t.l.Error("Handle TranslationPut - Default locale", "id", id, "locale", locale)
+		writeProblem(rw, r, http.StatusConflict, err.Error())
+		return
+	}
+
+	if !t.writeTranslationError(rw, r, "TranslationPut", err) {
+		return
+	}
+
+	status := http.StatusOK
+
+	if added {
+		status = http.StatusCreated
+		rw.Header().Set("Location", fmt.Sprintf("/products/%d/translations/%s", id, tr.Locale))
+	}
+
+	t.writeTranslation(rw, r, "TranslationPut", status, tr)
+}
+
+// swagger:route DELETE /products/{id}/translations/{locale} translations DeleteTranslation
+// Removes the translation of a product in a locale
+//
+// responses:
+//	204: noContentResponse
+//	400: errorResponse
+//	404: errorResponse
+
+// TranslationDelete removes the translation of the product in the locale of the path
+func (t *Translations) TranslationDelete(rw http.ResponseWriter, r *http.Request) {
+	id, _ := strconv.Atoi(mux.Vars(r)["id"])
+	locale := mux.Vars(r)["locale"]
+
+	t.l.Debug("Handle TranslationDelete", "id", id, "locale", locale)
+
+	err := t.productDB.TranslationDelete(id, locale)
+
+	if !t.writeTranslationError(rw, r, "TranslationDelete", err) {
+		return
+	}
+
+	rw.WriteHeader(http.StatusNoContent)
+}
+
+// writeTranslationError writes the error response of a translation request, it returns true when there was no error
+func (t *Translations) writeTranslationError(rw http.ResponseWriter, r *http.Request, handler string, err error) bool {
+	switch err {
+	case nil:
+		return true
+	case data.ErrProductNotFound, data.ErrTranslationNotFound:
+		writeProblem(rw, r, http.StatusNotFound, err.Error())
+	case data.ErrInvalidLocale:
+		t.l.Error("Handle "+handler+" - Invalid locale", "error", err)
+		writeProblem(rw, r, http.StatusBadRequest, err.Error())
+	default:
+		t.l.Error("Handle "+handler+" - Internal error", "error", err)
+		writeProblem(rw, r, http.StatusInternalServerError, "Internal error")
+	}
+
+	return false
+}
+
+func (t *Translations) writeTranslation(rw http.ResponseWriter, r *http.Request, handler string, status int, tr *data.Translation) {
+	rw.Header().Set("Content-Type", "application/json")
+	rw.Header().Set("Content-Language", tr.Locale)
+	rw.WriteHeader(status)
+
+	err := data.ToJSON(tr, rw)
+
+	if err != nil {
+		t.l.Error("Handle "+handler+" - Unable to serializing translation", "error", err)
+	}
+}
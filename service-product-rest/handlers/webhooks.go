@@ -0,0 +1,284 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/CharlesSchiavinato/go-microservices/service-product-rest/data"
+	"github.com/CharlesSchiavinato/go-microservices/service-product-rest/webhook"
+	"github.com/gorilla/mux"
+	"github.com/hashicorp/go-hclog"
+)
+
+// Webhooks is a http.Handler managing the webhook subscriptions
+type Webhooks struct {
+	l          hclog.Logger
+	dispatcher *webhook.Dispatcher
+	adminKey   string
+}
+
+// NewWebhooks creates the webhooks handler with the given dispatcher, only the
+// requests with adminKey manage the webhooks
+func NewWebhooks(l hclog.Logger, d *webhook.Dispatcher, adminKey string) *Webhooks {
+	return &Webhooks{l, d, adminKey}
+}
+
+// A list of webhook subscriptions
+// swagger:response webhooksResponse
+type webhooksResponseWrapper struct {
+	// in: body
+	Body []webhook.Subscription
+}
+
+// A webhook subscription, the secret is only returned on the creation
+// swagger:response webhookResponse
+type webhookResponseWrapper struct {
+	// in: body
+	Body webhook.Subscription
+}
+
+// The latest delivery attempts of a webhook, the newest first
+// swagger:response webhookDeliveriesResponse
+type webhookDeliveriesResponseWrapper struct {
+	// in: body
+	Body []webhook.Delivery
+}
+
+// The events which could not be delivered to a webhook
+// swagger:response webhookDeadLettersResponse
+type webhookDeadLettersResponseWrapper struct {
+	// in: body
+	Body []webhook.DeadLetter
+}
+
+// swagger:parameters CreateWebhook
+type webhookParamsWrapper struct {
+	// Webhook subscription to register
+	// in: body
+	// required: true
+	Body webhook.Subscription
+}
+
+// swagger:parameters ListWebhooks CreateWebhook GetWebhook DeleteWebhook ListWebhookDeliveries ListWebhookDeadLetters
+type webhookAdminKeyParameterWrapper struct {
+	// Key of the administrators, required to manage the webhooks
+	// in: header
+	// required: true
+	AdminKey string `json:"X-Admin-Key"`
+}
+
+// swagger:parameters GetWebhook DeleteWebhook ListWebhookDeliveries ListWebhookDeadLetters
+type webhookIDParameterWrapper struct {
+	// The id of the webhook subscription
+	// in: path
+	// required: true
+	ID int `json:"id"`
+}
+
+// WebhookMiddlewareAdmin writes the 403 response when the request is not made by an administrator
+func (w *Webhooks) WebhookMiddlewareAdmin(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		if !isAdmin(r, w.adminKey) {
+			w.l.Error("Handle WebhookMiddlewareAdmin - Webhooks managed by a non administrator", "actor", actor(r))
+			writeProblem(rw, r, http.StatusForbidden, "Only administrators can manage the webhooks")
+			return
+		}
+
+		next.ServeHTTP(rw, r)
+	})
+}
+
+// swagger:route GET /webhooks webhooks ListWebhooks
+// Returns the webhook subscriptions
+//
+// responses:
+//	200: webhooksResponse
+//	403: errorResponse
+
+// WebhookList returns the webhook subscriptions
+func (w *Webhooks) WebhookList(rw http.ResponseWriter, r *http.Request) {
+	w.l.Debug("Handle WebhookList")
+
+	rw.Header().Add("Content-Type", "application/json")
+
+	err := data.ToJSON(w.dispatcher.Subscriptions(), rw)
+
+	if err != nil {
+		w.l.Error("Handle WebhookList - Internal error", "error", err)
+		writeProblem(rw, r, http.StatusInternalServerError, "Unable to serialize the response")
+	}
+}
+
+// swagger:route GET /webhooks/{id} webhooks GetWebhook
+// Returns a webhook subscription
+//
+// responses:
+//	200: webhookResponse
+//	403: errorResponse
+//	404: errorResponse
+
+// WebhookGet returns the webhook subscription with the id of the path
+func (w *Webhooks) WebhookGet(rw http.ResponseWriter, r *http.Request) {
+	id, _ := strconv.Atoi(mux.Vars(r)["id"])
+
+	w.l.Debug("Handle WebhookGet", "id", id)
+
+	s, err := w.dispatcher.Subscription(id)
+
+	if err == webhook.ErrSubscriptionNotFound {
+		writeProblem(rw, r, http.StatusNotFound, err.Error())
+		return
+	}
+
+	rw.Header().Add("Content-Type", "application/json")
+
+	err = data.ToJSON(s, rw)
+
+	if err != nil {
+		w.l.Error("Handle WebhookGet - Internal error", "error", err)
+		writeProblem(rw, r, http.StatusInternalServerError, "Unable to serialize the response")
+	}
+}
+
+// swagger:route POST /webhooks webhooks CreateWebhook
+// Registers a webhook receiving the product events. The deliveries are POST requests
+// signed with the X-Webhook-Signature header, sha256=HMAC-SHA256(secret, "<X-Webhook-Timestamp>.<body>").
+// The URLs reaching a loopback, link-local or private address are rejected
+//
+// responses:
+//	201: webhookResponse
+//	400: errorResponse
+//	403: errorResponse
+//	422: errorValidation
+
+// WebhookCreate registers a webhook subscription
+func (w *Webhooks) WebhookCreate(rw http.ResponseWriter, r *http.Request) {
+	w.l.Debug("Handle WebhookCreate")
+
+	s := webhook.Subscription{}
+
+	err := data.FromJSON(&s, r.Body)
+
+	if err != nil {
+		w.l.Error("Handle WebhookCreate - Deserializing webhook", "error", err)
+		writeProblem(rw, r, http.StatusBadRequest, fmt.Sprintf("Error reading webhook: %s", err))
+		return
+	}
+
+	ns, err := w.dispatcher.Register(s)
+
+	if data.ValidationFieldErrors(err) != nil {
+		w.l.Error("Handle WebhookCreate - Validating webhook", "error", err)
+		writeFieldsProblem(rw, r, "The webhook has invalid fields", err)
+		return
+	}
+
+	if err == webhook.ErrPrivateDestination || err == webhook.ErrUnresolvableDestination {
+		w.l.Error("Handle WebhookCreate - Rejecting the destination", "error", err)
+		writeProblem(rw, r, http.StatusUnprocessableEntity, err.Error())
+		return
+	}
+
+	if err != nil {
+		w.l.Error("Handle WebhookCreate - Internal error", "error", err)
+		writeProblem(rw, r, http.StatusInternalServerError, "Internal error")
+		return
+	}
+
+	rw.Header().Set("Content-Type", "application/json")
+	rw.Header().Set("Location", fmt.Sprintf("/webhooks/%d", ns.ID))
+	rw.WriteHeader(http.StatusCreated)
+
+	err = data.ToJSON(ns, rw)
+
+	if err != nil {
+		w.l.Error("Handle WebhookCreate - Unable to serializing webhook", "error", err)
+	}
+}
+
+// swagger:route DELETE /webhooks/{id} webhooks DeleteWebhook
+// Removes a webhook subscription, its pending deliveries are dropped
+//
+// responses:
+//	204: noContentResponse
+//	403: errorResponse
+//	404: errorResponse
+
+// WebhookDelete removes the webhook subscription with the id of the path
+func (w *Webhooks) WebhookDelete(rw http.ResponseWriter, r *http.Request) {
+	id, _ := strconv.Atoi(mux.Vars(r)["id"])
+
+	w.l.Debug("Handle WebhookDelete", "id", id)
+
+	err := w.dispatcher.Unregister(id)
+
+	if err == webhook.ErrSubscriptionNotFound {
+		writeProblem(rw, r, http.StatusNotFound, err.Error())
+		return
+	}
+
+	rw.WriteHeader(http.StatusNoContent)
+}
+
+// swagger:route GET /webhooks/{id}/deliveries webhooks ListWebhookDeliveries
+// Returns the latest delivery attempts of a webhook, the newest first
+//
+// responses:
+//	200: webhookDeliveriesResponse
+//	403: errorResponse
+//	404: errorResponse
+
+// WebhookDeliveries returns the delivery log of the webhook with the id of the path
+func (w *Webhooks) WebhookDeliveries(rw http.ResponseWriter, r *http.Request) {
+	id, _ := strconv.Atoi(mux.Vars(r)["id"])
+
+	w.l.Debug("Handle WebhookDeliveries", "id", id)
+
+	dl, err := w.dispatcher.Deliveries(id)
+
+	if err == webhook.ErrSubscriptionNotFound {
+		writeProblem(rw, r, http.StatusNotFound, err.Error())
+		return
+	}
+
+	rw.Header().Add("Content-Type", "application/json")
+
+	err = data.ToJSON(dl, rw)
+
+	if err != nil {
+		w.l.Error("Handle WebhookDeliveries - Internal error", "error", err)
+		writeProblem(rw, r, http.StatusInternalServerError, "Unable to serialize the response")
+	}
+}
+
+// swagger:route GET /webhooks/{id}/dead-letters webhooks ListWebhookDeadLetters
+// Returns the events which could not be delivered to a webhook after all the retries
+//
+// responses:
+//	200: webhookDeadLettersResponse
+//	403: errorResponse
+//	404: errorResponse
+
+// WebhookDeadLetters returns the dead-letter list of the webhook with the id of the path
+func (w *Webhooks) WebhookDeadLetters(rw http.ResponseWriter, r *http.Request) {
+	id, _ := strconv.Atoi(mux.Vars(r)["id"])
+
+	w.l.Debug("Handle WebhookDeadLetters", "id", id)
+
+	dl, err := w.dispatcher.DeadLetters(id)
+
+	if err == webhook.ErrSubscriptionNotFound {
+		writeProblem(rw, r, http.StatusNotFound, err.Error())
+		return
+	}
+
+	rw.Header().Add("Content-Type", "application/json")
+
+	err = data.ToJSON(dl, rw)
+
+	if err != nil {
+		w.l.Error("Handle WebhookDeadLetters - Internal error", "error", err)
+		writeProblem(rw, r, http.StatusInternalServerError, "Unable to serialize the response")
+	}
+}
@@ -0,0 +1,79 @@
+package idempotency
+
+import (
+	"sync"
+	"time"
+)
+
+// Memory is an implementation of the Store interface which keeps the
+// records in memory, the records are lost when the service restarts
+type Memory struct {
+	mu      sync.Mutex
+	records map[string]*Record
+}
+
+// NewMemory creates a new in memory store
+func NewMemory() *Memory {
+	return &Memory{records: map[string]*Record{}}
+}
+
+// Begin reserves the key for the request with the given fingerprint during ttl
+func (m *Memory) Begin(key, fingerprint string, ttl time.Duration) (*Record, bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+
+	if rec, ok := m.records[key]; ok && now.Before(rec.ExpiresAt) {
+		cp := *rec
+		return &cp, false, nil
+	}
+
+	m.records[key] = &Record{Fingerprint: fingerprint, ExpiresAt: now.Add(ttl)}
+
+	return nil, true, nil
+}
+
+// Complete saves the response of the request which reserved the key
+func (m *Memory) Complete(key string, resp *Response) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	rec, ok := m.records[key]
+
+	if !ok {
+		return ErrKeyNotFound
+	}
+
+	rec.Response = resp
+
+	return nil
+}
+
+// Release removes the key so the request can be retried
+func (m *Memory) Release(key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.records, key)
+
+	return nil
+}
+
+// Cleanup removes the expired records and returns the number of removed records
+func (m *Memory) Cleanup() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	n := 0
+
+	for k, rec := range m.records {
+		if !now.Before(rec.ExpiresAt) {
+			delete(m.records, k)
+			n++
+		}
+	}
+
+	return n
+}
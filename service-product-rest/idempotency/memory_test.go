@@ -0,0 +1,44 @@
+package idempotency
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMemoryBeginReturnsExistingRecord(t *testing.T) {
+	m := NewMemory()
+
+	rec, ok, err := m.Begin("key", "abc", time.Minute)
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	assert.Nil(t, rec)
+
+	rec, ok, err = m.Begin("key", "def", time.Minute)
+	assert.NoError(t, err)
+	assert.False(t, ok)
+	assert.Equal(t, "abc", rec.Fingerprint)
+	assert.Nil(t, rec.Response)
+
+	resp := &Response{Status: http.StatusCreated, Body: []byte("{}")}
+	assert.NoError(t, m.Complete("key", resp))
+
+	rec, ok, _ = m.Begin("key", "abc", time.Minute)
+	assert.False(t, ok)
+	assert.Equal(t, resp, rec.Response)
+}
+
+func TestMemoryExpiredKeyCanBeReused(t *testing.T) {
+	m := NewMemory()
+
+	_, ok, _ := m.Begin("key", "abc", 0)
+	assert.True(t, ok)
+
+	_, ok, _ = m.Begin("key", "def", time.Minute)
+	assert.True(t, ok)
+
+	assert.NoError(t, m.Release("key"))
+	assert.Equal(t, ErrKeyNotFound, m.Complete("key", &Response{}))
+}
@@ -0,0 +1,37 @@
+package idempotency
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+)
+
+var ErrKeyNotFound = fmt.Errorf("Idempotency key not found")
+
+// Response is the stored response of a request, replayed on the retries
+type Response struct {
+	Status int
+	Header http.Header
+	Body   []byte
+}
+
+// Record is the state of an idempotency key
+type Record struct {
+	// Fingerprint identifies the request which used the key first
+	Fingerprint string
+	// Response is nil while the first request is still being processed
+	Response *Response
+	// ExpiresAt is the time after which the key can be reused
+	ExpiresAt time.Time
+}
+
+// Store keeps the idempotency keys and the responses of the requests
+type Store interface {
+	// Begin reserves the key for the request with the given fingerprint during ttl.
+	// When the key is already in use it returns the existing record and false
+	Begin(key, fingerprint string, ttl time.Duration) (*Record, bool, error)
+	// Complete saves the response of the request which reserved the key
+	Complete(key string, resp *Response) error
+	// Release removes the key so the request can be retried
+	Release(key string) error
+}
@@ -0,0 +1,180 @@
+// Package images is the client of the image service, which stores the image files of the products
+package images
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/CharlesSchiavinato/go-microservices/service-product-rest/data"
+)
+
+// Client calls the image service at its base URL, like http://localhost:9091
+type Client struct {
+	baseURL  string
+	client   *http.Client
+	parallel int
+}
+
+// NewClient creates the client of the image service, parallel bounds the
+// number of requests running at the same time for a list of products
+func NewClient(baseURL string, hc *http.Client, parallel int) *Client {
+	if parallel < 1 {
+		parallel = 1
+	}
+
+	return &Client{strings.TrimSuffix(baseURL, "/"), hc, parallel}
+}
+
+// URL returns the URL of the image of the product in the image service
+func (c *Client) URL(productID int, filename string) string {
+	return fmt.Sprintf("%s/images/%d/%s", c.baseURL, productID, filename)
+}
+
+// List returns the images of the product ordered by filename
+func (c *Client) List(ctx context.Context, productID int) ([]data.ProductImage, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, fmt.Sprintf("%s/images/%d", c.baseURL, productID), nil)
+
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := c.client.Do(req)
+
+	if err != nil {
+		return nil, fmt.Errorf("Unable to list the images of product %d: %w", productID, err)
+	}
+
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("Unable to list the images of product %d: image service returned %s", productID, resp.Status)
+	}
+
+	il := []data.ProductImage{}
+
+	err = json.NewDecoder(resp.Body).Decode(&il)
+
+	if err != nil {
+		return nil, fmt.Errorf("Unable to read the images of product %d: %w", productID, err)
+	}
+
+	for i := range il {
+		il[i].URL = c.URL(productID, il[i].Filename)
+	}
+
+	return il, nil
+}
+
+// Exists returns true when the image service stores the image of the product, it
+// only fetches the headers of the image
+func (c *Client) Exists(ctx context.Context, productID int, filename string) (bool, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead, c.URL(productID, filename), nil)
+
+	if err != nil {
+		return false, err
+	}
+
+	resp, err := c.client.Do(req)
+
+	if err != nil {
+		return false, fmt.Errorf("Unable to find the image %s of product %d: %w", filename, productID, err)
+	}
+
+	resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return true, nil
+	case http.StatusNotFound:
+		return false, nil
+	}
+
+	return false, fmt.Errorf("Unable to find the image %s of product %d: image service returned %s", filename, productID, resp.Status)
+}
+
+// DeleteAll removes the images of the product from the image service
+func (c *Client) DeleteAll(ctx context.Context, productID int) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodDelete, fmt.Sprintf("%s/images/%d", c.baseURL, productID), nil)
+
+	if err != nil {
+		return err
+	}
+
+	resp, err := c.client.Do(req)
+
+	if err != nil {
+		return fmt.Errorf("Unable to delete the images of product %d: %w", productID, err)
+	}
+
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusNoContent && resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("Unable to delete the images of product %d: image service returned %s", productID, resp.Status)
+	}
+
+	return nil
+}
+
+// Cleanup removes the images of the purged products from the image service and returns the
+// number of products cleaned up. The products whose images could not be removed stay in
+// the cleanups of the data store for the next run, the last error is returned
+func (c *Client) Cleanup(ctx context.Context, pdb *data.ProductDB) (int, error) {
+	n := 0
+	var last error
+
+	for _, id := range pdb.ImageCleanups() {
+		if err := c.DeleteAll(ctx, id); err != nil {
+			last = err
+			continue
+		}
+
+		pdb.ImageCleanupDone(id)
+		n++
+	}
+
+	return n, last
+}
+
+// ListAll returns the images of the products by product id, fetched in parallel. The products
+// whose images could not be fetched are left out of the images and returned with their error
+func (c *Client) ListAll(ctx context.Context, productIDs []int) (map[int][]data.ProductImage, map[int]error) {
+	images := map[int][]data.ProductImage{}
+	errs := map[int]error{}
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+
+	sem := make(chan struct{}, c.parallel)
+
+	for _, id := range productIDs {
+		wg.Add(1)
+		sem <- struct{}{}
+
+		go func(id int) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+
+			il, err := c.List(ctx, id)
+
+			mu.Lock()
+			defer mu.Unlock()
+
+			if err != nil {
+				errs[id] = err
+				return
+			}
+
+			images[id] = il
+		}(id)
+	}
+
+	wg.Wait()
+
+	return images, errs
+}
@@ -0,0 +1,144 @@
+package images
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/CharlesSchiavinato/go-microservices/service-product-rest/data"
+	"github.com/hashicorp/go-hclog"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestListAllBoundsTheRequests(t *testing.T) {
+	var mu sync.Mutex
+	running, peak := 0, 0
+
+	srv := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		running++
+		if running > peak {
+			peak = running
+		}
+		mu.Unlock()
+
+		time.Sleep(10 * time.Millisecond)
+
+		mu.Lock()
+		running--
+		mu.Unlock()
+
+		if r.URL.Path == "/images/3" {
+			http.Error(rw, "Unable to list files", http.StatusInternalServerError)
+			return
+		}
+
+		rw.Write([]byte(`[{"filename": "test.png", "size": 11, "modified_on": "2022-11-05T10:00:00Z"}]`))
+	}))
+	defer srv.Close()
+
+	c := NewClient(srv.URL+"/", srv.Client(), 2)
+
+	images, errs := c.ListAll(context.Background(), []int{1, 2, 3, 4, 5})
+
+	assert.LessOrEqual(t, peak, 2)
+	assert.Len(t, images, 4)
+	assert.Len(t, errs, 1)
+	assert.Contains(t, errs[3].Error(), "500")
+	assert.Equal(t, srv.URL+"/images/2/test.png", images[2][0].URL)
+	assert.Equal(t, int64(11), images[2][0].Size)
+}
+
+func TestListInvalidResponse(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		rw.Write([]byte(`{"filename":`))
+	}))
+	defer srv.Close()
+
+	_, err := NewClient(srv.URL, srv.Client(), 1).List(context.Background(), 1)
+
+	assert.Error(t, err)
+	assert.True(t, strings.HasPrefix(err.Error(), "Unable to read the images of product 1"))
+}
+
+func TestExists(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodHead, r.Method)
+
+		switch r.URL.Path {
+		case "/images/1/front.png":
+			rw.WriteHeader(http.StatusOK)
+		case "/images/1/back.png":
+			rw.WriteHeader(http.StatusNotFound)
+		default:
+			rw.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	defer srv.Close()
+
+	c := NewClient(srv.URL, srv.Client(), 1)
+
+	ok, err := c.Exists(context.Background(), 1, "front.png")
+	assert.NoError(t, err)
+	assert.True(t, ok)
+
+	ok, err = c.Exists(context.Background(), 1, "back.png")
+	assert.NoError(t, err)
+	assert.False(t, ok)
+
+	_, err = c.Exists(context.Background(), 2, "front.png")
+	assert.Error(t, err)
+}
+
+func TestCleanupKeepsTheFailedProducts(t *testing.T) {
+	var mu sync.Mutex
+	deleted := []string{}
+
+	srv := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodDelete, r.Method)
+
+		mu.Lock()
+		defer mu.Unlock()
+
+		if len(deleted) == 0 {
+			deleted = append(deleted, r.URL.Path)
+			http.Error(rw, "Unable to delete files", http.StatusInternalServerError)
+			return
+		}
+
+		deleted = append(deleted, r.URL.Path)
+		rw.WriteHeader(http.StatusNoContent)
+	}))
+	defer srv.Close()
+
+	pdb := data.NewProductDB(hclog.NewNullLogger(), nil, nil)
+
+	ids := []int{}
+	for _, sku := range []string{"cle-anu-pone", "cle-anu-ptwo"} {
+		pr := &data.Product{Name: "Cleanup", Price: data.Money{Amount: 100, Currency: "EUR"}, SKU: sku}
+		assert.NoError(t, pdb.ProductAdd(pr, "test"))
+		assert.NoError(t, pdb.ProductDelete(pr.ID, 0, "test"))
+		ids = append(ids, pr.ID)
+	}
+
+	assert.Equal(t, 2, pdb.ProductPurge(0))
+	assert.Equal(t, ids, pdb.ImageCleanups())
+
+	c := NewClient(srv.URL, srv.Client(), 1)
+
+	n, err := c.Cleanup(context.Background(), pdb)
+	assert.Error(t, err)
+	assert.Equal(t, 1, n)
+	assert.Equal(t, ids[:1], pdb.ImageCleanups())
+
+	n, err = c.Cleanup(context.Background(), pdb)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, n)
+	assert.Empty(t, pdb.ImageCleanups())
+	assert.Equal(t, fmt.Sprintf("/images/%d", ids[0]), deleted[2])
+}
@@ -10,6 +10,10 @@ import (
 	protos "github.com/CharlesSchiavinato/go-microservices/service-currency-grpc/protos/currency"
 	"github.com/CharlesSchiavinato/go-microservices/service-product-rest/data"
 	"github.com/CharlesSchiavinato/go-microservices/service-product-rest/handlers"
+	"github.com/CharlesSchiavinato/go-microservices/service-product-rest/idempotency"
+	"github.com/CharlesSchiavinato/go-microservices/service-product-rest/images"
+	"github.com/CharlesSchiavinato/go-microservices/service-product-rest/outbox"
+	"github.com/CharlesSchiavinato/go-microservices/service-product-rest/webhook"
 	"github.com/go-openapi/runtime/middleware"
 	gohandlers "github.com/gorilla/handlers"
 	"github.com/gorilla/mux"
@@ -20,12 +24,62 @@ import (
 var bindAddress = ":9090" // env.String("BIND_ADDRESS", false, ":9090", "Bind address or the server")
 var grpcCurrencyTarget = "localhost:9092"
 var allowedOrigins = []string{"http://localhost:3000"}
+var rateCacheTTL = time.Minute            // env.Duration("RATE_CACHE_TTL", false, "1m", "Time the currency rates are cached")
+var rateFallback = data.RateFallbackStale // env.String("RATE_FALLBACK", false, "stale", "Behaviour when the currency service is down [stale, unavailable]")
+var rateWatchInterval = 15 * time.Second  // env.Duration("RATE_WATCH_INTERVAL", false, "15s", "Interval between the refreshes of the currency rates, shorter than the cache TTL")
+var rateBreakerThreshold = 5              // env.Int("RATE_BREAKER_THRESHOLD", false, 5, "Consecutive currency service failures opening the circuit breaker")
+var rateBreakerTimeout = 30 * time.Second // env.Duration("RATE_BREAKER_TIMEOUT", false, "30s", "Time the circuit breaker stays open")
+var purgeRetention = 30 * 24 * time.Hour  // env.Duration("PURGE_RETENTION", false, "720h", "Time deleted products are kept before being purged")
+var purgeInterval = time.Hour             // env.Duration("PURGE_INTERVAL", false, "1h", "Interval between the purges of deleted products")
+var eventBufferSize = 1000                // env.Int("EVENT_BUFFER_SIZE", false, 1000, "Number of product events kept to resume the event streams")
+var webhookMaxAttempts = 5                // env.Int("WEBHOOK_MAX_ATTEMPTS", false, 5, "Delivery attempts of a webhook event before it is dead-lettered")
+var webhookTimeout = 5 * time.Second      // env.Duration("WEBHOOK_TIMEOUT", false, "5s", "Timeout of a webhook delivery")
+var webhookPrivate = false                // env.Bool("WEBHOOK_ALLOW_PRIVATE", false, false, "Allow the webhooks to loopback, link-local and private addresses")
+var outboxPublisher = "log"               // env.String("OUTBOX_PUBLISHER", false, "log", "Destination of the product events [log, file, http]")
+var outboxFile = "product-events.ndjson"  // env.String("OUTBOX_FILE", false, "product-events.ndjson", "File receiving the product events with the file publisher")
+var outboxURL = ""                        // env.String("OUTBOX_URL", false, "", "URL receiving the product events with the http publisher")
+var outboxSecret = ""                     // env.String("OUTBOX_SECRET", false, "", "Key signing the product events with the http publisher")
+var outboxInterval = time.Second          // env.Duration("OUTBOX_INTERVAL", false, "1s", "Interval between the publications of the outbox events")
+var outboxMaxAttempts = 10                // env.Int("OUTBOX_MAX_ATTEMPTS", false, 10, "Publications of an outbox event before it is dead-lettered")
+var outboxRetention = time.Hour           // env.Duration("OUTBOX_RETENTION", false, "1h", "Time the published and dead-lettered outbox events are kept")
+var outboxCleanup = 10 * time.Minute      // env.Duration("OUTBOX_CLEANUP_INTERVAL", false, "10m", "Interval between the removals of the published outbox events")
+var idempotencyTTL = 24 * time.Hour       // env.Duration("IDEMPOTENCY_TTL", false, "24h", "Time the responses are kept for the Idempotency-Key retries")
+var idempotencyCleanup = 10 * time.Minute // env.Duration("IDEMPOTENCY_CLEANUP_INTERVAL", false, "10m", "Interval between the removals of the expired idempotency keys")
+var skuPattern = data.DefaultSKUPattern   // env.String("SKU_PATTERN", false, "^[a-z]+-[a-z]+-[a-z]+$", "Pattern the lower case SKUs must match")
+var skuGenerate = true                    // env.Bool("SKU_GENERATE", false, true, "Generate the SKU of the products created without one")
+var reservationTTL = 15 * time.Minute     // env.Duration("RESERVATION_TTL", false, "15m", "Time the stock is held by the reservations without ttl")
+var reservationMaxTTL = 24 * time.Hour    // env.Duration("RESERVATION_MAX_TTL", false, "24h", "Longest time a reservation can hold the stock")
+var reservationExpiry = 10 * time.Second  // env.Duration("RESERVATION_EXPIRY_INTERVAL", false, "10s", "Interval between the releases of the expired reservations")
+var reservationKept = 7 * 24 * time.Hour  // env.Duration("RESERVATION_RETENTION", false, "168h", "Time the confirmed, cancelled and expired reservations are kept")
+var reservationCleanup = time.Hour        // env.Duration("RESERVATION_CLEANUP_INTERVAL", false, "1h", "Interval between the removals of the closed reservations")
+var defaultLocale = "en"                  // env.String("DEFAULT_LOCALE", false, "en", "Locale of the names and descriptions of the products")
+var requireIfMatch = false                // env.Bool("REQUIRE_IF_MATCH", false, false, "Reject product updates and deletes without the If-Match header")
+var adminKey = ""                         // env.String("ADMIN_KEY", false, "", "Key of the administrators in the X-Admin-Key header, nobody is an administrator when empty")
+var imageURL = "http://localhost:9091"    // env.String("IMAGE_URL", false, "http://localhost:9091", "Base URL of the image service")
+var imageTimeout = 2 * time.Second        // env.Duration("IMAGE_TIMEOUT", false, "2s", "Timeout of a request to the image service")
+var imageFetches = 4                      // env.Int("IMAGE_FETCHES", false, 4, "Requests to the image service running at the same time to expand a list")
 
 func main() {
 	// env.Parse()
 
 	l := hclog.Default()
 
+	// set the format of the SKUs before any product is validated
+	err := data.SetSKUPolicy(skuPattern, skuGenerate)
+
+	if err != nil {
+		l.Error("Invalid SKU policy", "error", err)
+		os.Exit(1)
+	}
+
+	// the product texts are written in the default locale, the other locales are translations
+	err = data.SetDefaultLocale(defaultLocale)
+
+	if err != nil {
+		l.Error("Invalid default locale", "locale", defaultLocale, "error", err)
+		os.Exit(1)
+	}
+
 	// create currency grpc client
 	conn, err := grpc.Dial(grpcCurrencyTarget, grpc.WithInsecure())
 
@@ -38,42 +92,76 @@ func main() {
 	// create client
 	cc := protos.NewCurrencyClient(conn)
 
+	// create the rate cache, the breaker stops calling the currency service while it is failing
+	cb := data.NewCircuitBreaker(rateBreakerThreshold, rateBreakerTimeout)
+	rc := data.NewRateCache(l, cc, rateCacheTTL, rateFallback, cb)
+
+	// the background workers stop when the service shuts down
+	bctx, stopBackground := context.WithCancel(context.Background())
+	defer stopBackground()
+
+	// keep the cached rates up to date, so prices are converted without calling the currency service per request
+	rw := data.NewRateWatcher(l, rc, rateWatchInterval, time.Second, time.Minute)
+	go rw.Run(bctx)
+
+	// create the broker delivering the product events of the outbox to the event streams and the webhooks
+	eb := data.NewProductEventBroker(eventBufferSize)
+
 	// create database instance
-	pdb := data.NewProductDB(l, cc)
+	pdb := data.NewProductDB(l, rc, eb)
 
-	// create the handlers
-	hp := handlers.NewProducts(l, cc, pdb)
+	// deliver the product events to the webhooks
+	wd := webhook.NewDispatcher(l, webhook.NewClient(webhookTimeout, webhookPrivate), webhookMaxAttempts, time.Second, 5*time.Minute, webhookPrivate)
+	go wd.Run(bctx, eb)
 
-	// create a new serve mux and register the handlers
-	sm := mux.NewRouter()
+	// publish the product events recorded in the outbox
+	var op outbox.Publisher
 
-	// handlers for API
-	getRouter := sm.Methods(http.MethodGet).Subrouter()
-	getRouter.HandleFunc("/products", hp.ProductList)
-	getRouter.HandleFunc("/products", hp.ProductList).Queries("currency", "{[A-Z]{3}}")
-	getRouter.HandleFunc("/products/{id:[0-9]+}", hp.ProductGet)
-	getRouter.HandleFunc("/products/{id:[0-9]+}", hp.ProductGet).Queries("currency", "{[A-Z]{3}}")
+	switch outboxPublisher {
+	case "file":
+		fp, err := outbox.NewFilePublisher(outboxFile)
 
-	putRouter := sm.Methods(http.MethodPut).Subrouter()
-	putRouter.HandleFunc("/products/{id:[0-9]+}", hp.ProductUpdate)
-	putRouter.Use(hp.ProductMiddlewareValidation)
+		if err != nil {
+			panic(err)
+		}
 
-	postRouter := sm.Methods(http.MethodPost).Subrouter()
-	postRouter.HandleFunc("/products", hp.ProductCreate)
-	postRouter.Use(hp.ProductMiddlewareValidation)
+		defer fp.Close()
+		op = fp
+	case "http":
+		op = outbox.NewHTTPPublisher(&http.Client{Timeout: webhookTimeout}, outboxURL, outboxSecret)
+	default:
+		op = outbox.NewLogPublisher(l)
+	}
 
-	deleteRouter := sm.Methods(http.MethodDelete).Subrouter()
-	deleteRouter.HandleFunc("/products/{id:[0-9]+}", hp.ProductDelete)
+	od := outbox.NewDispatcher(l, pdb, op, outboxInterval, outboxMaxAttempts, time.Second, 5*time.Minute)
+	go od.Run(bctx)
 
-	// handler for documentation
-	opts := middleware.RedocOpts{SpecURL: "/swagger.yaml"}
-	sh := middleware.Redoc(opts, nil)
+	// create the idempotency store
+	is := idempotency.NewMemory()
 
-	getRouter.Handle("/docs", sh)
-	getRouter.Handle("/swagger.yaml", http.FileServer(http.Dir("./")))
+	// create the client of the image service
+	ic := images.NewClient(imageURL, &http.Client{Timeout: imageTimeout}, imageFetches)
+
+	// create the handlers
+	hp := handlers.NewProducts(l, cc, pdb, requireIfMatch, adminKey, ic)
+	hi := handlers.NewIdempotency(l, is, idempotencyTTL)
+	he := handlers.NewProductEvents(l, pdb, eb, 15*time.Second)
+	hw := handlers.NewWebhooks(l, wd, adminKey)
+	hc := handlers.NewCategories(l, pdb)
+	hv := handlers.NewInventory(l, pdb, reservationTTL, reservationMaxTTL)
+	hr := handlers.NewPricing(l, pdb)
+	ht := handlers.NewTranslations(l, pdb)
+	hm := handlers.NewProductImages(l, pdb, ic)
+
+	// create a new serve mux and register the handlers
+	sm := newRouter(hp, hi, he, hw, hc, hv, hr, ht, hm)
 
 	//CORS
-	ch := gohandlers.CORS(gohandlers.AllowedOrigins(allowedOrigins))
+	ch := gohandlers.CORS(
+		gohandlers.AllowedOrigins(allowedOrigins),
+		gohandlers.AllowedHeaders([]string{"Content-Type", "If-Match", "If-None-Match", "X-Request-ID", "Idempotency-Key", "Last-Event-ID", "X-Actor", "X-Admin-Key"}),
+		gohandlers.ExposedHeaders([]string{"ETag", "Warning", "Link", "X-Total-Count", "X-Request-ID", "Idempotent-Replayed"}),
+	)
 
 	// create a new server
 	s := &http.Server{
@@ -83,8 +171,44 @@ func main() {
 		IdleTimeout:  120 * time.Second,
 		ReadTimeout:  5 * time.Second,
 		WriteTimeout: 10 * time.Second,
+		ConnContext:  handlers.ConnContext,
 	}
 
+	// purge the deleted products after the retention period, then remove their images
+	go every(bctx, purgeInterval, func() {
+		n := pdb.ProductPurge(purgeRetention)
+		l.Debug("Purged deleted products", "count", n)
+
+		// the images of the purged products failing to be removed are retried on the next purge
+		n, err := ic.Cleanup(bctx, pdb)
+		if err != nil {
+			l.Error("Unable to remove the images of purged products", "error", err)
+		}
+		l.Debug("Removed the images of purged products", "count", n)
+	})
+
+	go every(bctx, outboxCleanup, func() {
+		n := pdb.OutboxCleanup(outboxRetention)
+		l.Debug("Removed published and dead-lettered outbox events", "count", n)
+	})
+
+	go every(bctx, idempotencyCleanup, func() {
+		n := is.Cleanup()
+		l.Debug("Removed expired idempotency keys", "count", n)
+	})
+
+	go every(bctx, reservationCleanup, func() {
+		n := pdb.ReservationCleanup(reservationKept)
+		l.Debug("Removed closed reservations", "count", n)
+	})
+
+	// release the stock held by the expired reservations
+	go every(bctx, reservationExpiry, func() {
+		if n := pdb.ReservationExpire(); n > 0 {
+			l.Info("Released expired reservations", "count", n)
+		}
+	})
+
 	// start the server
 	go func() {
 		l.Info("Starting server on port 9090")
@@ -104,6 +228,112 @@ func main() {
 	sig := <-c
 	l.Info("Received terminate, graceful shutdown", sig)
 
-	tc, _ := context.WithTimeout(context.Background(), 30*time.Second)
+	tc, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
 	s.Shutdown(tc)
+
+	// stop the background workers before the publishers and the connections are closed
+	stopBackground()
+}
+
+// every runs the job every interval until the context is cancelled
+func every(ctx context.Context, interval time.Duration, job func()) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+			job()
+		}
+	}
+}
+
+// newRouter creates the serve mux and registers the handlers
+func newRouter(hp *handlers.Products, hi *handlers.Idempotency, he *handlers.ProductEvents, hw *handlers.Webhooks, hc *handlers.Categories, hv *handlers.Inventory, hr *handlers.Pricing, ht *handlers.Translations, hm *handlers.ProductImages) *mux.Router {
+	sm := mux.NewRouter()
+	sm.Use(handlers.RequestIDMiddleware)
+
+	// handlers for API
+	getRouter := sm.Methods(http.MethodGet).Subrouter()
+	getRouter.HandleFunc("/products", hp.ProductList)
+	getRouter.HandleFunc("/products", hp.ProductList).Queries("currency", "{[A-Z]{3}}")
+	getRouter.HandleFunc("/products/{id:[0-9]+}", hp.ProductGet)
+	getRouter.HandleFunc("/products/{id:[0-9]+}", hp.ProductGet).Queries("currency", "{[A-Z]{3}}")
+	getRouter.HandleFunc("/products/events", he.ProductEventStream)
+	getRouter.HandleFunc("/products/search", hp.ProductSearch)
+	getRouter.HandleFunc("/products/by-sku/{sku}", hp.ProductGetBySKU)
+	getRouter.HandleFunc("/products:export", hp.ProductExport)
+	getRouter.HandleFunc("/products/{id:[0-9]+}/history", hp.ProductHistory)
+	getRouter.HandleFunc("/products/{id:[0-9]+}/revisions/{rev:[0-9]+}", hp.ProductRevision)
+	getRouter.HandleFunc("/products/{id:[0-9]+}/stock", hv.StockGet)
+	getRouter.HandleFunc("/reservations/{id:[0-9]+}", hv.ReservationGet)
+	getRouter.HandleFunc("/products/{id:[0-9]+}/prices", hr.PriceList)
+	getRouter.HandleFunc("/promotions", hr.PromotionList)
+	getRouter.HandleFunc("/promotions/{id:[0-9]+}", hr.PromotionGet)
+	getRouter.HandleFunc("/products/{id:[0-9]+}/translations", ht.TranslationList)
+	getRouter.HandleFunc("/products/{id:[0-9]+}/translations/{locale}", ht.TranslationGet)
+	getRouter.HandleFunc("/products/{id:[0-9]+}/images", hm.ImageList)
+	getRouter.Handle("/webhooks", hw.WebhookMiddlewareAdmin(http.HandlerFunc(hw.WebhookList)))
+	getRouter.Handle("/webhooks/{id:[0-9]+}", hw.WebhookMiddlewareAdmin(http.HandlerFunc(hw.WebhookGet)))
+	getRouter.Handle("/webhooks/{id:[0-9]+}/deliveries", hw.WebhookMiddlewareAdmin(http.HandlerFunc(hw.WebhookDeliveries)))
+	getRouter.Handle("/webhooks/{id:[0-9]+}/dead-letters", hw.WebhookMiddlewareAdmin(http.HandlerFunc(hw.WebhookDeadLetters)))
+	getRouter.HandleFunc("/categories", hc.CategoryList)
+	getRouter.HandleFunc("/categories/tree", hc.CategoryTree)
+	getRouter.HandleFunc("/categories/{id:[0-9]+}", hc.CategoryGet)
+
+	putRouter := sm.Methods(http.MethodPut).Subrouter()
+	putRouter.HandleFunc("/products/{id:[0-9]+}", hp.ProductUpdate)
+	putRouter.Use(hp.ProductMiddlewareValidation)
+
+	postRouter := sm.Methods(http.MethodPost).Subrouter()
+	postRouter.HandleFunc("/products", hp.ProductCreate)
+	postRouter.Use(hi.IdempotencyMiddleware)
+	postRouter.Use(hp.ProductMiddlewareValidation)
+
+	patchRouter := sm.Methods(http.MethodPatch).Subrouter()
+	patchRouter.HandleFunc("/products/{id:[0-9]+}", hp.ProductPatch)
+
+	deleteRouter := sm.Methods(http.MethodDelete).Subrouter()
+	deleteRouter.HandleFunc("/products/{id:[0-9]+}", hp.ProductDelete)
+	deleteRouter.Handle("/webhooks/{id:[0-9]+}", hw.WebhookMiddlewareAdmin(http.HandlerFunc(hw.WebhookDelete)))
+	deleteRouter.HandleFunc("/categories/{id:[0-9]+}", hc.CategoryDelete)
+	deleteRouter.HandleFunc("/products/{id:[0-9]+}/prices/{price:[0-9]+}", hr.PriceDelete)
+	deleteRouter.HandleFunc("/promotions/{id:[0-9]+}", hr.PromotionDelete)
+	deleteRouter.HandleFunc("/products/{id:[0-9]+}/translations/{locale}", ht.TranslationDelete)
+	deleteRouter.HandleFunc("/products/{id:[0-9]+}/images/{filename}", hm.ImageDelete)
+
+	// actions without request body are registered apart from the validation middleware
+	actionRouter := sm.Methods(http.MethodPost).Subrouter()
+	actionRouter.HandleFunc("/products/{id:[0-9]+}/restore", hp.ProductRestore)
+	actionRouter.HandleFunc("/products/{id:[0-9]+}/revert/{rev:[0-9]+}", hp.ProductRevert)
+	actionRouter.HandleFunc("/products:import", hp.ProductImport)
+	actionRouter.Handle("/products:batch", hi.IdempotencyMiddleware(http.HandlerFunc(hp.ProductBatch)))
+	actionRouter.Handle("/webhooks", hw.WebhookMiddlewareAdmin(http.HandlerFunc(hw.WebhookCreate)))
+	actionRouter.HandleFunc("/categories", hc.CategoryCreate)
+	actionRouter.HandleFunc("/products/{id:[0-9]+}/stock/{warehouse}/adjustments", hv.StockAdjust)
+	actionRouter.Handle("/reservations", hi.IdempotencyMiddleware(http.HandlerFunc(hv.ReservationCreate)))
+	actionRouter.HandleFunc("/reservations/{id:[0-9]+}/confirm", hv.ReservationConfirm)
+	actionRouter.HandleFunc("/reservations/{id:[0-9]+}/cancel", hv.ReservationCancel)
+	actionRouter.HandleFunc("/products/{id:[0-9]+}/prices", hr.PriceCreate)
+	actionRouter.HandleFunc("/promotions", hr.PromotionCreate)
+
+	// the categories, the stock and the translations validate their own body
+	replaceRouter := sm.Methods(http.MethodPut).Subrouter()
+	replaceRouter.HandleFunc("/categories/{id:[0-9]+}", hc.CategoryUpdate)
+	replaceRouter.HandleFunc("/products/{id:[0-9]+}/stock/{warehouse}", hv.StockCount)
+	replaceRouter.HandleFunc("/products/{id:[0-9]+}/translations/{locale}", ht.TranslationPut)
+	replaceRouter.HandleFunc("/products/{id:[0-9]+}/images/{filename}", hm.ImagePut)
+
+	// handler for documentation
+	opts := middleware.RedocOpts{SpecURL: "/swagger.yaml"}
+	sh := middleware.Redoc(opts, nil)
+
+	getRouter.Handle("/docs", sh)
+	getRouter.Handle("/swagger.yaml", http.FileServer(http.Dir("./")))
+
+	return sm
 }
@@ -0,0 +1,1458 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	protos "github.com/CharlesSchiavinato/go-microservices/service-currency-grpc/protos/currency"
+	"github.com/CharlesSchiavinato/go-microservices/service-product-rest/data"
+	"github.com/CharlesSchiavinato/go-microservices/service-product-rest/handlers"
+	"github.com/CharlesSchiavinato/go-microservices/service-product-rest/idempotency"
+	"github.com/CharlesSchiavinato/go-microservices/service-product-rest/images"
+	"github.com/CharlesSchiavinato/go-microservices/service-product-rest/webhook"
+	"github.com/gorilla/mux"
+	"github.com/hashicorp/go-hclog"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+)
+
+// fakeCurrency is a CurrencyClient returning the same rate for every currency
+type fakeCurrency struct {
+	rate float64
+}
+
+func (f *fakeCurrency) GetRate(ctx context.Context, rr *protos.RateRequest, opts ...grpc.CallOption) (*protos.RateResponse, error) {
+	return &protos.RateResponse{Rate: f.rate}, nil
+}
+
+// fakeImageService lists, finds and deletes the images of the products like the image
+// service, the requests about the failing products return an error
+type fakeImageService struct {
+	mu      sync.Mutex
+	images  map[int][]string
+	failing map[int]bool
+}
+
+var imageService = &fakeImageService{images: map[int][]string{}, failing: map[int]bool{}}
+
+func (f *fakeImageService) ServeHTTP(rw http.ResponseWriter, r *http.Request) {
+	path, filename, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/images/"), "/")
+	id, err := strconv.Atoi(path)
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if err != nil || f.failing[id] {
+		http.Error(rw, "Unable to access files", http.StatusInternalServerError)
+		return
+	}
+
+	switch {
+	case r.Method == http.MethodHead:
+		for _, fn := range f.images[id] {
+			if fn == filename {
+				return
+			}
+		}
+
+		rw.WriteHeader(http.StatusNotFound)
+	case r.Method == http.MethodDelete:
+		delete(f.images, id)
+		rw.WriteHeader(http.StatusNoContent)
+	default:
+		il := []map[string]interface{}{}
+		for _, fn := range f.images[id] {
+			il = append(il, map[string]interface{}{"filename": fn, "size": 11, "modified_on": "2022-11-05T10:00:00Z"})
+		}
+
+		json.NewEncoder(rw).Encode(il)
+	}
+}
+
+// testAdminKey is the key of the administrators of the test router
+const testAdminKey = "test-admin-key"
+
+func setupRouter(t *testing.T) *mux.Router {
+	assert.NoError(t, data.SetSKUPolicy(data.DefaultSKUPattern, true))
+
+	l := hclog.NewNullLogger()
+	cc := &fakeCurrency{rate: 2}
+	rc := data.NewRateCache(l, cc, time.Minute, data.RateFallbackStale, data.NewCircuitBreaker(5, time.Minute))
+	eb := data.NewProductEventBroker(100)
+	pdb := data.NewProductDB(l, rc, eb)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+
+	wd := webhook.NewDispatcher(l, http.DefaultClient, 2, time.Millisecond, time.Millisecond, true)
+	go wd.Run(ctx, eb)
+
+	is := httptest.NewServer(imageService)
+	t.Cleanup(is.Close)
+
+	ic := images.NewClient(is.URL, is.Client(), 2)
+
+	return newRouter(
+		handlers.NewProducts(l, cc, pdb, false, testAdminKey, ic),
+		handlers.NewIdempotency(l, idempotency.NewMemory(), time.Minute),
+		handlers.NewProductEvents(l, pdb, eb, time.Minute),
+		handlers.NewWebhooks(l, wd, testAdminKey),
+		handlers.NewCategories(l, pdb),
+		handlers.NewInventory(l, pdb, time.Minute, time.Hour),
+		handlers.NewPricing(l, pdb),
+		handlers.NewTranslations(l, pdb),
+		handlers.NewProductImages(l, pdb, ic),
+	)
+}
+
+func serve(sm *mux.Router, method, target, body string, header map[string]string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(method, target, strings.NewReader(body))
+
+	for k, v := range header {
+		r.Header.Set(k, v)
+	}
+
+	rw := httptest.NewRecorder()
+	sm.ServeHTTP(rw, r)
+
+	return rw
+}
+
+// createProduct adds a product through the API and returns it
+func createProduct(t *testing.T, sm *mux.Router, name string) *data.Product {
+	rw := serve(sm, http.MethodPost, "/products", `{"name": "`+name+`", "price": {"amount": "1.5", "currency": "EUR"}}`, nil)
+
+	assert.Equal(t, http.StatusCreated, rw.Code)
+
+	pr := &data.Product{}
+	assert.NoError(t, json.Unmarshal(rw.Body.Bytes(), pr))
+
+	return pr
+}
+
+func TestProductCreate(t *testing.T) {
+	sm := setupRouter(t)
+
+	rw := serve(sm, http.MethodPost, "/products", `{"name": "Mocha", "price": {"amount": "2.5", "currency": "EUR"}}`, nil)
+
+	assert.Equal(t, http.StatusCreated, rw.Code)
+	assert.Equal(t, "application/json", rw.Header().Get("Content-Type"))
+
+	pr := &data.Product{}
+	assert.NoError(t, json.Unmarshal(rw.Body.Bytes(), pr))
+	assert.Equal(t, "Mocha", pr.Name)
+	assert.Equal(t, "/products/"+strconv.Itoa(pr.ID), rw.Header().Get("Location"))
+	assert.True(t, strings.HasPrefix(rw.Header().Get("ETag"), `"1-`))
+
+	// the tag of the write is the tag of the next read
+	rw = serve(sm, http.MethodGet, "/products/"+strconv.Itoa(pr.ID), "", map[string]string{"If-None-Match": rw.Header().Get("ETag")})
+
+	assert.Equal(t, http.StatusNotModified, rw.Code)
+}
+
+func TestProductCreateInvalidReturnsProblem(t *testing.T) {
+	sm := setupRouter(t)
+
+	rw := serve(sm, http.MethodPost, "/products", `{"name": "Mo", "price": {"amount": "2.5", "currency": "EUR"}}`, nil)
+
+	assert.Equal(t, http.StatusUnprocessableEntity, rw.Code)
+	assert.Equal(t, handlers.ProblemContentType, rw.Header().Get("Content-Type"))
+
+	pb := &handlers.Problem{}
+	assert.NoError(t, json.Unmarshal(rw.Body.Bytes(), pb))
+	assert.Len(t, pb.Errors, 1)
+	assert.Equal(t, "name", pb.Errors[0].Field)
+	assert.Equal(t, rw.Header().Get(handlers.RequestIDHeader), pb.RequestID)
+
+	rw = serve(sm, http.MethodPost, "/products", `{"name":`, nil)
+
+	assert.Equal(t, http.StatusBadRequest, rw.Code)
+}
+
+func TestProductCreateIdempotencyKey(t *testing.T) {
+	sm := setupRouter(t)
+	body := `{"name": "Affogato", "price": {"amount": "4.5", "currency": "EUR"}}`
+	header := map[string]string{"Idempotency-Key": "create-affogato"}
+
+	first := serve(sm, http.MethodPost, "/products", body, header)
+
+	assert.Equal(t, http.StatusCreated, first.Code)
+
+	retry := serve(sm, http.MethodPost, "/products", body, header)
+
+	assert.Equal(t, http.StatusCreated, retry.Code)
+	assert.Equal(t, "true", retry.Header().Get("Idempotent-Replayed"))
+	assert.Equal(t, first.Header().Get("Location"), retry.Header().Get("Location"))
+	assert.Equal(t, first.Body.String(), retry.Body.String())
+
+	rw := serve(sm, http.MethodPost, "/products", `{"name": "Affogato", "price": {"amount": "5", "currency": "EUR"}}`, header)
+
+	assert.Equal(t, http.StatusUnprocessableEntity, rw.Code)
+
+	header[handlers.ClientIDHeader] = "other-client"
+	rw = serve(sm, http.MethodPost, "/products", body, header)
+
+	assert.Equal(t, http.StatusCreated, rw.Code)
+	assert.NotEqual(t, first.Header().Get("Location"), rw.Header().Get("Location"))
+}
+
+func TestIdempotencyKeyBodyTooLarge(t *testing.T) {
+	sm := setupRouter(t)
+	body := `{"name": "` + strings.Repeat("a", 1<<20) + `"}`
+
+	rw := serve(sm, http.MethodPost, "/products", body, map[string]string{"Idempotency-Key": "create-large"})
+
+	assert.Equal(t, http.StatusRequestEntityTooLarge, rw.Code)
+}
+
+func TestIdempotencyKeyReleasedOnPanic(t *testing.T) {
+	l := hclog.NewNullLogger()
+	calls := 0
+
+	h := handlers.NewIdempotency(l, idempotency.NewMemory(), time.Minute).IdempotencyMiddleware(
+		http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+			calls++
+
+			if calls == 1 {
+				panic("failed")
+			}
+
+			rw.WriteHeader(http.StatusCreated)
+		}),
+	)
+
+	send := func() *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodPost, "/products", strings.NewReader(`{}`))
+		r.Header.Set("Idempotency-Key", "create-panic")
+
+		rw := httptest.NewRecorder()
+		h.ServeHTTP(rw, r)
+
+		return rw
+	}
+
+	assert.Panics(t, func() { send() })
+	assert.Equal(t, http.StatusCreated, send().Code)
+}
+
+func TestProductList(t *testing.T) {
+	sm := setupRouter(t)
+
+	rw := serve(sm, http.MethodGet, "/products?limit=1", "", nil)
+
+	assert.Equal(t, http.StatusOK, rw.Code)
+	assert.NotEmpty(t, rw.Header().Get("X-Total-Count"))
+	assert.Contains(t, rw.Header().Get("Link"), `rel="next"`)
+
+	pl := data.Products{}
+	assert.NoError(t, json.Unmarshal(rw.Body.Bytes(), &pl))
+	assert.Len(t, pl, 1)
+
+	rw = serve(sm, http.MethodGet, "/products?sort=color", "", nil)
+
+	assert.Equal(t, http.StatusBadRequest, rw.Code)
+
+	rw = serve(sm, http.MethodGet, "/products?currency=XYZ", "", nil)
+
+	assert.Equal(t, http.StatusBadRequest, rw.Code)
+}
+
+func TestProductListWithCurrency(t *testing.T) {
+	sm := setupRouter(t)
+
+	rw := serve(sm, http.MethodGet, "/products?currency=BRL&sku=cof-lat-std", "", nil)
+
+	assert.Equal(t, http.StatusOK, rw.Code)
+
+	pl := data.Products{}
+	assert.NoError(t, json.Unmarshal(rw.Body.Bytes(), &pl))
+	assert.Len(t, pl, 1)
+	assert.Equal(t, data.Money{Amount: 490, Currency: "BRL"}, pl[0].Price)
+}
+
+func TestProductGet(t *testing.T) {
+	sm := setupRouter(t)
+
+	rw := serve(sm, http.MethodGet, "/products/1", "", nil)
+
+	assert.Equal(t, http.StatusOK, rw.Code)
+
+	pr := &data.Product{}
+	assert.NoError(t, json.Unmarshal(rw.Body.Bytes(), pr))
+	assert.Equal(t, data.Money{Amount: 245, Currency: "EUR"}, pr.Price)
+
+	rw = serve(sm, http.MethodGet, "/products/1", "", map[string]string{"If-None-Match": rw.Header().Get("ETag")})
+
+	assert.Equal(t, http.StatusNotModified, rw.Code)
+
+	rw = serve(sm, http.MethodGet, "/products/1000", "", nil)
+
+	assert.Equal(t, http.StatusNotFound, rw.Code)
+	assert.Equal(t, handlers.ProblemContentType, rw.Header().Get("Content-Type"))
+}
+
+func TestProductGetWithCurrency(t *testing.T) {
+	sm := setupRouter(t)
+
+	rw := serve(sm, http.MethodGet, "/products/1?currency=BRL", "", nil)
+
+	assert.Equal(t, http.StatusOK, rw.Code)
+
+	pr := &data.Product{}
+	assert.NoError(t, json.Unmarshal(rw.Body.Bytes(), pr))
+	assert.Equal(t, data.Money{Amount: 490, Currency: "BRL"}, pr.Price)
+}
+
+func TestProductUpdate(t *testing.T) {
+	sm := setupRouter(t)
+	pr := createProduct(t, sm, "Flat white")
+	path := "/products/" + strconv.Itoa(pr.ID)
+	body := `{"name": "Flat white", "price": {"amount": "3", "currency": "EUR"}}`
+
+	rw := serve(sm, http.MethodPut, path, body, map[string]string{"If-Match": `"1"`})
+
+	assert.Equal(t, http.StatusNoContent, rw.Code)
+	assert.True(t, strings.HasPrefix(rw.Header().Get("ETag"), `"2-`))
+	assert.Empty(t, rw.Header().Get("Content-Type"))
+
+	assert.Equal(t, http.StatusNotModified, serve(sm, http.MethodGet, path, "", map[string]string{"If-None-Match": rw.Header().Get("ETag")}).Code)
+
+	rw = serve(sm, http.MethodPut, path, body, map[string]string{"If-Match": `"1"`})
+
+	assert.Equal(t, http.StatusPreconditionFailed, rw.Code)
+
+	rw = serve(sm, http.MethodPut, "/products/1000", body, nil)
+
+	assert.Equal(t, http.StatusNotFound, rw.Code)
+}
+
+func TestProductPatch(t *testing.T) {
+	sm := setupRouter(t)
+	pr := createProduct(t, sm, "Macchiato")
+	path := "/products/" + strconv.Itoa(pr.ID)
+
+	rw := serve(sm, http.MethodPatch, path, `{"price": {"amount": "4.25"}}`, map[string]string{"Content-Type": "application/merge-patch+json"})
+
+	assert.Equal(t, http.StatusOK, rw.Code)
+
+	np := &data.Product{}
+	assert.NoError(t, json.Unmarshal(rw.Body.Bytes(), np))
+	assert.Equal(t, data.Money{Amount: 425, Currency: "EUR"}, np.Price)
+	assert.Equal(t, "Macchiato", np.Name)
+
+	rw = serve(sm, http.MethodPatch, path, `[{"op": "replace", "path": "/name", "value": ""}]`, map[string]string{"Content-Type": "application/json-patch+json"})
+
+	assert.Equal(t, http.StatusUnprocessableEntity, rw.Code)
+
+	rw = serve(sm, http.MethodPatch, path, `{"price": {"amount": "4.25"}}`, map[string]string{"Content-Type": "application/json"})
+
+	assert.Equal(t, http.StatusUnsupportedMediaType, rw.Code)
+}
+
+func TestProductDeleteAndRestore(t *testing.T) {
+	sm := setupRouter(t)
+	pr := createProduct(t, sm, "Cortado")
+	path := "/products/" + strconv.Itoa(pr.ID)
+
+	rw := serve(sm, http.MethodDelete, path, "", nil)
+
+	assert.Equal(t, http.StatusNoContent, rw.Code)
+
+	rw = serve(sm, http.MethodGet, path, "", nil)
+
+	assert.Equal(t, http.StatusNotFound, rw.Code)
+
+	// only the administrators see the deleted products
+	for _, key := range []string{"", "not-the-admin-key"} {
+		rw = serve(sm, http.MethodGet, path+"?include_deleted=true", "", map[string]string{handlers.AdminKeyHeader: key})
+
+		assert.Equal(t, http.StatusForbidden, rw.Code)
+
+		rw = serve(sm, http.MethodGet, "/products?include_deleted=true", "", map[string]string{handlers.AdminKeyHeader: key})
+
+		assert.Equal(t, http.StatusForbidden, rw.Code)
+	}
+
+	rw = serve(sm, http.MethodGet, path+"?include_deleted=true", "", map[string]string{handlers.AdminKeyHeader: testAdminKey})
+
+	assert.Equal(t, http.StatusOK, rw.Code)
+
+	rw = serve(sm, http.MethodGet, "/products?include_deleted=true&name=cortado", "", map[string]string{handlers.AdminKeyHeader: testAdminKey})
+
+	assert.Equal(t, http.StatusOK, rw.Code)
+	assert.Contains(t, rw.Body.String(), `"id":`+strconv.Itoa(pr.ID)+`,`)
+
+	rw = serve(sm, http.MethodPost, path+"/restore", "", nil)
+
+	assert.Equal(t, http.StatusOK, rw.Code)
+
+	rw = serve(sm, http.MethodGet, path, "", nil)
+
+	assert.Equal(t, http.StatusOK, rw.Code)
+
+	rw = serve(sm, http.MethodDelete, "/products/1000", "", nil)
+
+	assert.Equal(t, http.StatusNotFound, rw.Code)
+}
+
+func TestProductHistory(t *testing.T) {
+	sm := setupRouter(t)
+	pr := createProduct(t, sm, "Flat White")
+	path := "/products/" + strconv.Itoa(pr.ID)
+
+	rw := serve(sm, http.MethodPatch, path, `{"name": "Flat White Large"}`, map[string]string{
+		"Content-Type": data.MergePatchContentType,
+		"If-Match":     `"1"`,
+		"X-Actor":      "alice",
+	})
+
+	assert.Equal(t, http.StatusOK, rw.Code)
+
+	rw = serve(sm, http.MethodGet, path+"/history", "", nil)
+
+	assert.Equal(t, http.StatusOK, rw.Code)
+
+	h := []data.Revision{}
+	assert.NoError(t, json.Unmarshal(rw.Body.Bytes(), &h))
+	assert.Len(t, h, 2)
+	assert.Equal(t, "anonymous", h[0].Actor)
+	assert.Equal(t, "alice", h[1].Actor)
+	assert.Equal(t, "name", h[1].Changes[0].Field)
+	assert.JSONEq(t, `"Flat White Large"`, string(h[1].Changes[0].To))
+
+	rw = serve(sm, http.MethodGet, path+"/revisions/1", "", nil)
+
+	assert.Equal(t, http.StatusOK, rw.Code)
+	assert.Contains(t, rw.Body.String(), `"name":"Flat White"`)
+
+	rw = serve(sm, http.MethodGet, path+"/revisions/5", "", nil)
+
+	assert.Equal(t, http.StatusNotFound, rw.Code)
+
+	rw = serve(sm, http.MethodPost, path+"/revert/1", "", map[string]string{"If-Match": `"1"`})
+
+	assert.Equal(t, http.StatusPreconditionFailed, rw.Code)
+
+	rw = serve(sm, http.MethodPost, path+"/revert/1", "", map[string]string{"If-Match": `"2"`})
+
+	assert.Equal(t, http.StatusOK, rw.Code)
+	assert.True(t, strings.HasPrefix(rw.Header().Get("ETag"), `"3-`))
+	assert.Equal(t, http.StatusNotModified, serve(sm, http.MethodGet, path, "", map[string]string{"If-None-Match": rw.Header().Get("ETag")}).Code)
+	assert.Contains(t, rw.Body.String(), `"name":"Flat White"`)
+
+	rw = serve(sm, http.MethodGet, "/products/1000/history", "", nil)
+
+	assert.Equal(t, http.StatusNotFound, rw.Code)
+}
+
+func TestProductImportExport(t *testing.T) {
+	sm := setupRouter(t)
+
+	body := "name,price,currency,sku\nRistretto,1.80,EUR,imp-api-one\nRi,1.80,EUR,imp-api-two\n"
+
+	rw := serve(sm, http.MethodPost, "/products:import?dry_run=true", body, map[string]string{"Content-Type": "text/csv"})
+
+	assert.Equal(t, http.StatusOK, rw.Code)
+
+	rep := &data.ImportReport{}
+	assert.NoError(t, json.Unmarshal(rw.Body.Bytes(), rep))
+	assert.True(t, rep.DryRun)
+	assert.Equal(t, 1, rep.Created)
+	assert.Equal(t, 1, rep.Failed)
+
+	rw = serve(sm, http.MethodPost, "/products:import?mode=upsert", body, map[string]string{"Content-Type": "text/csv"})
+
+	assert.Equal(t, http.StatusOK, rw.Code)
+	assert.NoError(t, json.Unmarshal(rw.Body.Bytes(), rep))
+	assert.Equal(t, 1, rep.Created)
+
+	// the second import updates the product with the same SKU
+	ndjson := `{"name": "Ristretto", "price": {"amount": "1.90", "currency": "EUR"}, "sku": "imp-api-one"}` + "\n"
+	rw = serve(sm, http.MethodPost, "/products:import?mode=upsert", ndjson, map[string]string{"Content-Type": "application/x-ndjson"})
+
+	assert.Equal(t, http.StatusOK, rw.Code)
+	assert.NoError(t, json.Unmarshal(rw.Body.Bytes(), rep))
+	assert.Equal(t, 1, rep.Updated)
+
+	rw = serve(sm, http.MethodPost, "/products:import", body, map[string]string{"Content-Type": "application/xml"})
+
+	assert.Equal(t, http.StatusUnsupportedMediaType, rw.Code)
+
+	rw = serve(sm, http.MethodPost, "/products:import?mode=replace", body, map[string]string{"Content-Type": "text/csv"})
+
+	assert.Equal(t, http.StatusBadRequest, rw.Code)
+
+	rw = serve(sm, http.MethodGet, "/products:export?format=csv&currency=BRL", "", nil)
+
+	assert.Equal(t, http.StatusOK, rw.Code)
+	assert.Equal(t, "text/csv", rw.Header().Get("Content-Type"))
+	assert.Contains(t, rw.Body.String(), ",Ristretto,,3.80,BRL,imp-api-one,,,2\n")
+
+	rw = serve(sm, http.MethodGet, "/products:export", "", nil)
+
+	assert.Equal(t, http.StatusOK, rw.Code)
+	assert.Equal(t, "application/x-ndjson", rw.Header().Get("Content-Type"))
+
+	lines := strings.Split(strings.TrimSpace(rw.Body.String()), "\n")
+	pr := &data.Product{}
+	assert.NoError(t, json.Unmarshal([]byte(lines[0]), pr))
+	assert.Equal(t, "Latte", pr.Name)
+
+	rw = serve(sm, http.MethodGet, "/products:export?format=xml", "", nil)
+
+	assert.Equal(t, http.StatusBadRequest, rw.Code)
+}
+
+func TestProductBatch(t *testing.T) {
+	sm := setupRouter(t)
+	pr := createProduct(t, sm, "Cortado")
+	id := strconv.Itoa(pr.ID)
+
+	body := `{"atomic": true, "operations": [
+		{"op": "create", "product": {"name": "Bica", "price": {"amount": "0.90", "currency": "EUR"}}},
+		{"op": "update", "id": ` + id + `, "version": 5, "product": {"name": "Cortado", "price": {"amount": "2.00", "currency": "EUR"}}}
+	]}`
+
+	rw := serve(sm, http.MethodPost, "/products:batch", body, nil)
+
+	assert.Equal(t, http.StatusUnprocessableEntity, rw.Code)
+
+	rep := &data.BatchReport{}
+	assert.NoError(t, json.Unmarshal(rw.Body.Bytes(), rep))
+	assert.False(t, rep.Committed)
+	assert.Equal(t, http.StatusFailedDependency, rep.Results[0].Status)
+	assert.Equal(t, http.StatusPreconditionFailed, rep.Results[1].Status)
+
+	body = `{"atomic": false, "operations": [
+		{"op": "create", "product": {"name": "Bica", "price": {"amount": "0.90", "currency": "EUR"}}},
+		{"op": "create", "product": {"name": "Bi", "price": {"amount": "0.90", "currency": "EUR"}}},
+		{"op": "delete", "id": ` + id + `, "version": 1}
+	]}`
+
+	rw = serve(sm, http.MethodPost, "/products:batch", body, map[string]string{"Idempotency-Key": "batch-1"})
+
+	assert.Equal(t, http.StatusOK, rw.Code)
+	assert.NoError(t, json.Unmarshal(rw.Body.Bytes(), rep))
+	assert.True(t, rep.Committed)
+	assert.Equal(t, http.StatusCreated, rep.Results[0].Status)
+	assert.Equal(t, http.StatusUnprocessableEntity, rep.Results[1].Status)
+	assert.Equal(t, "name", rep.Results[1].Errors[0].Field)
+	assert.Equal(t, http.StatusNoContent, rep.Results[2].Status)
+
+	// the retry of the batch is replayed
+	rw = serve(sm, http.MethodPost, "/products:batch", body, map[string]string{"Idempotency-Key": "batch-1"})
+
+	assert.Equal(t, http.StatusOK, rw.Code)
+	assert.Equal(t, "true", rw.Header().Get("Idempotent-Replayed"))
+
+	rw = serve(sm, http.MethodPost, "/products:batch", `{"operations": []}`, nil)
+
+	assert.Equal(t, http.StatusBadRequest, rw.Code)
+}
+
+func TestProductSKU(t *testing.T) {
+	sm := setupRouter(t)
+
+	// the SKU is generated when it is omitted
+	pr := createProduct(t, sm, "Marocchino")
+	assert.Regexp(t, `^mar-[a-z]{5}-[a-z]{5}$`, pr.SKU)
+
+	body := `{"name": "Marocchino", "price": {"amount": "2", "currency": "EUR"}, "sku": " ` + strings.ToUpper(pr.SKU) + `"}`
+	rw := serve(sm, http.MethodPost, "/products", body, nil)
+
+	assert.Equal(t, http.StatusConflict, rw.Code)
+
+	rw = serve(sm, http.MethodPost, "/products", `{"name": "Marocchino", "price": {"amount": "2", "currency": "EUR"}, "sku": "abc-123"}`, nil)
+
+	assert.Equal(t, http.StatusUnprocessableEntity, rw.Code)
+	assert.Contains(t, rw.Body.String(), `"field":"sku"`)
+
+	rw = serve(sm, http.MethodGet, "/products/by-sku/"+strings.ToUpper(pr.SKU)+"?currency=BRL", "", nil)
+
+	assert.Equal(t, http.StatusOK, rw.Code)
+
+	pg := &data.Product{}
+	assert.NoError(t, json.Unmarshal(rw.Body.Bytes(), pg))
+	assert.Equal(t, pr.ID, pg.ID)
+	assert.Equal(t, data.Money{Amount: 300, Currency: "BRL"}, pg.Price)
+
+	rw = serve(sm, http.MethodGet, "/products/by-sku/unknown-sku-here", "", nil)
+
+	assert.Equal(t, http.StatusNotFound, rw.Code)
+
+	// the SKU of a deleted product can be reused, the deleted product can not be restored then
+	path := "/products/" + strconv.Itoa(pr.ID)
+	serve(sm, http.MethodDelete, path, "", nil)
+
+	rw = serve(sm, http.MethodPost, "/products", body, nil)
+
+	assert.Equal(t, http.StatusCreated, rw.Code)
+
+	rw = serve(sm, http.MethodPost, path+"/restore", "", nil)
+
+	assert.Equal(t, http.StatusConflict, rw.Code)
+}
+
+func TestCategories(t *testing.T) {
+	sm := setupRouter(t)
+
+	rw := serve(sm, http.MethodPost, "/categories", `{"name": "Beans"}`, nil)
+
+	assert.Equal(t, http.StatusCreated, rw.Code)
+
+	beans := &data.Category{}
+	assert.NoError(t, json.Unmarshal(rw.Body.Bytes(), beans))
+	assert.Equal(t, "/categories/"+strconv.Itoa(beans.ID), rw.Header().Get("Location"))
+
+	rw = serve(sm, http.MethodPost, "/categories", `{"name": "Arabica", "parent_id": `+strconv.Itoa(beans.ID)+`}`, nil)
+
+	assert.Equal(t, http.StatusCreated, rw.Code)
+
+	arabica := &data.Category{}
+	assert.NoError(t, json.Unmarshal(rw.Body.Bytes(), arabica))
+
+	rw = serve(sm, http.MethodPost, "/categories", `{"name": "x"}`, nil)
+
+	assert.Equal(t, http.StatusUnprocessableEntity, rw.Code)
+
+	rw = serve(sm, http.MethodPut, "/categories/"+strconv.Itoa(beans.ID), `{"name": "Beans", "parent_id": `+strconv.Itoa(arabica.ID)+`}`, nil)
+
+	assert.Equal(t, http.StatusUnprocessableEntity, rw.Code)
+
+	rw = serve(sm, http.MethodPut, "/categories/"+strconv.Itoa(arabica.ID), `{"name": "Arabica beans", "parent_id": `+strconv.Itoa(beans.ID)+`}`, nil)
+
+	assert.Equal(t, http.StatusOK, rw.Code)
+
+	rw = serve(sm, http.MethodGet, "/categories/tree", "", nil)
+
+	assert.Equal(t, http.StatusOK, rw.Code)
+	assert.Contains(t, rw.Body.String(), `"children":[{"id":`+strconv.Itoa(arabica.ID)+`,"name":"Arabica beans"`)
+
+	body := `{"name": "Santos", "price": {"amount": "9", "currency": "EUR"}, "category_id": ` + strconv.Itoa(arabica.ID) + `, "tags": ["Brazil", "medium"]}`
+	rw = serve(sm, http.MethodPost, "/products", body, nil)
+
+	assert.Equal(t, http.StatusCreated, rw.Code)
+
+	pr := &data.Product{}
+	assert.NoError(t, json.Unmarshal(rw.Body.Bytes(), pr))
+	assert.Equal(t, []string{"brazil", "medium"}, pr.Tags)
+
+	rw = serve(sm, http.MethodPost, "/products", `{"name": "Santos", "price": {"amount": "9", "currency": "EUR"}, "category_id": 1000}`, nil)
+
+	assert.Equal(t, http.StatusUnprocessableEntity, rw.Code)
+
+	rw = serve(sm, http.MethodGet, "/products?category="+strconv.Itoa(beans.ID)+"&tag=brazil&facets=true", "", nil)
+
+	assert.Equal(t, http.StatusOK, rw.Code)
+
+	pg := &data.ProductPage{}
+	assert.NoError(t, json.Unmarshal(rw.Body.Bytes(), pg))
+	assert.Equal(t, 1, pg.Total)
+	assert.Equal(t, pr.ID, pg.Products[0].ID)
+	assert.Len(t, pg.Facets.Categories, 2)
+	assert.Equal(t, []data.TagFacet{{Tag: "brazil", Count: 1}, {Tag: "medium", Count: 1}}, pg.Facets.Tags)
+
+	rw = serve(sm, http.MethodGet, "/products?tag=brazil,light", "", nil)
+
+	assert.Equal(t, http.StatusOK, rw.Code)
+	assert.Equal(t, "0", rw.Header().Get("X-Total-Count"))
+
+	rw = serve(sm, http.MethodGet, "/products?category=1000", "", nil)
+
+	assert.Equal(t, http.StatusBadRequest, rw.Code)
+
+	rw = serve(sm, http.MethodDelete, "/categories/"+strconv.Itoa(arabica.ID), "", nil)
+
+	assert.Equal(t, http.StatusConflict, rw.Code)
+
+	serve(sm, http.MethodDelete, "/products/"+strconv.Itoa(pr.ID), "", nil)
+	rw = serve(sm, http.MethodDelete, "/categories/"+strconv.Itoa(arabica.ID), "", nil)
+
+	assert.Equal(t, http.StatusNoContent, rw.Code)
+
+	rw = serve(sm, http.MethodGet, "/categories/"+strconv.Itoa(arabica.ID), "", nil)
+
+	assert.Equal(t, http.StatusNotFound, rw.Code)
+}
+
+func TestProductSearch(t *testing.T) {
+	sm := setupRouter(t)
+
+	pr := createProduct(t, sm, "Irish coffee")
+
+	rw := serve(sm, http.MethodGet, "/products/search?q=iris&currency=BRL", "", nil)
+
+	assert.Equal(t, http.StatusOK, rw.Code)
+	assert.Equal(t, "1", rw.Header().Get("X-Total-Count"))
+
+	rl := []data.SearchResult{}
+	assert.NoError(t, json.Unmarshal(rw.Body.Bytes(), &rl))
+	assert.Equal(t, pr.ID, rl[0].Product.ID)
+	assert.Equal(t, "BRL", rl[0].Product.Price.Currency)
+	assert.Equal(t, "<em>Irish</em> coffee", rl[0].Highlights["name"])
+
+	rw = serve(sm, http.MethodGet, "/products/search?q=coffee&sort=-id&limit=1", "", nil)
+
+	assert.Equal(t, http.StatusOK, rw.Code)
+	assert.Contains(t, rw.Header().Get("Link"), `rel="next"`)
+	assert.Contains(t, rw.Body.String(), `"id":`+strconv.Itoa(pr.ID)+`,`)
+
+	rw = serve(sm, http.MethodGet, "/products/search?q=+", "", nil)
+
+	assert.Equal(t, http.StatusBadRequest, rw.Code)
+}
+
+func TestInventory(t *testing.T) {
+	sm := setupRouter(t)
+
+	pr := createProduct(t, sm, "Flat white")
+	stock := "/products/" + strconv.Itoa(pr.ID) + "/stock"
+
+	rw := serve(sm, http.MethodPut, stock+"/LIS", `{"on_hand": 3}`, nil)
+
+	assert.Equal(t, http.StatusOK, rw.Code)
+
+	rw = serve(sm, http.MethodPost, stock+"/opo/adjustments", `{"delta": 2, "reason": "restock"}`, nil)
+
+	assert.Equal(t, http.StatusOK, rw.Code)
+
+	st := &data.Stock{}
+	assert.NoError(t, json.Unmarshal(rw.Body.Bytes(), st))
+	assert.Equal(t, 5, st.Available)
+
+	rw = serve(sm, http.MethodPost, stock+"/opo/adjustments", `{"delta": 0}`, nil)
+
+	assert.Equal(t, http.StatusUnprocessableEntity, rw.Code)
+
+	rw = serve(sm, http.MethodPut, stock+"/opo_1", `{"on_hand": 1}`, nil)
+
+	assert.Equal(t, http.StatusBadRequest, rw.Code)
+
+	rw = serve(sm, http.MethodPost, stock+"/opo/adjustments", `{"delta": -3}`, nil)
+
+	assert.Equal(t, http.StatusConflict, rw.Code)
+
+	body := `{"items": [{"product_id": ` + strconv.Itoa(pr.ID) + `, "quantity": 4}], "ttl": 60}`
+	rw = serve(sm, http.MethodPost, "/reservations", body, nil)
+
+	assert.Equal(t, http.StatusCreated, rw.Code)
+
+	rv := &data.Reservation{}
+	assert.NoError(t, json.Unmarshal(rw.Body.Bytes(), rv))
+	assert.Equal(t, "/reservations/"+strconv.Itoa(rv.ID), rw.Header().Get("Location"))
+	assert.Equal(t, data.ReservationPending, rv.Status)
+	assert.Len(t, rv.Items[0].Allocations, 2)
+
+	// the held units can not be reserved again
+	rw = serve(sm, http.MethodPost, "/reservations", `{"items": [{"product_id": `+strconv.Itoa(pr.ID)+`, "quantity": 2}]}`, nil)
+
+	assert.Equal(t, http.StatusConflict, rw.Code)
+
+	rw = serve(sm, http.MethodPost, "/reservations", `{"items": [{"product_id": 1000, "quantity": 1}]}`, nil)
+
+	assert.Equal(t, http.StatusUnprocessableEntity, rw.Code)
+
+	rw = serve(sm, http.MethodPost, "/reservations", `{"items": [], "ttl": 60}`, nil)
+
+	assert.Equal(t, http.StatusUnprocessableEntity, rw.Code)
+
+	rw = serve(sm, http.MethodPost, "/reservations", `{"items": [{"product_id": 1, "quantity": 1}], "ttl": 7200}`, nil)
+
+	assert.Equal(t, http.StatusUnprocessableEntity, rw.Code)
+
+	rw = serve(sm, http.MethodPost, "/reservations/"+strconv.Itoa(rv.ID)+"/confirm", "", nil)
+
+	assert.Equal(t, http.StatusOK, rw.Code)
+	assert.Contains(t, rw.Body.String(), `"status":"confirmed"`)
+
+	rw = serve(sm, http.MethodPost, "/reservations/"+strconv.Itoa(rv.ID)+"/cancel", "", nil)
+
+	assert.Equal(t, http.StatusConflict, rw.Code)
+
+	rw = serve(sm, http.MethodGet, stock, "", nil)
+
+	assert.Equal(t, http.StatusOK, rw.Code)
+	assert.NoError(t, json.Unmarshal(rw.Body.Bytes(), st))
+	assert.Equal(t, 1, st.OnHand)
+	assert.Equal(t, 0, st.Reserved)
+
+	rw = serve(sm, http.MethodGet, "/reservations/1000000", "", nil)
+
+	assert.Equal(t, http.StatusNotFound, rw.Code)
+}
+
+func TestPricing(t *testing.T) {
+	sm := setupRouter(t)
+
+	pr := createProduct(t, sm, "Cold brew")
+	prices := "/products/" + strconv.Itoa(pr.ID) + "/prices"
+
+	rw := serve(sm, http.MethodPost, prices, `{"price_list": "wholesale", "price": {"amount": "1.2", "currency": "EUR"}}`, nil)
+
+	assert.Equal(t, http.StatusCreated, rw.Code)
+
+	e := &data.PriceEntry{}
+	assert.NoError(t, json.Unmarshal(rw.Body.Bytes(), e))
+	assert.Equal(t, prices+"/"+strconv.Itoa(e.ID), rw.Header().Get("Location"))
+
+	rw = serve(sm, http.MethodPost, prices, `{"price": {"amount": "1", "currency": "EUR"}, "effective_from": "2030-01-02T00:00:00Z", "effective_to": "2030-01-01T00:00:00Z"}`, nil)
+
+	assert.Equal(t, http.StatusUnprocessableEntity, rw.Code)
+
+	rw = serve(sm, http.MethodPost, prices, `{"price": {"amount": "0", "currency": "EUR"}}`, nil)
+
+	assert.Equal(t, http.StatusUnprocessableEntity, rw.Code)
+
+	body := `{"name": "Happy hour", "type": "percentage", "percent": 50, "starts_at": "2020-01-01T00:00:00Z", "product_ids": [` + strconv.Itoa(pr.ID) + `]}`
+	rw = serve(sm, http.MethodPost, "/promotions", body, nil)
+
+	assert.Equal(t, http.StatusCreated, rw.Code)
+
+	pm := &data.Promotion{}
+	assert.NoError(t, json.Unmarshal(rw.Body.Bytes(), pm))
+
+	rw = serve(sm, http.MethodPost, "/promotions", `{"name": "Broken", "type": "fixed", "starts_at": "2020-01-01T00:00:00Z"}`, nil)
+
+	assert.Equal(t, http.StatusUnprocessableEntity, rw.Code)
+
+	// the price is resolved and discounted, then converted
+	rw = serve(sm, http.MethodGet, "/products/"+strconv.Itoa(pr.ID)+"?price_list=wholesale&currency=BRL", "", nil)
+
+	assert.Equal(t, http.StatusOK, rw.Code)
+
+	pg := &data.Product{}
+	assert.NoError(t, json.Unmarshal(rw.Body.Bytes(), pg))
+	assert.Equal(t, "1.20", pg.Price.String())
+	assert.Equal(t, "BRL", pg.Price.Currency)
+	assert.Equal(t, "2.40", pg.Pricing.ListPrice.String())
+	assert.Equal(t, pm.ID, pg.Pricing.PromotionID)
+
+	// the product read by SKU is priced the same
+	rw = serve(sm, http.MethodGet, "/products/by-sku/"+pr.SKU+"?price_list=wholesale&currency=BRL", "", nil)
+
+	assert.Equal(t, http.StatusOK, rw.Code)
+	assert.Contains(t, rw.Body.String(), `"price":{"amount":"1.20","currency":"BRL"}`)
+
+	// the list, the search and the export use the effective price, the base price is 3.00 BRL
+	rw = serve(sm, http.MethodGet, "/products?sku="+pr.SKU+"&price_list=wholesale&currency=BRL&max_price=1.5", "", nil)
+
+	assert.Equal(t, http.StatusOK, rw.Code)
+	assert.Equal(t, "1", rw.Header().Get("X-Total-Count"))
+	assert.Contains(t, rw.Body.String(), `"price":{"amount":"1.20","currency":"BRL"}`)
+
+	rw = serve(sm, http.MethodGet, "/products/search?q=cold+brew&price_list=wholesale&currency=BRL&max_price=1.5", "", nil)
+
+	assert.Equal(t, http.StatusOK, rw.Code)
+	assert.Contains(t, rw.Body.String(), `"price":{"amount":"1.20","currency":"BRL"}`)
+
+	rw = serve(sm, http.MethodGet, "/products:export?price_list=wholesale&currency=BRL", "", nil)
+
+	assert.Equal(t, http.StatusOK, rw.Code)
+	assert.Contains(t, rw.Body.String(), `"price":{"amount":"1.20","currency":"BRL"}`)
+
+	// the price changes the entity tag without changing the version of the product
+	rw = serve(sm, http.MethodGet, "/products/"+strconv.Itoa(pr.ID), "", nil)
+	tag := rw.Header().Get("ETag")
+
+	serve(sm, http.MethodPost, prices, `{"price": {"amount": "2", "currency": "EUR"}, "effective_from": "2020-01-01T00:00:00Z"}`, nil)
+	rw = serve(sm, http.MethodGet, "/products/"+strconv.Itoa(pr.ID), "", map[string]string{"If-None-Match": tag})
+
+	assert.Equal(t, http.StatusOK, rw.Code)
+	assert.NotEqual(t, tag, rw.Header().Get("ETag"))
+
+	// before the promotion the base price is used
+	rw = serve(sm, http.MethodGet, "/products/"+strconv.Itoa(pr.ID)+"?at=2019-06-01T00:00:00Z", "", nil)
+
+	assert.Equal(t, http.StatusOK, rw.Code)
+	assert.NoError(t, json.Unmarshal(rw.Body.Bytes(), pg))
+	assert.Equal(t, "1.50", pg.Price.String())
+
+	rw = serve(sm, http.MethodGet, "/products/"+strconv.Itoa(pr.ID)+"?at=yesterday", "", nil)
+
+	assert.Equal(t, http.StatusBadRequest, rw.Code)
+
+	rw = serve(sm, http.MethodGet, prices, "", nil)
+
+	assert.Equal(t, http.StatusOK, rw.Code)
+	assert.Contains(t, rw.Body.String(), `"price_list":"wholesale"`)
+
+	rw = serve(sm, http.MethodDelete, "/promotions/"+strconv.Itoa(pm.ID), "", nil)
+
+	assert.Equal(t, http.StatusNoContent, rw.Code)
+
+	rw = serve(sm, http.MethodDelete, prices+"/"+strconv.Itoa(e.ID), "", nil)
+
+	assert.Equal(t, http.StatusNoContent, rw.Code)
+
+	rw = serve(sm, http.MethodGet, "/promotions/"+strconv.Itoa(pm.ID), "", nil)
+
+	assert.Equal(t, http.StatusNotFound, rw.Code)
+}
+
+func TestTranslations(t *testing.T) {
+	sm := setupRouter(t)
+
+	pr := createProduct(t, sm, "Hot chocolate")
+	tr := "/products/" + strconv.Itoa(pr.ID) + "/translations"
+
+	rw := serve(sm, http.MethodPut, tr+"/pt-br", `{"name": "Chocolate quente", "description": "Com chantilly"}`, nil)
+
+	assert.Equal(t, http.StatusCreated, rw.Code)
+	assert.Equal(t, tr+"/pt-BR", rw.Header().Get("Location"))
+
+	rw = serve(sm, http.MethodPut, tr+"/pt-BR", `{"name": "Chocolate quente cremoso"}`, nil)
+
+	assert.Equal(t, http.StatusOK, rw.Code)
+
+	rw = serve(sm, http.MethodPut, tr+"/en", `{"name": "Hot cocoa"}`, nil)
+
+	assert.Equal(t, http.StatusConflict, rw.Code)
+
+	rw = serve(sm, http.MethodPut, tr+"/portuguese", `{"name": "Chocolate"}`, nil)
+
+	assert.Equal(t, http.StatusBadRequest, rw.Code)
+
+	rw = serve(sm, http.MethodPut, tr+"/es", `{"name": "Ch"}`, nil)
+
+	assert.Equal(t, http.StatusUnprocessableEntity, rw.Code)
+
+	header := map[string]string{"Accept-Language": "fr;q=0.9, pt-BR, *;q=0.1"}
+	rw = serve(sm, http.MethodGet, "/products/"+strconv.Itoa(pr.ID), "", header)
+
+	assert.Equal(t, http.StatusOK, rw.Code)
+	assert.Equal(t, "pt-BR", rw.Header().Get("Content-Language"))
+	assert.Contains(t, rw.Header().Values("Vary"), "Accept-Language")
+
+	pg := &data.Product{}
+	assert.NoError(t, json.Unmarshal(rw.Body.Bytes(), pg))
+	assert.Equal(t, "Chocolate quente cremoso", pg.Name)
+
+	tag := rw.Header().Get("ETag")
+
+	rw = serve(sm, http.MethodGet, "/products?sku="+pr.SKU, "", map[string]string{"Accept-Language": "pt-PT, en;q=0.5"})
+
+	assert.Equal(t, http.StatusOK, rw.Code)
+	assert.Equal(t, "en", rw.Header().Get("Content-Language"))
+	assert.Contains(t, rw.Body.String(), `"name":"Hot chocolate"`)
+
+	// the locale and the translations change the entity tag of the product without changing its version
+	rw = serve(sm, http.MethodGet, "/products/"+strconv.Itoa(pr.ID), "", map[string]string{"If-None-Match": tag, "Accept-Language": "pt-BR"})
+
+	assert.Equal(t, http.StatusNotModified, rw.Code)
+	assert.Contains(t, rw.Header().Values("Vary"), "Accept-Language")
+
+	rw = serve(sm, http.MethodGet, "/products/"+strconv.Itoa(pr.ID), "", map[string]string{"If-None-Match": tag})
+
+	assert.Equal(t, http.StatusOK, rw.Code)
+
+	serve(sm, http.MethodPut, tr+"/pt-BR", `{"name": "Chocolate quente amargo"}`, nil)
+	rw = serve(sm, http.MethodGet, "/products/"+strconv.Itoa(pr.ID), "", map[string]string{"If-None-Match": tag, "Accept-Language": "pt-BR"})
+
+	assert.Equal(t, http.StatusOK, rw.Code)
+	assert.Contains(t, rw.Body.String(), `"name":"Chocolate quente amargo"`)
+
+	// the list is filtered and sorted by the names in the language of the response
+	createProduct(t, sm, "Espresso")
+
+	names := func(rw *httptest.ResponseRecorder) []string {
+		pl := []data.Product{}
+		assert.NoError(t, json.Unmarshal(rw.Body.Bytes(), &pl))
+
+		nl := []string{}
+		for _, p := range pl {
+			if p.Name == "Espresso" || strings.Contains(p.Name, "chocolate") || strings.Contains(p.Name, "Chocolate") {
+				nl = append(nl, p.Name)
+			}
+		}
+
+		return nl
+	}
+
+	rw = serve(sm, http.MethodGet, "/products?sort=name&limit=100", "", nil)
+
+	assert.Equal(t, []string{"Espresso", "Hot chocolate"}, names(rw))
+
+	rw = serve(sm, http.MethodGet, "/products?sort=name&limit=100", "", map[string]string{"Accept-Language": "pt-BR"})
+
+	assert.Equal(t, []string{"Chocolate quente amargo", "Espresso"}, names(rw))
+
+	rw = serve(sm, http.MethodGet, "/products?name=quente", "", map[string]string{"Accept-Language": "pt-BR"})
+
+	assert.Equal(t, "1", rw.Header().Get("X-Total-Count"))
+
+	// the tag of a read is accepted by the updates
+	rw = serve(sm, http.MethodPut, "/products/"+strconv.Itoa(pr.ID), `{"name": "Hot chocolate", "price": {"amount": "3", "currency": "EUR"}}`, map[string]string{"If-Match": rw.Header().Get("ETag")})
+
+	assert.Equal(t, http.StatusNoContent, rw.Code)
+
+	rw = serve(sm, http.MethodGet, tr, "", nil)
+
+	assert.Equal(t, http.StatusOK, rw.Code)
+	assert.Contains(t, rw.Body.String(), `"locale":"pt-BR"`)
+
+	rw = serve(sm, http.MethodDelete, tr+"/pt-BR", "", nil)
+
+	assert.Equal(t, http.StatusNoContent, rw.Code)
+
+	rw = serve(sm, http.MethodGet, tr+"/pt-BR", "", nil)
+
+	assert.Equal(t, http.StatusNotFound, rw.Code)
+}
+
+func TestContentNegotiation(t *testing.T) {
+	sm := setupRouter(t)
+
+	body := `<product><name>Flat white</name><price><amount>3.2</amount><currency>EUR</currency></price><sku>neg-flat-white</sku><tags><tag>milk</tag></tags></product>`
+	rw := serve(sm, http.MethodPost, "/products", body, map[string]string{"Content-Type": "application/xml", "Accept": "text/xml"})
+
+	assert.Equal(t, http.StatusCreated, rw.Code)
+	assert.Equal(t, handlers.XMLContentType, rw.Header().Get("Content-Type"))
+	assert.Contains(t, rw.Header().Values("Vary"), "Accept")
+
+	pr := &data.Product{}
+	assert.NoError(t, xml.Unmarshal(rw.Body.Bytes(), pr))
+	assert.Equal(t, "Flat white", pr.Name)
+	assert.Equal(t, data.Money{Amount: 320, Currency: "EUR"}, pr.Price)
+	assert.Equal(t, []string{"milk"}, pr.Tags)
+
+	b := &bytes.Buffer{}
+	assert.NoError(t, handlers.NewMsgpackEncoder(b).Encode(map[string]interface{}{"name": "Cortado", "sku": "neg-cor-tado", "price": map[string]interface{}{"amount": 2.1, "currency": "EUR"}}))
+
+	rw = serve(sm, http.MethodPost, "/products", b.String(), map[string]string{"Content-Type": "application/x-msgpack", "Accept": handlers.MsgpackContentType})
+
+	assert.Equal(t, http.StatusCreated, rw.Code)
+	assert.Equal(t, handlers.MsgpackContentType, rw.Header().Get("Content-Type"))
+
+	mp := &data.Product{}
+	assert.NoError(t, handlers.NewMsgpackDecoder(rw.Body).Decode(mp))
+	assert.Equal(t, "Cortado", mp.Name)
+	assert.Equal(t, data.Money{Amount: 210, Currency: "EUR"}, mp.Price)
+
+	// the refused JSON is skipped by the wildcard
+	rw = serve(sm, http.MethodGet, "/products/"+strconv.Itoa(pr.ID), "", map[string]string{"Accept": "application/json;q=0, application/*;q=0.8"})
+
+	assert.Equal(t, http.StatusOK, rw.Code)
+	assert.Equal(t, handlers.XMLContentType, rw.Header().Get("Content-Type"))
+
+	rw = serve(sm, http.MethodGet, "/products/by-sku/neg-cor-tado", "", map[string]string{"Accept": "*/*"})
+
+	assert.Equal(t, http.StatusOK, rw.Code)
+	assert.Equal(t, handlers.JSONContentType, rw.Header().Get("Content-Type"))
+
+	rw = serve(sm, http.MethodGet, "/products?sku=neg-flat-white", "", map[string]string{"Accept": "text/csv, application/json;q=0.5"})
+
+	assert.Equal(t, http.StatusOK, rw.Code)
+	assert.Equal(t, data.CSVContentType, rw.Header().Get("Content-Type"))
+	assert.Equal(t, "id,name,description,price,currency,sku,category_id,tags,version\n"+strconv.Itoa(pr.ID)+",Flat white,,3.20,EUR,neg-flat-white,,milk,1\n", rw.Body.String())
+
+	rw = serve(sm, http.MethodGet, "/products?sku=neg-flat-white", "", map[string]string{"Accept": "application/xml"})
+
+	assert.Equal(t, http.StatusOK, rw.Code)
+	assert.Contains(t, rw.Body.String(), "<products><product><id>"+strconv.Itoa(pr.ID)+"</id>")
+
+	// CSV only represents the lists
+	for _, target := range []string{"/products/" + strconv.Itoa(pr.ID), "/products?facets=true"} {
+		rw = serve(sm, http.MethodGet, target, "", map[string]string{"Accept": "text/csv"})
+
+		assert.Equal(t, http.StatusNotAcceptable, rw.Code, target)
+		assert.Equal(t, handlers.ProblemContentType, rw.Header().Get("Content-Type"))
+	}
+
+	rw = serve(sm, http.MethodGet, "/products", "", map[string]string{"Accept": "image/png"})
+
+	assert.Equal(t, http.StatusNotAcceptable, rw.Code)
+
+	// nothing is added when the response is not acceptable
+	rw = serve(sm, http.MethodPost, "/products", `{"name": "Ristretto", "sku": "neg-ris-tretto", "price": {"amount": "1", "currency": "EUR"}}`, map[string]string{"Accept": "text/html"})
+
+	assert.Equal(t, http.StatusNotAcceptable, rw.Code)
+
+	rw = serve(sm, http.MethodGet, "/products/by-sku/neg-ris-tretto", "", nil)
+
+	assert.Equal(t, http.StatusNotFound, rw.Code)
+
+	rw = serve(sm, http.MethodPost, "/products", "name,price\nRistretto,1", map[string]string{"Content-Type": "text/csv"})
+
+	assert.Equal(t, http.StatusUnsupportedMediaType, rw.Code)
+
+	rw = serve(sm, http.MethodPost, "/products", "\x81\xa4name", map[string]string{"Content-Type": handlers.MsgpackContentType})
+
+	assert.Equal(t, http.StatusBadRequest, rw.Code)
+
+	// the bodies are limited whatever their media type
+	name := strings.Repeat("a", 1<<20)
+	b.Reset()
+	assert.NoError(t, handlers.NewMsgpackEncoder(b).Encode(map[string]string{"name": name}))
+
+	bodies := map[string]string{
+		handlers.JSONContentType:    `{"name":"` + name + `"}`,
+		handlers.XMLContentType:     "<product><name>" + name + "</name></product>",
+		handlers.MsgpackContentType: b.String(),
+	}
+
+	for ct, body := range bodies {
+		rw = serve(sm, http.MethodPost, "/products", body, map[string]string{"Content-Type": ct})
+
+		assert.Equal(t, http.StatusRequestEntityTooLarge, rw.Code, ct)
+	}
+
+	for _, id := range []int{pr.ID, mp.ID} {
+		assert.Equal(t, http.StatusNoContent, serve(sm, http.MethodDelete, "/products/"+strconv.Itoa(id), "", nil).Code)
+	}
+}
+
+func TestProductViews(t *testing.T) {
+	sm := setupRouter(t)
+
+	pa := createProduct(t, sm, "Sparse alpha")
+	pb := createProduct(t, sm, "Sparse beta")
+
+	imageService.mu.Lock()
+	imageService.images[pa.ID] = []string{"back.png", "front.png", "side.png"}
+	imageService.images[pb.ID] = []string{"front.png"}
+	imageService.mu.Unlock()
+
+	for _, target := range []string{"/products/" + strconv.Itoa(pa.ID) + "/images/back.png", "/products/" + strconv.Itoa(pa.ID) + "/images/front.png", "/products/" + strconv.Itoa(pb.ID) + "/images/front.png"} {
+		assert.Equal(t, http.StatusCreated, serve(sm, http.MethodPut, target, "", nil).Code, target)
+	}
+
+	imageService.mu.Lock()
+	imageService.failing[pb.ID] = true
+	imageService.mu.Unlock()
+
+	path := "/products/" + strconv.Itoa(pa.ID)
+
+	rw := serve(sm, http.MethodGet, path+"?fields=id,name,price", "", nil)
+
+	assert.Equal(t, http.StatusOK, rw.Code)
+	assert.JSONEq(t, `{"id": `+strconv.Itoa(pa.ID)+`, "name": "Sparse alpha", "price": {"amount": "1.50", "currency": "EUR"}}`, rw.Body.String())
+
+	rw = serve(sm, http.MethodGet, path+"?fields=name&expand=images", "", nil)
+
+	assert.Equal(t, http.StatusOK, rw.Code)
+
+	pr := &data.Product{}
+	assert.NoError(t, json.Unmarshal(rw.Body.Bytes(), pr))
+	assert.Equal(t, "Sparse alpha", pr.Name)
+	assert.Len(t, pr.Images, 2)
+	assert.Equal(t, "front.png", pr.Images[1].Filename)
+	assert.True(t, strings.HasSuffix(pr.Images[1].URL, "/images/"+strconv.Itoa(pa.ID)+"/front.png"))
+	assert.Equal(t, int64(11), pr.Images[1].Size)
+	assert.NotNil(t, pr.Images[1].ModifiedOn)
+
+	rw = serve(sm, http.MethodGet, path+"?expand=rate&currency=BRL", "", nil)
+
+	assert.Equal(t, http.StatusOK, rw.Code)
+
+	pr = &data.Product{}
+	assert.NoError(t, json.Unmarshal(rw.Body.Bytes(), pr))
+	assert.Equal(t, data.Money{Amount: 300, Currency: "BRL"}, pr.Price)
+	assert.Equal(t, "EUR", pr.Rate.Base)
+	assert.Equal(t, 2.0, pr.Rate.Rate)
+
+	// the rate is only returned when it is expanded
+	rw = serve(sm, http.MethodGet, path+"?currency=BRL", "", nil)
+
+	assert.Equal(t, http.StatusOK, rw.Code)
+	assert.NotContains(t, rw.Body.String(), `"rate"`)
+
+	rw = serve(sm, http.MethodGet, path+"?fields=id,name", "", map[string]string{"Accept": "application/xml"})
+
+	assert.Equal(t, http.StatusOK, rw.Code)
+	assert.Contains(t, rw.Body.String(), "<product><id>"+strconv.Itoa(pa.ID)+"</id><name>Sparse alpha</name></product>")
+
+	// the images of the other products are expanded when the listing of a product fails
+	rw = serve(sm, http.MethodGet, "/products?name=sparse&fields=id&expand=images", "", nil)
+
+	assert.Equal(t, http.StatusOK, rw.Code)
+	assert.Equal(t, `199 - "Unable to expand the images of the products `+strconv.Itoa(pb.ID)+`"`, rw.Header().Get("Warning"))
+
+	pl := data.Products{}
+	assert.NoError(t, json.Unmarshal(rw.Body.Bytes(), &pl))
+	assert.Len(t, pl, 2)
+	assert.Len(t, pl[0].Images, 2)
+	assert.Equal(t, int64(11), pl[0].Images[0].Size)
+	assert.Len(t, pl[1].Images, 1)
+	assert.Zero(t, pl[1].Images[0].Size)
+
+	rw = serve(sm, http.MethodGet, "/products?name=sparse&facets=true&fields=name", "", nil)
+
+	assert.Equal(t, http.StatusOK, rw.Code)
+	assert.Contains(t, rw.Body.String(), `"products":[{"name":"Sparse alpha"},{"name":"Sparse beta"}]`)
+
+	for _, target := range []string{path + "?fields=id,color", path + "?expand=reviews", "/products?fields="} {
+		rw = serve(sm, http.MethodGet, target, "", nil)
+
+		assert.Equal(t, http.StatusBadRequest, rw.Code, target)
+	}
+
+	rw = serve(sm, http.MethodGet, "/products?fields=id", "", map[string]string{"Accept": "text/csv"})
+
+	assert.Equal(t, http.StatusNotAcceptable, rw.Code)
+
+	for _, id := range []int{pa.ID, pb.ID} {
+		assert.Equal(t, http.StatusNoContent, serve(sm, http.MethodDelete, "/products/"+strconv.Itoa(id), "", nil).Code)
+	}
+}
+
+func TestProductImages(t *testing.T) {
+	sm := setupRouter(t)
+
+	pr := createProduct(t, sm, "Pictured mocha")
+	path := "/products/" + strconv.Itoa(pr.ID) + "/images"
+
+	imageService.mu.Lock()
+	imageService.images[pr.ID] = []string{"back.png", "front.png"}
+	imageService.mu.Unlock()
+
+	// the image must be stored by the image service
+	rw := serve(sm, http.MethodPut, path+"/side.png", "", nil)
+	assert.Equal(t, http.StatusUnprocessableEntity, rw.Code)
+
+	rw = serve(sm, http.MethodPut, path+"/front.png", `{"alt": "The mocha from the front"}`, nil)
+	assert.Equal(t, http.StatusCreated, rw.Code)
+
+	img := &data.ProductImage{}
+	assert.NoError(t, json.Unmarshal(rw.Body.Bytes(), img))
+	assert.True(t, img.Primary)
+	assert.Equal(t, 1, img.Position)
+	assert.True(t, strings.HasSuffix(img.URL, "/images/"+strconv.Itoa(pr.ID)+"/front.png"))
+
+	rw = serve(sm, http.MethodPut, path+"/back.png", `{"alt": "The mocha from the back", "primary": true, "position": 1}`, nil)
+	assert.Equal(t, http.StatusCreated, rw.Code)
+
+	rw = serve(sm, http.MethodPut, path+"/front.png", `{"alt": "The mocha"}`, nil)
+	assert.Equal(t, http.StatusOK, rw.Code)
+
+	rw = serve(sm, http.MethodGet, path, "", nil)
+	assert.Equal(t, http.StatusOK, rw.Code)
+
+	il := []data.ProductImage{}
+	assert.NoError(t, json.Unmarshal(rw.Body.Bytes(), &il))
+	assert.Len(t, il, 2)
+	assert.Equal(t, "back.png", il[0].Filename)
+	assert.True(t, il[0].Primary)
+	assert.Equal(t, "front.png", il[1].Filename)
+	assert.Equal(t, "The mocha", il[1].Alt)
+	assert.Equal(t, 2, il[1].Position)
+	assert.False(t, il[1].Primary)
+
+	// the images are part of the product and of its history
+	rw = serve(sm, http.MethodGet, "/products/"+strconv.Itoa(pr.ID), "", nil)
+
+	got := &data.Product{}
+	assert.NoError(t, json.Unmarshal(rw.Body.Bytes(), got))
+	assert.Equal(t, pr.Version+3, got.Version)
+	assert.Len(t, got.Images, 2)
+
+	rw = serve(sm, http.MethodGet, "/products/"+strconv.Itoa(pr.ID)+"/history", "", nil)
+	assert.Contains(t, rw.Body.String(), `"field":"images"`)
+
+	// an update keeps the images
+	rw = serve(sm, http.MethodPut, "/products/"+strconv.Itoa(pr.ID), `{"name": "Pictured latte", "price": {"amount": "1.5", "currency": "EUR"}, "images": []}`, nil)
+	assert.Equal(t, http.StatusNoContent, rw.Code)
+
+	il, err := data.NewProductDB(hclog.NewNullLogger(), nil, nil).ProductImageList(pr.ID)
+	assert.NoError(t, err)
+	assert.Len(t, il, 2)
+
+	for target, status := range map[string]int{
+		path + "/front":                   http.StatusBadRequest,
+		"/products/9999/images/front.png": http.StatusNotFound,
+	} {
+		assert.Equal(t, status, serve(sm, http.MethodPut, target, "", nil).Code, target)
+	}
+
+	rw = serve(sm, http.MethodPut, path+"/front.png", `{"alt": "`+strings.Repeat("a", 151)+`"}`, nil)
+	assert.Equal(t, http.StatusUnprocessableEntity, rw.Code)
+
+	// detaching the primary image makes the next one primary
+	assert.Equal(t, http.StatusNoContent, serve(sm, http.MethodDelete, path+"/back.png", "", nil).Code)
+	assert.Equal(t, http.StatusNotFound, serve(sm, http.MethodDelete, path+"/back.png", "", nil).Code)
+
+	rw = serve(sm, http.MethodGet, path, "", nil)
+
+	il = []data.ProductImage{}
+	assert.NoError(t, json.Unmarshal(rw.Body.Bytes(), &il))
+	assert.Len(t, il, 1)
+	assert.True(t, il[0].Primary)
+	assert.Equal(t, 1, il[0].Position)
+
+	imageService.mu.Lock()
+	imageService.failing[pr.ID] = true
+	imageService.mu.Unlock()
+
+	rw = serve(sm, http.MethodPut, path+"/back.png", "", nil)
+	assert.Equal(t, http.StatusServiceUnavailable, rw.Code)
+}
+
+func TestProductEventStream(t *testing.T) {
+	sm := setupRouter(t)
+	srv := httptest.NewServer(sm)
+	defer srv.Close()
+
+	pr := createProduct(t, sm, "Mocha")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	r, _ := http.NewRequestWithContext(ctx, http.MethodGet, srv.URL+"/products/events?currency=BRL&product_id="+strconv.Itoa(pr.ID), nil)
+	r.Header.Set("Last-Event-ID", "0")
+
+	resp, err := http.DefaultClient.Do(r)
+	assert.NoError(t, err)
+	defer resp.Body.Close()
+
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "text/event-stream", resp.Header.Get("Content-Type"))
+
+	// the created event is replayed and the update is streamed
+	serve(sm, http.MethodDelete, "/products/"+strconv.Itoa(pr.ID), "", nil)
+
+	sc := bufio.NewScanner(resp.Body)
+	events := []data.ProductEvent{}
+
+	for len(events) < 2 && sc.Scan() {
+		if !strings.HasPrefix(sc.Text(), "data: ") {
+			continue
+		}
+
+		e := data.ProductEvent{}
+		assert.NoError(t, json.Unmarshal([]byte(strings.TrimPrefix(sc.Text(), "data: ")), &e))
+		events = append(events, e)
+	}
+
+	assert.Len(t, events, 2)
+	assert.Equal(t, data.ProductCreated, events[0].Type)
+	assert.Equal(t, data.Money{Amount: 300, Currency: "BRL"}, events[0].Product.Price)
+	assert.Equal(t, data.ProductDeleted, events[1].Type)
+	assert.Equal(t, 2, events[1].Version)
+
+	rw := serve(sm, http.MethodGet, "/products/events", "", map[string]string{"Last-Event-ID": "x"})
+
+	assert.Equal(t, http.StatusBadRequest, rw.Code)
+}
+
+func TestProductEventStreamOutlivesWriteTimeout(t *testing.T) {
+	l := hclog.NewNullLogger()
+	eb := data.NewProductEventBroker(100)
+	pe := handlers.NewProductEvents(l, data.NewProductDB(l, nil, eb), eb, 20*time.Millisecond)
+
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(pe.ProductEventStream))
+	srv.Config.WriteTimeout = 50 * time.Millisecond
+	srv.Config.ConnContext = handlers.ConnContext
+	srv.Start()
+	defer srv.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	r, _ := http.NewRequestWithContext(ctx, http.MethodGet, srv.URL, nil)
+
+	resp, err := http.DefaultClient.Do(r)
+	assert.NoError(t, err)
+	defer resp.Body.Close()
+
+	// the heartbeats keep coming after the write timeout
+	start := time.Now()
+	sc := bufio.NewScanner(resp.Body)
+
+	for time.Since(start) < 200*time.Millisecond {
+		if !assert.True(t, sc.Scan(), "stream closed after %s", time.Since(start)) {
+			return
+		}
+	}
+}
+
+func TestWebhooks(t *testing.T) {
+	sm := setupRouter(t)
+
+	received := make(chan *http.Request, 10)
+	recv := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		received <- r
+	}))
+	defer recv.Close()
+
+	admin := map[string]string{handlers.AdminKeyHeader: testAdminKey}
+
+	// only the administrators manage the webhooks
+	rw := serve(sm, http.MethodGet, "/webhooks", "", nil)
+
+	assert.Equal(t, http.StatusForbidden, rw.Code)
+
+	rw = serve(sm, http.MethodPost, "/webhooks", `{"url": "`+recv.URL+`", "events": ["created"]}`, map[string]string{handlers.AdminKeyHeader: "wrong"})
+
+	assert.Equal(t, http.StatusForbidden, rw.Code)
+
+	rw = serve(sm, http.MethodPost, "/webhooks", `{"url": "ftp://example.com", "events": ["renamed"]}`, admin)
+
+	assert.Equal(t, http.StatusUnprocessableEntity, rw.Code)
+	assert.Contains(t, rw.Body.String(), `"field":"url"`)
+	assert.Contains(t, rw.Body.String(), `"field":"events[0]"`)
+
+	rw = serve(sm, http.MethodPost, "/webhooks", `{"url": "`+recv.URL+`", "events": ["created"]}`, admin)
+
+	assert.Equal(t, http.StatusCreated, rw.Code)
+
+	s := &webhook.Subscription{}
+	assert.NoError(t, json.Unmarshal(rw.Body.Bytes(), s))
+	assert.NotEmpty(t, s.Secret)
+	assert.Equal(t, "/webhooks/"+strconv.Itoa(s.ID), rw.Header().Get("Location"))
+
+	path := rw.Header().Get("Location")
+
+	// the secret is only returned on the creation
+	rw = serve(sm, http.MethodGet, path, "", admin)
+
+	assert.Equal(t, http.StatusOK, rw.Code)
+	assert.NotContains(t, rw.Body.String(), "secret")
+
+	createProduct(t, sm, "Mocha")
+
+	select {
+	case r := <-received:
+		assert.Equal(t, "created", r.Header.Get(webhook.EventHeader))
+	case <-time.After(5 * time.Second):
+		t.Fatal("the webhook did not receive the event")
+	}
+
+	assert.Eventually(t, func() bool {
+		rw = serve(sm, http.MethodGet, path+"/deliveries", "", admin)
+		return strings.Contains(rw.Body.String(), `"status_code":200`)
+	}, 5*time.Second, 10*time.Millisecond)
+
+	rw = serve(sm, http.MethodGet, path+"/dead-letters", "", admin)
+
+	assert.Equal(t, http.StatusOK, rw.Code)
+	assert.Equal(t, "[]\n", rw.Body.String())
+
+	rw = serve(sm, http.MethodDelete, path, "", admin)
+
+	assert.Equal(t, http.StatusNoContent, rw.Code)
+
+	rw = serve(sm, http.MethodGet, path+"/deliveries", "", admin)
+
+	assert.Equal(t, http.StatusNotFound, rw.Code)
+}
+
+func TestDocumentation(t *testing.T) {
+	sm := setupRouter(t)
+
+	rw := serve(sm, http.MethodGet, "/docs", "", nil)
+
+	assert.Equal(t, http.StatusOK, rw.Code)
+
+	rw = serve(sm, http.MethodGet, "/swagger.yaml", "", nil)
+
+	assert.Equal(t, http.StatusOK, rw.Code)
+}
@@ -0,0 +1,106 @@
+package outbox
+
+import (
+	"context"
+	"time"
+
+	"github.com/CharlesSchiavinato/go-microservices/service-product-rest/data"
+	"github.com/hashicorp/go-hclog"
+)
+
+// batchSize is the number of outbox entries read on each dispatch
+const batchSize = 100
+
+// Dispatcher publishes the pending outbox entries. An entry is only marked as
+// published after the publisher accepts it, so the events are published at
+// least once. When the publication of a product event fails the next events of
+// the same product wait for it, keeping the order of the events per product.
+// The entry is dead-lettered after the last attempt so the product is not blocked
+type Dispatcher struct {
+	l           hclog.Logger
+	productDB   *data.ProductDB
+	publisher   Publisher
+	interval    time.Duration
+	maxAttempts int
+	minBackoff  time.Duration
+	maxBackoff  time.Duration
+}
+
+// NewDispatcher creates a dispatcher polling the outbox every interval and making up to
+// maxAttempts publications per entry, waiting from minBackoff up to maxBackoff between them
+func NewDispatcher(l hclog.Logger, pdb *data.ProductDB, p Publisher, interval time.Duration, maxAttempts int, minBackoff, maxBackoff time.Duration) *Dispatcher {
+	return &Dispatcher{l, pdb, p, interval, maxAttempts, minBackoff, maxBackoff}
+}
+
+// Run dispatches the outbox entries until the context is cancelled
+func (d *Dispatcher) Run(ctx context.Context) {
+	t := time.NewTicker(d.interval)
+	defer t.Stop()
+
+	for {
+		d.Dispatch(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+	}
+}
+
+// Dispatch publishes the pending outbox entries and returns the number of published entries
+func (d *Dispatcher) Dispatch(ctx context.Context) int {
+	published := 0
+	blocked := map[int]bool{}
+
+	for _, e := range d.productDB.OutboxPending(batchSize) {
+		if ctx.Err() != nil {
+			break
+		}
+
+		pid := e.Event.ProductID
+
+		if blocked[pid] {
+			continue
+		}
+
+		err := d.publisher.Publish(ctx, e.Event)
+
+		if err != nil && e.Attempts+1 >= d.maxAttempts {
+			d.l.Error("Unable to publish the product event, giving up", "id", e.Event.ID, "product_id", pid, "attempts", e.Attempts+1, "error", err)
+			d.productDB.OutboxDeadLetter(e.Event.ID, err)
+
+			continue
+		}
+
+		if err != nil {
+			blocked[pid] = true
+			retryAt := time.Now().Add(d.backoff(e.Attempts + 1))
+
+			d.l.Error("Unable to publish the product event", "id", e.Event.ID, "product_id", pid, "attempt", e.Attempts+1, "retry_at", retryAt, "error", err)
+			d.productDB.OutboxFailed(e.Event.ID, err, retryAt)
+
+			continue
+		}
+
+		d.productDB.OutboxPublished(e.Event.ID)
+		published++
+	}
+
+	return published
+}
+
+// backoff returns the time to wait before the given attempt
+func (d *Dispatcher) backoff(attempt int) time.Duration {
+	b := d.minBackoff
+
+	for i := 1; i < attempt && b < d.maxBackoff; i++ {
+		b *= 2
+	}
+
+	if b > d.maxBackoff {
+		b = d.maxBackoff
+	}
+
+	return b
+}
@@ -0,0 +1,190 @@
+package outbox
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/CharlesSchiavinato/go-microservices/service-product-rest/data"
+	"github.com/CharlesSchiavinato/go-microservices/service-product-rest/webhook"
+	"github.com/hashicorp/go-hclog"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakePublisher records the published events and fails the
+// events of a product while failures is greater than zero
+type fakePublisher struct {
+	mu        sync.Mutex
+	events    []data.ProductEvent
+	failID    int
+	failures  int
+	published map[uint64]int
+}
+
+func (f *fakePublisher) Publish(ctx context.Context, e data.ProductEvent) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if e.ProductID == f.failID && f.failures > 0 {
+		f.failures--
+		return fmt.Errorf("publisher unavailable")
+	}
+
+	f.events = append(f.events, e)
+	f.published[e.ID]++
+
+	return nil
+}
+
+// productEvents returns the types of the published events of the product
+func (f *fakePublisher) productEvents(id int) []data.ProductEventType {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	tl := []data.ProductEventType{}
+	for _, e := range f.events {
+		if e.ProductID == id {
+			tl = append(tl, e.Type)
+		}
+	}
+
+	return tl
+}
+
+func newProduct(pdb *data.ProductDB, name, sku string) *data.Product {
+	pr := &data.Product{Name: name, Price: data.Money{Amount: 250, Currency: "EUR"}, SKU: sku}
+	pdb.ProductAdd(pr, "test")
+
+	return pr
+}
+
+func TestDispatcherKeepsOrderPerProduct(t *testing.T) {
+	pdb := data.NewProductDB(hclog.NewNullLogger(), nil, nil)
+
+	failing := newProduct(pdb, "Ristretto", "out-ris-one")
+	other := newProduct(pdb, "Lungo", "out-lun-one")
+	assert.NoError(t, pdb.ProductDelete(failing.ID, 0, "test"))
+	assert.NoError(t, pdb.ProductDelete(other.ID, 0, "test"))
+
+	fp := &fakePublisher{failID: failing.ID, failures: 2, published: map[uint64]int{}}
+	d := NewDispatcher(hclog.NewNullLogger(), pdb, fp, time.Hour, 10, 0, 0)
+
+	// the events of the failing product wait, the other product is not delayed
+	d.Dispatch(context.Background())
+
+	assert.Empty(t, fp.productEvents(failing.ID))
+	assert.Equal(t, []data.ProductEventType{data.ProductCreated, data.ProductDeleted}, fp.productEvents(other.ID))
+
+	d.Dispatch(context.Background())
+	assert.Empty(t, fp.productEvents(failing.ID))
+
+	d.Dispatch(context.Background())
+	assert.Equal(t, []data.ProductEventType{data.ProductCreated, data.ProductDeleted}, fp.productEvents(failing.ID))
+
+	// the published entries are not published again
+	d.Dispatch(context.Background())
+
+	for id, n := range fp.published {
+		assert.Equal(t, 1, n, "event %d", id)
+	}
+}
+
+func TestDispatcherBackoff(t *testing.T) {
+	pdb := data.NewProductDB(hclog.NewNullLogger(), nil, nil)
+	pr := newProduct(pdb, "Doppio", "out-dop-one")
+
+	fp := &fakePublisher{failID: pr.ID, failures: 1, published: map[uint64]int{}}
+	d := NewDispatcher(hclog.NewNullLogger(), pdb, fp, time.Hour, 10, time.Hour, time.Hour)
+
+	d.Dispatch(context.Background())
+	d.Dispatch(context.Background())
+
+	// the entry waits for its retry time
+	assert.Empty(t, fp.productEvents(pr.ID))
+
+	assert.Equal(t, time.Hour, d.backoff(1))
+	d = NewDispatcher(hclog.NewNullLogger(), pdb, fp, time.Hour, 10, time.Second, 5*time.Second)
+	assert.Equal(t, 4*time.Second, d.backoff(3))
+	assert.Equal(t, 5*time.Second, d.backoff(10))
+}
+
+func TestDispatcherDeadLettersAfterMaxAttempts(t *testing.T) {
+	pdb := data.NewProductDB(hclog.NewNullLogger(), nil, nil)
+
+	pr := newProduct(pdb, "Cortado", "out-cor-one")
+	assert.NoError(t, pdb.ProductDelete(pr.ID, 0, "test"))
+
+	fp := &fakePublisher{failID: pr.ID, failures: 2, published: map[uint64]int{}}
+	d := NewDispatcher(hclog.NewNullLogger(), pdb, fp, time.Hour, 2, 0, 0)
+
+	d.Dispatch(context.Background())
+	assert.Empty(t, fp.productEvents(pr.ID))
+
+	// the created event is given up after the second attempt, the next event of the product is published
+	d.Dispatch(context.Background())
+	assert.Equal(t, []data.ProductEventType{data.ProductDeleted}, fp.productEvents(pr.ID))
+
+	for _, e := range pdb.OutboxPending(1000) {
+		assert.NotEqual(t, pr.ID, e.Event.ProductID)
+	}
+}
+
+func TestFilePublisher(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "events.ndjson")
+
+	fp, err := NewFilePublisher(path)
+	assert.NoError(t, err)
+
+	assert.NoError(t, fp.Publish(context.Background(), data.ProductEvent{ID: 1, Type: data.ProductCreated, ProductID: 3}))
+	assert.NoError(t, fp.Publish(context.Background(), data.ProductEvent{ID: 2, Type: data.ProductUpdated, ProductID: 3}))
+	assert.NoError(t, fp.Close())
+
+	f, err := os.Open(path)
+	assert.NoError(t, err)
+	defer f.Close()
+
+	el := []data.ProductEvent{}
+	sc := bufio.NewScanner(f)
+
+	for sc.Scan() {
+		e := data.ProductEvent{}
+		assert.NoError(t, json.Unmarshal(sc.Bytes(), &e))
+		el = append(el, e)
+	}
+
+	assert.Len(t, el, 2)
+	assert.Equal(t, data.ProductUpdated, el[1].Type)
+}
+
+func TestHTTPPublisher(t *testing.T) {
+	status := http.StatusOK
+	var signed bool
+
+	recv := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		ts, _ := strconv.ParseInt(r.Header.Get(webhook.TimestampHeader), 10, 64)
+
+		signed = r.Header.Get(webhook.SignatureHeader) == webhook.Sign("secret", ts, body)
+		rw.WriteHeader(status)
+	}))
+	defer recv.Close()
+
+	hp := NewHTTPPublisher(http.DefaultClient, recv.URL, "secret")
+	e := data.ProductEvent{ID: 1, Type: data.ProductCreated, ProductID: 3}
+
+	assert.NoError(t, hp.Publish(context.Background(), e))
+	assert.True(t, signed)
+
+	status = http.StatusBadGateway
+	assert.EqualError(t, hp.Publish(context.Background(), e), "Webhook returned status 502")
+}
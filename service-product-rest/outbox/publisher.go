@@ -0,0 +1,136 @@
+package outbox
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/CharlesSchiavinato/go-microservices/service-product-rest/data"
+	"github.com/CharlesSchiavinato/go-microservices/service-product-rest/webhook"
+	"github.com/hashicorp/go-hclog"
+)
+
+// Publisher delivers the product events out of the service. The events can be
+// published more than once, consumers deduplicate them by the event id
+type Publisher interface {
+	Publish(ctx context.Context, e data.ProductEvent) error
+}
+
+// LogPublisher writes the events to the log
+type LogPublisher struct {
+	l hclog.Logger
+}
+
+// NewLogPublisher creates a publisher writing the events to the given logger
+func NewLogPublisher(l hclog.Logger) *LogPublisher {
+	return &LogPublisher{l}
+}
+
+// Publish logs the event
+func (p *LogPublisher) Publish(ctx context.Context, e data.ProductEvent) error {
+	p.l.Info("Product event", "id", e.ID, "type", e.Type, "product_id", e.ProductID, "version", e.Version)
+
+	return nil
+}
+
+// FilePublisher appends the events to a file as newline delimited JSON
+type FilePublisher struct {
+	mu sync.Mutex
+	f  *os.File
+}
+
+// NewFilePublisher opens the file, creating it when it does not exist
+func NewFilePublisher(path string) (*FilePublisher, error) {
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &FilePublisher{f: f}, nil
+}
+
+// Publish appends the event to the file and syncs it to the disk
+func (p *FilePublisher) Publish(ctx context.Context, e data.ProductEvent) error {
+	b, err := json.Marshal(e)
+
+	if err != nil {
+		return err
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	_, err = p.f.Write(append(b, '\n'))
+
+	if err != nil {
+		return err
+	}
+
+	return p.f.Sync()
+}
+
+// Close closes the file
+func (p *FilePublisher) Close() error {
+	return p.f.Close()
+}
+
+// HTTPPublisher posts the events to a webhook URL. When a secret is given the
+// requests are signed like the webhook subscriptions deliveries
+type HTTPPublisher struct {
+	client *http.Client
+	url    string
+	secret string
+}
+
+// NewHTTPPublisher creates a publisher posting the events to the given URL
+func NewHTTPPublisher(c *http.Client, url, secret string) *HTTPPublisher {
+	return &HTTPPublisher{c, url, secret}
+}
+
+// Publish posts the event, any status other than 2xx is an error
+func (p *HTTPPublisher) Publish(ctx context.Context, e data.ProductEvent) error {
+	body, err := json.Marshal(e)
+
+	if err != nil {
+		return err
+	}
+
+	r, err := http.NewRequestWithContext(ctx, http.MethodPost, p.url, bytes.NewReader(body))
+
+	if err != nil {
+		return err
+	}
+
+	r.Header.Set("Content-Type", "application/json")
+	r.Header.Set(webhook.EventHeader, string(e.Type))
+	r.Header.Set(webhook.DeliveryHeader, strconv.FormatUint(e.ID, 10))
+
+	if p.secret != "" {
+		ts := time.Now().Unix()
+		r.Header.Set(webhook.TimestampHeader, strconv.FormatInt(ts, 10))
+		r.Header.Set(webhook.SignatureHeader, webhook.Sign(p.secret, ts, body))
+	}
+
+	resp, err := p.client.Do(r)
+
+	if err != nil {
+		return err
+	}
+
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64*1024))
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("Webhook returned status %d", resp.StatusCode)
+	}
+
+	return nil
+}
@@ -0,0 +1,276 @@
+package search
+
+import (
+	"math"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// BM25 parameters, k1 saturates the term frequency and b normalizes by the field length
+const (
+	bm25K1 = 1.2
+	bm25B  = 0.75
+)
+
+// MaxPrefixTerms limits the number of indexed words a prefix is expanded to
+const MaxPrefixTerms = 50
+
+// prefixWeight lowers the score of the words matched by a prefix, so the exact matches rank first
+const prefixWeight = 0.8
+
+// Keys of the terms in the postings, a word is indexed by its English stem,
+// its Portuguese stem and as it is, for the prefix matching
+const (
+	englishKey    = "e:"
+	portugueseKey = "p:"
+	wordKey       = "w:"
+)
+
+// Hit is a document matching a query
+type Hit struct {
+	ID    int
+	Score float64
+}
+
+// Index is an inverted index of documents made of weighted fields, it is safe for concurrent use
+type Index struct {
+	mu       sync.RWMutex
+	boosts   []float64
+	docs     map[int]*document
+	postings map[string]map[int][]int
+	lengths  []int
+	words    []string
+}
+
+// document keeps the terms of an indexed document to remove it, and the length of each field
+type document struct {
+	terms   []string
+	lengths []int
+}
+
+// NewIndex creates an index of documents with a field for each boost,
+// the score of a match in a field is multiplied by its boost
+func NewIndex(boosts ...float64) *Index {
+	return &Index{
+		boosts:   boosts,
+		docs:     map[int]*document{},
+		postings: map[string]map[int][]int{},
+		lengths:  make([]int, len(boosts)),
+	}
+}
+
+// Len returns the number of indexed documents
+func (ix *Index) Len() int {
+	ix.mu.RLock()
+	defer ix.mu.RUnlock()
+
+	return len(ix.docs)
+}
+
+// Add indexes the fields of the document, replacing the document with the same id
+func (ix *Index) Add(id int, fields ...string) {
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+
+	ix.remove(id)
+
+	d := &document{lengths: make([]int, len(ix.boosts))}
+
+	for f, text := range fields {
+		if f >= len(ix.boosts) {
+			break
+		}
+
+		for _, t := range Tokenize(text) {
+			if stopWords[t.Text] {
+				continue
+			}
+
+			d.lengths[f]++
+
+			for _, key := range []string{englishKey + StemEnglish(t.Text), portugueseKey + StemPortuguese(t.Text), wordKey + t.Text} {
+				p, ok := ix.postings[key]
+
+				if !ok {
+					p = map[int][]int{}
+					ix.postings[key] = p
+
+					if strings.HasPrefix(key, wordKey) {
+						ix.insertWord(t.Text)
+					}
+				}
+
+				if _, ok := p[id]; !ok {
+					p[id] = make([]int, len(ix.boosts))
+					d.terms = append(d.terms, key)
+				}
+
+				p[id][f]++
+			}
+		}
+
+		ix.lengths[f] += d.lengths[f]
+	}
+
+	ix.docs[id] = d
+}
+
+// Remove removes the document from the index
+func (ix *Index) Remove(id int) {
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+
+	ix.remove(id)
+}
+
+// remove removes the document, it must be called holding the lock
+func (ix *Index) remove(id int) {
+	d, ok := ix.docs[id]
+
+	if !ok {
+		return
+	}
+
+	for _, key := range d.terms {
+		p := ix.postings[key]
+		delete(p, id)
+
+		if len(p) == 0 {
+			delete(ix.postings, key)
+
+			if strings.HasPrefix(key, wordKey) {
+				ix.deleteWord(strings.TrimPrefix(key, wordKey))
+			}
+		}
+	}
+
+	for f, n := range d.lengths {
+		ix.lengths[f] -= n
+	}
+
+	delete(ix.docs, id)
+}
+
+// insertWord adds the word to the sorted words used by the prefix matching
+func (ix *Index) insertWord(w string) {
+	i := sort.SearchStrings(ix.words, w)
+
+	ix.words = append(ix.words, "")
+	copy(ix.words[i+1:], ix.words[i:])
+	ix.words[i] = w
+}
+
+// deleteWord removes the word from the sorted words
+func (ix *Index) deleteWord(w string) {
+	i := sort.SearchStrings(ix.words, w)
+
+	if i < len(ix.words) && ix.words[i] == w {
+		ix.words = append(ix.words[:i], ix.words[i+1:]...)
+	}
+}
+
+// Search returns the documents matching all the terms of the query, from the most relevant
+func (ix *Index) Search(q *Query) []Hit {
+	ix.mu.RLock()
+	defer ix.mu.RUnlock()
+
+	if q.Empty() {
+		return []Hit{}
+	}
+
+	var scores map[int]float64
+
+	for i, t := range q.terms {
+		ts := map[int]float64{}
+
+		for key, weight := range ix.expand(t, q.prefix && i == len(q.terms)-1) {
+			for id, tf := range ix.postings[key] {
+				if s := ix.score(key, id, tf) * weight; s > ts[id] {
+					ts[id] = s
+				}
+			}
+		}
+
+		if scores == nil {
+			scores = ts
+			continue
+		}
+
+		for id := range scores {
+			s, ok := ts[id]
+
+			if !ok {
+				delete(scores, id)
+				continue
+			}
+
+			scores[id] += s
+		}
+	}
+
+	hits := make([]Hit, 0, len(scores))
+	for id, s := range scores {
+		hits = append(hits, Hit{ID: id, Score: s})
+	}
+
+	sort.Slice(hits, func(i, j int) bool {
+		if hits[i].Score != hits[j].Score {
+			return hits[i].Score > hits[j].Score
+		}
+
+		return hits[i].ID < hits[j].ID
+	})
+
+	return hits
+}
+
+// expand returns the keys of the terms matching a term of the query with their weight,
+// the indexed words starting with the term when it is matched as a prefix
+func (ix *Index) expand(t queryTerm, prefix bool) map[string]float64 {
+	keys := map[string]float64{
+		englishKey + t.english:       1,
+		portugueseKey + t.portuguese: 1,
+	}
+
+	if !prefix {
+		return keys
+	}
+
+	start := sort.SearchStrings(ix.words, t.word)
+
+	for i := start; i < len(ix.words) && i < start+MaxPrefixTerms; i++ {
+		w := ix.words[i]
+
+		if !strings.HasPrefix(w, t.word) {
+			break
+		}
+
+		if w != t.word {
+			keys[wordKey+w] = prefixWeight
+		}
+	}
+
+	return keys
+}
+
+// score returns the BM25 score of the term in the document, summed over the weighted fields
+func (ix *Index) score(key string, id int, tf []int) float64 {
+	n := float64(len(ix.docs))
+	df := float64(len(ix.postings[key]))
+	idf := math.Log(1 + (n-df+0.5)/(df+0.5))
+
+	s := 0.0
+
+	for f, c := range tf {
+		if c == 0 {
+			continue
+		}
+
+		avg := float64(ix.lengths[f]) / n
+		norm := 1 - bm25B + bm25B*float64(ix.docs[id].lengths[f])/avg
+		s += ix.boosts[f] * idf * float64(c) * (bm25K1 + 1) / (float64(c) + bm25K1*norm)
+	}
+
+	return s
+}
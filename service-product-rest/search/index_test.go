@@ -0,0 +1,84 @@
+package search
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestIndex() *Index {
+	ix := NewIndex(2, 1)
+	ix.Add(1, "Latte", "Frothy milky coffee")
+	ix.Add(2, "Expresso", "Short and strong coffee without milk")
+	ix.Add(3, "Café com leite", "Café coado com leite quente")
+	ix.Add(4, "Chocolate quente", "Bebida cremosa de chocolate")
+
+	return ix
+}
+
+func hitIDs(hits []Hit) []int {
+	ids := []int{}
+	for _, h := range hits {
+		ids = append(ids, h.ID)
+	}
+
+	return ids
+}
+
+func TestIndexSearchStemsAndRanks(t *testing.T) {
+	ix := newTestIndex()
+
+	// coffees and coffee have the same English stem, the shorter description ranks first
+	assert.Equal(t, []int{1, 2}, hitIDs(ix.Search(ParseQuery("coffees "))))
+	assert.Equal(t, []int{2}, hitIDs(ix.Search(ParseQuery("milk "))))
+
+	// the accents are folded and the Portuguese plurals stemmed
+	assert.Equal(t, []int{3}, hitIDs(ix.Search(ParseQuery("cafés com leites "))))
+
+	// all the terms must match, the name weighs more than the description
+	assert.Equal(t, []int{4, 3}, hitIDs(ix.Search(ParseQuery("quente"))))
+	assert.Empty(t, ix.Search(ParseQuery("chocolate milk ")))
+	assert.True(t, ParseQuery("the of ").Empty())
+}
+
+func TestIndexSearchPrefix(t *testing.T) {
+	ix := newTestIndex()
+
+	assert.Equal(t, []int{4}, hitIDs(ix.Search(ParseQuery("choc"))))
+	assert.Equal(t, []int{2}, hitIDs(ix.Search(ParseQuery("coffee stro"))))
+
+	// the last word is not a prefix once it is complete
+	assert.Empty(t, ix.Search(ParseQuery("choc ")))
+
+	// a stop word being typed is matched as a prefix
+	assert.Equal(t, []int{1}, hitIDs(ix.Search(ParseQuery("froth"))))
+}
+
+func TestIndexAddReplacesAndRemove(t *testing.T) {
+	ix := newTestIndex()
+
+	ix.Add(1, "Flat white", "Velvety milk")
+	assert.Empty(t, ix.Search(ParseQuery("latte ")))
+	assert.Equal(t, []int{1}, hitIDs(ix.Search(ParseQuery("velvet"))))
+
+	ix.Remove(1)
+	assert.Equal(t, 3, ix.Len())
+	assert.Empty(t, ix.Search(ParseQuery("velv")))
+}
+
+func TestHighlight(t *testing.T) {
+	q := ParseQuery("milk cof")
+
+	h, ok := Highlight("Frothy milk <coffee>", q, 0)
+
+	assert.True(t, ok)
+	assert.Equal(t, "Frothy <em>milk</em> &lt;<em>coffee</em>&gt;", h)
+
+	h, ok = Highlight("A long text with many words before the milk and many words after it", q, 6)
+
+	assert.True(t, ok)
+	assert.Equal(t, "…the <em>milk</em> and many words after…", h)
+
+	_, ok = Highlight("Short and strong", q, 0)
+	assert.False(t, ok)
+}
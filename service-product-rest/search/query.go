@@ -0,0 +1,146 @@
+package search
+
+import (
+	"html"
+	"strings"
+)
+
+// Query is a parsed search, a document matches when it matches all the terms
+type Query struct {
+	terms  []queryTerm
+	prefix bool
+}
+
+// queryTerm is a word of the query with its stems
+type queryTerm struct {
+	word       string
+	english    string
+	portuguese string
+}
+
+// ParseQuery splits the search text in terms without the stop words. When the text
+// does not end with a space or a punctuation, its last word is matched as a prefix
+func ParseQuery(text string) *Query {
+	q := &Query{prefix: endsWord(text)}
+
+	tokens := Tokenize(text)
+
+	for i, t := range tokens {
+		// the last word can be the start of a longer word
+		if stopWords[t.Text] && !(q.prefix && i == len(tokens)-1) {
+			continue
+		}
+
+		q.terms = append(q.terms, queryTerm{word: t.Text, english: StemEnglish(t.Text), portuguese: StemPortuguese(t.Text)})
+	}
+
+	if len(q.terms) == 0 || q.terms[len(q.terms)-1].word != tokens[len(tokens)-1].Text {
+		q.prefix = false
+	}
+
+	return q
+}
+
+// Empty returns true when the query has no term to search
+func (q *Query) Empty() bool {
+	return len(q.terms) == 0
+}
+
+// matches returns true when the folded word matches a term of the query
+func (q *Query) matches(w string) bool {
+	if stopWords[w] {
+		return false
+	}
+
+	en, pt := StemEnglish(w), StemPortuguese(w)
+
+	for i, t := range q.terms {
+		if en == t.english || pt == t.portuguese {
+			return true
+		}
+
+		if q.prefix && i == len(q.terms)-1 && strings.HasPrefix(w, t.word) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Highlight returns the text HTML escaped with the words matching the query in <em> tags.
+// When maxWords is greater than zero and the text is longer, only the snippet of maxWords
+// words around the first match is returned, with an ellipsis for the text left out.
+// It returns false when no word of the text matches
+func Highlight(text string, q *Query, maxWords int) (string, bool) {
+	tokens := Tokenize(text)
+
+	first := -1
+	matched := make([]bool, len(tokens))
+
+	for i, t := range tokens {
+		if q.matches(t.Text) {
+			matched[i] = true
+
+			if first < 0 {
+				first = i
+			}
+		}
+	}
+
+	if first < 0 {
+		return "", false
+	}
+
+	from, to := 0, len(tokens)
+
+	if maxWords > 0 && len(tokens) > maxWords {
+		// keep a few words of context before the first match
+		from = first - maxWords/4
+
+		if from < 0 {
+			from = 0
+		}
+
+		if from+maxWords > len(tokens) {
+			from = len(tokens) - maxWords
+		}
+
+		to = from + maxWords
+	}
+
+	var sb strings.Builder
+
+	start, end := 0, len(text)
+
+	if from > 0 {
+		start = tokens[from].Start
+		sb.WriteString("…")
+	}
+
+	if to < len(tokens) {
+		end = tokens[to-1].End
+	}
+
+	pos := start
+
+	for i := from; i < to; i++ {
+		if !matched[i] {
+			continue
+		}
+
+		t := tokens[i]
+		sb.WriteString(html.EscapeString(text[pos:t.Start]))
+		sb.WriteString("<em>")
+		sb.WriteString(html.EscapeString(text[t.Start:t.End]))
+		sb.WriteString("</em>")
+		pos = t.End
+	}
+
+	sb.WriteString(html.EscapeString(text[pos:end]))
+
+	if to < len(tokens) {
+		sb.WriteString("…")
+	}
+
+	return sb.String(), true
+}
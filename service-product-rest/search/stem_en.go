@@ -0,0 +1,310 @@
+package search
+
+// StemEnglish returns the stem of a folded English word with the Porter algorithm,
+// like "relational" to "relat". Words with other letters than a to z are returned as they are
+//
+// https://tartarus.org/martin/PorterStemmer/def.txt
+func StemEnglish(w string) string {
+	if len(w) <= 2 || !isAlpha(w) {
+		return w
+	}
+
+	z := &porter{b: []byte(w), k: len(w) - 1}
+
+	z.step1ab()
+
+	if z.k > 0 {
+		z.step1c()
+		z.step2()
+		z.step3()
+		z.step4()
+		z.step5()
+	}
+
+	return string(z.b[:z.k+1])
+}
+
+// porter is the state of the stemming of a word, the word is b[0..k] and
+// j is the end of the stem when a suffix was matched
+type porter struct {
+	b []byte
+	k int
+	j int
+}
+
+// cons returns true when b[i] is a consonant
+func (z *porter) cons(i int) bool {
+	switch z.b[i] {
+	case 'a', 'e', 'i', 'o', 'u':
+		return false
+	case 'y':
+		return i == 0 || !z.cons(i-1)
+	}
+
+	return true
+}
+
+// m measures the number of consonant sequences in b[0..j]
+func (z *porter) m() int {
+	n, i := 0, 0
+
+	for ; ; i++ {
+		if i > z.j {
+			return n
+		}
+
+		if !z.cons(i) {
+			break
+		}
+	}
+
+	for i++; ; i++ {
+		for ; ; i++ {
+			if i > z.j {
+				return n
+			}
+
+			if z.cons(i) {
+				break
+			}
+		}
+
+		n++
+
+		for i++; ; i++ {
+			if i > z.j {
+				return n
+			}
+
+			if !z.cons(i) {
+				break
+			}
+		}
+	}
+}
+
+// vowelInStem returns true when b[0..j] has a vowel
+func (z *porter) vowelInStem() bool {
+	for i := 0; i <= z.j; i++ {
+		if !z.cons(i) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// doublec returns true when b[i-1..i] is a double consonant
+func (z *porter) doublec(i int) bool {
+	return i >= 1 && z.b[i] == z.b[i-1] && z.cons(i)
+}
+
+// cvc returns true when b[i-2..i] is consonant, vowel, consonant and the
+// last consonant is not w, x or y, like in hop but not in snow
+func (z *porter) cvc(i int) bool {
+	if i < 2 || !z.cons(i) || z.cons(i-1) || !z.cons(i-2) {
+		return false
+	}
+
+	switch z.b[i] {
+	case 'w', 'x', 'y':
+		return false
+	}
+
+	return true
+}
+
+// ends returns true when b[0..k] ends with s, setting j to the end of the stem
+func (z *porter) ends(s string) bool {
+	l := len(s)
+
+	if l > z.k+1 || string(z.b[z.k-l+1:z.k+1]) != s {
+		return false
+	}
+
+	z.j = z.k - l
+
+	return true
+}
+
+// setto replaces b[j+1..k] with s
+func (z *porter) setto(s string) {
+	z.b = append(z.b[:z.j+1], s...)
+	z.k = z.j + len(s)
+}
+
+// r replaces the suffix with s when the stem has a consonant sequence
+func (z *porter) r(s string) {
+	if z.m() > 0 {
+		z.setto(s)
+	}
+}
+
+// replace replaces the first matching suffix of the pairs, the
+// suffixes after the first matching one are not tried
+func (z *porter) replace(pairs ...string) {
+	for i := 0; i < len(pairs); i += 2 {
+		if z.ends(pairs[i]) {
+			z.r(pairs[i+1])
+			return
+		}
+	}
+}
+
+// step1ab removes the plurals and -ed or -ing
+func (z *porter) step1ab() {
+	if z.b[z.k] == 's' {
+		switch {
+		case z.ends("sses"):
+			z.k -= 2
+		case z.ends("ies"):
+			z.setto("i")
+		case z.b[z.k-1] != 's':
+			z.k--
+		}
+	}
+
+	if z.ends("eed") {
+		if z.m() > 0 {
+			z.k--
+		}
+
+		return
+	}
+
+	if (z.ends("ed") || z.ends("ing")) && z.vowelInStem() {
+		z.k = z.j
+
+		switch {
+		case z.ends("at"):
+			z.setto("ate")
+		case z.ends("bl"):
+			z.setto("ble")
+		case z.ends("iz"):
+			z.setto("ize")
+		case z.doublec(z.k):
+			switch z.b[z.k] {
+			case 'l', 's', 'z':
+			default:
+				z.k--
+			}
+		default:
+			z.j = z.k
+
+			if z.m() == 1 && z.cvc(z.k) {
+				z.setto("e")
+			}
+		}
+	}
+}
+
+// step1c turns a terminal y to i when there is another vowel in the stem
+func (z *porter) step1c() {
+	if z.ends("y") && z.vowelInStem() {
+		z.b[z.k] = 'i'
+	}
+}
+
+// step2 maps the double suffixes to single ones, like -ization to -ize
+func (z *porter) step2() {
+	switch z.b[z.k-1] {
+	case 'a':
+		z.replace("ational", "ate", "tional", "tion")
+	case 'c':
+		z.replace("enci", "ence", "anci", "ance")
+	case 'e':
+		z.replace("izer", "ize")
+	case 'l':
+		z.replace("bli", "ble", "alli", "al", "entli", "ent", "eli", "e", "ousli", "ous")
+	case 'o':
+		z.replace("ization", "ize", "ation", "ate", "ator", "ate")
+	case 's':
+		z.replace("alism", "al", "iveness", "ive", "fulness", "ful", "ousness", "ous")
+	case 't':
+		z.replace("aliti", "al", "iviti", "ive", "biliti", "ble")
+	case 'g':
+		z.replace("logi", "log")
+	}
+}
+
+// step3 handles -ic-, -full, -ness and the like
+func (z *porter) step3() {
+	switch z.b[z.k] {
+	case 'e':
+		z.replace("icate", "ic", "ative", "", "alize", "al")
+	case 'i':
+		z.replace("iciti", "ic")
+	case 'l':
+		z.replace("ical", "ic", "ful", "")
+	case 's':
+		z.replace("ness", "")
+	}
+}
+
+// step4 removes -ant, -ence and the like when the stem has two consonant sequences
+func (z *porter) step4() {
+	var suffixes []string
+
+	switch z.b[z.k-1] {
+	case 'a':
+		suffixes = []string{"al"}
+	case 'c':
+		suffixes = []string{"ance", "ence"}
+	case 'e':
+		suffixes = []string{"er"}
+	case 'i':
+		suffixes = []string{"ic"}
+	case 'l':
+		suffixes = []string{"able", "ible"}
+	case 'n':
+		suffixes = []string{"ant", "ement", "ment", "ent"}
+	case 'o':
+		if z.ends("ion") && z.j >= 0 && (z.b[z.j] == 's' || z.b[z.j] == 't') {
+			break
+		}
+
+		suffixes = []string{"ou"}
+	case 's':
+		suffixes = []string{"ism"}
+	case 't':
+		suffixes = []string{"ate", "iti"}
+	case 'u':
+		suffixes = []string{"ous"}
+	case 'v':
+		suffixes = []string{"ive"}
+	case 'z':
+		suffixes = []string{"ize"}
+	default:
+		return
+	}
+
+	matched := suffixes == nil
+
+	for _, s := range suffixes {
+		if z.ends(s) {
+			matched = true
+			break
+		}
+	}
+
+	if matched && z.m() > 1 {
+		z.k = z.j
+	}
+}
+
+// step5 removes a final -e and turns -ll to -l when the stem has two consonant sequences
+func (z *porter) step5() {
+	z.j = z.k
+
+	if z.b[z.k] == 'e' {
+		a := z.m()
+
+		if a > 1 || a == 1 && !z.cvc(z.k-1) {
+			z.k--
+		}
+	}
+
+	if z.b[z.k] == 'l' && z.doublec(z.k) && z.m() > 1 {
+		z.k--
+	}
+}
@@ -0,0 +1,256 @@
+package search
+
+import (
+	"strings"
+)
+
+// StemPortuguese returns the stem of a folded Portuguese word with the Snowball
+// algorithm, like "cafezinhos" to "cafezinh". The suffixes are matched without
+// their diacritics since the words are folded before being stemmed. Words with
+// other letters than a to z are returned as they are
+//
+// https://snowballstem.org/algorithms/portuguese/stemmer.html
+func StemPortuguese(w string) string {
+	if len(w) <= 2 || !isAlpha(w) {
+		return w
+	}
+
+	z := &ptStemmer{w: w}
+	z.markRegions()
+
+	if z.standardSuffix() || z.verbSuffix() {
+		if strings.HasSuffix(z.w, "ci") && len(z.w)-1 >= z.rv {
+			z.w = z.w[:len(z.w)-1]
+		}
+	} else {
+		z.residualSuffix()
+	}
+
+	z.residualForm()
+
+	return z.w
+}
+
+// ptStemmer is the state of the stemming of a Portuguese word, rv, r1 and r2 are the
+// start of the regions of the word where the suffixes can be removed
+type ptStemmer struct {
+	w  string
+	rv int
+	r1 int
+	r2 int
+}
+
+// ptStandardSuffixes are the noun and adjective suffixes, deleted when they are in R2
+var ptStandardSuffixes = []string{
+	"eza", "ezas", "ico", "ica", "icos", "icas", "ismo", "ismos", "avel", "ivel", "ista", "istas",
+	"oso", "osa", "osos", "osas", "amento", "amentos", "imento", "imentos", "adora", "ador", "acao",
+	"adoras", "adores", "acoes", "ante", "antes", "ancia",
+}
+
+// ptStep1Suffixes are all the suffixes of the first step, the longest matching one is handled
+var ptStep1Suffixes = append([]string{
+	"logia", "logias", "ucao", "ucoes", "encia", "encias", "amente", "mente", "idade", "idades",
+	"iva", "ivo", "ivas", "ivos", "ira", "iras",
+}, ptStandardSuffixes...)
+
+// ptVerbSuffixes are the verb suffixes, deleted when they are in RV
+var ptVerbSuffixes = []string{
+	"ada", "ida", "ia", "aria", "eria", "iria", "ara", "era", "ira", "ava", "asse", "esse", "isse",
+	"aste", "este", "iste", "ei", "arei", "erei", "irei", "am", "iam", "ariam", "eriam", "iriam",
+	"aram", "eram", "iram", "avam", "em", "arem", "erem", "irem", "assem", "essem", "issem", "ado",
+	"ido", "ando", "endo", "indo", "arao", "erao", "irao", "ar", "er", "ir", "as", "adas", "idas",
+	"ias", "arias", "erias", "irias", "aras", "eras", "iras", "avas", "es", "ardes", "erdes", "irdes",
+	"ares", "eres", "ires", "asses", "esses", "isses", "astes", "estes", "istes", "is", "ais", "eis",
+	"ariais", "eriais", "iriais", "arieis", "erieis", "irieis", "areis", "ereis", "ireis", "asseis",
+	"esseis", "isseis", "aveis", "ieis", "ados", "idos", "amos", "iamos", "ariamos", "eriamos",
+	"iriamos", "aramos", "eramos", "iramos", "avamos", "emos", "aremos", "eremos", "iremos",
+	"assemos", "essemos", "issemos", "imos", "armos", "ermos", "irmos", "eu", "iu", "ou",
+}
+
+func isVowel(c byte) bool {
+	switch c {
+	case 'a', 'e', 'i', 'o', 'u':
+		return true
+	}
+
+	return false
+}
+
+// markRegions sets the start of the RV, R1 and R2 regions
+func (z *ptStemmer) markRegions() {
+	w := z.w
+	n := len(w)
+
+	// gopast returns the index after the first letter from i which is (or is not) a vowel
+	gopast := func(i int, vowel bool) int {
+		for ; i < n; i++ {
+			if isVowel(w[i]) == vowel {
+				return i + 1
+			}
+		}
+
+		return n
+	}
+
+	// RV is after the next vowel when the second letter is a consonant, after the next
+	// consonant when the first two letters are vowels, otherwise after the third letter
+	z.rv = n
+
+	switch {
+	case isVowel(w[0]) && !isVowel(w[1]):
+		z.rv = gopast(2, true)
+	case isVowel(w[0]):
+		z.rv = gopast(2, false)
+	case !isVowel(w[1]):
+		z.rv = gopast(2, true)
+	default:
+		z.rv = 3
+	}
+
+	// R1 is after the first consonant following a vowel, R2 is the R1 of R1
+	z.r1 = gopast(gopast(0, true), false)
+	z.r2 = gopast(gopast(z.r1, true), false)
+}
+
+// longest returns the longest suffix of the word among the suffixes which starts
+// at or after from, an empty string when there is none
+func (z *ptStemmer) longest(suffixes []string, from int) string {
+	s := ""
+
+	for _, suf := range suffixes {
+		if len(suf) > len(s) && strings.HasSuffix(z.w, suf) && len(z.w)-len(suf) >= from {
+			s = suf
+		}
+	}
+
+	return s
+}
+
+// in returns true when the suffix starts at or after the start of the region
+func (z *ptStemmer) in(suffix string, region int) bool {
+	return len(z.w)-len(suffix) >= region
+}
+
+// cut removes the suffix from the word
+func (z *ptStemmer) cut(suffix string) {
+	z.w = z.w[:len(z.w)-len(suffix)]
+}
+
+// tryCut removes the longest of the suffixes which is in R2
+func (z *ptStemmer) tryCut(suffixes ...string) string {
+	s := z.longest(suffixes, 0)
+
+	if s != "" && z.in(s, z.r2) {
+		z.cut(s)
+		return s
+	}
+
+	return ""
+}
+
+// standardSuffix removes the noun and adjective suffixes, it returns true when the word changed
+func (z *ptStemmer) standardSuffix() bool {
+	s := z.longest(ptStep1Suffixes, 0)
+
+	switch s {
+	case "":
+		return false
+	case "logia", "logias":
+		if !z.in(s, z.r2) {
+			return false
+		}
+
+		z.w = z.w[:len(z.w)-len(s)] + "log"
+	case "ucao", "ucoes":
+		if !z.in(s, z.r2) {
+			return false
+		}
+
+		z.w = z.w[:len(z.w)-len(s)] + "u"
+	case "encia", "encias":
+		if !z.in(s, z.r2) {
+			return false
+		}
+
+		z.w = z.w[:len(z.w)-len(s)] + "ente"
+	case "amente":
+		if !z.in(s, z.r1) {
+			return false
+		}
+
+		z.cut(s)
+
+		if z.tryCut("iv", "os", "ic", "ad") == "iv" {
+			z.tryCut("at")
+		}
+	case "mente":
+		if !z.in(s, z.r2) {
+			return false
+		}
+
+		z.cut(s)
+		z.tryCut("ante", "avel", "ivel")
+	case "idade", "idades":
+		if !z.in(s, z.r2) {
+			return false
+		}
+
+		z.cut(s)
+		z.tryCut("abil", "ic", "iv")
+	case "iva", "ivo", "ivas", "ivos":
+		if !z.in(s, z.r2) {
+			return false
+		}
+
+		z.cut(s)
+		z.tryCut("at")
+	case "ira", "iras":
+		// eira becomes eir
+		if !z.in(s, z.rv) || !strings.HasSuffix(z.w[:len(z.w)-len(s)], "e") {
+			return false
+		}
+
+		z.w = z.w[:len(z.w)-len(s)] + "ir"
+	default:
+		if !z.in(s, z.r2) {
+			return false
+		}
+
+		z.cut(s)
+	}
+
+	return true
+}
+
+// verbSuffix removes the longest verb suffix in RV, it returns true when the word changed
+func (z *ptStemmer) verbSuffix() bool {
+	s := z.longest(ptVerbSuffixes, z.rv)
+
+	if s == "" {
+		return false
+	}
+
+	z.cut(s)
+
+	return true
+}
+
+// residualSuffix removes the final os, a, i or o in RV
+func (z *ptStemmer) residualSuffix() {
+	if s := z.longest([]string{"os", "a", "i", "o"}, z.rv); s != "" {
+		z.cut(s)
+	}
+}
+
+// residualForm removes the final e in RV, and the u of gu or the i of ci when it is in RV
+func (z *ptStemmer) residualForm() {
+	if !strings.HasSuffix(z.w, "e") || !z.in("e", z.rv) {
+		return
+	}
+
+	z.cut("e")
+
+	if (strings.HasSuffix(z.w, "gu") || strings.HasSuffix(z.w, "ci")) && len(z.w)-1 >= z.rv {
+		z.w = z.w[:len(z.w)-1]
+	}
+}
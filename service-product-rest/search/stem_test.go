@@ -0,0 +1,59 @@
+package search
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStemEnglish(t *testing.T) {
+	words := map[string]string{
+		"caresses":       "caress",
+		"ponies":         "poni",
+		"agreed":         "agre",
+		"hopping":        "hop",
+		"filing":         "file",
+		"relational":     "relat",
+		"generalization": "gener",
+		"hopefulness":    "hope",
+		"adjustment":     "adjust",
+		"coffees":        "coffe",
+		"milky":          "milki",
+		"sky":            "sky",
+		"v60":            "v60",
+	}
+
+	for w, s := range words {
+		assert.Equal(t, s, StemEnglish(w), w)
+	}
+}
+
+func TestStemPortuguese(t *testing.T) {
+	words := map[string]string{
+		"cafes":         "caf",
+		"cafe":          "caf",
+		"bebidas":       "beb",
+		"gelados":       "gel",
+		"cremosa":       "cremos",
+		"cafeteiras":    "cafeteir",
+		"rapidamente":   "rapid",
+		"nacionalidade": "nacional",
+		"organizacoes":  "organiz",
+		"correndo":      "corr",
+		"linguagem":     "linguag",
+	}
+
+	for w, s := range words {
+		assert.Equal(t, s, StemPortuguese(w), w)
+	}
+}
+
+func TestTokenize(t *testing.T) {
+	text := "Café, com LEITE!"
+	tokens := Tokenize(text)
+
+	assert.Len(t, tokens, 3)
+	assert.Equal(t, "cafe", tokens[0].Text)
+	assert.Equal(t, "Café", text[tokens[0].Start:tokens[0].End])
+	assert.Equal(t, "leite", tokens[2].Text)
+}
@@ -0,0 +1,101 @@
+// Package search is an in-process full-text index with English and Portuguese
+// stemming, prefix matching for typeahead, BM25 ranking and highlighted snippets
+package search
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Token is a word of a text, folded to lower case without diacritics
+type Token struct {
+	// Text is the folded word
+	Text string
+	// Start and End are the byte offsets of the word in the original text
+	Start int
+	End   int
+}
+
+// foldRunes maps the accented letters of English and Portuguese to their base letter
+var foldRunes = map[rune]rune{
+	'á': 'a', 'à': 'a', 'â': 'a', 'ã': 'a', 'ä': 'a',
+	'é': 'e', 'è': 'e', 'ê': 'e', 'ë': 'e',
+	'í': 'i', 'ì': 'i', 'î': 'i', 'ï': 'i',
+	'ó': 'o', 'ò': 'o', 'ô': 'o', 'õ': 'o', 'ö': 'o',
+	'ú': 'u', 'ù': 'u', 'û': 'u', 'ü': 'u',
+	'ç': 'c', 'ñ': 'n',
+}
+
+// Tokenize splits the text in words of letters and digits, the words are
+// folded so "Café" and "cafe" are the same word
+func Tokenize(text string) []Token {
+	tokens := []Token{}
+	start := -1
+	var sb strings.Builder
+
+	flush := func(end int) {
+		if start >= 0 {
+			tokens = append(tokens, Token{Text: sb.String(), Start: start, End: end})
+			start = -1
+			sb.Reset()
+		}
+	}
+
+	for i, r := range text {
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) {
+			flush(i)
+			continue
+		}
+
+		if start < 0 {
+			start = i
+		}
+
+		sb.WriteRune(fold(r))
+	}
+
+	flush(len(text))
+
+	return tokens
+}
+
+// fold returns the rune in lower case without diacritics
+func fold(r rune) rune {
+	r = unicode.ToLower(r)
+
+	if f, ok := foldRunes[r]; ok {
+		return f
+	}
+
+	return r
+}
+
+// endsWord returns true when the text ends in the middle of a word,
+// the last word of a query being typed is matched as a prefix
+func endsWord(text string) bool {
+	r, _ := utf8.DecodeLastRuneInString(text)
+
+	return unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+// stopWords are the frequent English and Portuguese words which are not indexed
+var stopWords = map[string]bool{
+	"a": true, "an": true, "and": true, "are": true, "as": true, "at": true, "be": true, "by": true,
+	"for": true, "from": true, "in": true, "is": true, "it": true, "of": true, "on": true, "or": true,
+	"the": true, "to": true, "with": true, "without": true,
+	"ao": true, "com": true, "da": true, "das": true, "de": true, "do": true, "dos": true, "e": true,
+	"em": true, "na": true, "nas": true, "no": true, "nos": true, "o": true, "os": true, "ou": true,
+	"para": true, "por": true, "sem": true, "um": true, "uma": true,
+}
+
+// isAlpha returns true when the word only has the letters a to z
+func isAlpha(w string) bool {
+	for i := 0; i < len(w); i++ {
+		if w[i] < 'a' || w[i] > 'z' {
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,84 @@
+package webhook
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"syscall"
+	"time"
+)
+
+var ErrPrivateDestination = fmt.Errorf("Webhook URL must not reach a loopback, link-local or private address")
+var ErrUnresolvableDestination = fmt.Errorf("Webhook URL host can not be resolved")
+
+// lookupIP resolves the hosts of the webhook URLs
+var lookupIP = net.LookupIP
+
+// privateIP returns true when the address is not reachable from the internet: the loopback,
+// link-local, private and unspecified addresses
+func privateIP(ip net.IP) bool {
+	return ip.IsLoopback() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+		ip.IsInterfaceLocalMulticast() || ip.IsPrivate() || ip.IsUnspecified()
+}
+
+// checkDestination returns ErrPrivateDestination when the host of the URL is or resolves
+// to a private address, the URL must be valid
+func checkDestination(rawURL string) error {
+	u, err := url.Parse(rawURL)
+
+	if err != nil {
+		return err
+	}
+
+	ips := []net.IP{net.ParseIP(u.Hostname())}
+
+	if ips[0] == nil {
+		ips, err = lookupIP(u.Hostname())
+
+		if err != nil || len(ips) == 0 {
+			return ErrUnresolvableDestination
+		}
+	}
+
+	for _, ip := range ips {
+		if privateIP(ip) {
+			return ErrPrivateDestination
+		}
+	}
+
+	return nil
+}
+
+// dialControl rejects the connections to the private addresses, so a host resolving
+// to a private address after its subscription is not reached
+func dialControl(network, address string, c syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+
+	if err != nil {
+		return err
+	}
+
+	if ip := net.ParseIP(host); ip == nil || privateIP(ip) {
+		return ErrPrivateDestination
+	}
+
+	return nil
+}
+
+// NewClient returns the HTTP client of the deliveries with the given timeout, it only
+// connects to the public addresses unless allowPrivate is true
+func NewClient(timeout time.Duration, allowPrivate bool) *http.Client {
+	if allowPrivate {
+		return &http.Client{Timeout: timeout}
+	}
+
+	d := &net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second, Control: dialControl}
+
+	// the deliveries connect to the receivers directly, a proxy would be the address checked
+	t := http.DefaultTransport.(*http.Transport).Clone()
+	t.Proxy = nil
+	t.DialContext = d.DialContext
+
+	return &http.Client{Timeout: timeout, Transport: t}
+}
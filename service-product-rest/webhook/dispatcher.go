@@ -0,0 +1,400 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/CharlesSchiavinato/go-microservices/service-product-rest/data"
+	"github.com/hashicorp/go-hclog"
+)
+
+const (
+	// queueSize is the number of events waiting for delivery per subscription,
+	// the events beyond it go straight to the dead-letter list
+	queueSize = 256
+	// deliveryLogSize is the number of delivery attempts kept per subscription
+	deliveryLogSize = 100
+	// deadLetterSize is the number of dead letters kept per subscription
+	deadLetterSize = 1000
+)
+
+// subscriber is a registered subscription with its delivery queue and logs
+type subscriber struct {
+	Subscription
+	queue       chan data.ProductEvent
+	cancel      context.CancelFunc
+	deliveries  []Delivery
+	deadLetters []DeadLetter
+}
+
+// Dispatcher keeps the webhook subscriptions and delivers the product events
+// to them asynchronously. Each subscription has its own queue, so a slow
+// receiver does not delay the others, and the events are delivered in order.
+// Failed deliveries are retried with exponential backoff and the events are
+// moved to the dead-letter list after the last attempt
+type Dispatcher struct {
+	l           hclog.Logger
+	client      *http.Client
+	maxAttempts int
+	minBackoff  time.Duration
+	maxBackoff  time.Duration
+	// allowPrivate accepts the subscriptions to loopback, link-local and private addresses
+	allowPrivate bool
+
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	mu          sync.Mutex
+	nextID      int
+	subscribers map[int]*subscriber
+}
+
+// NewDispatcher creates a dispatcher making up to maxAttempts deliveries per event,
+// waiting from minBackoff up to maxBackoff between them. The subscriptions to loopback,
+// link-local and private addresses are rejected unless allowPrivate is true
+func NewDispatcher(l hclog.Logger, c *http.Client, maxAttempts int, minBackoff, maxBackoff time.Duration, allowPrivate bool) *Dispatcher {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	return &Dispatcher{
+		l:            l,
+		client:       c,
+		maxAttempts:  maxAttempts,
+		minBackoff:   minBackoff,
+		maxBackoff:   maxBackoff,
+		allowPrivate: allowPrivate,
+		ctx:          ctx,
+		cancel:       cancel,
+		subscribers:  map[int]*subscriber{},
+	}
+}
+
+// Register validates and adds the subscription, generating the secret when it is empty.
+// The returned subscription is the only one including the secret. It returns
+// ErrPrivateDestination when the URL reaches a private address and they are not allowed
+func (d *Dispatcher) Register(s Subscription) (*Subscription, error) {
+	err := s.Validate()
+
+	if err != nil {
+		return nil, err
+	}
+
+	if !d.allowPrivate {
+		if err := checkDestination(s.URL); err != nil {
+			return nil, err
+		}
+	}
+
+	if s.Secret == "" {
+		s.Secret, err = newSecret()
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.nextID++
+	s.ID = d.nextID
+	s.CreatedOn = time.Now().UTC()
+
+	ctx, cancel := context.WithCancel(d.ctx)
+	sub := &subscriber{
+		Subscription: s,
+		queue:        make(chan data.ProductEvent, queueSize),
+		cancel:       cancel,
+	}
+
+	d.subscribers[s.ID] = sub
+	go d.deliver(ctx, sub)
+
+	return &s, nil
+}
+
+// Unregister removes the subscription, the pending deliveries are dropped
+func (d *Dispatcher) Unregister(id int) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	sub, ok := d.subscribers[id]
+
+	if !ok {
+		return ErrSubscriptionNotFound
+	}
+
+	sub.cancel()
+	delete(d.subscribers, id)
+
+	return nil
+}
+
+// Subscriptions returns the subscriptions ordered by id, without their secrets
+func (d *Dispatcher) Subscriptions() []*Subscription {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	sl := []*Subscription{}
+	for _, sub := range d.subscribers {
+		s := sub.Subscription
+		s.Secret = ""
+		sl = append(sl, &s)
+	}
+
+	sort.Slice(sl, func(i, j int) bool { return sl[i].ID < sl[j].ID })
+
+	return sl
+}
+
+// Subscription returns the subscription with the given id, without its secret
+func (d *Dispatcher) Subscription(id int) (*Subscription, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	sub, ok := d.subscribers[id]
+
+	if !ok {
+		return nil, ErrSubscriptionNotFound
+	}
+
+	s := sub.Subscription
+	s.Secret = ""
+
+	return &s, nil
+}
+
+// Deliveries returns the latest delivery attempts of the subscription, the newest first
+func (d *Dispatcher) Deliveries(id int) ([]Delivery, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	sub, ok := d.subscribers[id]
+
+	if !ok {
+		return nil, ErrSubscriptionNotFound
+	}
+
+	dl := make([]Delivery, 0, len(sub.deliveries))
+	for i := len(sub.deliveries) - 1; i >= 0; i-- {
+		dl = append(dl, sub.deliveries[i])
+	}
+
+	return dl, nil
+}
+
+// DeadLetters returns the events which could not be delivered to the subscription, the oldest first
+func (d *Dispatcher) DeadLetters(id int) ([]DeadLetter, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	sub, ok := d.subscribers[id]
+
+	if !ok {
+		return nil, ErrSubscriptionNotFound
+	}
+
+	return append([]DeadLetter{}, sub.deadLetters...), nil
+}
+
+// Run subscribes to the product events and queues them to the matching
+// subscriptions until the context is cancelled, then it stops the deliveries
+func (d *Dispatcher) Run(ctx context.Context, eb *data.ProductEventBroker) {
+	defer d.cancel()
+
+	var lastID uint64
+
+	for {
+		backlog, ch, cancel := eb.Subscribe(lastID)
+
+		for _, e := range backlog {
+			d.dispatch(e)
+			lastID = e.ID
+		}
+
+		lastID = d.consume(ctx, ch, lastID)
+		cancel()
+
+		if ctx.Err() != nil {
+			return
+		}
+
+		// the broker dropped the subscription because it fell behind, resume after the last event
+		d.l.Warn("Webhook dispatcher resubscribing to the product events", "last_id", lastID)
+	}
+}
+
+// consume dispatches the events of the channel until it is closed or the
+// context is cancelled and returns the id of the last event dispatched
+func (d *Dispatcher) consume(ctx context.Context, ch <-chan data.ProductEvent, lastID uint64) uint64 {
+	for {
+		select {
+		case <-ctx.Done():
+			return lastID
+		case e, ok := <-ch:
+			if !ok {
+				return lastID
+			}
+
+			d.dispatch(e)
+			lastID = e.ID
+		}
+	}
+}
+
+// dispatch queues the event to the subscriptions accepting its type
+func (d *Dispatcher) dispatch(e data.ProductEvent) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	for _, sub := range d.subscribers {
+		if !sub.accepts(e.Type) {
+			continue
+		}
+
+		select {
+		case sub.queue <- e:
+		default:
+			d.l.Error("Webhook delivery queue is full", "subscription", sub.ID, "event", e.ID)
+			sub.addDeadLetter(DeadLetter{Event: e, Error: "delivery queue is full", Time: time.Now().UTC()})
+		}
+	}
+}
+
+// deliver sends the queued events of the subscription until the context is cancelled
+func (d *Dispatcher) deliver(ctx context.Context, sub *subscriber) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case e := <-sub.queue:
+			d.deliverEvent(ctx, sub, e)
+		}
+	}
+}
+
+// deliverEvent posts the event to the subscription URL, retrying with exponential
+// backoff, and moves it to the dead-letter list when all the attempts fail
+func (d *Dispatcher) deliverEvent(ctx context.Context, sub *subscriber, e data.ProductEvent) {
+	body, err := json.Marshal(e)
+
+	if err != nil {
+		d.l.Error("Unable to serialize the webhook event", "event", e.ID, "error", err)
+		return
+	}
+
+	backoff := d.minBackoff
+	var last Delivery
+
+	for attempt := 1; attempt <= d.maxAttempts; attempt++ {
+		last = d.post(ctx, sub.Subscription, e, body)
+		last.Attempt = attempt
+
+		d.mu.Lock()
+		sub.addDelivery(last)
+		d.mu.Unlock()
+
+		if last.Succeeded() {
+			return
+		}
+
+		d.l.Warn("Webhook delivery failed", "subscription", sub.ID, "event", e.ID, "attempt", attempt, "status", last.StatusCode, "error", last.Error)
+
+		if attempt == d.maxAttempts {
+			break
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(backoff):
+		}
+
+		backoff *= 2
+		if backoff > d.maxBackoff {
+			backoff = d.maxBackoff
+		}
+	}
+
+	reason := last.Error
+	if reason == "" {
+		reason = fmt.Sprintf("receiver returned status %d", last.StatusCode)
+	}
+
+	d.mu.Lock()
+	sub.addDeadLetter(DeadLetter{Event: e, Attempts: d.maxAttempts, Error: reason, Time: time.Now().UTC()})
+	d.mu.Unlock()
+}
+
+// post makes a single signed delivery of the event
+func (d *Dispatcher) post(ctx context.Context, s Subscription, e data.ProductEvent, body []byte) Delivery {
+	start := time.Now()
+	dl := Delivery{EventID: e.ID, EventType: e.Type, Time: start.UTC()}
+
+	r, err := http.NewRequestWithContext(ctx, http.MethodPost, s.URL, bytes.NewReader(body))
+
+	if err != nil {
+		dl.Error = err.Error()
+		return dl
+	}
+
+	ts := start.Unix()
+	r.Header.Set("Content-Type", "application/json")
+	r.Header.Set(EventHeader, string(e.Type))
+	r.Header.Set(DeliveryHeader, strconv.FormatUint(e.ID, 10))
+	r.Header.Set(TimestampHeader, strconv.FormatInt(ts, 10))
+	r.Header.Set(SignatureHeader, Sign(s.Secret, ts, body))
+
+	resp, err := d.client.Do(r)
+	dl.DurationMS = time.Since(start).Milliseconds()
+
+	if err != nil {
+		dl.Error = err.Error()
+		return dl
+	}
+
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64*1024))
+
+	dl.StatusCode = resp.StatusCode
+
+	return dl
+}
+
+// addDelivery appends the attempt to the delivery log, discarding the oldest ones
+func (s *subscriber) addDelivery(d Delivery) {
+	s.deliveries = append(s.deliveries, d)
+
+	if len(s.deliveries) > deliveryLogSize {
+		s.deliveries = s.deliveries[len(s.deliveries)-deliveryLogSize:]
+	}
+}
+
+// addDeadLetter appends the event to the dead-letter list, discarding the oldest ones
+func (s *subscriber) addDeadLetter(dl DeadLetter) {
+	s.deadLetters = append(s.deadLetters, dl)
+
+	if len(s.deadLetters) > deadLetterSize {
+		s.deadLetters = s.deadLetters[len(s.deadLetters)-deadLetterSize:]
+	}
+}
+
+// newSecret generates a random signing key
+func newSecret() (string, error) {
+	b := make([]byte, 32)
+
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(b), nil
+}
@@ -0,0 +1,173 @@
+package webhook
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/CharlesSchiavinato/go-microservices/service-product-rest/data"
+	"github.com/hashicorp/go-hclog"
+	"github.com/stretchr/testify/assert"
+)
+
+// setupDispatcher runs a dispatcher on a new event broker until the test ends
+func setupDispatcher(t *testing.T, maxAttempts int) (*Dispatcher, *data.ProductEventBroker) {
+	eb := data.NewProductEventBroker(100)
+	d := NewDispatcher(hclog.NewNullLogger(), http.DefaultClient, maxAttempts, time.Millisecond, 5*time.Millisecond, true)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+
+	go d.Run(ctx, eb)
+
+	return d, eb
+}
+
+func TestSubscriptionValidate(t *testing.T) {
+	s := &Subscription{URL: "http://example.com/hooks", Events: []data.ProductEventType{data.ProductCreated}}
+	assert.NoError(t, s.Validate())
+
+	s = &Subscription{URL: "example.com"}
+	assert.Error(t, s.Validate())
+
+	s = &Subscription{URL: "http://example.com", Events: []data.ProductEventType{"renamed"}}
+	assert.Error(t, s.Validate())
+
+	s = &Subscription{URL: "http://example.com", Secret: "short"}
+	assert.Error(t, s.Validate())
+}
+
+func TestDispatcherPrivateDestination(t *testing.T) {
+	d := NewDispatcher(hclog.NewNullLogger(), http.DefaultClient, 1, time.Millisecond, time.Millisecond, false)
+
+	for _, u := range []string{"http://127.0.0.1/hook", "http://10.0.0.1/hook", "http://[::1]/hook", "http://169.254.169.254/latest", "http://0.0.0.0/hook"} {
+		_, err := d.Register(Subscription{URL: u})
+		assert.Equal(t, ErrPrivateDestination, err, u)
+	}
+
+	lookup := lookupIP
+	t.Cleanup(func() { lookupIP = lookup })
+
+	lookupIP = func(host string) ([]net.IP, error) {
+		if host == "internal.example.com" {
+			return []net.IP{net.ParseIP("93.184.216.34"), net.ParseIP("192.168.1.10")}, nil
+		}
+
+		return nil, fmt.Errorf("no such host")
+	}
+
+	_, err := d.Register(Subscription{URL: "http://internal.example.com/hook"})
+	assert.Equal(t, ErrPrivateDestination, err)
+
+	_, err = d.Register(Subscription{URL: "http://missing.example.com/hook"})
+	assert.Equal(t, ErrUnresolvableDestination, err)
+
+	_, err = d.Register(Subscription{URL: "https://93.184.216.34/hook"})
+	assert.NoError(t, err)
+
+	// the client does not connect to a private address resolved after the subscription
+	recv := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {}))
+	defer recv.Close()
+
+	_, err = NewClient(time.Second, false).Get(recv.URL)
+	assert.ErrorIs(t, err, ErrPrivateDestination)
+
+	res, err := NewClient(time.Second, true).Get(recv.URL)
+	if assert.NoError(t, err) {
+		res.Body.Close()
+	}
+}
+
+func TestDispatcherSignedDelivery(t *testing.T) {
+	d, eb := setupDispatcher(t, 3)
+
+	received := make(chan bool, 10)
+	recv := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		ts, _ := strconv.ParseInt(r.Header.Get(TimestampHeader), 10, 64)
+
+		received <- r.Header.Get(SignatureHeader) == Sign("0123456789abcdef", ts, body) &&
+			r.Header.Get(EventHeader) == "updated"
+	}))
+	defer recv.Close()
+
+	s, err := d.Register(Subscription{URL: recv.URL, Secret: "0123456789abcdef", Events: []data.ProductEventType{data.ProductUpdated}})
+	assert.NoError(t, err)
+
+	// the created event is filtered out by the subscription
+	eb.Publish(data.ProductEvent{ID: 1, Type: data.ProductCreated, ProductID: 1, Product: &data.Product{ID: 1}})
+	eb.Publish(data.ProductEvent{ID: 2, Type: data.ProductUpdated, ProductID: 1, Product: &data.Product{ID: 1}})
+
+	select {
+	case ok := <-received:
+		assert.True(t, ok, "invalid signature or event")
+	case <-time.After(5 * time.Second):
+		t.Fatal("the webhook did not receive the event")
+	}
+
+	assert.Eventually(t, func() bool {
+		dl, _ := d.Deliveries(s.ID)
+		return len(dl) == 1 && dl[0].Succeeded() && dl[0].EventID == 2
+	}, 5*time.Second, time.Millisecond)
+}
+
+func TestDispatcherRetry(t *testing.T) {
+	d, eb := setupDispatcher(t, 3)
+
+	var calls int32
+	recv := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&calls, 1) < 3 {
+			rw.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer recv.Close()
+
+	s, _ := d.Register(Subscription{URL: recv.URL})
+
+	eb.Publish(data.ProductEvent{ID: 1, Type: data.ProductCreated, ProductID: 1, Product: &data.Product{ID: 1}})
+
+	assert.Eventually(t, func() bool {
+		dl, _ := d.Deliveries(s.ID)
+		return len(dl) == 3 && dl[0].Succeeded()
+	}, 5*time.Second, time.Millisecond)
+
+	dl, _ := d.Deliveries(s.ID)
+	assert.Equal(t, 3, dl[0].Attempt)
+	assert.Equal(t, http.StatusServiceUnavailable, dl[1].StatusCode)
+
+	dead, _ := d.DeadLetters(s.ID)
+	assert.Empty(t, dead)
+}
+
+func TestDispatcherDeadLetter(t *testing.T) {
+	d, eb := setupDispatcher(t, 2)
+
+	recv := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		rw.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer recv.Close()
+
+	s, _ := d.Register(Subscription{URL: recv.URL})
+
+	eb.Publish(data.ProductEvent{ID: 1, Type: data.ProductDeleted, ProductID: 7, Product: &data.Product{ID: 7}})
+
+	assert.Eventually(t, func() bool {
+		dead, _ := d.DeadLetters(s.ID)
+		return len(dead) == 1
+	}, 5*time.Second, time.Millisecond)
+
+	dead, _ := d.DeadLetters(s.ID)
+	assert.Equal(t, 7, dead[0].Event.ProductID)
+	assert.Equal(t, 2, dead[0].Attempts)
+	assert.Equal(t, "receiver returned status 500", dead[0].Error)
+
+	assert.NoError(t, d.Unregister(s.ID))
+	assert.Equal(t, ErrSubscriptionNotFound, d.Unregister(s.ID))
+}
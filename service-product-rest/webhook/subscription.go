@@ -0,0 +1,131 @@
+package webhook
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/CharlesSchiavinato/go-microservices/service-product-rest/data"
+	"github.com/go-playground/validator/v10"
+)
+
+var ErrSubscriptionNotFound = fmt.Errorf("Webhook subscription not found")
+
+// Headers sent with every delivery
+const (
+	// SignatureHeader carries the HMAC-SHA256 of the timestamp and the body, as sha256=<hex>
+	SignatureHeader = "X-Webhook-Signature"
+	// TimestampHeader carries the unix time of the delivery, receivers should
+	// reject old timestamps to prevent replays
+	TimestampHeader = "X-Webhook-Timestamp"
+	// EventHeader carries the type of the product event
+	EventHeader = "X-Webhook-Event"
+	// DeliveryHeader carries the id of the product event, it is the same on the retries
+	DeliveryHeader = "X-Webhook-Delivery"
+)
+
+// Subscription is a URL receiving the product events
+// swagger:model
+type Subscription struct {
+	// the id of the subscription
+	//
+	// read only: true
+	ID int `json:"id"`
+
+	// the URL receiving the events with POST requests
+	//
+	// required: true
+	// example: https://erp.example.com/hooks/products
+	URL string `json:"url" validate:"required,url,startswith=http"`
+
+	// the event types delivered to the URL, all the types when empty
+	//
+	// example: ["created", "updated"]
+	Events []data.ProductEventType `json:"events,omitempty" validate:"dive,oneof=created updated deleted"`
+
+	// the key used to sign the deliveries, it is generated when empty and
+	// only returned when the subscription is created
+	Secret string `json:"secret,omitempty" validate:"omitempty,min=16"`
+
+	// the creation time of the subscription
+	//
+	// read only: true
+	CreatedOn time.Time `json:"created_on"`
+}
+
+// Validate checks the URL, the event types and the secret of the subscription
+func (s *Subscription) Validate() error {
+	validate := validator.New()
+
+	// report the fields by their json name
+	validate.RegisterTagNameFunc(func(f reflect.StructField) string {
+		return strings.SplitN(f.Tag.Get("json"), ",", 2)[0]
+	})
+
+	return validate.Struct(s)
+}
+
+// accepts reports whether the subscription receives the given event type
+func (s *Subscription) accepts(t data.ProductEventType) bool {
+	if len(s.Events) == 0 {
+		return true
+	}
+
+	for _, e := range s.Events {
+		if e == t {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Delivery is an attempt to deliver an event to a subscription
+// swagger:model
+type Delivery struct {
+	// the id of the delivered event
+	EventID uint64 `json:"event_id"`
+	// the type of the delivered event
+	EventType data.ProductEventType `json:"event_type"`
+	// the attempt number, starting at 1
+	Attempt int `json:"attempt"`
+	// the HTTP status returned by the receiver, 0 when the request failed
+	StatusCode int `json:"status_code"`
+	// the reason of the failure
+	Error string `json:"error,omitempty"`
+	// the time of the attempt
+	Time time.Time `json:"time"`
+	// the duration of the request in milliseconds
+	DurationMS int64 `json:"duration_ms"`
+}
+
+// Succeeded reports whether the receiver accepted the event
+func (d *Delivery) Succeeded() bool {
+	return d.StatusCode >= 200 && d.StatusCode < 300
+}
+
+// DeadLetter is an event which could not be delivered to a subscription
+// swagger:model
+type DeadLetter struct {
+	// the event which was not delivered
+	Event data.ProductEvent `json:"event"`
+	// the number of attempts made
+	Attempts int `json:"attempts"`
+	// the reason of the last failure
+	Error string `json:"error"`
+	// the time the event was given up
+	Time time.Time `json:"time"`
+}
+
+// Sign returns the signature of a delivery, the HMAC-SHA256 of "<timestamp>.<body>" keyed by the secret
+func Sign(secret string, timestamp int64, body []byte) string {
+	m := hmac.New(sha256.New, []byte(secret))
+	fmt.Fprintf(m, "%d.", timestamp)
+	m.Write(body)
+
+	return "sha256=" + hex.EncodeToString(m.Sum(nil))
+}